@@ -3,4 +3,4 @@
 EXECUTION_FILE="/usr/local/app/tars/tarscontroller/bin/tarscontroller"
 
 chmod +x ${EXECUTION_FILE}
-exec ${EXECUTION_FILE}
+exec ${EXECUTION_FILE} "$@"
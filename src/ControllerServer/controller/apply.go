@@ -0,0 +1,44 @@
+package controller
+
+import (
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/client-go/rest"
+	tarsMeta "k8s.tars.io/meta"
+	tarsTool "k8s.tars.io/tool"
+	"strings"
+)
+
+// legacyFieldManager is the field manager of the objects created or updated by controller before it applies them,
+// apiserver takes it from the user agent, which is the name of the binary by default
+var legacyFieldManager = strings.Split(rest.DefaultKubernetesUserAgent(), "/")[0]
+
+// PatchFunc patch the object through the typed client of its resource
+type PatchFunc func(pt patchTypes.PatchType, data []byte, options k8sMetaV1.PatchOptions) error
+
+// Apply server side apply obj as tarsMeta.ControllerFieldManager, current is the existing object in cache,
+// objects are created rather than applied, so that objects of others with the same name are never taken over.
+// The fields of current written by the creation or the legacy updates of controller are handed over to the apply first,
+// so that the fields no longer applied are removed, while the fields set by others are kept
+func Apply(current k8sMetaV1.Object, obj interface{}, patch PatchFunc) error {
+	if upgrade := tarsTool.UpgradeManagedFields(current.GetManagedFields(), legacyFieldManager, tarsMeta.ControllerFieldManager); upgrade != nil {
+		jsonPatch := append(tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchTest,
+				Path:  "/metadata/resourceVersion",
+				Value: current.GetResourceVersion(),
+			},
+		}, upgrade...)
+		bs, _ := json.Marshal(jsonPatch)
+		if err := patch(patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{}); err != nil {
+			return err
+		}
+	}
+
+	bs, err := tarsTool.ApplyPatch(obj)
+	if err != nil {
+		return err
+	}
+	return patch(patchTypes.ApplyPatchType, bs, tarsTool.ApplyOptions(tarsMeta.ControllerFieldManager))
+}
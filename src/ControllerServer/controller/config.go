@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"fmt"
+	"golang.org/x/time/rate"
+	"io/ioutil"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/util/workqueue"
+	tarsRuntime "k8s.tars.io/runtime"
+	"sigs.k8s.io/yaml"
+	"time"
+)
+
+// WorkerConfig tunes one controller, Workers 0 keeps the default of the controller
+type WorkerConfig struct {
+	Workers int  `json:"workers,omitempty"`
+	Disable bool `json:"disable,omitempty"`
+}
+
+// RateLimiterConfig tunes the rate limiter of all controller queues.
+// retries of an item are delayed exponentially from BaseDelay to MaxDelay, QPS and Burst limit the overall rate of a queue
+type RateLimiterConfig struct {
+	BaseDelay k8sMetaV1.Duration `json:"baseDelay,omitempty"`
+	MaxDelay  k8sMetaV1.Duration `json:"maxDelay,omitempty"`
+	QPS       float64            `json:"qps,omitempty"`
+	Burst     int                `json:"burst,omitempty"`
+}
+
+// Config is the configuration file of tarscontroller, zero values keep the defaults
+type Config struct {
+	// QPS and Burst of the clients talking to kube-apiserver
+	QPS   float32 `json:"qps,omitempty"`
+	Burst int     `json:"burst,omitempty"`
+	// Resync is the period informers replay their caches to controllers, 0 disables it
+	Resync      k8sMetaV1.Duration      `json:"resync,omitempty"`
+	RateLimiter RateLimiterConfig       `json:"rateLimiter,omitempty"`
+	Controllers map[string]WorkerConfig `json:"controllers,omitempty"`
+}
+
+// same as workqueue.DefaultControllerRateLimiter
+var rateLimiterConfig = RateLimiterConfig{
+	BaseDelay: k8sMetaV1.Duration{Duration: 5 * time.Millisecond},
+	MaxDelay:  k8sMetaV1.Duration{Duration: 1000 * time.Second},
+	QPS:       10,
+	Burst:     100,
+}
+
+// LoadConfig read the yaml or json config file, an empty file name returns the default config
+func LoadConfig(file string) (*Config, error) {
+	config := &Config{}
+	if file == "" {
+		return config, nil
+	}
+
+	bs, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read config file %s error: %s", file, err.Error())
+	}
+	if err = yaml.UnmarshalStrict(bs, config); err != nil {
+		return nil, fmt.Errorf("parse config file %s error: %s", file, err.Error())
+	}
+	return config, nil
+}
+
+func (c *Config) Validate() error {
+	if c.QPS < 0 || c.Burst < 0 || c.Resync.Duration < 0 {
+		return fmt.Errorf("qps, burst and resync should not be negative")
+	}
+	if c.RateLimiter.BaseDelay.Duration < 0 || c.RateLimiter.MaxDelay.Duration < 0 || c.RateLimiter.QPS < 0 || c.RateLimiter.Burst < 0 {
+		return fmt.Errorf("rateLimiter values should not be negative")
+	}
+	for name, worker := range c.Controllers {
+		if worker.Workers < 0 {
+			return fmt.Errorf("workers of controller %s should not be negative", name)
+		}
+	}
+	return nil
+}
+
+// ValidateControllers check the configured names are known, controllers can be tuned and disabled,
+// queues are the extra queues of controllers, which can only be tuned
+func (c *Config) ValidateControllers(controllers []string, queues []string) error {
+	canDisable := map[string]bool{}
+	for _, name := range controllers {
+		canDisable[name] = true
+	}
+	for _, name := range queues {
+		canDisable[name] = false
+	}
+	for name, worker := range c.Controllers {
+		disable, ok := canDisable[name]
+		if !ok {
+			return fmt.Errorf("unknown controller %s", name)
+		}
+		if worker.Disable && !disable {
+			return fmt.Errorf("queue %s can not be disabled, disable its controller instead", name)
+		}
+	}
+	return nil
+}
+
+// Apply set the client and rate limiter config, it should be called before tarsRuntime.CreateContext
+func (c *Config) Apply() {
+	tarsRuntime.Configure(tarsRuntime.ContextConfig{
+		QPS:    c.QPS,
+		Burst:  c.Burst,
+		Resync: c.Resync.Duration,
+	})
+
+	if c.RateLimiter.BaseDelay.Duration > 0 {
+		rateLimiterConfig.BaseDelay = c.RateLimiter.BaseDelay
+	}
+	if c.RateLimiter.MaxDelay.Duration > 0 {
+		rateLimiterConfig.MaxDelay = c.RateLimiter.MaxDelay
+	}
+	if c.RateLimiter.QPS > 0 {
+		rateLimiterConfig.QPS = c.RateLimiter.QPS
+	}
+	if c.RateLimiter.Burst > 0 {
+		rateLimiterConfig.Burst = c.RateLimiter.Burst
+	}
+}
+
+// Enabled return false if controller name is disabled
+func (c *Config) Enabled(name string) bool {
+	return !c.Controllers[name].Disable
+}
+
+// Workers return the worker count of controller name, or defaultWorkers if not configured
+func (c *Config) Workers(name string, defaultWorkers int) int {
+	if workers := c.Controllers[name].Workers; workers > 0 {
+		return workers
+	}
+	return defaultWorkers
+}
+
+// NewItemBasedRateLimiter return the configured per item exponential rate limiter
+func NewItemBasedRateLimiter() workqueue.RateLimiter {
+	return workqueue.NewItemExponentialFailureRateLimiter(rateLimiterConfig.BaseDelay.Duration, rateLimiterConfig.MaxDelay.Duration)
+}
+
+// NewRateLimiter return the configured rate limiter, which replaces workqueue.DefaultControllerRateLimiter
+func NewRateLimiter() workqueue.RateLimiter {
+	return workqueue.NewMaxOfRateLimiter(
+		NewItemBasedRateLimiter(),
+		&workqueue.BucketRateLimiter{Limiter: rate.NewLimiter(rate.Limit(rateLimiterConfig.QPS), rateLimiterConfig.Burst)},
+	)
+}
@@ -15,6 +15,20 @@ const (
 	AddAfter   Result = 3
 )
 
+func (r Result) String() string {
+	switch r {
+	case Done:
+		return "done"
+	case Retry:
+		return "retry"
+	case FatalError:
+		return "fatal_error"
+	case AddAfter:
+		return "add_after"
+	}
+	return "unknown"
+}
+
 type Controller interface {
 	EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{})
 	Run(chan struct{})
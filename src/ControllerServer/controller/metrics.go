@@ -0,0 +1,257 @@
+package controller
+
+import (
+	"fmt"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const metricsNamespace = "tars_controller"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	workqueueDepth = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace, Subsystem: "workqueue", Name: "depth",
+		Help: "Current depth of workqueue",
+	}, []string{"name"})
+
+	workqueueAdds = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Subsystem: "workqueue", Name: "adds_total",
+		Help: "Total number of adds handled by workqueue",
+	}, []string{"name"})
+
+	workqueueLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Subsystem: "workqueue", Name: "queue_duration_seconds",
+		Help:    "How long in seconds an item stays in workqueue before being requested",
+		Buckets: prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"})
+
+	workqueueWorkDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Subsystem: "workqueue", Name: "work_duration_seconds",
+		Help:    "How long in seconds processing an item from workqueue takes",
+		Buckets: prometheus.ExponentialBuckets(10e-9, 10, 10),
+	}, []string{"name"})
+
+	workqueueUnfinishedWork = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace, Subsystem: "workqueue", Name: "unfinished_work_seconds",
+		Help: "How many seconds of work has been done that is in progress and hasn't been observed by work_duration",
+	}, []string{"name"})
+
+	workqueueLongestRunning = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace, Subsystem: "workqueue", Name: "longest_running_processor_seconds",
+		Help: "How many seconds has the longest running processor for workqueue been running",
+	}, []string{"name"})
+
+	workqueueRetries = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Subsystem: "workqueue", Name: "retries_total",
+		Help: "Total number of retries handled by workqueue",
+	}, []string{"name"})
+
+	reconcileDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace, Name: "reconcile_duration_seconds",
+		Help:    "How long in seconds a reconcile takes",
+		Buckets: prometheus.ExponentialBuckets(0.001, 2, 15),
+	}, []string{"controller"})
+
+	reconcileTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "reconcile_total",
+		Help: "Total number of reconciles by result",
+	}, []string{"controller", "result"})
+
+	reconcilePanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "reconcile_panics_total",
+		Help: "Total number of reconciles which panicked",
+	}, []string{"controller"})
+
+	apiErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace, Name: "api_errors_total",
+		Help: "Total number of failed kubernetes api requests by resource",
+	}, []string{"resource", "verb", "code"})
+
+	leaderStatus = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace, Name: "leader_election_master_status",
+		Help: "Whether this process is currently the leader, 1 is leader, 0 is standby",
+	}, []string{"name"})
+
+	informerSynced = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace, Name: "informer_synced",
+		Help: "Whether the informer cache has synced, 1 is synced, 0 is not",
+	}, []string{"informer"})
+)
+
+var readyMutex sync.RWMutex
+var ready bool
+
+func init() {
+	registry.MustRegister(
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		prometheus.NewGoCollector(),
+		workqueueDepth, workqueueAdds, workqueueLatency, workqueueWorkDuration,
+		workqueueUnfinishedWork, workqueueLongestRunning, workqueueRetries,
+		reconcileDuration, reconcileTotal, reconcilePanics, apiErrors, leaderStatus, informerSynced,
+	)
+	workqueue.SetProvider(workqueueMetricsProvider{})
+	leaderelection.SetProvider(leaderMetricsProvider{})
+}
+
+// ObserveReconcile records the duration and result of one reconcile of controller
+func ObserveReconcile(controller string, start time.Time, result Result) {
+	reconcileDuration.WithLabelValues(controller).Observe(time.Since(start).Seconds())
+	reconcileTotal.WithLabelValues(controller, result.String()).Inc()
+}
+
+// ObservePanic records a panic of one reconcile of controller
+func ObservePanic(controller string) {
+	reconcilePanics.WithLabelValues(controller).Inc()
+}
+
+// ObserveInformerSynced records the sync state of informers, /readyz succeeds once all of them synced
+func ObserveInformerSynced(synced map[string]bool) {
+	allSynced := true
+	for informer, v := range synced {
+		if v {
+			informerSynced.WithLabelValues(informer).Set(1)
+		} else {
+			informerSynced.WithLabelValues(informer).Set(0)
+			allSynced = false
+		}
+	}
+	readyMutex.Lock()
+	ready = allSynced
+	readyMutex.Unlock()
+}
+
+// apiErrorRoundTripper counts responses of failed kubernetes api requests by resource
+type apiErrorRoundTripper struct {
+	rt http.RoundTripper
+}
+
+func (a *apiErrorRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := a.rt.RoundTrip(req)
+	if err != nil {
+		apiErrors.WithLabelValues(resourceFromPath(req.URL.Path), req.Method, "<error>").Inc()
+		return resp, err
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		apiErrors.WithLabelValues(resourceFromPath(req.URL.Path), req.Method, strconv.Itoa(resp.StatusCode)).Inc()
+	}
+	return resp, err
+}
+
+// WrapAPITransport is a transport.WrapperFunc that records api errors
+func WrapAPITransport(rt http.RoundTripper) http.RoundTripper {
+	return &apiErrorRoundTripper{rt: rt}
+}
+
+// resourceFromPath extracts resource from request path like
+// /api/v1/namespaces/{namespace}/{resource}/{name} or /apis/{group}/{version}/{resource}
+func resourceFromPath(path string) string {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+	var rest []string
+	switch {
+	case len(segments) >= 2 && segments[0] == "api":
+		rest = segments[2:]
+	case len(segments) >= 3 && segments[0] == "apis":
+		rest = segments[3:]
+	default:
+		return "unknown"
+	}
+	if len(rest) >= 3 && rest[0] == "namespaces" {
+		rest = rest[2:]
+	}
+	if len(rest) == 0 {
+		return "unknown"
+	}
+	return rest[0]
+}
+
+// ServeMetrics serves /metrics, /healthz and /readyz on port until stopCh closed
+func ServeMetrics(port int, stopCh chan struct{}) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		readyMutex.RLock()
+		defer readyMutex.RUnlock()
+		if !ready {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			_, _ = w.Write([]byte("informer caches not synced"))
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	go wait.Until(func() {
+		srv := &http.Server{
+			Addr:              fmt.Sprintf(":%d", port),
+			Handler:           mux,
+			ReadHeaderTimeout: 5 * time.Second,
+		}
+		// ListenAndServe always returns a non-nil error. After Shutdown or Close,
+		// the returned error is ErrServerClosed.
+		err := srv.ListenAndServe()
+		if err != nil {
+			klog.Errorf("metrics server exit because: %s \n", err.Error())
+		}
+	}, time.Second, stopCh)
+}
+
+type workqueueMetricsProvider struct{}
+
+func (workqueueMetricsProvider) NewDepthMetric(name string) workqueue.GaugeMetric {
+	return workqueueDepth.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewAddsMetric(name string) workqueue.CounterMetric {
+	return workqueueAdds.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLatencyMetric(name string) workqueue.HistogramMetric {
+	return workqueueLatency.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewWorkDurationMetric(name string) workqueue.HistogramMetric {
+	return workqueueWorkDuration.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewUnfinishedWorkSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueUnfinishedWork.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewLongestRunningProcessorSecondsMetric(name string) workqueue.SettableGaugeMetric {
+	return workqueueLongestRunning.WithLabelValues(name)
+}
+
+func (workqueueMetricsProvider) NewRetriesMetric(name string) workqueue.CounterMetric {
+	return workqueueRetries.WithLabelValues(name)
+}
+
+type leaderMetricsProvider struct{}
+
+func (leaderMetricsProvider) NewLeaderMetric() leaderelection.SwitchMetric {
+	return leaderSwitchMetric{}
+}
+
+type leaderSwitchMetric struct{}
+
+func (leaderSwitchMetric) On(name string) {
+	leaderStatus.WithLabelValues(name).Set(1)
+}
+
+func (leaderSwitchMetric) Off(name string) {
+	leaderStatus.WithLabelValues(name).Set(0)
+}
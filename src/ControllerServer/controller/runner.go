@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"fmt"
+	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+// DefaultRequeueAfter is the delay of AddAfter when the reconciler does not give one
+const DefaultRequeueAfter = time.Second
+
+// ReconcileFunc reconcile the object of key, after is the delay to requeue key when the result is AddAfter
+type ReconcileFunc func(key string) (result Result, after time.Duration)
+
+// RequeueAfter adapt reconcile which always requeue key after the same delay on AddAfter
+func RequeueAfter(reconcile func(key string) Result, after time.Duration) ReconcileFunc {
+	return func(key string) (Result, time.Duration) {
+		return reconcile(key), after
+	}
+}
+
+// Runner drain a named work queue into reconcile with workers, the name labels the queue and reconcile metrics.
+// Retry requeue the key with per key backoff, AddAfter requeue it after the given delay,
+// FatalError drop the key until the next event of it, and a panic of reconcile is retried like Retry
+type Runner struct {
+	name      string
+	workers   int
+	queue     workqueue.RateLimitingInterface
+	reconcile ReconcileFunc
+}
+
+func NewRunner(name string, workers int, rateLimiter workqueue.RateLimiter, reconcile ReconcileFunc) *Runner {
+	return &Runner{
+		name:      name,
+		workers:   workers,
+		queue:     workqueue.NewNamedRateLimitingQueue(rateLimiter, name),
+		reconcile: reconcile,
+	}
+}
+
+func (r *Runner) Add(key string) {
+	r.queue.Add(key)
+}
+
+func (r *Runner) AddAfter(key string, after time.Duration) {
+	r.queue.AddAfter(key, after)
+}
+
+// Run start the workers once synced, it blocks until stopCh closed and the keys being reconciled are finished,
+// keys left in queue are dropped
+func (r *Runner) Run(stopCh chan struct{}, synced ...cache.InformerSynced) {
+	defer utilRuntime.HandleCrash()
+	defer r.queue.ShutDown()
+
+	if !cache.WaitForNamedCacheSync(fmt.Sprintf("%s controller", r.name), stopCh, synced...) {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < r.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for r.processItem(stopCh) {
+			}
+		}()
+	}
+
+	<-stopCh
+	r.queue.ShutDown()
+	wg.Wait()
+}
+
+func (r *Runner) processItem(stopCh chan struct{}) bool {
+	obj, shutdown := r.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer r.queue.Done(obj)
+
+	select {
+	case <-stopCh:
+		return false
+	default:
+	}
+
+	key, ok := obj.(string)
+	if !ok {
+		klog.Errorf("expected string in workqueue but got %#v", obj)
+		r.queue.Forget(obj)
+		return true
+	}
+
+	start := time.Now()
+	result, after := r.safeReconcile(key)
+	ObserveReconcile(r.name, start, result)
+
+	switch result {
+	case Done:
+		r.queue.Forget(obj)
+	case Retry:
+		r.queue.AddRateLimited(obj)
+	case AddAfter:
+		r.queue.Forget(obj)
+		if after <= 0 {
+			after = DefaultRequeueAfter
+		}
+		r.queue.AddAfter(obj, after)
+	case FatalError:
+		klog.Errorf("%s controller gave up reconciling %s", r.name, key)
+		r.queue.Forget(obj)
+	default:
+		klog.Errorf("%s controller got unexpected result %d of %s", r.name, result, key)
+		r.queue.Forget(obj)
+	}
+	return true
+}
+
+// safeReconcile recover the panic of reconcile, so one bad object never stops the workers
+func (r *Runner) safeReconcile(key string) (result Result, after time.Duration) {
+	defer func() {
+		if e := recover(); e != nil {
+			utilRuntime.HandleError(fmt.Errorf("%s controller panic when reconciling %s: %v\n%s", r.name, key, e, debug.Stack()))
+			ObservePanic(r.name)
+			result, after = Retry, 0
+		}
+	}()
+	return r.reconcile(key)
+}
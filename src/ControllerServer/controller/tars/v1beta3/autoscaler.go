@@ -0,0 +1,390 @@
+package v1beta3
+
+import (
+	"context"
+	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMeta "k8s.io/apimachinery/pkg/api/meta"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
+	k8sCoreListerV1 "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/retry"
+	"k8s.io/klog/v2"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"math"
+	"strconv"
+	"sync"
+	"tarscontroller/controller"
+	"time"
+)
+
+const (
+	AutoscalerScaleUpReason         = "ScaleUp"
+	AutoscalerScaleDownReason       = "ScaleDown"
+	AutoscalerMissingSourceReason   = "MissingMetricsSource"
+	AutoscalerFailedGetMetricReason = "FailedGetMetrics"
+)
+
+type recommendation struct {
+	replicas  int32
+	timestamp time.Time
+}
+
+type AutoscalerReconciler struct {
+	podLister k8sCoreListerV1.PodLister
+	tsLister  tarsListerV1beta3.TServerLister
+	runner    *controller.Runner
+	synced    []cache.InformerSynced
+
+	eventRecorder record.EventRecorder
+
+	mutex           sync.Mutex
+	tracked         map[string]bool
+	recommendations map[string][]recommendation
+	lastScaleTime   map[string]time.Time
+}
+
+func NewAutoscalerController(threads int) *AutoscalerReconciler {
+	podInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Core().V1().Pods()
+	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
+	c := &AutoscalerReconciler{
+		podLister:       podInformer.Lister(),
+		tsLister:        tsInformer.Lister(),
+		synced:          []cache.InformerSynced{podInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		eventRecorder:   tarsRuntime.NewEventRecorder("autoscaler-controller"),
+		tracked:         map[string]bool{},
+		recommendations: map[string][]recommendation{},
+		lastScaleTime:   map[string]time.Time{},
+	}
+	c.runner = controller.NewRunner("autoscaler", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, time.Second*tarsMeta.DefaultAutoscalerSyncPeriod))
+	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
+	return c
+}
+
+func (r *AutoscalerReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
+	switch resourceObj.(type) {
+	case *tarsV1beta3.TServer:
+		tserver := resourceObj.(*tarsV1beta3.TServer)
+		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
+		switch resourceEvent {
+		case k8sWatchV1.Added, k8sWatchV1.Deleted:
+			r.runner.Add(key)
+		case k8sWatchV1.Modified:
+			// tracked tserver is resynced periodically, only the newly added autoscaler need to be enqueued
+			if tserver.Spec.K8S.Autoscaler != nil && !r.isTracked(key) {
+				r.runner.Add(key)
+			}
+		}
+	default:
+		return
+	}
+}
+
+func (r *AutoscalerReconciler) Run(stopCh chan struct{}) {
+	r.runner.Run(stopCh, r.synced...)
+}
+
+func (r *AutoscalerReconciler) isTracked(key string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.tracked[key]
+}
+
+func (r *AutoscalerReconciler) track(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.tracked[key] = true
+}
+
+func (r *AutoscalerReconciler) forget(key string) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	delete(r.tracked, key)
+	delete(r.recommendations, key)
+	delete(r.lastScaleTime, key)
+}
+
+// stabilize record the recommendation, and return the stabilized replicas,
+// scale up use the minimum recommendation in the scale up window, scale down use the maximum recommendation in the scale down window
+func (r *AutoscalerReconciler) stabilize(key string, current, recommended int32, autoscaler *tarsV1beta3.TK8SAutoscaler) int32 {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	now := time.Now()
+
+	upWindow := time.Duration(autoscaler.ScaleUpStabilizationSeconds) * time.Second
+	downSeconds := autoscaler.ScaleDownStabilizationSeconds
+	if downSeconds == 0 {
+		downSeconds = tarsMeta.DefaultAutoscalerScaleDownStabilizationSeconds
+	}
+	downWindow := time.Duration(downSeconds) * time.Second
+
+	maxWindow := upWindow
+	if downWindow > maxWindow {
+		maxWindow = downWindow
+	}
+
+	records := []recommendation{{replicas: recommended, timestamp: now}}
+	for _, v := range r.recommendations[key] {
+		if now.Sub(v.timestamp) <= maxWindow {
+			records = append(records, v)
+		}
+	}
+	r.recommendations[key] = records
+
+	upRecommended, downRecommended := recommended, recommended
+	for _, v := range records {
+		if now.Sub(v.timestamp) <= upWindow && v.replicas < upRecommended {
+			upRecommended = v.replicas
+		}
+		if now.Sub(v.timestamp) <= downWindow && v.replicas > downRecommended {
+			downRecommended = v.replicas
+		}
+	}
+
+	desired := current
+	if desired < upRecommended {
+		desired = upRecommended
+	}
+	if desired > downRecommended {
+		desired = downRecommended
+	}
+	return desired
+}
+
+func (r *AutoscalerReconciler) inCooldown(key string, tserver *tarsV1beta3.TServer) bool {
+	cooldown := time.Duration(tserver.Spec.K8S.Autoscaler.CooldownSeconds) * time.Second
+	if cooldown == 0 {
+		return false
+	}
+
+	r.mutex.Lock()
+	lastScaleTime, ok := r.lastScaleTime[key]
+	r.mutex.Unlock()
+
+	if !ok {
+		condition := k8sMeta.FindStatusCondition(tserver.Status.Conditions, tarsV1beta3.TServerScaled)
+		if condition == nil || condition.Status != k8sMetaV1.ConditionTrue {
+			return false
+		}
+		lastScaleTime = condition.LastTransitionTime.Time
+	}
+	return time.Since(lastScaleTime) < cooldown
+}
+
+func getReplicasBounds(tserver *tarsV1beta3.TServer) (int32, int32) {
+	minReplicas, maxReplicas := int32(tarsMeta.DefaultAutoscalerMinReplicas), int32(tarsMeta.DefaultAutoscalerMaxReplicas)
+	if v, ok := tserver.Annotations[tarsMeta.TMinReplicasAnnotation]; ok {
+		if value, err := strconv.Atoi(v); err == nil {
+			minReplicas = int32(value)
+		}
+	}
+	if v, ok := tserver.Annotations[tarsMeta.TMaxReplicasAnnotation]; ok {
+		if value, err := strconv.Atoi(v); err == nil {
+			maxReplicas = int32(value)
+		}
+	}
+	return minReplicas, maxReplicas
+}
+
+func (r *AutoscalerReconciler) updateCondition(tserver *tarsV1beta3.TServer, status k8sMetaV1.ConditionStatus, reason, message string) error {
+	unchanged := func(conditions []k8sMetaV1.Condition) bool {
+		current := k8sMeta.FindStatusCondition(conditions, tarsV1beta3.TServerScaled)
+		return current != nil && current.Status == status && current.Reason == reason && current.Message == message
+	}
+	if unchanged(tserver.Status.Conditions) {
+		return nil
+	}
+
+	namespace, name := tserver.Namespace, tserver.Name
+	// the conditions are shared with tserver controller, update them on the latest tserver and retry on conflict
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(namespace).Get(context.TODO(), name, k8sMetaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if unchanged(latest.Status.Conditions) {
+			return nil
+		}
+		if status == k8sMetaV1.ConditionTrue {
+			// every scaling is a transition, the cooldown is counted from it
+			k8sMeta.RemoveStatusCondition(&latest.Status.Conditions, tarsV1beta3.TServerScaled)
+		}
+		k8sMeta.SetStatusCondition(&latest.Status.Conditions, k8sMetaV1.Condition{
+			Type:               tarsV1beta3.TServerScaled,
+			Status:             status,
+			ObservedGeneration: latest.Generation,
+			Reason:             reason,
+			Message:            message,
+		})
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(namespace).UpdateStatus(context.TODO(), latest, k8sMetaV1.UpdateOptions{})
+		return err
+	})
+}
+
+func (r *AutoscalerReconciler) reconcile(key string) controller.Result {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("invalid key: %s", key)
+		return controller.Done
+	}
+
+	tserver, err := r.tsLister.TServers(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceGetError, "tserver", namespace, name, err.Error())
+			return controller.Retry
+		}
+		r.forget(key)
+		return controller.Done
+	}
+
+	if tserver.DeletionTimestamp != nil {
+		r.forget(key)
+		return controller.Done
+	}
+
+	autoscaler := tserver.Spec.K8S.Autoscaler
+	if autoscaler == nil || tserver.Spec.K8S.DaemonSet || tserver.Spec.SubType == tarsV1beta3.External || tserver.Spec.Release == nil {
+		r.forget(key)
+		return controller.Done
+	}
+	r.track(key)
+
+	current := tserver.Spec.K8S.Replicas
+	minReplicas, maxReplicas := getReplicasBounds(tserver)
+	clamp := func(v int32) int32 {
+		if v < minReplicas {
+			return minReplicas
+		}
+		if v > maxReplicas {
+			return maxReplicas
+		}
+		return v
+	}
+
+	// replicas out of the bounds is scaled into the bounds without metrics
+	if desired := clamp(current); desired != current {
+		return r.scale(key, tserver, current, desired, fmt.Sprintf("scaled from %d to %d, out of the bounds [%d,%d]", current, desired, minReplicas, maxReplicas))
+	}
+
+	source := getMetricsSource(autoscaler.Metric)
+	if source == nil {
+		msg := fmt.Sprintf("no metrics source registered for metric %s", autoscaler.Metric)
+		r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, AutoscalerMissingSourceReason, msg)
+		if err = r.updateCondition(tserver, k8sMetaV1.ConditionFalse, AutoscalerMissingSourceReason, msg); err != nil {
+			klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+		}
+		return controller.AddAfter
+	}
+
+	appRequire, _ := labels.NewRequirement(tarsMeta.TServerAppLabel, selection.Equals, []string{tserver.Spec.App})
+	serverRequire, _ := labels.NewRequirement(tarsMeta.TServerNameLabel, selection.Equals, []string{tserver.Spec.Server})
+	selector := labels.NewSelector().Add(*appRequire).Add(*serverRequire)
+
+	pods, err := r.podLister.Pods(namespace).List(selector)
+	if err != nil {
+		klog.Errorf(tarsMeta.ResourceSelectorError, namespace, "pods", err.Error())
+		return controller.Retry
+	}
+
+	var readyPods []*k8sCoreV1.Pod
+	for _, pod := range pods {
+		if pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, condition := range pod.Status.Conditions {
+			if condition.Type == k8sCoreV1.PodReady && condition.Status == k8sCoreV1.ConditionTrue {
+				readyPods = append(readyPods, pod)
+				break
+			}
+		}
+	}
+
+	if len(readyPods) == 0 {
+		return controller.AddAfter
+	}
+
+	metrics, err := source.GetMetrics(tserver, readyPods)
+	if err == nil && len(metrics) == 0 {
+		err = fmt.Errorf("no metrics returned")
+	}
+	if err != nil {
+		msg := fmt.Sprintf("get %s metrics error: %s", autoscaler.Metric, err.Error())
+		r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, AutoscalerFailedGetMetricReason, msg)
+		if err = r.updateCondition(tserver, k8sMetaV1.ConditionFalse, AutoscalerFailedGetMetricReason, msg); err != nil {
+			klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+		}
+		return controller.AddAfter
+	}
+
+	var total int64
+	for _, v := range metrics {
+		total += v
+	}
+	// metrics are in milli units of the target
+	average := float64(total) / float64(len(metrics)) / 1000
+
+	recommended := current
+
+	ratio := average / float64(autoscaler.Target)
+	if math.Abs(ratio-1.0) > tarsMeta.DefaultAutoscalerTolerance {
+		recommended = int32(math.Ceil(ratio * float64(len(metrics))))
+	}
+
+	desired := clamp(r.stabilize(key, current, clamp(recommended), autoscaler))
+	if desired == current {
+		return controller.AddAfter
+	}
+
+	if r.inCooldown(key, tserver) {
+		return controller.AddAfter
+	}
+
+	return r.scale(key, tserver, current, desired, fmt.Sprintf("scaled from %d to %d, average %s %.2f, target %d", current, desired, autoscaler.Metric, average, autoscaler.Target))
+}
+
+func (r *AutoscalerReconciler) scale(key string, tserver *tarsV1beta3.TServer, current, desired int32, msg string) controller.Result {
+	namespace, name := tserver.Namespace, tserver.Name
+	jsonPatch := tarsTool.JsonPatch{
+		{
+			OP:    tarsTool.JsonPatchReplace,
+			Path:  "/spec/k8s/replicas",
+			Value: desired,
+		},
+	}
+	bs, _ := json.Marshal(jsonPatch)
+	patched, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(namespace).Patch(context.TODO(), name, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+	if err != nil {
+		msg := fmt.Sprintf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+		klog.Errorf(msg)
+		r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourcePatchReason, msg)
+		return controller.Retry
+	}
+	tserver = patched
+
+	r.mutex.Lock()
+	r.lastScaleTime[key] = time.Now()
+	r.mutex.Unlock()
+
+	reason := AutoscalerScaleUpReason
+	if desired < current {
+		reason = AutoscalerScaleDownReason
+	}
+	r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeNormal, reason, msg)
+	if err = r.updateCondition(tserver, k8sMetaV1.ConditionTrue, reason, msg); err != nil {
+		klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+	}
+	return controller.AddAfter
+}
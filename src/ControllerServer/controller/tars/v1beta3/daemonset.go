@@ -7,15 +7,11 @@ import (
 	k8sCoreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
+	patchTypes "k8s.io/apimachinery/pkg/types"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes/scheme"
-	k8sCoreTypeV1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	k8sAppsListerV1 "k8s.io/client-go/listers/apps/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
@@ -28,8 +24,7 @@ import (
 type DaemonSetReconciler struct {
 	dsLister      k8sAppsListerV1.DaemonSetLister
 	tsLister      tarsListerV1beta3.TServerLister
-	threads       int
-	queue         workqueue.RateLimitingInterface
+	runner        *controller.Runner
 	synced        []cache.InformerSynced
 	eventRecorder record.EventRecorder
 }
@@ -38,17 +33,13 @@ func NewDaemonSetController(threads int) *DaemonSetReconciler {
 	dsInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Apps().V1().DaemonSets()
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
 
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartRecordingToSink(&k8sCoreTypeV1.EventSinkImpl{Interface: tarsRuntime.Clients.K8sClient.CoreV1().Events("")})
-
 	c := &DaemonSetReconciler{
 		dsLister:      dsInformer.Lister(),
 		tsLister:      tsInformer.Lister(),
-		threads:       threads,
-		queue:         workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
 		synced:        []cache.InformerSynced{dsInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
-		eventRecorder: eventBroadcaster.NewRecorder(scheme.Scheme, k8sCoreV1.EventSource{Component: "daemonset-controller"}),
+		eventRecorder: tarsRuntime.NewEventRecorder("daemonset-controller"),
 	}
+	c.runner = controller.NewRunner("daemonset", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, time.Second))
 
 	controller.RegistryInformerEventHandle(tarsMeta.KDaemonSetKind, dsInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
@@ -56,56 +47,17 @@ func NewDaemonSetController(threads int) *DaemonSetReconciler {
 	return c
 }
 
-func (r *DaemonSetReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	res := r.reconcile(key)
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.AddAfter:
-		r.queue.AddAfter(obj, time.Second*1)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *DaemonSetReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
 	switch resourceObj.(type) {
 	case *tarsV1beta3.TServer:
 		tserver := resourceObj.(*tarsV1beta3.TServer)
 		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	case *k8sAppsV1.DaemonSet:
 		daemonset := resourceObj.(*k8sAppsV1.DaemonSet)
 		if resourceEvent == k8sWatchV1.Deleted {
 			key := fmt.Sprintf("%s/%s", daemonset.Namespace, daemonset.Name)
-			r.queue.Add(key)
+			r.runner.Add(key)
 		}
 	default:
 		return
@@ -113,22 +65,15 @@ func (r *DaemonSetReconciler) EnqueueResourceEvent(resourceKind string, resource
 }
 
 func (r *DaemonSetReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("daemonset controller", stopCh, r.synced...) {
-		return
-	}
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
+	r.runner.Run(stopCh, r.synced...)
+}
 
-	<-stopCh
+func (r *DaemonSetReconciler) apply(current k8sMetaV1.Object, daemonSet *k8sAppsV1.DaemonSet) error {
+	daemonSetInterface := tarsRuntime.Clients.K8sClient.AppsV1().DaemonSets(daemonSet.Namespace)
+	return controller.Apply(current, daemonSet, func(pt patchTypes.PatchType, data []byte, options k8sMetaV1.PatchOptions) error {
+		_, err := daemonSetInterface.Patch(context.TODO(), daemonSet.Name, pt, data, options)
+		return err
+	})
 }
 
 func (r *DaemonSetReconciler) reconcile(key string) controller.Result {
@@ -152,7 +97,7 @@ func (r *DaemonSetReconciler) reconcile(key string) controller.Result {
 		return controller.Done
 	}
 
-	if tserver.DeletionTimestamp != nil || !tserver.Spec.K8S.DaemonSet {
+	if tserver.DeletionTimestamp != nil || !tserver.Spec.K8S.DaemonSet || tserver.Spec.SubType == tarsV1beta3.External {
 		err = tarsRuntime.Clients.K8sClient.AppsV1().DaemonSets(namespace).Delete(context.TODO(), name, k8sMetaV1.DeleteOptions{})
 		if err != nil && !errors.IsNotFound(err) {
 			klog.Errorf(tarsMeta.ResourceDeleteError, "daemonset", namespace, name, err.Error())
@@ -169,10 +114,16 @@ func (r *DaemonSetReconciler) reconcile(key string) controller.Result {
 		}
 		daemonSet = tarsRuntime.TarsTranslator.BuildDaemonset(tserver)
 		daemonSetInterface := tarsRuntime.Clients.K8sClient.AppsV1().DaemonSets(namespace)
-		if _, err = daemonSetInterface.Create(context.TODO(), daemonSet, k8sMetaV1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
-			klog.Errorf(tarsMeta.ResourceCreateError, "daemonset", namespace, name, err.Error())
+		_, err = daemonSetInterface.Create(context.TODO(), daemonSet, k8sMetaV1.CreateOptions{FieldManager: tarsMeta.ControllerFieldManager})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			msg := fmt.Sprintf(tarsMeta.ResourceCreateError, "daemonset", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceCreateReason, msg)
 			return controller.Retry
 		}
+		if err == nil {
+			r.eventRecorder.Eventf(tserver, k8sCoreV1.EventTypeNormal, tarsMeta.ResourceCreatedReason, "created daemonset %s/%s", namespace, name)
+		}
 
 		return controller.Done
 	}
@@ -188,11 +139,12 @@ func (r *DaemonSetReconciler) reconcile(key string) controller.Result {
 		return controller.Retry
 	}
 
-	update, target := tarsRuntime.TarsTranslator.DryRunSyncDaemonset(tserver, daemonSet)
-	if update {
-		daemonSetInterface := tarsRuntime.Clients.K8sClient.AppsV1().DaemonSets(namespace)
-		if _, err = daemonSetInterface.Update(context.TODO(), target, k8sMetaV1.UpdateOptions{}); err != nil {
-			klog.Errorf(tarsMeta.ResourceUpdateError, "daemonset", namespace, name, err.Error())
+	apply, target := tarsRuntime.TarsTranslator.DryRunApplyDaemonset(tserver, daemonSet)
+	if apply {
+		if err = r.apply(daemonSet, target); err != nil {
+			msg := fmt.Sprintf(tarsMeta.ResourceUpdateError, "daemonset", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceUpdateReason, msg)
 			return controller.Retry
 		}
 	}
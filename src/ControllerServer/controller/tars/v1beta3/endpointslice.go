@@ -0,0 +1,182 @@
+package v1beta3
+
+import (
+	"context"
+	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sDiscoveryV1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/selection"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
+	k8sDiscoveryListerV1beta1 "k8s.io/client-go/listers/discovery/v1beta1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	"tarscontroller/controller"
+)
+
+type EndpointSliceReconciler struct {
+	esLister      k8sDiscoveryListerV1beta1.EndpointSliceLister
+	tsLister      tarsListerV1beta3.TServerLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
+}
+
+func NewEndpointSliceController(threads int) *EndpointSliceReconciler {
+	esInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Discovery().V1beta1().EndpointSlices()
+	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
+	c := &EndpointSliceReconciler{
+		esLister:      esInformer.Lister(),
+		tsLister:      tsInformer.Lister(),
+		synced:        []cache.InformerSynced{esInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("endpointslice-controller"),
+	}
+	c.runner = controller.NewRunner("endpointslice", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, 0))
+	controller.RegistryInformerEventHandle(tarsMeta.KEndpointSliceKind, esInformer.Informer(), c)
+	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
+	return c
+}
+
+func (r *EndpointSliceReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
+	switch resourceObj.(type) {
+	case *tarsV1beta3.TServer:
+		tserver := resourceObj.(*tarsV1beta3.TServer)
+		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
+		r.runner.Add(key)
+	case *k8sDiscoveryV1beta1.EndpointSlice:
+		slice := resourceObj.(*k8sDiscoveryV1beta1.EndpointSlice)
+		if serviceName, ok := slice.Labels[k8sDiscoveryV1beta1.LabelServiceName]; ok {
+			key := fmt.Sprintf("%s/%s", slice.Namespace, serviceName)
+			r.runner.Add(key)
+		}
+	default:
+		return
+	}
+}
+
+func (r *EndpointSliceReconciler) Run(stopCh chan struct{}) {
+	r.runner.Run(stopCh, r.synced...)
+}
+
+func (r *EndpointSliceReconciler) listEndpointSlices(namespace, name string) ([]*k8sDiscoveryV1beta1.EndpointSlice, error) {
+	serviceRequirement, _ := labels.NewRequirement(k8sDiscoveryV1beta1.LabelServiceName, selection.DoubleEquals, []string{name})
+	return r.esLister.EndpointSlices(namespace).List(labels.NewSelector().Add(*serviceRequirement))
+}
+
+func (r *EndpointSliceReconciler) deleteEndpointSlices(tserver *tarsV1beta3.TServer, namespace string, slices []*k8sDiscoveryV1beta1.EndpointSlice) controller.Result {
+	retry := false
+	for _, slice := range slices {
+		if tserver != nil && !k8sMetaV1.IsControlledBy(slice, tserver) {
+			continue
+		}
+		err := tarsRuntime.Clients.K8sClient.DiscoveryV1beta1().EndpointSlices(namespace).Delete(context.TODO(), slice.Name, k8sMetaV1.DeleteOptions{})
+		if err != nil && !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceDeleteError, "endpointslice", namespace, slice.Name, err.Error())
+			retry = true
+		}
+	}
+	if retry {
+		return controller.Retry
+	}
+	return controller.Done
+}
+
+func (r *EndpointSliceReconciler) apply(current k8sMetaV1.Object, endpointSlice *k8sDiscoveryV1beta1.EndpointSlice) error {
+	endpointSliceInterface := tarsRuntime.Clients.K8sClient.DiscoveryV1beta1().EndpointSlices(endpointSlice.Namespace)
+	return controller.Apply(current, endpointSlice, func(pt patchTypes.PatchType, data []byte, options k8sMetaV1.PatchOptions) error {
+		_, err := endpointSliceInterface.Patch(context.TODO(), endpointSlice.Name, pt, data, options)
+		return err
+	})
+}
+
+func (r *EndpointSliceReconciler) reconcile(key string) controller.Result {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("invalid key: %s", key)
+		return controller.Done
+	}
+
+	slices, err := r.listEndpointSlices(namespace, name)
+	if err != nil {
+		klog.Errorf(tarsMeta.ResourceSelectorError, namespace, "endpointslices", err.Error())
+		return controller.Retry
+	}
+
+	tserver, err := r.tsLister.TServers(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceGetError, "tserver", namespace, name, err.Error())
+			return controller.Retry
+		}
+		return r.deleteEndpointSlices(nil, namespace, slices)
+	}
+
+	if tserver.DeletionTimestamp != nil || tserver.Spec.SubType != tarsV1beta3.External {
+		return r.deleteEndpointSlices(tserver, namespace, slices)
+	}
+
+	targets := tarsRuntime.TarsTranslator.BuildEndpointSlices(tserver)
+	targetMap := make(map[string]*k8sDiscoveryV1beta1.EndpointSlice, len(targets))
+	for _, target := range targets {
+		targetMap[target.Name] = target
+	}
+
+	var shouldDeletes []*k8sDiscoveryV1beta1.EndpointSlice
+	currentMap := make(map[string]*k8sDiscoveryV1beta1.EndpointSlice, len(slices))
+	for _, slice := range slices {
+		if _, ok := targetMap[slice.Name]; !ok {
+			shouldDeletes = append(shouldDeletes, slice)
+			continue
+		}
+		currentMap[slice.Name] = slice
+	}
+
+	for _, target := range targets {
+		current, ok := currentMap[target.Name]
+		if !ok {
+			endpointSliceInterface := tarsRuntime.Clients.K8sClient.DiscoveryV1beta1().EndpointSlices(namespace)
+			_, err = endpointSliceInterface.Create(context.TODO(), target, k8sMetaV1.CreateOptions{FieldManager: tarsMeta.ControllerFieldManager})
+			if err != nil && !errors.IsAlreadyExists(err) {
+				msg := fmt.Sprintf(tarsMeta.ResourceCreateError, "endpointslice", namespace, target.Name, err.Error())
+				klog.Errorf(msg)
+				r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceCreateReason, msg)
+				return controller.Retry
+			}
+			if err == nil {
+				r.eventRecorder.Eventf(tserver, k8sCoreV1.EventTypeNormal, tarsMeta.ResourceCreatedReason, "created endpointslice %s/%s", namespace, target.Name)
+			}
+			continue
+		}
+
+		if current.DeletionTimestamp != nil {
+			continue
+		}
+
+		if !k8sMetaV1.IsControlledBy(current, tserver) {
+			// 此处意味着出现了非由 controller 管理的同名 endpointslice, 需要警告和重试
+			msg := fmt.Sprintf(tarsMeta.ResourceOutControlError, "endpointslice", namespace, current.Name, namespace, name)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceOutControlReason, msg)
+			return controller.Retry
+		}
+
+		apply, target := tarsRuntime.TarsTranslator.DryRunApplyEndpointSlice(target, current)
+		if apply {
+			if err = r.apply(current, target); err != nil {
+				msg := fmt.Sprintf(tarsMeta.ResourceUpdateError, "endpointslice", namespace, current.Name, err.Error())
+				klog.Errorf(msg)
+				r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceUpdateReason, msg)
+				return controller.Retry
+			}
+		}
+	}
+
+	return r.deleteEndpointSlices(tserver, namespace, shouldDeletes)
+}
@@ -0,0 +1,146 @@
+package v1beta3
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRuntime "k8s.tars.io/runtime"
+	"sync"
+)
+
+// MetricsSource provide the metric value of TServer pods,
+// the autoscaler controller query the source registered for .spec.k8s.autoscaler.metric
+type MetricsSource interface {
+	// GetMetrics return the metric value of pods in milli units, keyed by pod name, pods without value should be omitted
+	GetMetrics(tserver *tarsV1beta3.TServer, pods []*k8sCoreV1.Pod) (map[string]int64, error)
+}
+
+var metricsSourcesMutex sync.RWMutex
+
+var metricsSources = map[tarsV1beta3.TK8SAutoscalerMetric]MetricsSource{
+	tarsV1beta3.CPUMetric:      &CPUMetricsSource{},
+	tarsV1beta3.PropertyMetric: &PropertyMetricsSource{},
+}
+
+// RegistryMetricsSource registry or replace the source of metric
+func RegistryMetricsSource(metric tarsV1beta3.TK8SAutoscalerMetric, source MetricsSource) {
+	metricsSourcesMutex.Lock()
+	defer metricsSourcesMutex.Unlock()
+	metricsSources[metric] = source
+}
+
+func getMetricsSource(metric tarsV1beta3.TK8SAutoscalerMetric) MetricsSource {
+	metricsSourcesMutex.RLock()
+	defer metricsSourcesMutex.RUnlock()
+	return metricsSources[metric]
+}
+
+// CPUMetricsSource read the cpu usage from metrics api, and return the milli utilization percentage of pod cpu requests
+type CPUMetricsSource struct {
+}
+
+type podMetrics struct {
+	Metadata struct {
+		Name string `json:"name"`
+	} `json:"metadata"`
+	Containers []struct {
+		Name  string                 `json:"name"`
+		Usage k8sCoreV1.ResourceList `json:"usage"`
+	} `json:"containers"`
+}
+
+type podMetricsList struct {
+	Items []podMetrics `json:"items"`
+}
+
+func (s *CPUMetricsSource) GetMetrics(tserver *tarsV1beta3.TServer, pods []*k8sCoreV1.Pod) (map[string]int64, error) {
+	bs, err := tarsRuntime.Clients.K8sClient.CoreV1().RESTClient().Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", tserver.Namespace, "pods").
+		Param("labelSelector", tserver.Status.Selector).
+		DoRaw(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("query metrics api error: %s", err.Error())
+	}
+
+	var metricsList podMetricsList
+	if err = json.Unmarshal(bs, &metricsList); err != nil {
+		return nil, fmt.Errorf("decode metrics api response error: %s", err.Error())
+	}
+
+	usages := map[string]int64{}
+	for _, item := range metricsList.Items {
+		var usage int64
+		for _, container := range item.Containers {
+			if cpu, ok := container.Usage[k8sCoreV1.ResourceCPU]; ok {
+				usage += cpu.MilliValue()
+			}
+		}
+		usages[item.Metadata.Name] = usage
+	}
+
+	values := map[string]int64{}
+	for _, pod := range pods {
+		usage, ok := usages[pod.Name]
+		if !ok {
+			continue
+		}
+
+		var request int64
+		for _, container := range pod.Spec.Containers {
+			if cpu, ok := container.Resources.Requests[k8sCoreV1.ResourceCPU]; ok {
+				request += cpu.MilliValue()
+			}
+		}
+
+		if request == 0 {
+			return nil, fmt.Errorf("missing cpu request of pod %s", pod.Name)
+		}
+		values[pod.Name] = usage * 100 * 1000 / request
+	}
+	return values, nil
+}
+
+// PropertyMetricsSource read the .spec.k8s.autoscaler.property of pods from custom metrics api,
+// the tars property value should be exported to the api by metrics adapter with the same name
+type PropertyMetricsSource struct {
+}
+
+type metricValueList struct {
+	Items []struct {
+		DescribedObject struct {
+			Name string `json:"name"`
+		} `json:"describedObject"`
+		Value resource.Quantity `json:"value"`
+	} `json:"items"`
+}
+
+func (s *PropertyMetricsSource) GetMetrics(tserver *tarsV1beta3.TServer, pods []*k8sCoreV1.Pod) (map[string]int64, error) {
+	bs, err := tarsRuntime.Clients.K8sClient.CoreV1().RESTClient().Get().
+		AbsPath("/apis/custom.metrics.k8s.io/v1beta1/namespaces", tserver.Namespace, "pods", "*", tserver.Spec.K8S.Autoscaler.Property).
+		Param("labelSelector", tserver.Status.Selector).
+		DoRaw(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("query custom metrics api error: %s", err.Error())
+	}
+
+	var valueList metricValueList
+	if err = json.Unmarshal(bs, &valueList); err != nil {
+		return nil, fmt.Errorf("decode custom metrics api response error: %s", err.Error())
+	}
+
+	values := map[string]int64{}
+	for _, item := range valueList.Items {
+		values[item.DescribedObject.Name] = item.Value.MilliValue()
+	}
+
+	podValues := map[string]int64{}
+	for _, pod := range pods {
+		if value, ok := values[pod.Name]; ok {
+			podValues[pod.Name] = value
+		}
+	}
+	return podValues, nil
+}
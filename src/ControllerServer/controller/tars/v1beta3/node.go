@@ -2,15 +2,14 @@ package v1beta3
 
 import (
 	"context"
+	"fmt"
 	k8sCoreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
 	k8sCoreListerV1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	tarsMeta "k8s.tars.io/meta"
 	tarsRuntime "k8s.tars.io/runtime"
@@ -20,92 +19,37 @@ import (
 )
 
 type NodeReconciler struct {
-	nodeLister k8sCoreListerV1.NodeLister
-	threads    int
-	queue      workqueue.RateLimitingInterface
-	synced     []cache.InformerSynced
+	nodeLister    k8sCoreListerV1.NodeLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
 }
 
 func NewNodeController(threads int) *NodeReconciler {
 	nodeInformer := tarsRuntime.Factories.K8SInformerFactory.Core().V1().Nodes()
 	c := &NodeReconciler{
-		nodeLister: nodeInformer.Lister(),
-		threads:    threads,
-		queue:      workqueue.NewRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter()),
-		synced:     []cache.InformerSynced{nodeInformer.Informer().HasSynced},
+		nodeLister:    nodeInformer.Lister(),
+		synced:        []cache.InformerSynced{nodeInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("node-controller"),
 	}
+	c.runner = controller.NewRunner("node", threads, controller.NewItemBasedRateLimiter(), controller.RequeueAfter(c.reconcile, time.Second))
 	controller.RegistryInformerEventHandle(tarsMeta.KNodeKind, nodeInformer.Informer(), c)
 	return c
 }
 
-func (r *NodeReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	res := r.reconcile(key)
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.AddAfter:
-		r.queue.AddAfter(obj, time.Second*1)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *NodeReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
 	switch resourceObj.(type) {
 	case *k8sCoreV1.Node:
 		node := resourceObj.(*k8sCoreV1.Node)
 		key := node.Name
-		r.queue.Add(key)
+		r.runner.Add(key)
 	default:
 		return
 	}
 }
 
 func (r *NodeReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("node controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
-
-	<-stopCh
+	r.runner.Run(stopCh, r.synced...)
 }
 
 func (r *NodeReconciler) reconcile(key string) controller.Result {
@@ -146,7 +90,9 @@ func (r *NodeReconciler) reconcile(key string) controller.Result {
 
 	nodeInterface := tarsRuntime.Clients.K8sClient.CoreV1().Nodes()
 	if _, err = nodeInterface.Update(context.TODO(), nodeCopy, k8sMetaV1.UpdateOptions{}); err != nil {
-		klog.Errorf(tarsMeta.ResourceUpdateError, "node", "", name, err.Error())
+		msg := fmt.Sprintf(tarsMeta.ResourceUpdateError, "node", "", name, err.Error())
+		klog.Errorf(msg)
+		r.eventRecorder.Event(node, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceUpdateReason, msg)
 		return controller.Retry
 	}
 
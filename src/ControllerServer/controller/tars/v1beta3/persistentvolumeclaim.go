@@ -8,14 +8,10 @@ import (
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
-	k8sCoreTypeV1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	k8sCoreListerV1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
@@ -41,75 +37,34 @@ func containLabel(l, r map[string]string) bool {
 }
 
 type PVCReconciler struct {
-	pvcLister k8sCoreListerV1.PersistentVolumeClaimLister
-	tsLister  tarsListerV1beta3.TServerLister
-	threads   int
-	queue     workqueue.RateLimitingInterface
-	synced    []cache.InformerSynced
+	pvcLister     k8sCoreListerV1.PersistentVolumeClaimLister
+	tsLister      tarsListerV1beta3.TServerLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
 }
 
 func NewPVCController(threads int) *PVCReconciler {
 	pvcInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Core().V1().PersistentVolumeClaims()
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartRecordingToSink(&k8sCoreTypeV1.EventSinkImpl{Interface: tarsRuntime.Clients.K8sClient.CoreV1().Events("")})
 	c := &PVCReconciler{
-		pvcLister: pvcInformer.Lister(),
-		tsLister:  tsInformer.Lister(),
-		threads:   threads,
-		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		synced:    []cache.InformerSynced{pvcInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		pvcLister:     pvcInformer.Lister(),
+		tsLister:      tsInformer.Lister(),
+		synced:        []cache.InformerSynced{pvcInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("pvc-controller"),
 	}
+	c.runner = controller.NewRunner("persistentvolumeclaim", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, time.Second*3))
 	controller.RegistryInformerEventHandle(tarsMeta.KPersistentVolumeClaimKind, tsInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
 	return c
 }
 
-func (r *PVCReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	res := r.reconcile(key)
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	case controller.AddAfter:
-		r.queue.AddAfter(obj, time.Second*3)
-		return true
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *PVCReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
 	switch resourceObj.(type) {
 	case *tarsV1beta3.TServer:
 		tserver := resourceObj.(*tarsV1beta3.TServer)
 		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	case *k8sCoreV1.PersistentVolumeClaim:
 		if resourceEvent == k8sWatchV1.Deleted {
 			break
@@ -120,7 +75,7 @@ func (r *PVCReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent
 			server, serverExist := pvc.Labels[tarsMeta.TServerNameLabel]
 			if appExist && serverExist {
 				key := fmt.Sprintf("%s/%s-%s", pvc.Namespace, strings.ToLower(app), strings.ToLower(server))
-				r.queue.Add(key)
+				r.runner.Add(key)
 				return
 			}
 		}
@@ -128,23 +83,7 @@ func (r *PVCReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent
 }
 
 func (r *PVCReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("persistentvolumeclaim controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
-
-	<-stopCh
+	r.runner.Run(stopCh, r.synced...)
 }
 
 func buildPVCAnnotations(tserver *tarsV1beta3.TServer) map[string]map[string]string {
@@ -179,7 +118,7 @@ func (r *PVCReconciler) reconcile(key string) controller.Result {
 		return controller.Done
 	}
 
-	if tserver.DeletionTimestamp != nil || tserver.Spec.K8S.DaemonSet {
+	if tserver.DeletionTimestamp != nil || tserver.Spec.K8S.DaemonSet || tserver.Spec.SubType == tarsV1beta3.External {
 		return controller.Done
 	}
 
@@ -217,7 +156,9 @@ func (r *PVCReconciler) reconcile(key string) controller.Result {
 				continue
 			}
 			retry = true
-			klog.Errorf(tarsMeta.ResourceUpdateError, "PersistentVolumeClaims", namespace, pvc.Name, err.Error())
+			msg := fmt.Sprintf(tarsMeta.ResourceUpdateError, "PersistentVolumeClaims", namespace, pvc.Name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceUpdateReason, msg)
 		}
 	}
 	if retry {
@@ -0,0 +1,164 @@
+package v1beta3
+
+import (
+	"context"
+	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sPolicyV1beta1 "k8s.io/api/policy/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
+	k8sPolicyListerV1beta1 "k8s.io/client-go/listers/policy/v1beta1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	"tarscontroller/controller"
+	"time"
+)
+
+type PodDisruptionBudgetReconciler struct {
+	pdbLister     k8sPolicyListerV1beta1.PodDisruptionBudgetLister
+	tsLister      tarsListerV1beta3.TServerLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
+}
+
+func NewPodDisruptionBudgetController(threads int) *PodDisruptionBudgetReconciler {
+	pdbInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Policy().V1beta1().PodDisruptionBudgets()
+	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
+
+	c := &PodDisruptionBudgetReconciler{
+		pdbLister:     pdbInformer.Lister(),
+		tsLister:      tsInformer.Lister(),
+		synced:        []cache.InformerSynced{pdbInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("poddisruptionbudget-controller"),
+	}
+	c.runner = controller.NewRunner("poddisruptionbudget", threads, controller.NewItemBasedRateLimiter(), controller.RequeueAfter(c.reconcile, time.Second))
+	controller.RegistryInformerEventHandle(tarsMeta.KPodDisruptionBudgetKind, pdbInformer.Informer(), c)
+	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
+	return c
+}
+
+func (r *PodDisruptionBudgetReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
+	switch resourceObj.(type) {
+	case *tarsV1beta3.TServer:
+		tserver := resourceObj.(*tarsV1beta3.TServer)
+		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
+		r.runner.Add(key)
+	case *k8sPolicyV1beta1.PodDisruptionBudget:
+		pdb := resourceObj.(*k8sPolicyV1beta1.PodDisruptionBudget)
+		if resourceEvent == k8sWatchV1.Deleted {
+			key := fmt.Sprintf("%s/%s", pdb.Namespace, pdb.Name)
+			r.runner.Add(key)
+		}
+	default:
+		return
+	}
+}
+
+func (r *PodDisruptionBudgetReconciler) Run(stopCh chan struct{}) {
+	r.runner.Run(stopCh, r.synced...)
+}
+
+func (r *PodDisruptionBudgetReconciler) deletePodDisruptionBudget(namespace, name string) controller.Result {
+	pdb, err := r.pdbLister.PodDisruptionBudgets(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceGetError, "poddisruptionbudget", namespace, name, err.Error())
+			return controller.Retry
+		}
+		return controller.Done
+	}
+
+	// only delete the poddisruptionbudget which managed by tserver
+	ownerRef := k8sMetaV1.GetControllerOf(pdb)
+	if ownerRef == nil || ownerRef.Kind != tarsMeta.TServerKind || ownerRef.Name != name {
+		return controller.Done
+	}
+
+	err = tarsRuntime.Clients.K8sClient.PolicyV1beta1().PodDisruptionBudgets(namespace).Delete(context.TODO(), name, k8sMetaV1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		klog.Errorf(tarsMeta.ResourceDeleteError, "poddisruptionbudget", namespace, name, err.Error())
+		return controller.Retry
+	}
+	return controller.Done
+}
+
+func (r *PodDisruptionBudgetReconciler) apply(current k8sMetaV1.Object, pdb *k8sPolicyV1beta1.PodDisruptionBudget) error {
+	pdbInterface := tarsRuntime.Clients.K8sClient.PolicyV1beta1().PodDisruptionBudgets(pdb.Namespace)
+	return controller.Apply(current, pdb, func(pt patchTypes.PatchType, data []byte, options k8sMetaV1.PatchOptions) error {
+		_, err := pdbInterface.Patch(context.TODO(), pdb.Name, pt, data, options)
+		return err
+	})
+}
+
+func (r *PodDisruptionBudgetReconciler) reconcile(key string) controller.Result {
+
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		klog.Errorf("invalid key: %s", key)
+		return controller.Done
+	}
+
+	tserver, err := r.tsLister.TServers(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceGetError, "tserver", namespace, name, err.Error())
+			return controller.Retry
+		}
+		return r.deletePodDisruptionBudget(namespace, name)
+	}
+
+	if tserver.DeletionTimestamp != nil || tserver.Spec.K8S.DaemonSet || tserver.Spec.SubType == tarsV1beta3.External || tserver.Spec.K8S.DisruptionBudget == nil {
+		return r.deletePodDisruptionBudget(namespace, name)
+	}
+
+	pdb, err := r.pdbLister.PodDisruptionBudgets(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceGetError, "poddisruptionbudget", namespace, name, err.Error())
+			return controller.Retry
+		}
+		pdb = tarsRuntime.TarsTranslator.BuildPodDisruptionBudget(tserver)
+		pdbInterface := tarsRuntime.Clients.K8sClient.PolicyV1beta1().PodDisruptionBudgets(namespace)
+		_, err = pdbInterface.Create(context.TODO(), pdb, k8sMetaV1.CreateOptions{FieldManager: tarsMeta.ControllerFieldManager})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			msg := fmt.Sprintf(tarsMeta.ResourceCreateError, "poddisruptionbudget", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceCreateReason, msg)
+			return controller.Retry
+		}
+		if err == nil {
+			r.eventRecorder.Eventf(tserver, k8sCoreV1.EventTypeNormal, tarsMeta.ResourceCreatedReason, "created poddisruptionbudget %s/%s", namespace, name)
+		}
+		return controller.Done
+	}
+
+	if pdb.DeletionTimestamp != nil {
+		return controller.AddAfter
+	}
+
+	if !k8sMetaV1.IsControlledBy(pdb, tserver) {
+		// 此处意味着出现了非由 controller 管理的同名 poddisruptionbudget, 需要警告和重试
+		msg := fmt.Sprintf(tarsMeta.ResourceOutControlError, "poddisruptionbudget", namespace, pdb.Name, namespace, name)
+		r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceOutControlReason, msg)
+		return controller.Retry
+	}
+
+	apply, target := tarsRuntime.TarsTranslator.DryRunApplyPodDisruptionBudget(tserver, pdb)
+	if apply {
+		if err = r.apply(pdb, target); err != nil {
+			msg := fmt.Sprintf(tarsMeta.ResourceUpdateError, "poddisruptionbudget", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceUpdateReason, msg)
+			return controller.Retry
+		}
+	}
+	return controller.Done
+}
@@ -6,15 +6,11 @@ import (
 	k8sCoreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
+	patchTypes "k8s.io/apimachinery/pkg/types"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes/scheme"
-	k8sCoreTypeV1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	k8sCoreListerV1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
@@ -27,8 +23,7 @@ import (
 type ServiceReconciler struct {
 	svcLiter      k8sCoreListerV1.ServiceLister
 	tsLister      tarsListerV1beta3.TServerLister
-	threads       int
-	queue         workqueue.RateLimitingInterface
+	runner        *controller.Runner
 	synced        []cache.InformerSynced
 	eventRecorder record.EventRecorder
 }
@@ -36,72 +31,30 @@ type ServiceReconciler struct {
 func NewServiceController(threads int) *ServiceReconciler {
 	svcInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Core().V1().Services()
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartRecordingToSink(&k8sCoreTypeV1.EventSinkImpl{Interface: tarsRuntime.Clients.K8sClient.CoreV1().Events("")})
 
 	c := &ServiceReconciler{
 		svcLiter:      svcInformer.Lister(),
 		tsLister:      tsInformer.Lister(),
-		threads:       threads,
-		queue:         workqueue.NewRateLimitingQueue(workqueue.DefaultItemBasedRateLimiter()),
 		synced:        []cache.InformerSynced{svcInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
-		eventRecorder: eventBroadcaster.NewRecorder(scheme.Scheme, k8sCoreV1.EventSource{Component: "daemonset-controller"}),
+		eventRecorder: tarsRuntime.NewEventRecorder("service-controller"),
 	}
+	c.runner = controller.NewRunner("service", threads, controller.NewItemBasedRateLimiter(), controller.RequeueAfter(c.reconcile, time.Second))
 	controller.RegistryInformerEventHandle(tarsMeta.KServiceKind, svcInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
 	return c
 }
 
-func (r *ServiceReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	res := r.reconcile(key)
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.AddAfter:
-		r.queue.AddAfter(obj, time.Second*1)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *ServiceReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
 	switch resourceObj.(type) {
 	case *tarsV1beta3.TServer:
 		tserver := resourceObj.(*tarsV1beta3.TServer)
 		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	case *k8sCoreV1.Service:
 		service := resourceObj.(*k8sCoreV1.Service)
 		if resourceEvent == k8sWatchV1.Deleted {
 			key := fmt.Sprintf("%s/%s", service.Namespace, service.Name)
-			r.queue.Add(key)
+			r.runner.Add(key)
 		}
 	default:
 		return
@@ -109,23 +62,15 @@ func (r *ServiceReconciler) EnqueueResourceEvent(resourceKind string, resourceEv
 }
 
 func (r *ServiceReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("service controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
+	r.runner.Run(stopCh, r.synced...)
+}
 
-	<-stopCh
+func (r *ServiceReconciler) apply(current k8sMetaV1.Object, service *k8sCoreV1.Service) error {
+	serviceInterface := tarsRuntime.Clients.K8sClient.CoreV1().Services(service.Namespace)
+	return controller.Apply(current, service, func(pt patchTypes.PatchType, data []byte, options k8sMetaV1.PatchOptions) error {
+		_, err := serviceInterface.Patch(context.TODO(), service.Name, pt, data, options)
+		return err
+	})
 }
 
 func (r *ServiceReconciler) reconcile(key string) controller.Result {
@@ -167,10 +112,16 @@ func (r *ServiceReconciler) reconcile(key string) controller.Result {
 		}
 		service = tarsRuntime.TarsTranslator.BuildService(tserver)
 		serviceInterface := tarsRuntime.Clients.K8sClient.CoreV1().Services(namespace)
-		if _, err = serviceInterface.Create(context.TODO(), service, k8sMetaV1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
-			klog.Errorf(tarsMeta.ResourceCreateError, "service", namespace, name, err.Error())
+		_, err = serviceInterface.Create(context.TODO(), service, k8sMetaV1.CreateOptions{FieldManager: tarsMeta.ControllerFieldManager})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			msg := fmt.Sprintf(tarsMeta.ResourceCreateError, "service", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceCreateReason, msg)
 			return controller.Retry
 		}
+		if err == nil {
+			r.eventRecorder.Eventf(tserver, k8sCoreV1.EventTypeNormal, tarsMeta.ResourceCreatedReason, "created service %s/%s", namespace, name)
+		}
 
 		return controller.Done
 	}
@@ -186,11 +137,12 @@ func (r *ServiceReconciler) reconcile(key string) controller.Result {
 		return controller.Retry
 	}
 
-	update, target := tarsRuntime.TarsTranslator.DryRunSyncService(tserver, service)
-	if update {
-		serviceInterface := tarsRuntime.Clients.K8sClient.CoreV1().Services(namespace)
-		if _, err = serviceInterface.Update(context.TODO(), target, k8sMetaV1.UpdateOptions{}); err != nil {
-			klog.Errorf(tarsMeta.ResourceUpdateError, "service", namespace, name, err.Error())
+	apply, target := tarsRuntime.TarsTranslator.DryRunApplyService(tserver, service)
+	if apply {
+		if err = r.apply(service, target); err != nil {
+			msg := fmt.Sprintf(tarsMeta.ResourceUpdateError, "service", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceUpdateReason, msg)
 			return controller.Retry
 		}
 	}
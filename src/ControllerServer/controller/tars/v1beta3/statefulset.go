@@ -10,29 +10,33 @@ import (
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes/scheme"
-	k8sCoreTypeV1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	k8sAppsListerV1 "k8s.io/client-go/listers/apps/v1"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/record"
-	"k8s.io/client-go/util/workqueue"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
 	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"strconv"
 	"tarscontroller/controller"
 	"time"
 )
 
+const (
+	CanaryRolledBackReason = "CanaryRolledBack"
+	CanaryCompletedReason  = "CanaryCompleted"
+)
+
 type StatefulSetReconciler struct {
 	stsLister     k8sAppsListerV1.StatefulSetLister
 	tsLister      tarsListerV1beta3.TServerLister
-	threads       int
-	queue         workqueue.RateLimitingInterface
+	teLister      tarsListerV1beta3.TEndpointLister
+	runner        *controller.Runner
 	synced        []cache.InformerSynced
 	eventRecorder record.EventRecorder
 }
@@ -72,93 +76,38 @@ func diffVolumeClaimTemplate(current, target []k8sCoreV1.PersistentVolumeClaim)
 func NewStatefulSetController(threads int) *StatefulSetReconciler {
 	stsInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Apps().V1().StatefulSets()
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
-	eventBroadcaster := record.NewBroadcaster()
-	eventBroadcaster.StartRecordingToSink(&k8sCoreTypeV1.EventSinkImpl{Interface: tarsRuntime.Clients.K8sClient.CoreV1().Events("")})
+	teInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TEndpoints()
 	c := &StatefulSetReconciler{
 		stsLister:     stsInformer.Lister(),
 		tsLister:      tsInformer.Lister(),
-		threads:       threads,
-		queue:         workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		synced:        []cache.InformerSynced{stsInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
-		eventRecorder: eventBroadcaster.NewRecorder(scheme.Scheme, k8sCoreV1.EventSource{Component: "daemonset-controller"}),
+		teLister:      teInformer.Lister(),
+		synced:        []cache.InformerSynced{stsInformer.Informer().HasSynced, tsInformer.Informer().HasSynced, teInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("statefulset-controller"),
 	}
+	c.runner = controller.NewRunner("statefulset", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, time.Second*3))
 	controller.RegistryInformerEventHandle(tarsMeta.KStatefulSetKind, stsInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
 	return c
 }
 
-func (r *StatefulSetReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	res := r.reconcile(key)
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	case controller.AddAfter:
-		r.queue.AddAfter(obj, time.Second*3)
-		return true
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *StatefulSetReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
 	switch resourceObj.(type) {
 	case *tarsV1beta3.TServer:
 		tserver := resourceObj.(*tarsV1beta3.TServer)
 		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	case *k8sAppsV1.StatefulSet:
 		statefulset := resourceObj.(*k8sAppsV1.StatefulSet)
-		if resourceEvent == k8sWatchV1.Deleted {
+		// the release is synced by the rollout status of statefulset
+		if resourceEvent == k8sWatchV1.Deleted || resourceEvent == k8sWatchV1.Modified {
 			key := fmt.Sprintf("%s/%s", statefulset.Namespace, statefulset.Name)
-			r.queue.Add(key)
+			r.runner.Add(key)
 		}
 	}
 }
 
 func (r *StatefulSetReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("statefulset controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
-
-	<-stopCh
+	r.runner.Run(stopCh, r.synced...)
 }
 
 func (r *StatefulSetReconciler) rebuildStatefulset(tserver *tarsV1beta3.TServer, shouldDeletes []string) controller.Result {
@@ -166,9 +115,12 @@ func (r *StatefulSetReconciler) rebuildStatefulset(tserver *tarsV1beta3.TServer,
 	name := tserver.Name
 	err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(namespace).Delete(context.TODO(), name, k8sMetaV1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf(tarsMeta.ResourceDeleteError, "statefulset", namespace, name, err.Error())
+		msg := fmt.Sprintf(tarsMeta.ResourceDeleteError, "statefulset", namespace, name, err.Error())
+		klog.Errorf(msg)
+		r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceDeleteReason, msg)
 		return controller.Retry
 	}
+	r.eventRecorder.Eventf(tserver, k8sCoreV1.EventTypeNormal, tarsMeta.ResourceRebuildReason, "rebuild statefulset %s/%s because volumeClaimTemplates changed", namespace, name)
 
 	if shouldDeletes != nil {
 		appRequirement, _ := labels.NewRequirement(tarsMeta.TServerAppLabel, selection.DoubleEquals, []string{tserver.Spec.App})
@@ -186,6 +138,14 @@ func (r *StatefulSetReconciler) rebuildStatefulset(tserver *tarsV1beta3.TServer,
 	return controller.AddAfter
 }
 
+func (r *StatefulSetReconciler) apply(current k8sMetaV1.Object, statefulSet *k8sAppsV1.StatefulSet) error {
+	statefulSetInterface := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(statefulSet.Namespace)
+	return controller.Apply(current, statefulSet, func(pt patchTypes.PatchType, data []byte, options k8sMetaV1.PatchOptions) error {
+		_, err := statefulSetInterface.Patch(context.TODO(), statefulSet.Name, pt, data, options)
+		return err
+	})
+}
+
 func (r *StatefulSetReconciler) reconcile(key string) controller.Result {
 	namespace, name, err := cache.SplitMetaNamespaceKey(key)
 	if err != nil {
@@ -207,7 +167,7 @@ func (r *StatefulSetReconciler) reconcile(key string) controller.Result {
 		return controller.Done
 	}
 
-	if tserver.DeletionTimestamp != nil || tserver.Spec.K8S.DaemonSet {
+	if tserver.DeletionTimestamp != nil || tserver.Spec.K8S.DaemonSet || tserver.Spec.SubType == tarsV1beta3.External {
 		err = tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(namespace).Delete(context.TODO(), name, k8sMetaV1.DeleteOptions{})
 		if err != nil && !errors.IsNotFound(err) {
 			klog.Errorf(tarsMeta.ResourceDeleteError, "statefulset", namespace, name, err.Error())
@@ -226,11 +186,16 @@ func (r *StatefulSetReconciler) reconcile(key string) controller.Result {
 		if !tserver.Spec.K8S.DaemonSet {
 			statefulSet = tarsRuntime.TarsTranslator.BuildStatefulset(tserver)
 			statefulSetInterface := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(namespace)
-			_, err = statefulSetInterface.Create(context.TODO(), statefulSet, k8sMetaV1.CreateOptions{})
+			_, err = statefulSetInterface.Create(context.TODO(), statefulSet, k8sMetaV1.CreateOptions{FieldManager: tarsMeta.ControllerFieldManager})
 			if err != nil && !errors.IsAlreadyExists(err) {
-				klog.Errorf(tarsMeta.ResourceCreateError, "statefulset", namespace, name, err.Error())
+				msg := fmt.Sprintf(tarsMeta.ResourceCreateError, "statefulset", namespace, name, err.Error())
+				klog.Errorf(msg)
+				r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceCreateReason, msg)
 				return controller.Retry
 			}
+			if err == nil {
+				r.eventRecorder.Eventf(tserver, k8sCoreV1.EventTypeNormal, tarsMeta.ResourceCreatedReason, "created statefulset %s/%s", namespace, name)
+			}
 		}
 		return controller.Done
 	}
@@ -252,13 +217,223 @@ func (r *StatefulSetReconciler) reconcile(key string) controller.Result {
 		return r.rebuildStatefulset(tserver, shouldDeletes)
 	}
 
-	update, target := tarsRuntime.TarsTranslator.DryRunSyncStatefulset(tserver, statefulSet)
-	if update {
-		statefulSetInterface := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(namespace)
-		if _, err = statefulSetInterface.Update(context.TODO(), target, k8sMetaV1.UpdateOptions{}); err != nil {
-			klog.Errorf(tarsMeta.ResourceUpdateError, "statefulset", namespace, name, err.Error())
+	apply, target := tarsRuntime.TarsTranslator.DryRunApplyStatefulset(tserver, statefulSet)
+	if apply {
+		if err = r.apply(statefulSet, target); err != nil {
+			msg := fmt.Sprintf(tarsMeta.ResourceUpdateError, "statefulset", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceUpdateReason, msg)
 			return controller.Retry
 		}
+		return controller.Done
+	}
+	return r.syncRelease(tserver, statefulSet)
+}
+
+func (r *StatefulSetReconciler) updateReleaseStatus(tserver *tarsV1beta3.TServer, stable *tarsV1beta3.TServerRelease, canary *tarsV1beta3.TServerCanaryStatus) error {
+	if equality.Semantic.DeepEqual(stable, tserver.Status.StableRelease) && equality.Semantic.DeepEqual(canary, tserver.Status.Canary) {
+		return nil
+	}
+	patch := map[string]interface{}{
+		"status": map[string]interface{}{
+			"stableRelease": stable,
+			"canary":        canary,
+		},
+	}
+	bs, _ := json.Marshal(patch)
+	_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(tserver.Namespace).Patch(context.TODO(), tserver.Name, patchTypes.MergePatchType, bs, k8sMetaV1.PatchOptions{}, "status")
+	return err
+}
+
+func buildStableRelease(release *tarsV1beta3.TServerRelease) *tarsV1beta3.TServerRelease {
+	stable := release.DeepCopy()
+	stable.Canary = nil
+	return stable
+}
+
+func statefulsetRolledOut(tserver *tarsV1beta3.TServer, statefulSet *k8sAppsV1.StatefulSet) bool {
+	if statefulSet.Spec.Template.Labels[tarsMeta.TServerIdLabel] != tserver.Spec.Release.ID {
+		return false
+	}
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation {
+		return false
+	}
+	// replicas may be managed by others, eg. HorizontalPodAutoscaler
+	replicas := tserver.Spec.K8S.Replicas
+	if statefulSet.Spec.Replicas != nil {
+		replicas = *statefulSet.Spec.Replicas
+	}
+	return statefulSet.Status.CurrentRevision == statefulSet.Status.UpdateRevision &&
+		statefulSet.Status.UpdatedReplicas == replicas && statefulSet.Status.ReadyReplicas == replicas
+}
+
+var failedWaitingReasons = map[string]interface{}{
+	"CrashLoopBackOff":           nil,
+	"ImagePullBackOff":           nil,
+	"ErrImagePull":               nil,
+	"InvalidImageName":           nil,
+	"CreateContainerConfigError": nil,
+}
+
+func canaryPodFailed(podStatus *tarsV1beta3.TEndpointPodStatus, failureThreshold int32) (bool, string) {
+	for _, container := range podStatus.ContainerStatuses {
+		if container.RestartCount >= failureThreshold {
+			return true, fmt.Sprintf("container %s of pod %s restarted %d times", container.Name, podStatus.Name, container.RestartCount)
+		}
+		if container.State.Waiting != nil {
+			if _, ok := failedWaitingReasons[container.State.Waiting.Reason]; ok {
+				return true, fmt.Sprintf("container %s of pod %s is %s", container.Name, podStatus.Name, container.State.Waiting.Reason)
+			}
+		}
+	}
+	return false, ""
+}
+
+func (r *StatefulSetReconciler) rollbackCanary(tserver *tarsV1beta3.TServer, canary *tarsV1beta3.TServerCanaryStatus, reason string) controller.Result {
+	namespace, name := tserver.Namespace, tserver.Name
+	stable := tserver.Status.StableRelease
+
+	jsonPatch := tarsTool.JsonPatch{
+		{
+			OP:    tarsTool.JsonPatchReplace,
+			Path:  "/spec/release",
+			Value: stable,
+		},
+	}
+	bs, _ := json.Marshal(jsonPatch)
+	current, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(namespace).Patch(context.TODO(), name, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+	if err != nil {
+		klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+		return controller.Retry
+	}
+
+	msg := fmt.Sprintf("canary release %s rolled back to %s: %s", canary.ReleaseID, stable.ID, reason)
+	r.eventRecorder.Event(current, k8sCoreV1.EventTypeWarning, CanaryRolledBackReason, msg)
+
+	canary.Phase = tarsV1beta3.CanaryRolledBack
+	canary.BakeTime = nil
+	canary.Message = msg
+	if err = r.updateReleaseStatus(current, stable, canary); err != nil {
+		klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+		return controller.Retry
 	}
 	return controller.Done
 }
+
+// syncRelease record the stable release and drive the canary steps of the release
+func (r *StatefulSetReconciler) syncRelease(tserver *tarsV1beta3.TServer, statefulSet *k8sAppsV1.StatefulSet) controller.Result {
+	namespace, name := tserver.Namespace, tserver.Name
+	release := tserver.Spec.Release
+	if release == nil {
+		return controller.Done
+	}
+
+	stable := tserver.Status.StableRelease
+	if stable != nil && stable.ID == release.ID {
+		return controller.Done
+	}
+
+	if stable == nil || release.Canary == nil || len(release.Canary.Steps) == 0 {
+		if !statefulsetRolledOut(tserver, statefulSet) {
+			return controller.Done
+		}
+		if err := r.updateReleaseStatus(tserver, buildStableRelease(release), tserver.Status.Canary); err != nil {
+			klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+			return controller.Retry
+		}
+		return controller.Done
+	}
+
+	now := k8sMetaV1.Now()
+	canary := tserver.Status.Canary
+	if canary == nil || canary.ReleaseID != release.ID || canary.Phase == tarsV1beta3.CanaryRolledBack || canary.Phase == tarsV1beta3.CanaryCompleted {
+		canary = &tarsV1beta3.TServerCanaryStatus{
+			ReleaseID: release.ID,
+			Step:      0,
+			Phase:     tarsV1beta3.CanaryProgressing,
+			StepTime:  now,
+			Message:   fmt.Sprintf("canary release %s started", release.ID),
+		}
+		if err := r.updateReleaseStatus(tserver, stable, canary); err != nil {
+			klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+			return controller.Retry
+		}
+		return controller.AddAfter
+	}
+	canary = canary.DeepCopy()
+
+	if statefulSet.Spec.Template.Labels[tarsMeta.TServerIdLabel] != release.ID {
+		return controller.AddAfter
+	}
+
+	tendpoint, err := r.teLister.TEndpoints(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceGetError, "tendpoint", namespace, name, err.Error())
+			return controller.Retry
+		}
+		return controller.AddAfter
+	}
+
+	failureThreshold := release.Canary.FailureThreshold
+	if failureThreshold == 0 {
+		failureThreshold = tarsMeta.DefaultCanaryFailureThreshold
+	}
+
+	var active int32
+	for _, podStatus := range tendpoint.Status.PodStatus {
+		if podStatus.ID != release.ID {
+			continue
+		}
+		if failed, reason := canaryPodFailed(podStatus, failureThreshold); failed {
+			return r.rollbackCanary(tserver, canary, reason)
+		}
+		if podStatus.PresentState == "Active" {
+			active++
+		}
+	}
+
+	target := tarsRuntime.TarsTranslator.BuildCanaryStepReplicas(tserver, statefulSet, canary.Step)
+	if active < target {
+		progressDeadline := release.Canary.ProgressDeadlineSeconds
+		if progressDeadline == 0 {
+			progressDeadline = tarsMeta.DefaultCanaryProgressDeadlineSeconds
+		}
+		if canary.Phase == tarsV1beta3.CanaryProgressing && now.Sub(canary.StepTime.Time) > time.Duration(progressDeadline)*time.Second {
+			return r.rollbackCanary(tserver, canary, fmt.Sprintf("step %d not active in %d seconds", canary.Step, progressDeadline))
+		}
+		canary.BakeTime = nil
+		canary.Message = fmt.Sprintf("step %d: %d/%d pods active", canary.Step, active, target)
+	} else if canary.BakeTime == nil {
+		canary.BakeTime = &now
+		canary.Message = fmt.Sprintf("step %d: %d pods active, baking", canary.Step, active)
+	} else if now.Sub(canary.BakeTime.Time) >= time.Duration(release.Canary.BakeSeconds)*time.Second {
+		step := release.Canary.Steps[canary.Step]
+		if step.Pause && tserver.Annotations[tarsMeta.TCanaryResumeAnnotation] != strconv.Itoa(int(canary.Step)) {
+			canary.Phase = tarsV1beta3.CanaryPaused
+			canary.Message = fmt.Sprintf("paused at step %d, set annotation %s to %d to resume", canary.Step, tarsMeta.TCanaryResumeAnnotation, canary.Step)
+		} else if int(canary.Step)+1 >= len(release.Canary.Steps) {
+			canary.Phase = tarsV1beta3.CanaryCompleted
+			canary.BakeTime = nil
+			canary.Message = fmt.Sprintf("canary release %s completed", release.ID)
+			stable = buildStableRelease(release)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeNormal, CanaryCompletedReason, canary.Message)
+		} else {
+			canary.Step += 1
+			canary.Phase = tarsV1beta3.CanaryProgressing
+			canary.StepTime = now
+			canary.BakeTime = nil
+			canary.Message = fmt.Sprintf("step %d started", canary.Step)
+		}
+	}
+
+	if err = r.updateReleaseStatus(tserver, stable, canary); err != nil {
+		klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
+		return controller.Retry
+	}
+
+	if canary.Phase == tarsV1beta3.CanaryCompleted {
+		return controller.Done
+	}
+	return controller.AddAfter
+}
@@ -3,17 +3,16 @@ package v1beta3
 import (
 	"context"
 	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
 	patchTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
@@ -21,17 +20,32 @@ import (
 	tarsTool "k8s.tars.io/tool"
 	"sort"
 	"strings"
+	"sync"
 	"tarscontroller/controller"
-	"time"
+)
+
+const (
+	TConfigDeactivatedReason = "Deactivated"
+	TConfigPrunedReason      = "Pruned"
 )
 
 type TConfigReconciler struct {
-	tcLister    cache.GenericLister
-	threads     int
-	addQueue    workqueue.RateLimitingInterface
-	modifyQueue workqueue.RateLimitingInterface
-	deleteQueue workqueue.RateLimitingInterface
-	synced      []cache.InformerSynced
+	tcLister      cache.GenericLister
+	addRunner     *controller.Runner
+	modifyRunner  *controller.Runner
+	deleteRunner  *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
+}
+
+// tconfigReference builds the event target from metadata only, tcLister does not carry full tconfig objects
+func tconfigReference(namespace, name string) *k8sCoreV1.ObjectReference {
+	return &k8sCoreV1.ObjectReference{
+		APIVersion: tarsV1beta3.SchemeGroupVersion.String(),
+		Kind:       tarsMeta.TConfigKind,
+		Namespace:  namespace,
+		Name:       name,
+	}
 }
 
 func (r *TConfigReconciler) splitAddKey(key string) (namespace, app, server, configName, podSeq string) {
@@ -51,13 +65,13 @@ func (r *TConfigReconciler) EnqueueResourceEvent(resourceKind string, resourceEv
 			configName, _ := objLabels[tarsMeta.TConfigNameLabel]
 			podSeq, _ := objLabels[tarsMeta.TConfigPodSeqLabel]
 			key := fmt.Sprintf("%s/%s/%s/%s/%s", namespace, app, server, configName, podSeq)
-			r.addQueue.Add(key)
-			r.modifyQueue.Add(namespace)
+			r.addRunner.Add(key)
+			r.modifyRunner.Add(namespace)
 		case k8sWatchV1.Modified:
-			r.modifyQueue.Add(namespace)
-			r.deleteQueue.Add(namespace)
+			r.modifyRunner.Add(namespace)
+			r.deleteRunner.Add(namespace)
 		case k8sWatchV1.Deleted:
-			r.deleteQueue.Add(namespace)
+			r.deleteRunner.Add(namespace)
 		}
 	}
 }
@@ -106,14 +120,18 @@ func (r *TConfigReconciler) reconcileAdded(key string) controller.Result {
 			continue
 		}
 		versions = append(versions, version)
+		versionNameMap[version] = obj.GetName()
 	}
 	sort.Strings(versions)
 	name := versionNameMap[versions[0]]
 	err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TConfigs(namespace).Delete(context.TODO(), name, k8sMetaV1.DeleteOptions{})
 	if err != nil && !errors.IsNotFound(err) {
-		klog.Errorf(tarsMeta.ResourceDeleteError, "tconfig", namespace, name, err.Error())
+		msg := fmt.Sprintf(tarsMeta.ResourceDeleteError, "tconfig", namespace, name, err.Error())
+		klog.Errorf(msg)
+		r.eventRecorder.Event(tconfigReference(namespace, name), k8sCoreV1.EventTypeWarning, tarsMeta.ResourceDeleteReason, msg)
 		return controller.Retry
 	}
+	r.eventRecorder.Eventf(tconfigReference(namespace, name), k8sCoreV1.EventTypeNormal, TConfigPrunedReason, "delete history version %s, over the limit of %d", versions[0], maxTConfigHistory)
 	return controller.Done
 }
 
@@ -150,10 +168,13 @@ func (r *TConfigReconciler) reconcileModified(key string) controller.Result {
 		name := v.GetName()
 		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TConfigs(namespace).Patch(context.TODO(), name, patchTypes.JSONPatchType, patchContent, k8sMetaV1.PatchOptions{})
 		if err != nil {
-			klog.Errorf(tarsMeta.ResourcePatchError, "tconfig", namespace, name, err.Error())
+			msg := fmt.Sprintf(tarsMeta.ResourcePatchError, "tconfig", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tconfigReference(namespace, name), k8sCoreV1.EventTypeWarning, tarsMeta.ResourcePatchReason, msg)
 			retry = true
 			continue
 		}
+		r.eventRecorder.Event(tconfigReference(namespace, name), k8sCoreV1.EventTypeNormal, TConfigDeactivatedReason, "deactivated because another version was activated")
 	}
 	if retry {
 		return controller.Retry
@@ -176,74 +197,28 @@ func (r *TConfigReconciler) reconcileDeleted(key string) controller.Result {
 }
 
 func (r *TConfigReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.addQueue.ShutDown()
-	defer r.modifyQueue.ShutDown()
-	defer r.deleteQueue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("tconfig controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		go wait.Until(func() { r.processItem(r.addQueue, r.reconcileAdded) }, time.Second, stopCh)
-	}
-
-	for i := 0; i < 3; i++ {
-		go wait.Until(func() { r.processItem(r.modifyQueue, r.reconcileModified) }, time.Second, stopCh)
-	}
-
-	for i := 0; i < 1; i++ {
-		go wait.Until(func() { r.processItem(r.deleteQueue, r.reconcileDeleted) }, time.Second, stopCh)
-	}
-
-	<-stopCh
-}
-
-func (r *TConfigReconciler) processItem(queue workqueue.RateLimitingInterface, reconciler func(key string) controller.Result) bool {
-	obj, shutdown := queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		queue.Forget(obj)
-		return true
-	}
-
-	res := reconciler(key)
-	switch res {
-	case controller.Done:
-		queue.Forget(obj)
-		return true
-	case controller.Retry:
-		queue.AddRateLimited(obj)
-		return true
-	case controller.FatalError:
-		queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
+	var wg sync.WaitGroup
+	for _, runner := range []*controller.Runner{r.addRunner, r.modifyRunner, r.deleteRunner} {
+		wg.Add(1)
+		go func(runner *controller.Runner) {
+			defer wg.Done()
+			runner.Run(stopCh, r.synced...)
+		}(runner)
+	}
+	wg.Wait()
 }
 
-func NewTConfigController(threads int) *TConfigReconciler {
+// NewTConfigController create the controller with the workers of add, modify and delete queues
+func NewTConfigController(addThreads, modifyThreads, deleteThreads int) *TConfigReconciler {
 	tcInformer := tarsRuntime.Factories.MetadataInformerFactor.ForResource(tarsV1beta3.SchemeGroupVersion.WithResource("tconfigs"))
 	c := &TConfigReconciler{
-		tcLister:    tcInformer.Lister(),
-		threads:     threads,
-		addQueue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		modifyQueue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		deleteQueue: workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		synced:      []cache.InformerSynced{tcInformer.Informer().HasSynced},
+		tcLister:      tcInformer.Lister(),
+		synced:        []cache.InformerSynced{tcInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("tconfig-controller"),
 	}
+	c.addRunner = controller.NewRunner("tconfig-add", addThreads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcileAdded, 0))
+	c.modifyRunner = controller.NewRunner("tconfig-modify", modifyThreads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcileModified, 0))
+	c.deleteRunner = controller.NewRunner("tconfig-delete", deleteThreads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcileDeleted, 0))
 	controller.RegistryInformerEventHandle(tarsMeta.TConfigKind, tcInformer.Informer(), c)
 	return c
 }
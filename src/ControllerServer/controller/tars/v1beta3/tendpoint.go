@@ -4,16 +4,16 @@ import (
 	"context"
 	"fmt"
 	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
+	patchTypes "k8s.io/apimachinery/pkg/types"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
 	k8sCoreListerV1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
@@ -22,16 +22,15 @@ import (
 	tarsTool "k8s.tars.io/tool"
 	"strings"
 	"tarscontroller/controller"
-	"time"
 )
 
 type TEndpointReconciler struct {
-	podLister k8sCoreListerV1.PodLister
-	teLister  tarsListerV1beta3.TEndpointLister
-	tsLister  tarsListerV1beta3.TServerLister
-	threads   int
-	queue     workqueue.RateLimitingInterface
-	synced    []cache.InformerSynced
+	podLister     k8sCoreListerV1.PodLister
+	teLister      tarsListerV1beta3.TEndpointLister
+	tsLister      tarsListerV1beta3.TServerLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
 }
 
 func NewTEndpointController(threads int) *TEndpointReconciler {
@@ -39,67 +38,29 @@ func NewTEndpointController(threads int) *TEndpointReconciler {
 	teInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TEndpoints()
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
 	c := &TEndpointReconciler{
-		podLister: podInformer.Lister(),
-		teLister:  teInformer.Lister(),
-		tsLister:  tsInformer.Lister(),
-		threads:   threads,
-		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		synced:    []cache.InformerSynced{podInformer.Informer().HasSynced, teInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		podLister:     podInformer.Lister(),
+		teLister:      teInformer.Lister(),
+		tsLister:      tsInformer.Lister(),
+		synced:        []cache.InformerSynced{podInformer.Informer().HasSynced, teInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("tendpoint-controller"),
 	}
+	c.runner = controller.NewRunner("tendpoint", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, 0))
 	controller.RegistryInformerEventHandle(tarsMeta.KPodKind, podInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TEndpointKind, teInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
 	return c
 }
 
-func (r *TEndpointReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	var res controller.Result
-	res = r.reconcile(key)
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		//r.queue.AddRateLimited(obj)
-		r.queue.AddAfter(obj, time.Millisecond*100)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *TEndpointReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
 	switch resourceObj.(type) {
 	case *tarsV1beta3.TServer:
 		tserver := resourceObj.(*tarsV1beta3.TServer)
 		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	case *tarsV1beta3.TEndpoint:
 		tendpoint := resourceObj.(*tarsV1beta3.TEndpoint)
 		key := fmt.Sprintf("%s/%s", tendpoint.Namespace, tendpoint.Name)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	case *k8sCoreV1.Pod:
 		pod := resourceObj.(*k8sCoreV1.Pod)
 		if pod.Labels != nil {
@@ -107,7 +68,7 @@ func (r *TEndpointReconciler) EnqueueResourceEvent(resourceKind string, resource
 			server := pod.Labels[tarsMeta.TServerNameLabel]
 			if app != "" && server != "" {
 				key := fmt.Sprintf("%s/%s-%s", pod.Namespace, strings.ToLower(app), strings.ToLower(server))
-				r.queue.Add(key)
+				r.runner.Add(key)
 				return
 			}
 		}
@@ -117,23 +78,15 @@ func (r *TEndpointReconciler) EnqueueResourceEvent(resourceKind string, resource
 }
 
 func (r *TEndpointReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("tendpoint controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
+	r.runner.Run(stopCh, r.synced...)
+}
 
-	<-stopCh
+func (r *TEndpointReconciler) apply(current k8sMetaV1.Object, tendpoint *tarsV1beta3.TEndpoint) error {
+	tendpointInterface := tarsRuntime.Clients.CrdClient.TarsV1beta3().TEndpoints(tendpoint.Namespace)
+	return controller.Apply(current, tendpoint, func(pt patchTypes.PatchType, data []byte, options k8sMetaV1.PatchOptions) error {
+		_, err := tendpointInterface.Patch(context.TODO(), tendpoint.Name, pt, data, options)
+		return err
+	})
 }
 
 func (r *TEndpointReconciler) reconcile(key string) controller.Result {
@@ -175,14 +128,22 @@ func (r *TEndpointReconciler) reconcile(key string) controller.Result {
 		}
 		tendpoint = tarsRuntime.TarsTranslator.BuildTEndpoint(tserver)
 		tendpointInterface := tarsRuntime.Clients.CrdClient.TarsV1beta3().TEndpoints(namespace)
-		if _, err = tendpointInterface.Create(context.TODO(), tendpoint, k8sMetaV1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
-			klog.Errorf(tarsMeta.ResourceCreateError, "tendpoint", namespace, name, err.Error())
+		_, err = tendpointInterface.Create(context.TODO(), tendpoint, k8sMetaV1.CreateOptions{FieldManager: tarsMeta.ControllerFieldManager})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			msg := fmt.Sprintf(tarsMeta.ResourceCreateError, "tendpoint", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceCreateReason, msg)
 			return controller.Retry
 		}
+		if err == nil {
+			r.eventRecorder.Eventf(tserver, k8sCoreV1.EventTypeNormal, tarsMeta.ResourceCreatedReason, "created tendpoint %s/%s", namespace, name)
+		}
 		return controller.Done
 	}
 
 	if !k8sMetaV1.IsControlledBy(tendpoint, tserver) {
+		msg := fmt.Sprintf(tarsMeta.ResourceOutControlError, "tendpoint", namespace, tendpoint.Name, namespace, name)
+		r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceOutControlReason, msg)
 		tendpointInterface := tarsRuntime.Clients.CrdClient.TarsV1beta3().TEndpoints(namespace)
 		if err = tendpointInterface.Delete(context.TODO(), tendpoint.Name, k8sMetaV1.DeleteOptions{}); err != nil {
 			klog.Errorf(tarsMeta.ResourceUpdateError, "tendpoint", namespace, name, err.Error())
@@ -190,11 +151,12 @@ func (r *TEndpointReconciler) reconcile(key string) controller.Result {
 		return controller.Retry
 	}
 
-	update, target := tarsRuntime.TarsTranslator.DryRunSyncTEndpoint(tserver, tendpoint)
-	if update {
-		tendpointInterface := tarsRuntime.Clients.CrdClient.TarsV1beta3().TEndpoints(namespace)
-		if _, err = tendpointInterface.Update(context.TODO(), target, k8sMetaV1.UpdateOptions{}); err != nil {
-			klog.Errorf(tarsMeta.ResourceUpdateError, "tendpoint", namespace, name, err.Error())
+	apply, target := tarsRuntime.TarsTranslator.DryRunApplyTEndpoint(tserver, tendpoint)
+	if apply {
+		if err = r.apply(tendpoint, target); err != nil {
+			msg := fmt.Sprintf(tarsMeta.ResourceUpdateError, "tendpoint", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceUpdateReason, msg)
 			return controller.Retry
 		}
 	}
@@ -214,6 +176,11 @@ func (r *TEndpointReconciler) buildPodStatus(pod *k8sCoreV1.Pod) *tarsV1beta3.TE
 		PresentState:      "",
 		PresentMessage:    "",
 		ID:                pod.Labels[tarsMeta.TServerIdLabel],
+		Image:             pod.Annotations[tarsMeta.TServerImageAnnotation],
+	}
+
+	if podStatus.Image == "" && len(pod.Spec.Containers) > 0 {
+		podStatus.Image = pod.Spec.Containers[0].Image
 	}
 
 	if pod.DeletionTimestamp != nil {
@@ -275,8 +242,66 @@ func (r *TEndpointReconciler) buildPodStatus(pod *k8sCoreV1.Pod) *tarsV1beta3.TE
 	return podStatus
 }
 
+// externalIPs return the distinct addresses of all upstreams in order of appearance
+func externalIPs(external *tarsV1beta3.TServerExternal) []string {
+	if external == nil {
+		return nil
+	}
+	var ips []string
+	seen := map[string]bool{}
+	for _, upstream := range external.Upstreams {
+		for _, address := range upstream.Addresses {
+			if !seen[address.IP] {
+				seen[address.IP] = true
+				ips = append(ips, address.IP)
+			}
+		}
+	}
+	return ips
+}
+
+// buildExternalPodStatus build pod like status for one external address, so tars clients resolve it like a pod
+func (r *TEndpointReconciler) buildExternalPodStatus(tendpoint *tarsV1beta3.TEndpoint, ip string) *tarsV1beta3.TEndpointPodStatus {
+	podStatus := &tarsV1beta3.TEndpointPodStatus{
+		UID:            "",
+		PID:            "",
+		Name:           fmt.Sprintf("%s-%s", tendpoint.Name, ip),
+		PodIP:          ip,
+		HostIP:         ip,
+		StartTime:      tendpoint.CreationTimestamp,
+		SettingState:   "Active",
+		PresentState:   "Active",
+		PresentMessage: "external address",
+		ID:             "",
+	}
+	if tendpoint.Spec.Release != nil {
+		podStatus.ID = tendpoint.Spec.Release.ID
+	}
+	return podStatus
+}
+
 func (r *TEndpointReconciler) updateStatus(tendpoint *tarsV1beta3.TEndpoint) controller.Result {
 	namespace := tendpoint.Namespace
+
+	if tendpoint.Spec.SubType == tarsV1beta3.External {
+		ips := externalIPs(tendpoint.Spec.External)
+		tendpointPodStatuses := make([]*tarsV1beta3.TEndpointPodStatus, 0, len(ips))
+		for _, ip := range ips {
+			tendpointPodStatuses = append(tendpointPodStatuses, r.buildExternalPodStatus(tendpoint, ip))
+		}
+		if equality.Semantic.DeepEqual(tendpointPodStatuses, tendpoint.Status.PodStatus) {
+			return controller.Done
+		}
+		tendpointCopy := tendpoint.DeepCopy()
+		tendpointCopy.Status.PodStatus = tendpointPodStatuses
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TEndpoints(namespace).UpdateStatus(context.TODO(), tendpointCopy, k8sMetaV1.UpdateOptions{})
+		if err != nil {
+			klog.Errorf(tarsMeta.ResourceUpdateError, "tendpoint", namespace, tendpoint.Name, err.Error())
+			return controller.Retry
+		}
+		return controller.Done
+	}
+
 	appRequirement, _ := labels.NewRequirement(tarsMeta.TServerAppLabel, selection.DoubleEquals, []string{tendpoint.Spec.App})
 	serverRequirement, _ := labels.NewRequirement(tarsMeta.TServerNameLabel, selection.DoubleEquals, []string{tendpoint.Spec.Server})
 
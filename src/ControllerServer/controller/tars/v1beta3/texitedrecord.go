@@ -8,11 +8,9 @@ import (
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	patchTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	"k8s.io/utils/integer"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
@@ -22,15 +20,14 @@ import (
 	tarsTool "k8s.tars.io/tool"
 	"strings"
 	"tarscontroller/controller"
-	"time"
 )
 
 type TExitedRecordReconciler struct {
-	teLister tarsListerV1beta3.TExitedRecordLister
-	tsLister tarsListerV1beta3.TServerLister
-	threads  int
-	queue    workqueue.RateLimitingInterface
-	synced   []cache.InformerSynced
+	teLister      tarsListerV1beta3.TExitedRecordLister
+	tsLister      tarsListerV1beta3.TServerLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
 }
 
 func NewTExitedPodController(threads int) *TExitedRecordReconciler {
@@ -38,12 +35,12 @@ func NewTExitedPodController(threads int) *TExitedRecordReconciler {
 	teInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TExitedRecords()
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
 	c := &TExitedRecordReconciler{
-		teLister: teInformer.Lister(),
-		tsLister: tsInformer.Lister(),
-		threads:  threads,
-		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		synced:   []cache.InformerSynced{podInformer.Informer().HasSynced, teInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		teLister:      teInformer.Lister(),
+		tsLister:      tsInformer.Lister(),
+		synced:        []cache.InformerSynced{podInformer.Informer().HasSynced, teInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("texitedrecord-controller"),
 	}
+	c.runner = controller.NewRunner("texitedrecord", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, 0))
 	controller.RegistryInformerEventHandle(tarsMeta.KPodKind, podInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TExitedRecordKind, teInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
@@ -55,11 +52,11 @@ func (r *TExitedRecordReconciler) EnqueueResourceEvent(resourceKind string, reso
 	case *tarsV1beta3.TServer:
 		tserver := resourceObj.(*tarsV1beta3.TServer)
 		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	case *tarsV1beta3.TExitedRecord:
 		texitedRecord := resourceObj.(*tarsV1beta3.TExitedRecord)
 		key := fmt.Sprintf("%s/%s", texitedRecord.Namespace, texitedRecord.Name)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	case *k8sCoreV1.Pod:
 		pod := resourceObj.(*k8sCoreV1.Pod)
 		if pod.DeletionTimestamp != nil && pod.UID != "" && pod.Labels != nil {
@@ -83,7 +80,7 @@ func (r *TExitedRecordReconciler) EnqueueResourceEvent(resourceKind string, reso
 				}
 				bs, _ := json.Marshal(tExitedEvent)
 				key := fmt.Sprintf("%s/event/%s", pod.Namespace, bs)
-				r.queue.Add(key)
+				r.runner.Add(key)
 				return
 			}
 		}
@@ -96,66 +93,16 @@ func (r *TExitedRecordReconciler) splitKey(key string) []string {
 	return strings.Split(key, "/")
 }
 
-func (r *TExitedRecordReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	var res controller.Result
+func (r *TExitedRecordReconciler) reconcile(key string) controller.Result {
 	v := r.splitKey(key)
 	if len(v) == 2 {
-		res = r.reconcileBaseTServer(v[0], v[1])
-	} else {
-		res = r.reconcileBasePod(v[0], v[2])
-	}
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
+		return r.reconcileBaseTServer(v[0], v[1])
 	}
+	return r.reconcileBasePod(v[0], v[2])
 }
 
 func (r *TExitedRecordReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("texitedrecord controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
-
-	<-stopCh
+	r.runner.Run(stopCh, r.synced...)
 }
 
 func (r *TExitedRecordReconciler) reconcileBaseTServer(namespace string, name string) controller.Result {
@@ -190,10 +137,16 @@ func (r *TExitedRecordReconciler) reconcileBaseTServer(namespace string, name st
 		}
 		tExitedRecord = tarsRuntime.TarsTranslator.BuildTExitedRecord(tserver)
 		tExitedPodInterface := tarsRuntime.Clients.CrdClient.TarsV1beta3().TExitedRecords(namespace)
-		if _, err = tExitedPodInterface.Create(context.TODO(), tExitedRecord, k8sMetaV1.CreateOptions{}); err != nil && !errors.IsAlreadyExists(err) {
-			klog.Errorf(tarsMeta.ResourceCreateError, "texitedrecord", namespace, name, err.Error())
+		_, err = tExitedPodInterface.Create(context.TODO(), tExitedRecord, k8sMetaV1.CreateOptions{})
+		if err != nil && !errors.IsAlreadyExists(err) {
+			msg := fmt.Sprintf(tarsMeta.ResourceCreateError, "texitedrecord", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(tserver, k8sCoreV1.EventTypeWarning, tarsMeta.ResourceCreateReason, msg)
 			return controller.Retry
 		}
+		if err == nil {
+			r.eventRecorder.Eventf(tserver, k8sCoreV1.EventTypeNormal, tarsMeta.ResourceCreatedReason, "created texitedrecord %s/%s", namespace, name)
+		}
 		return controller.Done
 	}
 	return controller.Done
@@ -3,15 +3,14 @@ package v1beta3
 import (
 	"context"
 	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
@@ -25,21 +24,23 @@ import (
 
 const reconcileTargetCheckImageBuildOvertime = "CHECK_BUILD_OVERTIME"
 
+const ImageBuildOvertimeReason = "BuildOvertime"
+
 type TImageReconciler struct {
-	tiLister tarsListerV1beta3.TImageLister
-	threads  int
-	queue    workqueue.RateLimitingInterface
-	synced   []cache.InformerSynced
+	tiLister      tarsListerV1beta3.TImageLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
 }
 
 func NewTImageController(threads int) *TImageReconciler {
 	tiInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TImages()
 	c := &TImageReconciler{
-		tiLister: tiInformer.Lister(),
-		threads:  threads,
-		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		synced:   []cache.InformerSynced{tiInformer.Informer().HasSynced},
+		tiLister:      tiInformer.Lister(),
+		synced:        []cache.InformerSynced{tiInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("timage-controller"),
 	}
+	c.runner = controller.NewRunner("timage", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, 0))
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tiInformer.Informer(), c)
 	return c
 }
@@ -57,7 +58,7 @@ func (r *TImageReconciler) EnqueueResourceEvent(resourceKind string, resourceEve
 					maxBuildTime = tfc.ImageBuild.MaxBuildTime
 				}
 				key := fmt.Sprintf("%s/%s/%s/%s", timage.Namespace, timage.Name, reconcileTargetCheckImageBuildOvertime, timage.Build.Running.ID)
-				r.queue.AddAfter(key, time.Duration(maxBuildTime)*time.Second)
+				r.runner.AddAfter(key, time.Duration(maxBuildTime)*time.Second)
 			}
 		}
 	default:
@@ -65,59 +66,8 @@ func (r *TImageReconciler) EnqueueResourceEvent(resourceKind string, resourceEve
 	}
 }
 
-func (r *TImageReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	res := r.reconcile(key)
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *TImageReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("timage controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
-
-	<-stopCh
+	r.runner.Run(stopCh, r.synced...)
 }
 
 func (r *TImageReconciler) splitKey(key string) (namespace, name, target, value string) {
@@ -143,25 +93,27 @@ func (r *TImageReconciler) reconcile(key string) controller.Result {
 		if timage.Build == nil || timage.Build.Running == nil || value != timage.Build.Running.ID {
 			return controller.Done
 		}
-		buildState := tarsV1beta3.TImageBuild{
-			Last: &tarsV1beta3.TImageBuildState{
-				ID:              timage.Build.Running.ID,
-				BaseImage:       timage.Build.Running.BaseImage,
-				BaseImageSecret: timage.Build.Running.BaseImageSecret,
-				Image:           timage.Build.Running.Image,
-				Secret:          timage.Build.Running.Secret,
-				ServerType:      timage.Build.Running.ServerType,
-				CreatePerson:    timage.Build.Running.CreatePerson,
-				CreateTime:      timage.Build.Running.CreateTime,
-				Mark:            timage.Build.Running.Mark,
-				Phase:           "Failed",
-				Message:         "task overtime",
-			},
+		// only replace last and running, builds queued in .build.queue are left to the image server
+		lastState := &tarsV1beta3.TImageBuildState{
+			ID:              timage.Build.Running.ID,
+			BaseImage:       timage.Build.Running.BaseImage,
+			BaseImageSecret: timage.Build.Running.BaseImageSecret,
+			Image:           timage.Build.Running.Image,
+			Secret:          timage.Build.Running.Secret,
+			ServerType:      timage.Build.Running.ServerType,
+			CreatePerson:    timage.Build.Running.CreatePerson,
+			CreateTime:      timage.Build.Running.CreateTime,
+			Mark:            timage.Build.Running.Mark,
+			Phase:           "Failed",
+			Message:         "task overtime",
 		}
 		jsonPatch = append(jsonPatch, tarsTool.JsonPatchItem{
 			OP:    tarsTool.JsonPatchAdd,
-			Path:  "/build",
-			Value: buildState,
+			Path:  "/build/last",
+			Value: lastState,
+		}, tarsTool.JsonPatchItem{
+			OP:   tarsTool.JsonPatchRemove,
+			Path: "/build/running",
 		})
 	}
 
@@ -169,9 +121,14 @@ func (r *TImageReconciler) reconcile(key string) controller.Result {
 		bs, _ := json.Marshal(jsonPatch)
 		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(namespace).Patch(context.TODO(), name, types.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
 		if err != nil {
-			klog.Errorf(err.Error())
+			msg := fmt.Sprintf(tarsMeta.ResourcePatchError, "timage", namespace, name, err.Error())
+			klog.Errorf(msg)
+			r.eventRecorder.Event(timage, k8sCoreV1.EventTypeWarning, tarsMeta.ResourcePatchReason, msg)
 			return controller.Retry
 		}
+		if target == reconcileTargetCheckImageBuildOvertime {
+			r.eventRecorder.Eventf(timage, k8sCoreV1.EventTypeWarning, ImageBuildOvertimeReason, "build task %s overtime, marked as failed", value)
+		}
 	}
 	return controller.Done
 }
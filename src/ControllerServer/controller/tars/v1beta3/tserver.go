@@ -3,86 +3,84 @@ package v1beta3
 import (
 	"context"
 	"fmt"
+	k8sAppsV1 "k8s.io/api/apps/v1"
 	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMeta "k8s.io/apimachinery/pkg/api/meta"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/selection"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
+	k8sAppsListerV1 "k8s.io/client-go/listers/apps/v1"
 	k8sCoreListerV1 "k8s.io/client-go/listers/core/v1"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
 	tarsRuntime "k8s.tars.io/runtime"
+	"sort"
 	"strings"
 	"tarscontroller/controller"
-	"time"
+)
+
+const (
+	TServerWorkloadNotFoundReason = "WorkloadNotFound"
+	TServerRollingUpdateReason    = "RollingUpdate"
+	TServerRolledOutReason        = "RolledOut"
+	TServerReplicasReadyReason    = "ReplicasReady"
+	TServerReplicasNotReadyReason = "ReplicasNotReady"
+	TServerNoReleaseReason        = "NoRelease"
+	TServerPodsActiveReason       = "PodsActive"
+	TServerPodsNotActiveReason    = "PodsNotActive"
+	TServerConfigActivatedReason  = "ConfigActivated"
+	TServerConfigInactiveReason   = "ConfigNotActivated"
+	TServerPodsFailingReason      = "PodsFailing"
+	TServerPodsHealthyReason      = "PodsHealthy"
 )
 
 type TServerReconciler struct {
-	podLister k8sCoreListerV1.PodLister
-	tsLister  tarsListerV1beta3.TServerLister
-	threads   int
-	queue     workqueue.RateLimitingInterface
-	synced    []cache.InformerSynced
+	podLister     k8sCoreListerV1.PodLister
+	stsLister     k8sAppsListerV1.StatefulSetLister
+	dsLister      k8sAppsListerV1.DaemonSetLister
+	tsLister      tarsListerV1beta3.TServerLister
+	teLister      tarsListerV1beta3.TEndpointLister
+	tcLister      cache.GenericLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
 }
 
 func NewTServerController(threads int) *TServerReconciler {
 	podInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Core().V1().Pods()
+	stsInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Apps().V1().StatefulSets()
+	dsInformer := tarsRuntime.Factories.K8SInformerFactoryWithTarsFilter.Apps().V1().DaemonSets()
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
+	teInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TEndpoints()
+	tcInformer := tarsRuntime.Factories.MetadataInformerFactor.ForResource(tarsV1beta3.SchemeGroupVersion.WithResource("tconfigs"))
 	c := &TServerReconciler{
 		podLister: podInformer.Lister(),
+		stsLister: stsInformer.Lister(),
+		dsLister:  dsInformer.Lister(),
 		tsLister:  tsInformer.Lister(),
-		threads:   threads,
-		queue:     workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		synced:    []cache.InformerSynced{tsInformer.Informer().HasSynced},
+		teLister:  teInformer.Lister(),
+		tcLister:  tcInformer.Lister(),
+		synced: []cache.InformerSynced{tsInformer.Informer().HasSynced, stsInformer.Informer().HasSynced, dsInformer.Informer().HasSynced,
+			teInformer.Informer().HasSynced, tcInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("tserver-controller"),
 	}
+	c.runner = controller.NewRunner("tserver", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, 0))
 	controller.RegistryInformerEventHandle(tarsMeta.KPodKind, podInformer.Informer(), c)
+	controller.RegistryInformerEventHandle(tarsMeta.KStatefulSetKind, stsInformer.Informer(), c)
+	controller.RegistryInformerEventHandle(tarsMeta.KDaemonSetKind, dsInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
+	controller.RegistryInformerEventHandle(tarsMeta.TEndpointKind, teInformer.Informer(), c)
+	controller.RegistryInformerEventHandle(tarsMeta.TConfigKind, tcInformer.Informer(), c)
 	return c
 }
 
-func (r *TServerReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	res := r.reconcile(key)
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *TServerReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
 	switch resourceObj.(type) {
 	case *k8sCoreV1.Pod:
@@ -99,30 +97,44 @@ func (r *TServerReconciler) EnqueueResourceEvent(resourceKind string, resourceEv
 			return
 		}
 		key := fmt.Sprintf("%s/%s-%s", pod.Namespace, strings.ToLower(app), strings.ToLower(server))
-		r.queue.Add(key)
+		r.runner.Add(key)
+	case *tarsV1beta3.TServer:
+		tserver := resourceObj.(*tarsV1beta3.TServer)
+		if tserver.Generation != tserver.Status.ObservedGeneration {
+			key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Name)
+			r.runner.Add(key)
+		}
+	case *k8sAppsV1.StatefulSet, *k8sAppsV1.DaemonSet:
+		// the conditions follow the rollout status of workload, enqueue the owner tserver on every change of it
+		metaObj := resourceObj.(k8sMetaV1.Object)
+		owner := k8sMetaV1.GetControllerOf(metaObj)
+		if owner == nil || owner.Kind != tarsMeta.TServerKind {
+			return
+		}
+		key := fmt.Sprintf("%s/%s", metaObj.GetNamespace(), owner.Name)
+		r.runner.Add(key)
+	case *tarsV1beta3.TEndpoint:
+		metaObj := resourceObj.(k8sMetaV1.Object)
+		key := fmt.Sprintf("%s/%s", metaObj.GetNamespace(), metaObj.GetName())
+		r.runner.Add(key)
+	case k8sMetaV1.Object:
+		if resourceKind != tarsMeta.TConfigKind {
+			return
+		}
+		metaObj := resourceObj.(k8sMetaV1.Object)
+		app, server := metaObj.GetLabels()[tarsMeta.TServerAppLabel], metaObj.GetLabels()[tarsMeta.TServerNameLabel]
+		if app == "" || server == "" {
+			return
+		}
+		key := fmt.Sprintf("%s/%s-%s", metaObj.GetNamespace(), strings.ToLower(app), strings.ToLower(server))
+		r.runner.Add(key)
 	default:
 		return
 	}
 }
 
 func (r *TServerReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("tserver controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
-
-	<-stopCh
+	r.runner.Run(stopCh, r.synced...)
 }
 
 func (r *TServerReconciler) reconcile(key string) controller.Result {
@@ -169,17 +181,232 @@ func (r *TServerReconciler) reconcile(key string) controller.Result {
 		}
 	}
 
-	tserverCopy := tserver.DeepCopy()
-	tserverCopy.Status = tarsV1beta3.TServerStatus{
-		Selector:        selector.String(),
-		Replicas:        tserver.Spec.K8S.Replicas,
-		ReadyReplicas:   readySize,
-		CurrentReplicas: currentSize,
+	tendpoint, err := r.teLister.TEndpoints(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceGetError, "tendpoint", namespace, name, err.Error())
+			return controller.Retry
+		}
+		tendpoint = nil
+	}
+
+	replicas := tserver.Spec.K8S.Replicas
+	if tserver.Spec.SubType == tarsV1beta3.External {
+		// external addresses have no pods, take every registered address as one ready replica
+		replicas = int32(len(externalIPs(tserver.Spec.External)))
+		readySize, currentSize = replicas, replicas
+	}
+
+	conditions := make([]k8sMetaV1.Condition, len(tserver.Status.Conditions))
+	copy(conditions, tserver.Status.Conditions)
+
+	desired, progressing, err := r.buildProgressingCondition(tserver)
+	if err != nil {
+		return controller.Retry
+	}
+	k8sMeta.SetStatusCondition(&conditions, progressing)
+	k8sMeta.SetStatusCondition(&conditions, buildAvailableCondition(tserver, desired, readySize))
+	k8sMeta.SetStatusCondition(&conditions, buildReleaseCompleteCondition(tserver, desired, progressing, tendpoint))
+	k8sMeta.SetStatusCondition(&conditions, buildDegradedCondition(tserver, tendpoint))
+
+	configActivated, err := r.buildConfigActivatedCondition(tserver)
+	if err != nil {
+		return controller.Retry
+	}
+	k8sMeta.SetStatusCondition(&conditions, configActivated)
+
+	status := tarsV1beta3.TServerStatus{
+		Selector:           selector.String(),
+		Replicas:           replicas,
+		ReadyReplicas:      readySize,
+		CurrentReplicas:    currentSize,
+		ObservedGeneration: tserver.Generation,
+		Conditions:         conditions,
+		StableRelease:      tserver.Status.StableRelease,
+		Canary:             tserver.Status.Canary,
+	}
+
+	if equality.Semantic.DeepEqual(status, tserver.Status) {
+		return controller.Done
 	}
+
+	tserverCopy := tserver.DeepCopy()
+	tserverCopy.Status = status
 	_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(namespace).UpdateStatus(context.TODO(), tserverCopy, k8sMetaV1.UpdateOptions{})
 	if err != nil {
 		klog.Errorf(tarsMeta.ResourcePatchError, "tserver", namespace, name, err.Error())
 		return controller.Retry
 	}
+	r.recordConditionEvents(tserver, tserver.Status.Conditions, conditions)
 	return controller.Done
 }
+
+// recordConditionEvents emits one event for every condition whose status changed, Degraded=True is reported as warning
+func (r *TServerReconciler) recordConditionEvents(tserver *tarsV1beta3.TServer, current, target []k8sMetaV1.Condition) {
+	for i := range target {
+		condition := &target[i]
+		old := k8sMeta.FindStatusCondition(current, condition.Type)
+		if old != nil && old.Status == condition.Status {
+			continue
+		}
+		eventType := k8sCoreV1.EventTypeNormal
+		if condition.Type == tarsV1beta3.TServerDegraded && condition.Status == k8sMetaV1.ConditionTrue {
+			eventType = k8sCoreV1.EventTypeWarning
+		}
+		r.eventRecorder.Eventf(tserver, eventType, condition.Reason, "%s is %s: %s", condition.Type, condition.Status, condition.Message)
+	}
+}
+
+func buildCondition(tserver *tarsV1beta3.TServer, conditionType string, status bool, reason, message string) k8sMetaV1.Condition {
+	condition := k8sMetaV1.Condition{
+		Type:               conditionType,
+		Status:             k8sMetaV1.ConditionFalse,
+		ObservedGeneration: tserver.Generation,
+		Reason:             reason,
+		Message:            message,
+	}
+	if status {
+		condition.Status = k8sMetaV1.ConditionTrue
+	}
+	return condition
+}
+
+// buildProgressingCondition return the desired replicas of the workload and the Progressing condition
+func (r *TServerReconciler) buildProgressingCondition(tserver *tarsV1beta3.TServer) (int32, k8sMetaV1.Condition, error) {
+	namespace, name := tserver.Namespace, tserver.Name
+
+	if tserver.Spec.SubType == tarsV1beta3.External {
+		desired := int32(len(externalIPs(tserver.Spec.External)))
+		return desired, buildCondition(tserver, tarsV1beta3.TServerProgressing, false, TServerRolledOutReason, "external addresses registered"), nil
+	}
+
+	if tserver.Spec.K8S.DaemonSet {
+		daemonSet, err := r.dsLister.DaemonSets(namespace).Get(name)
+		if err != nil {
+			if !errors.IsNotFound(err) {
+				klog.Errorf(tarsMeta.ResourceGetError, "daemonset", namespace, name, err.Error())
+				return 0, k8sMetaV1.Condition{}, err
+			}
+			return 0, buildCondition(tserver, tarsV1beta3.TServerProgressing, true, TServerWorkloadNotFoundReason, "daemonset not created"), nil
+		}
+		desired := daemonSet.Status.DesiredNumberScheduled
+		if daemonSet.Status.ObservedGeneration < daemonSet.Generation || daemonSet.Status.UpdatedNumberScheduled < desired {
+			msg := fmt.Sprintf("%d/%d pods updated", daemonSet.Status.UpdatedNumberScheduled, desired)
+			return desired, buildCondition(tserver, tarsV1beta3.TServerProgressing, true, TServerRollingUpdateReason, msg), nil
+		}
+		return desired, buildCondition(tserver, tarsV1beta3.TServerProgressing, false, TServerRolledOutReason, "daemonset rolled out"), nil
+	}
+
+	desired := tserver.Spec.K8S.Replicas
+	statefulSet, err := r.stsLister.StatefulSets(namespace).Get(name)
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			klog.Errorf(tarsMeta.ResourceGetError, "statefulset", namespace, name, err.Error())
+			return 0, k8sMetaV1.Condition{}, err
+		}
+		return desired, buildCondition(tserver, tarsV1beta3.TServerProgressing, true, TServerWorkloadNotFoundReason, "statefulset not created"), nil
+	}
+
+	// replicas may be managed by others, eg. HorizontalPodAutoscaler
+	if statefulSet.Spec.Replicas != nil {
+		desired = *statefulSet.Spec.Replicas
+	}
+
+	if statefulSet.Status.ObservedGeneration < statefulSet.Generation || statefulSet.Status.UpdatedReplicas < desired ||
+		statefulSet.Status.CurrentRevision != statefulSet.Status.UpdateRevision || statefulSet.Status.Replicas != desired {
+		msg := fmt.Sprintf("%d/%d pods updated", statefulSet.Status.UpdatedReplicas, desired)
+		return desired, buildCondition(tserver, tarsV1beta3.TServerProgressing, true, TServerRollingUpdateReason, msg), nil
+	}
+	return desired, buildCondition(tserver, tarsV1beta3.TServerProgressing, false, TServerRolledOutReason, "statefulset rolled out"), nil
+}
+
+func buildAvailableCondition(tserver *tarsV1beta3.TServer, desired, ready int32) k8sMetaV1.Condition {
+	msg := fmt.Sprintf("%d/%d pods ready", ready, desired)
+	if ready >= desired {
+		return buildCondition(tserver, tarsV1beta3.TServerAvailable, true, TServerReplicasReadyReason, msg)
+	}
+	return buildCondition(tserver, tarsV1beta3.TServerAvailable, false, TServerReplicasNotReadyReason, msg)
+}
+
+func buildReleaseCompleteCondition(tserver *tarsV1beta3.TServer, desired int32, progressing k8sMetaV1.Condition, tendpoint *tarsV1beta3.TEndpoint) k8sMetaV1.Condition {
+	release := tserver.Spec.Release
+	if release == nil {
+		return buildCondition(tserver, tarsV1beta3.TServerReleaseComplete, false, TServerNoReleaseReason, "no release")
+	}
+
+	if progressing.Status == k8sMetaV1.ConditionTrue {
+		return buildCondition(tserver, tarsV1beta3.TServerReleaseComplete, false, progressing.Reason, progressing.Message)
+	}
+
+	var active int32
+	if tendpoint != nil {
+		for _, podStatus := range tendpoint.Status.PodStatus {
+			if podStatus.ID == release.ID && podStatus.PresentState == "Active" {
+				active++
+			}
+		}
+	}
+
+	msg := fmt.Sprintf("%d/%d pods of release %s active", active, desired, release.ID)
+	if active >= desired {
+		return buildCondition(tserver, tarsV1beta3.TServerReleaseComplete, true, TServerPodsActiveReason, msg)
+	}
+	return buildCondition(tserver, tarsV1beta3.TServerReleaseComplete, false, TServerPodsNotActiveReason, msg)
+}
+
+func buildDegradedCondition(tserver *tarsV1beta3.TServer, tendpoint *tarsV1beta3.TEndpoint) k8sMetaV1.Condition {
+	var failures []string
+	if tendpoint != nil {
+		for _, podStatus := range tendpoint.Status.PodStatus {
+			for _, container := range podStatus.ContainerStatuses {
+				if container.State.Waiting == nil {
+					continue
+				}
+				if _, ok := failedWaitingReasons[container.State.Waiting.Reason]; ok {
+					failures = append(failures, fmt.Sprintf("%s/%s: %s", podStatus.Name, container.Name, container.State.Waiting.Reason))
+				}
+			}
+		}
+	}
+
+	if len(failures) != 0 {
+		return buildCondition(tserver, tarsV1beta3.TServerDegraded, true, TServerPodsFailingReason, strings.Join(failures, ", "))
+	}
+	return buildCondition(tserver, tarsV1beta3.TServerDegraded, false, TServerPodsHealthyReason, "no failing pods")
+}
+
+// buildConfigActivatedCondition check every server level config name has an activated version
+func (r *TServerReconciler) buildConfigActivatedCondition(tserver *tarsV1beta3.TServer) (k8sMetaV1.Condition, error) {
+	appRequirement, _ := labels.NewRequirement(tarsMeta.TServerAppLabel, selection.DoubleEquals, []string{tserver.Spec.App})
+	serverRequirement, _ := labels.NewRequirement(tarsMeta.TServerNameLabel, selection.DoubleEquals, []string{tserver.Spec.Server})
+	podSeqRequirement, _ := labels.NewRequirement(tarsMeta.TConfigPodSeqLabel, selection.DoubleEquals, []string{"m"})
+	deletingRequirement, _ := labels.NewRequirement(tarsMeta.TConfigDeletingLabel, selection.DoesNotExist, nil)
+	labelSelector := labels.NewSelector().Add(*appRequirement).Add(*serverRequirement).Add(*podSeqRequirement).Add(*deletingRequirement)
+
+	tconfigs, err := r.tcLister.ByNamespace(tserver.Namespace).List(labelSelector)
+	if err != nil && !errors.IsNotFound(err) {
+		klog.Errorf(tarsMeta.ResourceSelectorError, tserver.Namespace, "tconfig", err.Error())
+		return k8sMetaV1.Condition{}, err
+	}
+
+	configs := map[string]bool{}
+	for _, tconfig := range tconfigs {
+		tconfigLabels := tconfig.(k8sMetaV1.Object).GetLabels()
+		configName := tconfigLabels[tarsMeta.TConfigNameLabel]
+		configs[configName] = configs[configName] || tconfigLabels[tarsMeta.TConfigActivatedLabel] == "true"
+	}
+
+	var inactivated []string
+	for configName, activated := range configs {
+		if !activated {
+			inactivated = append(inactivated, configName)
+		}
+	}
+
+	if len(inactivated) != 0 {
+		sort.Strings(inactivated)
+		msg := fmt.Sprintf("config %s has no activated version", strings.Join(inactivated, ", "))
+		return buildCondition(tserver, tarsV1beta3.TServerConfigActivated, false, TServerConfigInactiveReason, msg), nil
+	}
+	return buildCondition(tserver, tarsV1beta3.TServerConfigActivated, true, TServerConfigActivatedReason, fmt.Sprintf("%d configs activated", len(configs))), nil
+}
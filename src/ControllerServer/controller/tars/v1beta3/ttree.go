@@ -3,14 +3,13 @@ package v1beta3
 import (
 	"context"
 	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	patchTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
-	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/tools/cache"
-	"k8s.io/client-go/util/workqueue"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/klog/v2"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
@@ -18,95 +17,42 @@ import (
 	tarsRuntime "k8s.tars.io/runtime"
 	tarsTool "k8s.tars.io/tool"
 	"tarscontroller/controller"
-	"time"
 )
 
 type TTreeReconciler struct {
-	trLister tarsListerV1beta3.TTreeLister
-	threads  int
-	queue    workqueue.RateLimitingInterface
-	synced   []cache.InformerSynced
+	trLister      tarsListerV1beta3.TTreeLister
+	runner        *controller.Runner
+	synced        []cache.InformerSynced
+	eventRecorder record.EventRecorder
 }
 
 func NewTTreeController(threads int) *TTreeReconciler {
 	trInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TTrees()
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
 	c := &TTreeReconciler{
-		trLister: trInformer.Lister(),
-		threads:  threads,
-		queue:    workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
-		synced:   []cache.InformerSynced{trInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		trLister:      trInformer.Lister(),
+		synced:        []cache.InformerSynced{trInformer.Informer().HasSynced, tsInformer.Informer().HasSynced},
+		eventRecorder: tarsRuntime.NewEventRecorder("ttree-controller"),
 	}
+	c.runner = controller.NewRunner("ttree", threads, controller.NewRateLimiter(), controller.RequeueAfter(c.reconcile, 0))
 	controller.RegistryInformerEventHandle(tarsMeta.TTreeKind, trInformer.Informer(), c)
 	controller.RegistryInformerEventHandle(tarsMeta.TServerKind, tsInformer.Informer(), c)
 	return c
 }
 
-func (r *TTreeReconciler) processItem() bool {
-
-	obj, shutdown := r.queue.Get()
-
-	if shutdown {
-		return false
-	}
-
-	defer r.queue.Done(obj)
-
-	key, ok := obj.(string)
-	if !ok {
-		klog.Errorf("expected string in workqueue but got %#v", obj)
-		r.queue.Forget(obj)
-		return true
-	}
-
-	res := r.reconcile(key)
-
-	switch res {
-	case controller.Done:
-		r.queue.Forget(obj)
-		return true
-	case controller.Retry:
-		r.queue.AddRateLimited(obj)
-		return true
-	case controller.FatalError:
-		r.queue.ShutDown()
-		return false
-	default:
-		//code should not reach here
-		klog.Errorf("should not reach place")
-		return false
-	}
-}
-
 func (r *TTreeReconciler) EnqueueResourceEvent(resourceKind string, resourceEvent k8sWatchV1.EventType, resourceObj interface{}) {
 	switch resourceObj.(type) {
 	case *tarsV1beta3.TServer:
 		tserver := resourceObj.(*tarsV1beta3.TServer)
 		key := fmt.Sprintf("%s/%s", tserver.Namespace, tserver.Spec.App)
-		r.queue.Add(key)
+		r.runner.Add(key)
 	default:
 		return
 	}
 }
 
 func (r *TTreeReconciler) Run(stopCh chan struct{}) {
-	defer utilRuntime.HandleCrash()
-	defer r.queue.ShutDown()
-
-	if !cache.WaitForNamedCacheSync("ttree controller", stopCh, r.synced...) {
-		return
-	}
-
-	for i := 0; i < r.threads; i++ {
-		worker := func() {
-			for r.processItem() {
-			}
-			r.queue.ShutDown()
-		}
-		go wait.Until(worker, time.Second, stopCh)
-	}
-
-	<-stopCh
+	r.runner.Run(stopCh, r.synced...)
 }
 
 func (r *TTreeReconciler) reconcile(key string) controller.Result {
@@ -147,6 +93,9 @@ func (r *TTreeReconciler) reconcile(key string) controller.Result {
 	patchContent, _ := json.Marshal(jsonPatch)
 	_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TTrees(namespace).Patch(context.TODO(), tarsMeta.FixedTTreeResourceName, patchTypes.JSONPatchType, patchContent, k8sMetaV1.PatchOptions{})
 	if err != nil {
+		msg := fmt.Sprintf(tarsMeta.ResourcePatchError, "ttree", namespace, tarsMeta.FixedTTreeResourceName, err.Error())
+		klog.Errorf(msg)
+		r.eventRecorder.Event(ttree, k8sCoreV1.EventTypeWarning, tarsMeta.ResourcePatchReason, msg)
 		return controller.Retry
 	}
 
@@ -3,12 +3,15 @@ module tarscontroller
 go 1.15
 
 require (
+	github.com/prometheus/client_golang v1.7.0
+	golang.org/x/time v0.0.0-20200630173020-3af7569d3a1e
 	k8s.io/api v0.20.15
 	k8s.io/apimachinery v0.20.15
 	k8s.io/client-go v0.20.15
 	k8s.io/klog/v2 v2.4.0
 	k8s.io/utils v0.0.0-20201110183641-67b214c5f920
 	k8s.tars.io v0.0.1
+	sigs.k8s.io/yaml v1.2.0
 )
 
 replace k8s.tars.io v0.0.1 => ../k8s.tars.io/
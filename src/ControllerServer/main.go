@@ -4,37 +4,113 @@ import (
 	"context"
 	"fmt"
 	"k8s.io/client-go/tools/leaderelection"
+	tarsMeta "k8s.tars.io/meta"
 	tarsRuntime "k8s.tars.io/runtime"
 	"os"
 	"tarscontroller/controller"
 	tarsControllerV1beta3 "tarscontroller/controller/tars/v1beta3"
 )
 
+// registration creates the controller name with the configured workers
+type registration struct {
+	name           string
+	defaultWorkers int
+	create         func(workers int) controller.Controller
+}
+
+// queues are the extra queues of registered controllers, they are tuned by their own entries and disabled with the controller
+var queues = []string{"tconfig-modify", "tconfig-delete"}
+
+var config *controller.Config
+
+var registrations = []registration{
+	{"node", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewNodeController(workers)
+	}},
+	{"daemonset", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewDaemonSetController(workers)
+	}},
+	{"ttree", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewTTreeController(workers)
+	}},
+	{"service", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewServiceController(workers)
+	}},
+	{"endpointslice", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewEndpointSliceController(workers)
+	}},
+	{"poddisruptionbudget", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewPodDisruptionBudgetController(workers)
+	}},
+	{"texitedrecord", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewTExitedPodController(workers)
+	}},
+	{"statefulset", 5, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewStatefulSetController(workers)
+	}},
+	{"tserver", 3, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewTServerController(workers)
+	}},
+	{"autoscaler", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewAutoscalerController(workers)
+	}},
+	{"tendpoint", 3, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewTEndpointController(workers)
+	}},
+	{"taccount", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewTAccountController(workers)
+	}},
+	{"tconfig", 3, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewTConfigController(workers, config.Workers("tconfig-modify", 3), config.Workers("tconfig-delete", 1))
+	}},
+	{"timage", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewTImageController(workers)
+	}},
+	{"persistentvolumeclaim", 1, func(workers int) controller.Controller {
+		return tarsControllerV1beta3.NewPVCController(workers)
+	}},
+}
+
 func main() {
+	var err error
+	config, err = loadConfig()
+	if err != nil {
+		fmt.Println(err.Error())
+		return
+	}
+
+	var names []string
+	for _, r := range registrations {
+		names = append(names, r.name)
+	}
+	if err = config.ValidateControllers(names, queues); err != nil {
+		fmt.Printf("invalid config: %s\n", err.Error())
+		return
+	}
+	config.Apply()
+
 	stopCh := make(chan struct{})
-	err := tarsRuntime.CreateContext("", "", false)
+	tarsRuntime.WrapTransport(controller.WrapAPITransport)
+	err = tarsRuntime.CreateContext("", "", false)
 	if err != nil {
 		fmt.Println(err.Error())
 		return
 	}
 
-	controllers := []controller.Controller{
-		tarsControllerV1beta3.NewNodeController(1),
-		tarsControllerV1beta3.NewDaemonSetController(1),
-		tarsControllerV1beta3.NewTTreeController(1),
-		tarsControllerV1beta3.NewServiceController(1),
-		tarsControllerV1beta3.NewTExitedPodController(1),
-		tarsControllerV1beta3.NewStatefulSetController(5),
-		tarsControllerV1beta3.NewTServerController(3),
-		tarsControllerV1beta3.NewTEndpointController(3),
-		tarsControllerV1beta3.NewTAccountController(1),
-		tarsControllerV1beta3.NewTConfigController(3),
-		tarsControllerV1beta3.NewTImageController(1),
-		tarsControllerV1beta3.NewPVCController(1),
+	var controllers []controller.Controller
+	for _, r := range registrations {
+		if config.Enabled(r.name) {
+			controllers = append(controllers, r.create(config.Workers(r.name, r.defaultWorkers)))
+		}
 	}
 
 	tarsRuntime.Factories.Start(stopCh)
 
+	controller.ServeMetrics(tarsMeta.ControllerMetricsPort, stopCh)
+	go func() {
+		controller.ObserveInformerSynced(tarsRuntime.Factories.WaitForCacheSync(stopCh))
+	}()
+
 	callbacks := leaderelection.LeaderCallbacks{
 		OnStartedLeading: func(ctx context.Context) {
 			for _, c := range controllers {
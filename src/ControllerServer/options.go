@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"tarscontroller/controller"
+	"time"
+)
+
+// loadConfig load the config file given by --config, flags set on the command line override the values of file
+func loadConfig() (*controller.Config, error) {
+	var (
+		configFile         string
+		qps                float64
+		burst              int
+		resync             time.Duration
+		rateLimiterBase    time.Duration
+		rateLimiterMax     time.Duration
+		rateLimiterQPS     float64
+		rateLimiterBurst   int
+		workers            string
+		disableControllers string
+	)
+
+	flag.StringVar(&configFile, "config", "", "path of the yaml config file")
+	flag.Float64Var(&qps, "kube-api-qps", 0, "qps of the clients talking to kube-apiserver")
+	flag.IntVar(&burst, "kube-api-burst", 0, "burst of the clients talking to kube-apiserver")
+	flag.DurationVar(&resync, "resync-period", 0, "period informers replay their caches to controllers, 0 disables it")
+	flag.DurationVar(&rateLimiterBase, "rate-limiter-base-delay", 0, "delay of the first retry of an item")
+	flag.DurationVar(&rateLimiterMax, "rate-limiter-max-delay", 0, "maximum delay of the retries of an item")
+	flag.Float64Var(&rateLimiterQPS, "rate-limiter-qps", 0, "overall qps of a controller queue")
+	flag.IntVar(&rateLimiterBurst, "rate-limiter-burst", 0, "overall burst of a controller queue")
+	flag.StringVar(&workers, "workers", "", "worker count of controllers, e.g. tserver=5,statefulset=10")
+	flag.StringVar(&disableControllers, "disable-controllers", "", "comma separated names of controllers not started")
+	flag.Parse()
+
+	config, err := controller.LoadConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+	if config.Controllers == nil {
+		config.Controllers = map[string]controller.WorkerConfig{}
+	}
+
+	flag.Visit(func(f *flag.Flag) {
+		switch f.Name {
+		case "kube-api-qps":
+			config.QPS = float32(qps)
+		case "kube-api-burst":
+			config.Burst = burst
+		case "resync-period":
+			config.Resync.Duration = resync
+		case "rate-limiter-base-delay":
+			config.RateLimiter.BaseDelay.Duration = rateLimiterBase
+		case "rate-limiter-max-delay":
+			config.RateLimiter.MaxDelay.Duration = rateLimiterMax
+		case "rate-limiter-qps":
+			config.RateLimiter.QPS = rateLimiterQPS
+		case "rate-limiter-burst":
+			config.RateLimiter.Burst = rateLimiterBurst
+		}
+	})
+
+	for _, v := range strings.Split(workers, ",") {
+		if v = strings.TrimSpace(v); v == "" {
+			continue
+		}
+		kv := strings.SplitN(v, "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("unexpected --workers value %q", v)
+		}
+		count, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("unexpected --workers value %q", v)
+		}
+		worker := config.Controllers[kv[0]]
+		worker.Workers = count
+		config.Controllers[kv[0]] = worker
+	}
+
+	for _, name := range strings.Split(disableControllers, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			worker := config.Controllers[name]
+			worker.Disable = true
+			config.Controllers[name] = worker
+		}
+	}
+
+	if err = config.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid config: %s", err.Error())
+	}
+	return config, nil
+}
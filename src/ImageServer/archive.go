@@ -0,0 +1,272 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// securePath return the path name is extracted to, name should not escape dstDir.
+// Entries under an extracted symlink are rejected as well, so links could be checked lexically
+func securePath(dstDir, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return "", fmt.Errorf("entry %s has absolute path", name)
+	}
+	target := filepath.Join(dstDir, name)
+	if target != dstDir && !strings.HasPrefix(target, dstDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("entry %s escapes the server dir", name)
+	}
+	for dir := filepath.Dir(target); dir != dstDir && strings.HasPrefix(dir, dstDir); dir = filepath.Dir(dir) {
+		if info, err := os.Lstat(dir); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			return "", fmt.Errorf("entry %s is under symlink %s", name, dir)
+		}
+	}
+	return target, nil
+}
+
+func inDir(dir, path string) bool {
+	return path == dir || strings.HasPrefix(path, dir+string(filepath.Separator))
+}
+
+// secureLink check the link target of entry at path stays in dstDir.
+// ".." is only allowed at the beginning of link, where it is resolved against the parent of path, which is not under any symlink.
+// After a symlink element, ".." goes up from the link target instead, that could not be checked lexically
+func secureLink(dstDir, path, link string) error {
+	if link == "" || filepath.IsAbs(link) {
+		return fmt.Errorf("link %s points to absolute path %s", path, link)
+	}
+	leading := true
+	for _, element := range strings.Split(filepath.ToSlash(link), "/") {
+		if element != ".." {
+			leading = leading && element == "."
+			continue
+		}
+		if !leading {
+			return fmt.Errorf("link %s has \"..\" in the middle of %s", path, link)
+		}
+	}
+	target := filepath.Join(filepath.Dir(path), link)
+	if !inDir(dstDir, target) {
+		return fmt.Errorf("link %s points outside of the server dir", path)
+	}
+	if resolved, err := filepath.EvalSymlinks(target); err == nil {
+		if root, err := filepath.EvalSymlinks(dstDir); err != nil || !inDir(root, resolved) {
+			return fmt.Errorf("link %s points outside of the server dir", path)
+		}
+	}
+	return nil
+}
+
+// writeEntry write reader to a regular file at path, an existing symlink at path is replaced instead of followed
+func writeEntry(path string, mode os.FileMode, reader io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0766); err != nil {
+		return err
+	}
+	if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+		if err = os.Remove(path); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY|syscall.O_NOFOLLOW, mode.Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, reader)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// handleTarFile extract the gzipped tar sourceFile into dstDir, the top level directory is stripped
+func handleTarFile(sourceFile string, dstDir string) error {
+	f, err := os.Open(sourceFile)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gzipReader, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gzipReader.Close()
+
+	dstDir = filepath.Clean(dstDir)
+	tarReader := tar.NewReader(gzipReader)
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		// same as tar --strip-components=1
+		name := filepath.ToSlash(filepath.Clean(header.Name))
+		if name == ".." || strings.HasPrefix(name, "../") {
+			return fmt.Errorf("entry %s escapes the server dir", header.Name)
+		}
+		i := strings.IndexByte(strings.TrimPrefix(name, "/"), '/')
+		if i == -1 {
+			continue
+		}
+		name = strings.TrimPrefix(name, "/")[i+1:]
+
+		path, err := securePath(dstDir, name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(path, 0766)
+		case tar.TypeReg, tar.TypeRegA:
+			err = writeEntry(path, header.FileInfo().Mode(), tarReader)
+		case tar.TypeSymlink:
+			if err = secureLink(dstDir, path, header.Linkname); err == nil {
+				_ = os.MkdirAll(filepath.Dir(path), 0766)
+				err = os.Symlink(header.Linkname, path)
+			}
+		case tar.TypeLink:
+			// hard link name is relative to archive root, strip it the same way
+			linkname := filepath.ToSlash(filepath.Clean(header.Linkname))
+			if i = strings.IndexByte(strings.TrimPrefix(linkname, "/"), '/'); i == -1 || strings.HasPrefix(linkname, "../") {
+				return fmt.Errorf("link %s points outside of the server dir", header.Name)
+			}
+			var target string
+			if target, err = securePath(dstDir, strings.TrimPrefix(linkname, "/")[i+1:]); err == nil {
+				err = os.Link(target, path)
+			}
+		default:
+			return fmt.Errorf("entry %s has unsupported type %c", header.Name, header.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// archiveDir write dir into the gzipped tar dstFile under its base name, which handleTarFile strips,
+// .git directories are excluded and symlinks are archived as they are
+func archiveDir(dir string, dstFile string) error {
+	f, err := os.OpenFile(dstFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	gzipWriter := gzip.NewWriter(f)
+	tarWriter := tar.NewWriter(gzipWriter)
+	root := filepath.Dir(dir)
+	err = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.Name() == ".git" {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		var link string
+		switch {
+		case info.Mode().IsRegular(), info.IsDir():
+		case info.Mode()&os.ModeSymlink != 0:
+			if link, err = os.Readlink(path); err != nil {
+				return err
+			}
+		default:
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		name, _ := filepath.Rel(root, path)
+		header.Name = filepath.ToSlash(name)
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if err = tarWriter.WriteHeader(header); err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() {
+			return nil
+		}
+
+		reader, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		_, err = io.Copy(tarWriter, reader)
+		return err
+	})
+	if err == nil {
+		err = tarWriter.Close()
+	}
+	if err == nil {
+		err = gzipWriter.Close()
+	}
+	return err
+}
+
+// handleWarFile extract the zip sourceFile into dstDir
+func handleWarFile(sourceFile string, dstDir string) error {
+	zipReader, err := zip.OpenReader(sourceFile)
+	if err != nil {
+		return err
+	}
+	defer zipReader.Close()
+
+	dstDir = filepath.Clean(dstDir)
+	for _, file := range zipReader.File {
+		path, err := securePath(dstDir, file.Name)
+		if err != nil {
+			return err
+		}
+
+		mode := file.Mode()
+		if mode.IsDir() {
+			if err = os.MkdirAll(path, 0766); err != nil {
+				return err
+			}
+			continue
+		}
+
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+
+		if mode&os.ModeSymlink != 0 {
+			var link []byte
+			if link, err = io.ReadAll(io.LimitReader(reader, 4096)); err == nil {
+				if err = secureLink(dstDir, path, string(link)); err == nil {
+					_ = os.MkdirAll(filepath.Dir(path), 0766)
+					err = os.Symlink(string(link), path)
+				}
+			}
+		} else {
+			if mode.Perm() == 0 {
+				mode = 0666
+			}
+			err = writeEntry(path, mode, reader)
+		}
+		_ = reader.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type testArchiveEntry struct {
+	name     string
+	typeflag byte
+	link     string
+	content  string
+}
+
+func writeTestTarFile(t *testing.T, file string, entries []testArchiveEntry) {
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz := gzip.NewWriter(f)
+	writer := tar.NewWriter(gz)
+	for _, entry := range entries {
+		header := &tar.Header{Name: entry.name, Typeflag: entry.typeflag, Linkname: entry.link, Mode: 0755, Size: int64(len(entry.content))}
+		if err = writer.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err = writer.Write([]byte(entry.content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = writer.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err = gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// findTestFile return the paths of files named name in dir
+func findTestFile(dir, name string) []string {
+	var found []string
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Name() == name {
+			found = append(found, path)
+		}
+		return nil
+	})
+	return found
+}
+
+func TestHandleTarFileSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	dstDir := filepath.Join(root, "1", "2", "3", "server")
+	if err := os.MkdirAll(dstDir, 0777); err != nil {
+		t.Fatal(err)
+	}
+
+	// l resolves to the server dir, so L resolves 3 levels above it, though it is inside lexically
+	sourceFile := filepath.Join(root, "server.tgz")
+	writeTestTarFile(t, sourceFile, []testArchiveEntry{
+		{name: "top/", typeflag: tar.TypeDir},
+		{name: "top/a/b/c/", typeflag: tar.TypeDir},
+		{name: "top/a/b/c/l", typeflag: tar.TypeSymlink, link: "../../.."},
+		{name: "top/L", typeflag: tar.TypeSymlink, link: "a/b/c/l/../../../pwned"},
+		{name: "top/L", typeflag: tar.TypeReg, content: "pwned"},
+	})
+
+	if err := handleTarFile(sourceFile, dstDir); err == nil {
+		t.Errorf("archive with escaping symlink should be rejected")
+	}
+	if found := findTestFile(root, "pwned"); len(found) != 0 {
+		t.Errorf("file should not be written outside of the server dir: %v", found)
+	}
+}
+
+func TestHandleTarFile(t *testing.T) {
+	root := t.TempDir()
+	dstDir := filepath.Join(root, "server")
+
+	sourceFile := filepath.Join(root, "server.tgz")
+	writeTestTarFile(t, sourceFile, []testArchiveEntry{
+		{name: "top/", typeflag: tar.TypeDir},
+		{name: "top/lib/libserver.so", typeflag: tar.TypeReg, content: "lib"},
+		{name: "top/bin/libserver.so", typeflag: tar.TypeSymlink, link: "../lib/libserver.so"},
+		{name: "top/bin/HelloServer", typeflag: tar.TypeReg, content: "server"},
+		{name: "top/bin/Hello", typeflag: tar.TypeLink, link: "top/bin/HelloServer"},
+		// a later regular entry replaces the symlink instead of writing its target
+		{name: "top/config", typeflag: tar.TypeSymlink, link: "lib/libserver.so"},
+		{name: "top/config", typeflag: tar.TypeReg, content: "config"},
+	})
+
+	if err := handleTarFile(sourceFile, dstDir); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"bin/libserver.so": "lib",
+		"bin/Hello":        "server",
+		"config":           "config",
+		"lib/libserver.so": "lib",
+	}
+	for name, content := range expected {
+		if bs, err := ioutil.ReadFile(filepath.Join(dstDir, name)); err != nil || string(bs) != content {
+			t.Errorf("%s should be %q, got %q, %v", name, content, bs, err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		entries []testArchiveEntry
+	}{
+		{"absolute link", []testArchiveEntry{{name: "top/l", typeflag: tar.TypeSymlink, link: "/etc/passwd"}}},
+		{"parent link", []testArchiveEntry{{name: "top/l", typeflag: tar.TypeSymlink, link: "../../etc/passwd"}}},
+		{"parent entry", []testArchiveEntry{{name: "../etc/passwd", typeflag: tar.TypeReg, content: "pwned"}}},
+		{"entry under link", []testArchiveEntry{
+			{name: "top/d", typeflag: tar.TypeSymlink, link: "."},
+			{name: "top/d/passwd", typeflag: tar.TypeReg, content: "pwned"},
+		}},
+		{"hard link outside", []testArchiveEntry{{name: "top/l", typeflag: tar.TypeLink, link: "../etc/passwd"}}},
+	}
+	for i, test := range tests {
+		sourceFile = filepath.Join(root, "invalid.tgz")
+		writeTestTarFile(t, sourceFile, test.entries)
+		if err := handleTarFile(sourceFile, filepath.Join(root, "invalid", strings.Repeat("x", i+1))); err == nil {
+			t.Errorf("%s should be rejected", test.name)
+		}
+	}
+}
+
+func TestArchiveDir(t *testing.T) {
+	root := t.TempDir()
+	srcDir := filepath.Join(root, "repository", "server")
+	for name, content := range map[string]string{
+		"bin/HelloServer":  "server",
+		"lib/libserver.so": "lib",
+		".git/config":      "git",
+		"conf/.git":        "gitlink",
+	} {
+		path := filepath.Join(srcDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../lib/libserver.so", filepath.Join(srcDir, "bin", "libserver.so")); err != nil {
+		t.Fatal(err)
+	}
+
+	serverFile := filepath.Join(root, "server.tgz")
+	if err := archiveDir(srcDir, serverFile); err != nil {
+		t.Fatal(err)
+	}
+
+	dstDir := filepath.Join(root, "extracted")
+	if err := handleTarFile(serverFile, dstDir); err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"bin/HelloServer":  "server",
+		"bin/libserver.so": "lib",
+		"lib/libserver.so": "lib",
+	}
+	for name, content := range expected {
+		if bs, err := ioutil.ReadFile(filepath.Join(dstDir, name)); err != nil || string(bs) != content {
+			t.Errorf("%s should be %q, got %q, %v", name, content, bs, err)
+		}
+	}
+	if link, err := os.Readlink(filepath.Join(dstDir, "bin", "libserver.so")); err != nil || link != "../lib/libserver.so" {
+		t.Errorf("bin/libserver.so should be kept as symlink, got %q, %v", link, err)
+	}
+	if found := findTestFile(dstDir, ".git"); len(found) != 0 {
+		t.Errorf(".git should be excluded, got %v", found)
+	}
+}
+
+func TestHandleWarFileSymlinkEscape(t *testing.T) {
+	root := t.TempDir()
+	dstDir := filepath.Join(root, "server")
+
+	sourceFile := filepath.Join(root, "server.war")
+	f, err := os.Create(sourceFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := zip.NewWriter(f)
+	header := &zip.FileHeader{Name: "WEB-INF/l"}
+	header.SetMode(os.ModeSymlink | 0777)
+	w, _ := writer.CreateHeader(header)
+	_, _ = w.Write([]byte("../lib/../../pwned"))
+	_ = writer.Close()
+	_ = f.Close()
+
+	if err = handleWarFile(sourceFile, dstDir); err == nil {
+		t.Errorf("war with escaping symlink should be rejected")
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var errUnauthenticated = fmt.Errorf("missing or invalid bearer token")
+
+var errUnauthorized = fmt.Errorf("permission denied")
+
+// roles of TAccount authorization which could build or cancel images of an app
+var buildRoles = map[string]interface{}{
+	AdminRole:     nil,
+	DeveloperRole: nil,
+}
+
+// roles of TAccount authorization which could read build status and log of an app
+var viewRoles = map[string]interface{}{
+	AdminRole:     nil,
+	OperatorRole:  nil,
+	DeveloperRole: nil,
+}
+
+type Authenticator struct {
+	enabled  bool
+	taLister tarsListerV1beta3.TAccountLister
+	synced   cache.InformerSynced
+}
+
+// NewAuthenticator should be called before the informer factories start
+func NewAuthenticator(enabled bool) *Authenticator {
+	a := &Authenticator{enabled: enabled}
+	if enabled {
+		taInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TAccounts()
+		a.taLister = taInformer.Lister()
+		a.synced = taInformer.Informer().HasSynced
+	}
+	return a
+}
+
+// Authenticate find the activated TAccount owning the valid and unexpired bearer token of r,
+// return nil account if authentication is disabled
+func (a *Authenticator) Authenticate(r *http.Request) (*tarsV1beta3.TAccount, error) {
+	if !a.enabled {
+		return nil, nil
+	}
+
+	token := r.Header.Get("Authorization")
+	if len(token) <= len(BearerPrefix) || !strings.EqualFold(token[:len(BearerPrefix)], BearerPrefix) {
+		return nil, errUnauthenticated
+	}
+	token = strings.TrimSpace(token[len(BearerPrefix):])
+
+	if !a.synced() {
+		return nil, fmt.Errorf("taccount cache not synced, retry later")
+	}
+
+	taccounts, err := a.taLister.TAccounts(tarsRuntime.Namespace).List(labels.Everything())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for _, taccount := range taccounts {
+		if !taccount.Spec.Authentication.Activated {
+			continue
+		}
+		for _, t := range taccount.Spec.Authentication.Tokens {
+			if t == nil || !t.Valid || !t.ExpirationTime.Time.After(now) {
+				continue
+			}
+			if subtle.ConstantTimeCompare([]byte(t.Content), []byte(token)) == 1 {
+				return taccount, nil
+			}
+		}
+	}
+	return nil, errUnauthenticated
+}
+
+// Authorize check taccount has one of roles on server app.name, flag of the authorization is "*", app or app.server
+func (a *Authenticator) Authorize(taccount *tarsV1beta3.TAccount, app, server string, roles map[string]interface{}) error {
+	if !a.enabled {
+		return nil
+	}
+
+	for _, authorization := range taccount.Spec.Authorization {
+		if authorization == nil {
+			continue
+		}
+		if _, ok := roles[authorization.Role]; !ok {
+			continue
+		}
+		switch authorization.Flag {
+		case "*":
+			return nil
+		case "":
+			continue
+		case app, fmt.Sprintf("%s.%s", app, server):
+			if app != "" {
+				return nil
+			}
+		}
+	}
+	return fmt.Errorf("%w, %s has no %s role on %s.%s", errUnauthorized, taccount.Spec.Username, roleNames(roles), app, server)
+}
+
+// AuthorizeTImage check taccount has one of roles on the server of timage, which is recorded in timage labels.
+// The authorized timage is returned, it is nil if authentication is disabled
+func (a *Authenticator) AuthorizeTImage(taccount *tarsV1beta3.TAccount, timageName string, roles map[string]interface{}) (*tarsV1beta3.TImage, error) {
+	if !a.enabled {
+		return nil, nil
+	}
+
+	timage, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Get(context.TODO(), timageName, k8sMetaV1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if err = a.AuthorizeTImageOwner(taccount, timage, roles); err != nil {
+		return nil, err
+	}
+	return timage, nil
+}
+
+// AuthorizeTImageOwner check taccount has one of roles on the server recorded in labels of timage, which may be of another namespace
+func (a *Authenticator) AuthorizeTImageOwner(taccount *tarsV1beta3.TAccount, timage *tarsV1beta3.TImage, roles map[string]interface{}) error {
+	if !a.enabled {
+		return nil
+	}
+
+	app, server := timage.Labels[tarsMeta.TServerAppLabel], timage.Labels[tarsMeta.TServerNameLabel]
+	if err := a.Authorize(taccount, app, server, roles); err != nil {
+		if app == "" {
+			return fmt.Errorf("%w, timage %s/%s belongs to no server, only taccount with * flag could access it", errUnauthorized, timage.Namespace, timage.Name)
+		}
+		return err
+	}
+	return nil
+}
+
+// checkTImageOwner check the server of build request is the one owns timage, so images of other servers are not overwritten
+func checkTImageOwner(timage *tarsV1beta3.TImage, app, server string) error {
+	owner := timage.Labels[tarsMeta.TServerAppLabel]
+	if owner != "" && !strings.EqualFold(owner, app) {
+		return newValidationError("serverApp", "owner", "timage %s belongs to app %s", timage.Name, owner)
+	}
+	owner = timage.Labels[tarsMeta.TServerNameLabel]
+	if owner != "" && !strings.EqualFold(owner, server) {
+		return newValidationError("serverName", "owner", "timage %s belongs to server %s", timage.Name, owner)
+	}
+	return nil
+}
+
+// labelTImageOwners label the server timages created before the webhook labels owners, with the app and server of the same named tserver
+func labelTImageOwners() {
+	timages, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
+	if err != nil {
+		log.Printf("list timages failed: %s\n", err.Error())
+		return
+	}
+
+	for i := range timages.Items {
+		timage := &timages.Items[i]
+		if timage.ImageType != TImageTypeServer || timage.Labels[tarsMeta.TServerAppLabel] != "" {
+			continue
+		}
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(tarsRuntime.Namespace).Get(context.TODO(), timage.Name, k8sMetaV1.GetOptions{})
+		if err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				log.Printf("get tserver %s failed: %s\n", timage.Name, err.Error())
+			}
+			continue
+		}
+		patch := map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": map[string]string{
+					tarsMeta.TServerAppLabel:  tserver.Spec.App,
+					tarsMeta.TServerNameLabel: tserver.Spec.Server,
+				},
+			},
+		}
+		bs, _ := json.Marshal(patch)
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Patch(context.TODO(), timage.Name, types.MergePatchType, bs, k8sMetaV1.PatchOptions{})
+		if err != nil {
+			log.Printf("label owner of timage %s failed: %s\n", timage.Name, err.Error())
+		}
+	}
+}
+
+// authErrorStatus map errors of Authenticate and Authorize to http status
+func authErrorStatus(writer http.ResponseWriter, err error) int {
+	switch {
+	case err == errUnauthenticated:
+		writer.Header().Set("WWW-Authenticate", `Bearer realm="tarsimage"`)
+		return http.StatusUnauthorized
+	case errors.Is(err, errUnauthorized):
+		return http.StatusForbidden
+	}
+	return taskErrorStatus(err)
+}
+
+func roleNames(roles map[string]interface{}) string {
+	names := make([]string, 0, len(roles))
+	for _, name := range []string{AdminRole, OperatorRole, DeveloperRole} {
+		if _, ok := roles[name]; ok {
+			names = append(names, name)
+		}
+	}
+	return strings.Join(names, "/")
+}
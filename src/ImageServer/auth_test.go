@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAuthorizeTImage(t *testing.T) {
+	setupTestEnv(t)
+	createTestTImage(t, newTestServerTImage("test-helloserver", "Test", "HelloServer"))
+	createTestTImage(t, newTestTImage("tars-cppbase", nil))
+
+	alice := newTestTAccount("alice", "alice-token", "Test", DeveloperRole)
+	bob := newTestTAccount("bob", "bob-token", "Other.HelloServer", AdminRole)
+	admin := newTestTAccount("admin", "admin-token", "*", AdminRole)
+	operator := newTestTAccount("carol", "carol-token", "Test.HelloServer", OperatorRole)
+	authenticator := newTestAuthenticator(t, alice, bob, admin, operator)
+
+	tests := []struct {
+		taccount *tarsV1beta3.TAccount
+		timage   string
+		roles    map[string]interface{}
+		err      error
+	}{
+		{alice, "test-helloserver", buildRoles, nil},
+		{bob, "test-helloserver", buildRoles, errUnauthorized},
+		{admin, "test-helloserver", buildRoles, nil},
+		{operator, "test-helloserver", viewRoles, nil},
+		{operator, "test-helloserver", buildRoles, errUnauthorized},
+		{alice, "tars-cppbase", viewRoles, errUnauthorized},
+		{admin, "tars-cppbase", buildRoles, nil},
+	}
+	for _, test := range tests {
+		timage, err := authenticator.AuthorizeTImage(test.taccount, test.timage, test.roles)
+		if !errors.Is(err, test.err) {
+			t.Errorf("%s on %s: error = %v, want %v", test.taccount.Name, test.timage, err, test.err)
+		}
+		if err == nil && (timage == nil || timage.Name != test.timage) {
+			t.Errorf("%s on %s: authorized timage should be returned", test.taccount.Name, test.timage)
+		}
+	}
+}
+
+func TestBuildAuthorizedByTImage(t *testing.T) {
+	setupTestEnv(t)
+	glEngine = NewEngine()
+	glAuthenticator = newTestAuthenticator(t,
+		newTestTAccount("alice", "alice-token", "Test", DeveloperRole),
+		newTestTAccount("bob", "bob-token", "Other", DeveloperRole),
+	)
+	createTestTImage(t, newTestServerTImage("test-helloserver", "Test", "HelloServer"))
+
+	server := httptest.NewServer((&RestfulServer{requestTimeout: RequestTimeout}).newRouter())
+	defer server.Close()
+
+	tests := []struct {
+		token  string
+		app    string
+		status int
+	}{
+		// the server of request is not the one authorized
+		{"bob-token", "Other", http.StatusForbidden},
+		// the image of other server should not be built by the timage
+		{"alice-token", "Other", http.StatusBadRequest},
+	}
+	for _, test := range tests {
+		body := fmt.Sprintf(`{"serverApp":%q,"serverName":"HelloServer","serverType":"cpp","baseImage":"tarscloud/tars.cppbase",
+			"source":{"url":{"url":"https://127.0.0.1/HelloServer.tgz","sha256":"%s"}}}`, test.app, strings.Repeat("0", 64))
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1beta3/timage/test-helloserver/building", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Authorization", BearerPrefix+test.token)
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = response.Body.Close()
+		if response.StatusCode != test.status {
+			t.Errorf("build %s.HelloServer with %s should get %d, got %d", test.app, test.token, test.status, response.StatusCode)
+		}
+	}
+}
+
+func TestLabelTImageOwners(t *testing.T) {
+	setupTestEnv(t)
+	createTestTImage(t, newTestTImage("test-helloserver", nil))
+	createTestTImage(t, newTestTImage("test-removedserver", nil))
+	tserver := &tarsV1beta3.TServer{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: "test-helloserver", Namespace: testNamespace},
+		Spec: tarsV1beta3.TServerSpec{
+			App:    "Test",
+			Server: "HelloServer",
+			K8S:    tarsV1beta3.TServerK8S{ImagePullPolicy: k8sCoreV1.PullAlways},
+		},
+	}
+	if _, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(testNamespace).Create(context.TODO(), tserver, k8sMetaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	labelTImageOwners()
+
+	timage := getTestTImage(t, "test-helloserver")
+	if timage.Labels[tarsMeta.TServerAppLabel] != "Test" || timage.Labels[tarsMeta.TServerNameLabel] != "HelloServer" {
+		t.Errorf("timage should be labelled with its tserver, got %v", timage.Labels)
+	}
+	if timage = getTestTImage(t, "test-removedserver"); len(timage.Labels) != 0 {
+		t.Errorf("timage without tserver should not be labelled, got %v", timage.Labels)
+	}
+}
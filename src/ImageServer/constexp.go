@@ -6,9 +6,51 @@ const UploadDir = "/upload"
 const BuildDir = "/build"
 const CacheDir = "/cache"
 
-const AutoDeleteServerFileDuration = time.Minute * 60
 const AutoDeleteServerBuildDirDuration = time.Minute * 60
 const MaximumConcurrencyBuildTask = 5
+const ScheduleInterval = time.Second * 5
+const LogPollInterval = time.Second * 1
+const BuilderPodRetainDuration = time.Minute * 15
+
+const HandlerLeasePrefix = "tarsimage-handler-"
+const HandlerLeaseDuration = time.Second * 30
+const HandlerLeaseRenewInterval = time.Second * 10
+const HandlerAbandonDuration = time.Minute * 5
+const FailoverInterval = time.Second * 15
+
+const SourceResolveTimeout = time.Minute * 1
+const SourceFetchTimeout = time.Minute * 10
+const SourceSizeCheckInterval = time.Second * 1
+
+// MaxGitCloneSize is the max size of a cloned git source repository, including its history
+const MaxGitCloneSize = 1024 * 1024 * 1024
+const MaxJsonRequestSize = 1024 * 1024
+
+// RequestTimeout limit the handling of api requests, except the log streaming
+const RequestTimeout = time.Second * 600
+
+// DefaultMaxUploadSize is the max multipart request size in MiB, override by env MaxUploadSize
+const DefaultMaxUploadSize = 150
+
+// MultipartMemorySize is the max part of multipart request kept in memory, the rest is stored in temporary files
+const MultipartMemorySize = 32 * 1024 * 1024
+
+const BearerPrefix = "Bearer "
+
+const RegistryRequestTimeout = time.Second * 30
+const RetentionQueueSize = 256
+const MaxManifestSize = 4 * 1024 * 1024
+const RetentionReason = "RegistryRetention"
+
+const (
+	AdminRole     = "admin"
+	OperatorRole  = "operator"
+	DeveloperRole = "developer"
+)
+
+const BuilderCancelledAnnotation = "tars.io/BuildCancelled"
+
+const TaskRecordFileSuffix = ".task.json"
 
 const (
 	ServerAppFormKey    = "ServerApp"
@@ -21,8 +63,13 @@ const (
 	BaseImageFormKey       = "BaseImage"
 	BaseImageSecretFormKey = "BaseImageSecret"
 
-	CreatePersonFormKey = "CreatePerson"
-	MarkFormKey         = "Mark"
+	CreatePersonFormKey     = "CreatePerson"
+	MarkFormKey             = "Mark"
+	GitShaFormKey           = "GitSha"
+	PriorityFormKey         = "Priority"
+	DockerfileFormKey       = "Dockerfile"
+	BuildArgFormKey         = "BuildArg"
+	ServerFileSha256FormKey = "ServerFileSha256"
 )
 
 const (
@@ -46,6 +93,7 @@ const (
 )
 
 const (
+	BuildPhaseQueued          = "Queued"
 	BuildPhasePending         = "Pending"
 	BuildPhasePreparing       = "Preparing"
 	BuildPhaseSubmitting      = "Submitting"
@@ -53,6 +101,7 @@ const (
 	BuildPhasePreparePushing  = "Pushing"
 	BuildPhaseFailed          = "Failed"
 	BuildPhaseDone            = "Done"
+	BuildPhaseCancelled       = "Cancelled"
 )
 
 const (
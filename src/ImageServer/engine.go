@@ -6,8 +6,8 @@ import (
 	"fmt"
 	"io/ioutil"
 	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/types"
 	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
@@ -15,9 +15,9 @@ import (
 	tarsTool "k8s.tars.io/tool"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,13 +26,20 @@ type TaskUserParams struct {
 	ServerApp       string `json:"serverApp" validate:"required,hostname_rfc1123"`
 	ServerName      string `json:"serverName" validate:"required,hostname_rfc1123"`
 	ServerType      string `json:"serverType" validate:"required,oneof=cpp java-jar java-war nodejs go php python"`
-	ServerTag       string `json:"serverTag" validate:"hostname_rfc1123"`
+	ServerTag       string `json:"serverTag" validate:"omitempty,image_tag"`
 	ServerFile      string `json:"serverFile"`
-	Secret          string `json:"secret" validate:"required,hostname_rfc1123"`
-	BaseImage       string `json:"baseImage" validate:"required,hostname_rfc1123"`
-	BaseImageSecret string `json:"baseImageSecret" validate:"required,hostname_rfc1123"`
-	CreatePerson    string `json:"createPerson"`
-	Mark            string `json:"mark"`
+	Secret          string `json:"secret" validate:"omitempty,hostname_rfc1123"`
+	BaseImage       string `json:"baseImage" validate:"required,image_reference,max=500"`
+	BaseImageSecret string `json:"baseImageSecret" validate:"omitempty,hostname_rfc1123"`
+	CreatePerson    string `json:"createPerson" validate:"max=800"`
+	Mark            string `json:"mark" validate:"max=1600"`
+	GitSha          string `json:"gitSha" validate:"omitempty,max=64"`
+	Priority        int32  `json:"priority"`
+	// Source is set by json build request instead of uploading ServerFile
+	Source *BuildSource `json:"source,omitempty"`
+	// Dockerfile and BuildArgs are merged after the ones of timage
+	Dockerfile string            `json:"dockerfile,omitempty"`
+	BuildArgs  map[string]string `json:"buildArgs,omitempty"`
 }
 
 type TaskPaths struct {
@@ -72,10 +79,22 @@ type Task struct {
 	registrySecret        string
 	executorImage         string
 	executorSecret        string
+	queued                bool
+	cancelled             bool
+	buildArgs             map[string]string
 }
 
 type Engine struct {
 	buildChan chan *Task
+	wakeChan  chan struct{}
+	threads   int
+
+	// postMutex serialize PostTask, so semver of queued tasks are generated in order
+	postMutex sync.Mutex
+
+	mutex    sync.Mutex
+	tasks    map[string]*Task  // tasks posted to this handler and not finished, keyed by id
+	building map[string]string // timage name to id of task this handler is building
 }
 
 func setup(task *Task) {
@@ -136,15 +155,62 @@ func prepare(task *Task) error {
 		return err
 	}
 
-	dockerFileContent := fmt.Sprintf("FROM %s\nENV ServerType=%s\nCOPY root /\n", task.userParams.BaseImage, task.userParams.ServerType)
+	dockerFileContent, err := generateDockerfile(task)
+	if err != nil {
+		return err
+	}
 	if err = ioutil.WriteFile(task.paths.dockerfileInPod, []byte(dockerFileContent), 0666); err != nil {
 		err = fmt.Errorf("create dockerfile(%s) error: %s", task.paths.dockerfileInPod, err.Error())
 		return err
 	}
+	task.taskBuildRunningState.Dockerfile = dockerFileContent
 
 	return nil
 }
 
+// generateDockerfile merge dockerfile fragment and build args of timage and task into the fixed server Dockerfile,
+// build args of task override the ones of timage
+func generateDockerfile(task *Task) (string, error) {
+	var fragments []string
+	task.buildArgs = map[string]string{}
+
+	if dockerfile := task.timage.Dockerfile; dockerfile != nil {
+		lines, err := tarsTool.ParseDockerfileFragment(dockerfile.Fragment)
+		if err != nil {
+			return "", fmt.Errorf("invalid dockerfile fragment of timage: %s", err.Error())
+		}
+		fragments = append(fragments, lines...)
+		for name, value := range dockerfile.BuildArgs {
+			task.buildArgs[name] = value
+		}
+	}
+
+	lines, err := tarsTool.ParseDockerfileFragment(task.userParams.Dockerfile)
+	if err != nil {
+		return "", fmt.Errorf("invalid dockerfile fragment: %s", err.Error())
+	}
+	fragments = append(fragments, lines...)
+	for name, value := range task.userParams.BuildArgs {
+		task.buildArgs[name] = value
+	}
+
+	if err = tarsTool.ValidBuildArgs(task.buildArgs); err != nil {
+		return "", err
+	}
+
+	var builder strings.Builder
+	builder.WriteString(fmt.Sprintf("FROM %s\n", task.userParams.BaseImage))
+	for _, name := range tarsTool.SortedBuildArgNames(task.buildArgs) {
+		builder.WriteString(fmt.Sprintf("ARG %s\n", name))
+	}
+	builder.WriteString(fmt.Sprintf("ENV ServerType=%s\nCOPY root /\n", task.userParams.ServerType))
+	for _, line := range fragments {
+		builder.WriteString(line)
+		builder.WriteString("\n")
+	}
+	return builder.String(), nil
+}
+
 func secret(task *Task) error {
 	log.Printf("task|%s: decrypting...\n", task.id)
 	if err := os.Mkdir(task.paths.dockerConfDirInPod, 0777); err != nil {
@@ -220,9 +286,23 @@ func secret(task *Task) error {
 
 func submit(task *Task) error {
 	log.Printf("task|%s: submitting...\n", task.id)
-	task.kanikoPodName = fmt.Sprintf("timage-builder-%s", task.id)
+	task.kanikoPodName = builderPodName(task.id)
+
+	args := []string{
+		fmt.Sprintf("--timage=%s", task.userParams.Timage),
+		fmt.Sprintf("--id=%s", task.id),
+		fmt.Sprintf("--dockerfile=%s", task.paths.dockerfileInKaniko),
+		fmt.Sprintf("--context=dir:/%s", task.paths.buildDirInKaniko),
+		fmt.Sprintf("--destination=%s", task.image),
+		fmt.Sprintf("--skip-tls-verify=%t", glRegistry.Insecure(task.image)),
+	}
+	for _, name := range tarsTool.SortedBuildArgNames(task.buildArgs) {
+		args = append(args, fmt.Sprintf("--build-arg=%s=%s", name, task.buildArgs[name]))
+	}
 
 	hostPathDirectory := k8sCoreV1.HostPathDirectoryOrCreate
+	automountServiceAccountToken := false
+
 	podLayout := &k8sCoreV1.Pod{
 		ObjectMeta: k8sMetaV1.ObjectMeta{
 			Name:      task.kanikoPodName,
@@ -239,13 +319,7 @@ func submit(task *Task) error {
 					Name:            "kaniko",
 					Image:           task.executorImage,
 					ImagePullPolicy: k8sCoreV1.PullAlways,
-					Args: []string{
-						fmt.Sprintf("--timage=%s", task.userParams.Timage),
-						fmt.Sprintf("--id=%s", task.id),
-						fmt.Sprintf("--dockerfile=%s", task.paths.dockerfileInKaniko),
-						fmt.Sprintf("--context=dir:/%s", task.paths.buildDirInKaniko),
-						fmt.Sprintf("--destination=%s", task.image),
-					},
+					Args:            args,
 					VolumeMounts: []k8sCoreV1.VolumeMount{
 						{
 							Name:      "kaniko-workdir",
@@ -301,6 +375,8 @@ func submit(task *Task) error {
 				},
 			}},
 			ServiceAccountName: "tars-tarsimage",
+			// kaniko never calls kubernetes api, the token of tars-tarsimage should not be exposed to the build
+			AutomountServiceAccountToken: &automountServiceAccountToken,
 		},
 	}
 
@@ -319,100 +395,132 @@ func submit(task *Task) error {
 	}
 
 	go func() {
-		time.Sleep(time.Minute * 15)
+		time.Sleep(BuilderPodRetainDuration)
 		_ = tarsRuntime.Clients.K8sClient.CoreV1().Pods(tarsRuntime.Namespace).Delete(context.TODO(), task.kanikoPodName, k8sMetaV1.DeleteOptions{})
 	}()
 
 	return nil
 }
 
-func watch(task *Task) error {
-	log.Printf("task|%s: watching...\n", task.id)
+// podFinished return whether the kaniko pod finished, and the error if it failed
+func podFinished(task *Task, podSnap *k8sCoreV1.Pod) (bool, error) {
+	switch podSnap.Status.Phase {
+	case k8sCoreV1.PodPending:
+		log.Printf("task|%s: pod|%s pending\n", task.id, task.kanikoPodName)
+	case k8sCoreV1.PodRunning:
+		log.Printf("task|%s: pod|%s running\n", task.id, task.kanikoPodName)
+	case k8sCoreV1.PodFailed:
+		var exitMessage = "failed but unknown state"
+		if len(podSnap.Status.ContainerStatuses) > 0 && podSnap.Status.ContainerStatuses[0].State.Terminated != nil {
+			exitMessage = podSnap.Status.ContainerStatuses[0].State.Terminated.Message
+		}
+		message := fmt.Sprintf("pod|%s %s", task.kanikoPodName, exitMessage)
+		log.Printf("task|%s: %s\n", task.id, message)
+		return true, fmt.Errorf(exitMessage)
+	case k8sCoreV1.PodSucceeded:
+		log.Printf("task|%s: pod|%s success\n", task.id, task.kanikoPodName)
+		return true, nil
+	}
+	return false, nil
+}
+
+// watchPod watch the kaniko pod from resourceVersion, and return false if the watch closed before the pod finished
+func watchPod(task *Task, resourceVersion string) (bool, error) {
 	watchInterface, err := tarsRuntime.Clients.K8sClient.CoreV1().Pods(tarsRuntime.Namespace).Watch(context.TODO(), k8sMetaV1.ListOptions{
-		FieldSelector: fmt.Sprintf("metadata.name=%s", task.kanikoPodName),
-		Watch:         true,
+		FieldSelector:   fmt.Sprintf("metadata.name=%s", task.kanikoPodName),
+		Watch:           true,
+		ResourceVersion: resourceVersion,
 	})
 
 	if err != nil {
-		return err
+		return true, err
 	}
+	defer watchInterface.Stop()
 
-	for {
-		event, ok := <-watchInterface.ResultChan()
-		if !ok {
-			return nil
-		}
+	for event := range watchInterface.ResultChan() {
 		switch event.Type {
-		case k8sWatchV1.Added, k8sWatchV1.Bookmark:
+		case k8sWatchV1.Bookmark:
 			continue
 		case k8sWatchV1.Error:
 			errSnap := event.Object.(*k8sMetaV1.Status)
 			err = fmt.Errorf("pod|%s failed: %s\n", task.kanikoPodName, errSnap.Message)
-			return err
+			return true, err
 		case k8sWatchV1.Deleted:
-			err = fmt.Errorf("pod|%s deleted: %s\n", task.kanikoPodName, "unknown reason")
-			return err
-		case k8sWatchV1.Modified:
 			podSnap := event.Object.(*k8sCoreV1.Pod)
-			switch podSnap.Status.Phase {
-			case k8sCoreV1.PodPending:
-				log.Printf("task|%s: pod|%s pending\n", task.id, task.kanikoPodName)
-				continue
-			case k8sCoreV1.PodRunning:
-				log.Printf("task|%s: pod|%s running\n", task.id, task.kanikoPodName)
-				continue
-			case k8sCoreV1.PodFailed:
-				var exitMessage = "failed but unknown state"
-				if podSnap.Status.ContainerStatuses[0].State.Terminated != nil {
-					exitMessage = podSnap.Status.ContainerStatuses[0].State.Terminated.Message
-				}
-				message := fmt.Sprintf("pod|%s %s", task.kanikoPodName, exitMessage)
-				log.Printf("task|%s: %s\n", task.id, message)
-				err = fmt.Errorf(exitMessage)
-				return err
-			case k8sCoreV1.PodSucceeded:
-				log.Printf("task|%s: pod|%s success\n", task.id, task.kanikoPodName)
-				return nil
+			if _, ok := podSnap.Annotations[BuilderCancelledAnnotation]; ok {
+				return true, errTaskCancelled
+			}
+			err = fmt.Errorf("pod|%s deleted: %s\n", task.kanikoPodName, "unknown reason")
+			return true, err
+		case k8sWatchV1.Added, k8sWatchV1.Modified:
+			if finished, err := podFinished(task, event.Object.(*k8sCoreV1.Pod)); finished {
+				return true, err
 			}
 		}
 	}
+	return false, nil
 }
 
-func handleTarFile(sourceFile string, dstDir string) error {
-	cmd := exec.Command("tar", "zxvf", sourceFile, "--strip-components=1", "-C", dstDir)
-	err := cmd.Run()
-	if err != nil {
-		fmt.Print(err.Error())
+func watch(task *Task) error {
+	log.Printf("task|%s: watching...\n", task.id)
+	for {
+		// the pod may have finished before watching, or the watch closed by apiserver before the pod finished,
+		// so the pod is checked before every watch, which starts from the version checked
+		podSnap, err := tarsRuntime.Clients.K8sClient.CoreV1().Pods(tarsRuntime.Namespace).Get(context.TODO(), task.kanikoPodName, k8sMetaV1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				err = fmt.Errorf("pod|%s deleted: %s\n", task.kanikoPodName, "unknown reason")
+			}
+			return err
+		}
+		if _, ok := podSnap.Annotations[BuilderCancelledAnnotation]; ok {
+			return errTaskCancelled
+		}
+		if finished, err := podFinished(task, podSnap); finished {
+			return err
+		}
+
+		if finished, err := watchPod(task, podSnap.ResourceVersion); finished {
+			return err
+		}
+		log.Printf("task|%s: watch closed, rewatching...\n", task.id)
 	}
-	return nil
 }
 
-func handleWarFile(sourceFile string, dstDir string) error {
-	cmd := exec.Command("unzip", sourceFile, "-d", dstDir)
-	err := cmd.Run()
-	if err != nil {
-		fmt.Print(err.Error())
-	}
-	return nil
+func builderPodName(id string) string {
+	return fmt.Sprintf("timage-builder-%s", id)
 }
 
 func NewEngine() *Engine {
 	worker := &Engine{
-		buildChan: make(chan *Task),
+		wakeChan: make(chan struct{}, 1),
+		tasks:    map[string]*Task{},
+		building: map[string]string{},
 	}
 	return worker
 }
 
 func pushBuildRunningState(task *Task) error {
-	task.timage.Build.Running = &task.taskBuildRunningState
-	var err error
-	task.timage, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Update(context.TODO(), task.timage, k8sMetaV1.UpdateOptions{})
+	timage, err := updateTImage(task.timage.Name, func(timage *tarsV1beta3.TImage) (bool, error) {
+		if timage.Build.Running == nil || timage.Build.Running.ID != task.id || timage.Build.Running.Handler != glPodName {
+			return false, nil
+		}
+		timage.Build.Running = &task.taskBuildRunningState
+		return true, nil
+	})
 	if err != nil {
 		var message = fmt.Sprintf("update running state failed: %s", err.Error())
 		log.Printf("task|%s: %s\n", task.id, message)
 		return fmt.Errorf(message)
 	}
-	return err
+	task.timage = timage
+	return nil
+}
+
+// adoptedByOthers check whether another handler took over task while this handler was considered lost
+func adoptedByOthers(timage *tarsV1beta3.TImage, task *Task) bool {
+	running := timage.Build.Running
+	return running != nil && running.ID == task.id && running.Handler != glPodName
 }
 
 func (e *Engine) onBuildFailed(task *Task, err error) {
@@ -422,102 +530,88 @@ func (e *Engine) onBuildFailed(task *Task, err error) {
 	}
 
 	task.taskBuildRunningState.Phase = BuildPhaseFailed
+	if err == errTaskCancelled {
+		task.taskBuildRunningState.Phase = BuildPhaseCancelled
+	}
 	task.taskBuildRunningState.Message = err.Error()
+	finishTime := k8sMetaV1.Now()
+	task.taskBuildRunningState.FinishTime = &finishTime
 
-	buildState := tarsV1beta3.TImageBuild{
-		Running: nil,
-		Last:    &task.taskBuildRunningState,
-	}
+	_, err = updateTImage(task.timage.Name, func(timage *tarsV1beta3.TImage) (bool, error) {
+		if adoptedByOthers(timage, task) {
+			return false, nil
+		}
+		if timage.Build.Running != nil && timage.Build.Running.ID == task.id {
+			timage.Build.Running = nil
+		}
+		timage.Build.Last = &task.taskBuildRunningState
+		return true, nil
+	})
 
-	jsonPatch := tarsTool.JsonPatch{
-		{
-			OP:    tarsTool.JsonPatchAdd,
-			Path:  "/build",
-			Value: buildState,
-		},
+	if err != nil {
+		log.Printf("task|%s: update running state failed: %s\n", task.id, err.Error())
 	}
 
-	bs, _ := json.Marshal(jsonPatch)
+	return
+}
 
-	for i := 1; i < 3; i++ {
-		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Patch(context.TODO(), task.timage.Name, types.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
-		if err != nil {
-			time.Sleep(time.Second * 1)
-			continue
-		}
-		break
+// pushedDigest return the manifest digest of the image pushed by task, which is reported by the builder in the running state.
+// builders not reporting it leave the digest resolved from registry, an empty digest leaves the release unpinned
+func pushedDigest(task *Task) string {
+	timage, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Get(context.TODO(), task.timage.Name, k8sMetaV1.GetOptions{})
+	if err == nil && timage.Build != nil && timage.Build.Running != nil && timage.Build.Running.ID == task.id && timage.Build.Running.Digest != "" {
+		return timage.Build.Running.Digest
 	}
 
+	digest, err := glRegistry.Digest(task.taskBuildRunningState.Image, tarsRuntime.Namespace, task.taskBuildRunningState.Secret)
 	if err != nil {
-		log.Printf("task|%s: update running state failed: %s\n", task.id, err.Error())
+		log.Printf("task|%s: resolve digest of %s failed: %s\n", task.id, task.taskBuildRunningState.Image, err.Error())
+		return ""
 	}
-
-	return
+	return digest
 }
 
 func (e *Engine) onBuildSuccess(task *Task) {
 
 	task.taskBuildRunningState.Phase = BuildPhaseDone
 	task.taskBuildRunningState.Message = "Success"
-
-	buildState := tarsV1beta3.TImageBuild{
-		Running: nil,
-		Last:    &task.taskBuildRunningState,
-	}
-
-	releases := []*tarsV1beta3.TImageRelease{
-		{
-			ID:           task.taskBuildRunningState.ID,
-			Image:        task.taskBuildRunningState.Image,
-			Secret:       task.taskBuildRunningState.Secret,
-			CreatePerson: &task.taskBuildRunningState.CreatePerson,
-			CreateTime:   task.taskBuildRunningState.CreateTime,
-			Mark:         &task.taskBuildRunningState.Mark,
-		},
-	}
-
-	if task.timage.Releases != nil {
-		releases = append(releases, task.timage.Releases...)
-		max := tarsMeta.DefaultMaxTImageRelease
-		if tfc := tarsRuntime.TFCConfig.GetTFrameworkConfig(tarsRuntime.Namespace); tfc != nil {
-			max = tfc.RecordLimit.TImageRelease
-		}
-		if len(releases) <= max {
-			task.timage.Releases = releases
-		} else {
-			task.timage.Releases = releases[0:max]
+	task.taskBuildRunningState.Digest = pushedDigest(task)
+	finishTime := k8sMetaV1.Now()
+	task.taskBuildRunningState.FinishTime = &finishTime
+
+	release := &tarsV1beta3.TImageRelease{
+		ID:           task.taskBuildRunningState.ID,
+		Image:        task.taskBuildRunningState.Image,
+		Secret:       task.taskBuildRunningState.Secret,
+		CreatePerson: &task.taskBuildRunningState.CreatePerson,
+		CreateTime:   task.taskBuildRunningState.CreateTime,
+		Mark:         &task.taskBuildRunningState.Mark,
+		Tag:          task.taskBuildRunningState.Tag,
+		SemVer:       task.taskBuildRunningState.SemVer,
+		Commit:       task.taskBuildRunningState.Commit,
+		Digest:       task.taskBuildRunningState.Digest,
+	}
+
+	var trimmed []*tarsV1beta3.TImageRelease
+	_, err := updateTImage(task.timage.Name, func(timage *tarsV1beta3.TImage) (bool, error) {
+		trimmed = nil
+		if adoptedByOthers(timage, task) {
+			return false, nil
 		}
-	}
-
-	jsonPatch := tarsTool.JsonPatch{
-		{
-			OP:    tarsTool.JsonPatchAdd,
-			Path:  "/build",
-			Value: buildState,
-		},
-		{
-			OP:    tarsTool.JsonPatchAdd,
-			Path:  "/releases",
-			Value: releases,
-		},
-	}
-
-	var err error
-	bs, _ := json.Marshal(jsonPatch)
-
-	for i := 1; i < 3; i++ {
-		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Patch(context.TODO(), task.timage.Name, types.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
-		if err != nil {
-			time.Sleep(time.Second * 1)
-			continue
+		if timage.Build.Running != nil && timage.Build.Running.ID == task.id {
+			timage.Build.Running = nil
 		}
-		break
-	}
+		timage.Build.Last = &task.taskBuildRunningState
+		trimmed = prependRelease(timage, release)
+		return true, nil
+	})
 
 	if err != nil {
 		message := fmt.Sprintf("update running state failed: %s", err.Error())
 		log.Printf("task|%s: %s\n", task.id, message)
 		err = fmt.Errorf(message)
+	} else {
+		glRetention.Collect(task.timage.Name, trimmed)
 	}
 
 	if task.waitChan != nil {
@@ -527,28 +621,118 @@ func (e *Engine) onBuildSuccess(task *Task) {
 	return
 }
 
-func (e *Engine) PostTask(task *Task) (string, error) {
+// buildImageTag return the image tag of task, explicit ServerTag wins over tagFormat, the build id is used if neither set.
+// semver is the version {semver} placeholder generated, it is recorded so the next build of the timage continues from it
+func buildImageTag(task *Task, format string) (tag string, semver string, err error) {
+	if task.userParams.ServerTag != "" {
+		if err = tarsTool.ValidImageTag(task.userParams.ServerTag); err != nil {
+			return "", "", fmt.Errorf("serverTag %s", err.Error())
+		}
+		return task.userParams.ServerTag, "", nil
+	}
+
+	if format == "" {
+		return task.id, "", nil
+	}
+
+	tagFormat, err := tarsTool.ParseTagFormat(format)
+	if err != nil {
+		return "", "", fmt.Errorf("parse tagFormat error: %s", err.Error())
+	}
+
+	if part := tagFormat.SemVerPart(); part != "" {
+		var versions []string
+		for _, release := range task.timage.Releases {
+			if release != nil {
+				versions = append(versions, release.SemVer)
+			}
+		}
+		// builds not finished yet have taken their versions
+		if build := task.timage.Build; build != nil {
+			if build.Running != nil {
+				versions = append(versions, build.Running.SemVer)
+			}
+			for _, state := range build.Queue {
+				versions = append(versions, state.SemVer)
+			}
+		}
+		semver = tarsTool.NextSemVer(versions, part)
+	}
+
+	tag, err = tagFormat.Execute(&tarsTool.TagFormatValues{
+		App:          task.userParams.ServerApp,
+		Server:       task.userParams.ServerName,
+		ID:           task.id,
+		Timestamp:    task.createTime.Time,
+		CreatePerson: task.userParams.CreatePerson,
+		GitSha:       task.userParams.GitSha,
+		BaseTag:      tarsTool.ImageTag(task.userParams.BaseImage),
+		SemVer:       semver,
+	})
+	if err != nil {
+		return "", "", err
+	}
+	return tag, semver, nil
+}
 
+// loadFrameworkConfig fill task with the registry and executor of framework config
+func loadFrameworkConfig(task *Task) (*tarsV1beta3.TFrameworkConfig, error) {
 	tfc := tarsRuntime.TFCConfig.GetTFrameworkConfig(tarsRuntime.Namespace)
 	if tfc == nil {
-		return "", fmt.Errorf("get tars framework config failed")
+		return nil, fmt.Errorf("get tars framework config failed")
 	}
 
 	task.repository, task.registrySecret = tfc.ImageUpload.Registry, tfc.ImageUpload.Secret
 	if task.repository == "" {
-		return "", fmt.Errorf("no default repository value set")
+		return nil, fmt.Errorf("no default repository value set")
 	}
-	task.image = fmt.Sprintf("%s/%s.%s:%s", task.repository, strings.ToLower(task.userParams.ServerApp), strings.ToLower(task.userParams.ServerName), task.userParams.ServerTag)
 
 	task.executorImage, task.executorSecret = tfc.ImageBuild.Executor.Image, tfc.ImageBuild.Executor.Secret
 	if task.executorImage == "" {
-		return "", fmt.Errorf("no execute image value set")
+		return nil, fmt.Errorf("no execute image value set")
 	}
+	return tfc, nil
+}
 
-	if task.userParams.ServerTag == "" {
-		task.userParams.ServerTag = task.id
+// PostTask append task to the build queue of its timage, return the image and the 1-based queue position
+func (e *Engine) PostTask(task *Task) (string, int, error) {
+
+	tfc, err := loadFrameworkConfig(task)
+	if err != nil {
+		return "", 0, err
 	}
 
+	e.postMutex.Lock()
+	defer e.postMutex.Unlock()
+
+	task.timage, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Get(context.TODO(), task.userParams.Timage, k8sMetaV1.GetOptions{})
+	if err != nil {
+		return "", 0, fmt.Errorf("get resource %s %s/%s failed: %s", "timage", tarsRuntime.Namespace, task.userParams.Timage, err.Error())
+	}
+
+	if task.timage.ImageType != TImageTypeServer {
+		return "", 0, fmt.Errorf("unexcepted imageType value: %s", task.timage.ImageType)
+	}
+
+	if len(task.timage.SupportedType) != 0 {
+		supported := false
+		for _, v := range task.timage.SupportedType {
+			if v == task.userParams.ServerType {
+				supported = true
+				break
+			}
+		}
+		if !supported {
+			return "", 0, newValidationError("serverType", "supportedType", "timage %s only supports %s", task.timage.Name, strings.Join(task.timage.SupportedType, ", "))
+		}
+	}
+
+	var semver string
+	if task.userParams.ServerTag, semver, err = buildImageTag(task, tfc.ImageBuild.TagFormat); err != nil {
+		return "", 0, err
+	}
+	task.image = fmt.Sprintf("%s/%s.%s:%s", task.repository, strings.ToLower(task.userParams.ServerApp), strings.ToLower(task.userParams.ServerName), task.userParams.ServerTag)
+
 	task.taskBuildRunningState = tarsV1beta3.TImageBuildState{
 		ID:              task.id,
 		BaseImage:       task.userParams.BaseImage,
@@ -559,47 +743,60 @@ func (e *Engine) PostTask(task *Task) (string, error) {
 		CreatePerson:    task.userParams.CreatePerson,
 		CreateTime:      task.createTime,
 		Mark:            task.userParams.Mark,
-		Phase:           BuildPhasePending,
-		Message:         "pending",
+		Phase:           BuildPhaseQueued,
+		Message:         "queued",
 		Handler:         glPodName,
+		Tag:             task.userParams.ServerTag,
+		SemVer:          semver,
+		Priority:        task.userParams.Priority,
+	}
+	if task.userParams.Source != nil && task.userParams.Source.Git != nil {
+		task.taskBuildRunningState.Commit = task.userParams.Source.Git.Commit
 	}
 
 	if task.taskBuildRunningState.Secret == "" {
 		task.taskBuildRunningState.Secret = task.registrySecret
 	}
 
-	var err error
-	task.timage, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Get(context.TODO(), task.userParams.Timage, k8sMetaV1.GetOptions{})
-	if err != nil {
-		return "", fmt.Errorf("get resource %s %s/%s failed: %s", "timage", tarsRuntime.Namespace, task.userParams.Timage, err.Error())
+	if err = saveTaskRecord(task); err != nil {
+		return "", 0, fmt.Errorf("save task record failed: %s", err.Error())
 	}
 
-	if task.timage.ImageType != TImageTypeServer {
-		return "", fmt.Errorf("unexcepted imageType value: %s", task.timage.ImageType)
-	}
+	e.mutex.Lock()
+	e.tasks[task.id] = task
+	e.mutex.Unlock()
 
-	if task.timage.Build != nil && task.timage.Build.Running != nil {
-		return "", fmt.Errorf("another task is running")
-	}
-
-	if task.timage.Build == nil {
-		task.timage.Build = &tarsV1beta3.TImageBuild{
-			Running: &task.taskBuildRunningState,
-		}
-	} else {
-		task.timage.Build.Running = &task.taskBuildRunningState
-	}
-
-	task.timage, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Update(context.TODO(), task.timage, k8sMetaV1.UpdateOptions{})
+	var position int
+	task.timage, err = updateTImage(task.userParams.Timage, func(timage *tarsV1beta3.TImage) (bool, error) {
+		state := task.taskBuildRunningState
+		timage.Build.Queue, position = insertQueue(timage.Build.Queue, &state)
+		return true, nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("update running state failed: %s\n", err.Error())
+		e.mutex.Lock()
+		delete(e.tasks, task.id)
+		e.mutex.Unlock()
+		_ = os.Remove(taskRecordFile(task.id))
+		return "", 0, fmt.Errorf("update build queue failed: %s", err.Error())
 	}
 
-	e.buildChan <- task
-	return task.image, nil
+	e.mutex.Lock()
+	task.queued = true
+	e.mutex.Unlock()
+
+	log.Printf("task|%s: queued at position %d\n", task.id, position)
+	e.wake()
+	return task.image, position, nil
 }
 
 func (e *Engine) Start(stopChan chan struct{}, threads int) {
+	e.threads = threads
+	e.buildChan = make(chan *Task, threads)
+	if err := renewLease(); err != nil {
+		log.Printf("renew handler lease failed: %s\n", err.Error())
+	}
+	go e.runFailover(stopChan)
+	go e.runScheduler(stopChan)
 	for i := 0; i < threads; i++ {
 		go func() {
 			for true {
@@ -617,12 +814,30 @@ func (e *Engine) Start(stopChan chan struct{}, threads int) {
 func (e *Engine) build(task *Task) {
 
 	defer log.Printf("task|%s: stopped\n", task.id)
+	defer e.finish(task)
 
 	var err error
 	for true {
 
+		if _, err = loadFrameworkConfig(task); err != nil {
+			break
+		}
+
 		setup(task)
 
+		if task.userParams.Source != nil {
+			task.taskBuildRunningState.Phase = BuildPhasePreparing
+			task.taskBuildRunningState.Message = "fetching source"
+			_ = pushBuildRunningState(task)
+
+			if err = fetchSource(task); err != nil {
+				message := fmt.Sprintf("fetch source failed, %s", err.Error())
+				log.Printf("task|%s: %s\n", task.id, message)
+				err = fmt.Errorf(message)
+				break
+			}
+		}
+
 		task.taskBuildRunningState.Phase = BuildPhasePreparing
 		task.taskBuildRunningState.Message = "preparing context"
 		_ = pushBuildRunningState(task)
@@ -645,6 +860,11 @@ func (e *Engine) build(task *Task) {
 			break
 		}
 
+		if e.isCancelled(task) {
+			err = errTaskCancelled
+			break
+		}
+
 		task.taskBuildRunningState.Phase = BuildPhaseSubmitting
 		task.taskBuildRunningState.Message = "submitting task"
 		_ = pushBuildRunningState(task)
@@ -656,7 +876,17 @@ func (e *Engine) build(task *Task) {
 			break
 		}
 
+		if e.isCancelled(task) {
+			// cancelled while submitting, the pod may be created after CancelTask deleted it
+			deleteBuilderPod(task.id)
+			err = errTaskCancelled
+			break
+		}
+
 		if err = watch(task); err != nil {
+			if e.isCancelled(task) {
+				err = errTaskCancelled
+			}
 			break
 		}
 
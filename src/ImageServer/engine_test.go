@@ -0,0 +1,100 @@
+package main
+
+import (
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sWatchV1 "k8s.io/apimachinery/pkg/watch"
+	k8sFake "k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRuntime "k8s.tars.io/runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBuildImageTag(t *testing.T) {
+	newTestTask := func(serverTag string) *Task {
+		return &Task{
+			id:         "v20220102030405-1",
+			createTime: k8sMetaV1.NewTime(time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC)),
+			userParams: TaskUserParams{
+				ServerApp:  "Test",
+				ServerName: "HelloServer",
+				ServerTag:  serverTag,
+			},
+			timage: &tarsV1beta3.TImage{
+				Releases: []*tarsV1beta3.TImageRelease{{SemVer: "1.0.1"}, {SemVer: "0.9.0"}},
+			},
+		}
+	}
+
+	tests := []struct {
+		serverTag string
+		format    string
+		tag       string
+		semver    string
+		valid     bool
+	}{
+		{"", "", "v20220102030405-1", "", true},
+		{"", "{app}-{timestamp}", "test-20220102030405", "", true},
+		{"", "v{semver}", "v1.0.2", "1.0.2", true},
+		{"v1.0.0", "{app}-{timestamp}", "v1.0.0", "", true},
+		{"V1.0.0", "", "", "", false},
+		{"v1/0", "{app}", "", "", false},
+		{"", "{unknown}", "", "", false},
+	}
+	for _, test := range tests {
+		tag, semver, err := buildImageTag(newTestTask(test.serverTag), test.format)
+		if (err == nil) != test.valid {
+			t.Errorf("buildImageTag(%q, %q) error = %v, want valid %v", test.serverTag, test.format, err, test.valid)
+			continue
+		}
+		if tag != test.tag || semver != test.semver {
+			t.Errorf("buildImageTag(%q, %q) = %q, %q, want %q, %q", test.serverTag, test.format, tag, semver, test.tag, test.semver)
+		}
+	}
+}
+
+func TestWatchClosed(t *testing.T) {
+	setupTestEnv(t)
+	task := &Task{id: "v1", kanikoPodName: builderPodName("v1")}
+
+	tests := []struct {
+		phase   k8sCoreV1.PodPhase
+		message string
+	}{
+		{k8sCoreV1.PodSucceeded, ""},
+		// the failed pod has no container status
+		{k8sCoreV1.PodFailed, "failed but unknown state"},
+	}
+	for _, test := range tests {
+		k8sClient := k8sFake.NewSimpleClientset(&k8sCoreV1.Pod{
+			ObjectMeta: k8sMetaV1.ObjectMeta{Name: task.kanikoPodName, Namespace: testNamespace},
+			Status:     k8sCoreV1.PodStatus{Phase: k8sCoreV1.PodRunning},
+		})
+		tarsRuntime.Clients.K8sClient = k8sClient
+
+		// the pod finishes while the watch is closed by apiserver
+		watches := 0
+		k8sClient.PrependWatchReactor("pods", func(action k8sTesting.Action) (bool, k8sWatchV1.Interface, error) {
+			watches++
+			gvr := k8sCoreV1.SchemeGroupVersion.WithResource("pods")
+			obj, _ := k8sClient.Tracker().Get(gvr, testNamespace, task.kanikoPodName)
+			pod := obj.(*k8sCoreV1.Pod)
+			pod.Status.Phase = test.phase
+			_ = k8sClient.Tracker().Update(gvr, pod, testNamespace)
+			watcher := k8sWatchV1.NewFake()
+			watcher.Stop()
+			return true, watcher, nil
+		})
+
+		err := watch(task)
+		if test.message == "" && err != nil || test.message != "" && (err == nil || !strings.Contains(err.Error(), test.message)) {
+			t.Errorf("watch %s pod error = %v, want %q", test.phase, err, test.message)
+		}
+		if watches != 1 {
+			t.Errorf("watch %s pod watched %d times, want 1", test.phase, watches)
+		}
+	}
+}
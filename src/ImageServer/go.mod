@@ -6,6 +6,7 @@ require (
 	github.com/gorilla/mux v1.8.0
 	k8s.io/api v0.20.15
 	k8s.io/apimachinery v0.20.15
+	k8s.io/client-go v0.20.15
 	k8s.tars.io v1.0.0
 )
 
@@ -0,0 +1,236 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	k8sCoordinationV1 "k8s.io/api/coordination/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+func handlerLeaseName(handler string) string {
+	return fmt.Sprintf("%s%s", HandlerLeasePrefix, handler)
+}
+
+// renewLease keep the lease of this handler, other handlers take over its builds once the lease expired
+func renewLease() error {
+	leaseInterface := tarsRuntime.Clients.K8sClient.CoordinationV1().Leases(tarsRuntime.Namespace)
+	now := k8sMetaV1.NowMicro()
+	duration := int32(HandlerLeaseDuration / time.Second)
+
+	lease, err := leaseInterface.Get(context.TODO(), handlerLeaseName(glPodName), k8sMetaV1.GetOptions{})
+	if err != nil {
+		if !errors.IsNotFound(err) {
+			return err
+		}
+		lease = &k8sCoordinationV1.Lease{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      handlerLeaseName(glPodName),
+				Namespace: tarsRuntime.Namespace,
+				Labels: map[string]string{
+					tarsMeta.TServerAppLabel:  "tars",
+					tarsMeta.TServerNameLabel: "tarsimage",
+				},
+			},
+			Spec: k8sCoordinationV1.LeaseSpec{
+				HolderIdentity:       &glPodName,
+				LeaseDurationSeconds: &duration,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		_, err = leaseInterface.Create(context.TODO(), lease, k8sMetaV1.CreateOptions{})
+		return err
+	}
+
+	lease.Spec.HolderIdentity = &glPodName
+	lease.Spec.LeaseDurationSeconds = &duration
+	lease.Spec.RenewTime = &now
+	_, err = leaseInterface.Update(context.TODO(), lease, k8sMetaV1.UpdateOptions{})
+	return err
+}
+
+// aliveHandlers return handlers whose lease renewed within duration
+func aliveHandlers(duration time.Duration) (map[string]interface{}, error) {
+	leases, err := tarsRuntime.Clients.K8sClient.CoordinationV1().Leases(tarsRuntime.Namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	alive := map[string]interface{}{glPodName: nil}
+	for _, lease := range leases.Items {
+		if !strings.HasPrefix(lease.Name, HandlerLeasePrefix) || lease.Spec.RenewTime == nil {
+			continue
+		}
+		if time.Since(lease.Spec.RenewTime.Time) < duration {
+			alive[strings.TrimPrefix(lease.Name, HandlerLeasePrefix)] = nil
+		}
+	}
+	return alive, nil
+}
+
+// failover take over builds of handlers whose lease expired:
+// running builds are adopted and watched to the end, queued builds are failed once the handler is gone for HandlerAbandonDuration,
+// because their uploaded files are only reachable from the lost handler
+func (e *Engine) failover() {
+	alive, err := aliveHandlers(HandlerLeaseDuration)
+	if err != nil {
+		log.Printf("list handler leases failed: %s\n", err.Error())
+		return
+	}
+
+	present, err := aliveHandlers(HandlerAbandonDuration)
+	if err != nil {
+		log.Printf("list handler leases failed: %s\n", err.Error())
+		return
+	}
+
+	timages, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
+	if err != nil {
+		log.Printf("list timages failed: %s\n", err.Error())
+		return
+	}
+
+	for i := range timages.Items {
+		timage := &timages.Items[i]
+		if timage.Build == nil {
+			continue
+		}
+
+		if running := timage.Build.Running; running != nil {
+			if _, ok := alive[running.Handler]; !ok {
+				e.adopt(timage.Name, running)
+			}
+		}
+
+		for _, state := range timage.Build.Queue {
+			if _, ok := present[state.Handler]; !ok {
+				e.abandon(timage.Name, state)
+			}
+		}
+	}
+}
+
+// adopt move the running build of a lost handler to this handler and finish it
+func (e *Engine) adopt(timageName string, running *tarsV1beta3.TImageBuildState) {
+	lost := running.Handler
+
+	timage, err := updateTImage(timageName, func(timage *tarsV1beta3.TImage) (bool, error) {
+		current := timage.Build.Running
+		if current == nil || current.ID != running.ID || current.Handler != lost {
+			return false, errTaskNotFound
+		}
+		current.Handler = glPodName
+		current.Message = fmt.Sprintf("adopted from lost handler %s", lost)
+		return true, nil
+	})
+	if err != nil {
+		if err != errTaskNotFound {
+			log.Printf("task|%s: adopt from %s failed: %s\n", running.ID, lost, err.Error())
+		}
+		return
+	}
+
+	log.Printf("task|%s: adopted from %s\n", running.ID, lost)
+
+	task := &Task{
+		id:                    running.ID,
+		createTime:            running.CreateTime,
+		image:                 running.Image,
+		userParams:            TaskUserParams{Timage: timageName},
+		taskBuildRunningState: *timage.Build.Running,
+		handler:               glPodName,
+		kanikoPodName:         builderPodName(running.ID),
+		timage:                timage,
+		queued:                true,
+	}
+
+	e.mutex.Lock()
+	e.tasks[task.id] = task
+	e.building[timageName] = task.id
+	e.mutex.Unlock()
+
+	go func() {
+		defer e.finish(task)
+		defer removeAbandonedBuildDir(lost, task.id)
+
+		_, err := tarsRuntime.Clients.K8sClient.CoreV1().Pods(tarsRuntime.Namespace).Get(context.TODO(), task.kanikoPodName, k8sMetaV1.GetOptions{})
+		if err != nil {
+			if errors.IsNotFound(err) {
+				err = fmt.Errorf("build handler %s lost before the task submitted", lost)
+			}
+			e.onBuildFailed(task, err)
+			return
+		}
+
+		time.AfterFunc(BuilderPodRetainDuration, func() { deleteBuilderPod(task.id) })
+
+		if err = watch(task); err != nil {
+			e.onBuildFailed(task, err)
+			return
+		}
+		e.onBuildSuccess(task)
+	}()
+}
+
+// abandon remove a queued build of a lost handler and record it as failed
+func (e *Engine) abandon(timageName string, state *tarsV1beta3.TImageBuildState) {
+	_, err := updateTImage(timageName, func(timage *tarsV1beta3.TImage) (bool, error) {
+		for i, v := range timage.Build.Queue {
+			if v.ID == state.ID && v.Handler == state.Handler {
+				finishTime := k8sMetaV1.Now()
+				last := *v
+				last.Phase = BuildPhaseFailed
+				last.Message = fmt.Sprintf("build handler %s lost", state.Handler)
+				last.FinishTime = &finishTime
+				timage.Build.Last = &last
+				timage.Build.Queue = append(timage.Build.Queue[:i], timage.Build.Queue[i+1:]...)
+				return true, nil
+			}
+		}
+		return false, nil
+	})
+	if err != nil {
+		log.Printf("task|%s: abandon failed: %s\n", state.ID, err.Error())
+		return
+	}
+	log.Printf("task|%s: abandoned because handler %s lost\n", state.ID, state.Handler)
+	e.wake()
+}
+
+// removeAbandonedBuildDir remove build dir of the lost handler, it is only reachable when both handlers share the node
+func removeAbandonedBuildDir(handler string, id string) {
+	dirs, _ := filepath.Glob(filepath.Join(filepath.Dir(glPodBuildDir), handler, fmt.Sprintf("*-%s", id)))
+	for _, dir := range dirs {
+		_ = os.RemoveAll(dir)
+	}
+}
+
+func (e *Engine) runFailover(stopChan chan struct{}) {
+	leaseTicker := time.NewTicker(HandlerLeaseRenewInterval)
+	defer leaseTicker.Stop()
+
+	failoverTicker := time.NewTicker(FailoverInterval)
+	defer failoverTicker.Stop()
+
+	for {
+		select {
+		case <-leaseTicker.C:
+			if err := renewLease(); err != nil {
+				log.Printf("renew handler lease failed: %s\n", err.Error())
+			}
+		case <-failoverTicker.C:
+			e.failover()
+		case <-stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"context"
+	k8sCoordinationV1 "k8s.io/api/coordination/v1"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRuntime "k8s.tars.io/runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+// createTestLease create the lease of handler, renewed the duration ago
+func createTestLease(t *testing.T, handler string, renewed time.Duration) {
+	renewTime := k8sMetaV1.NewMicroTime(time.Now().Add(-renewed))
+	lease := &k8sCoordinationV1.Lease{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: handlerLeaseName(handler), Namespace: testNamespace},
+		Spec:       k8sCoordinationV1.LeaseSpec{HolderIdentity: &handler, RenewTime: &renewTime},
+	}
+	if _, err := tarsRuntime.Clients.K8sClient.CoordinationV1().Leases(testNamespace).Create(context.TODO(), lease, k8sMetaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func createTestBuilderPod(t *testing.T, id string, phase k8sCoreV1.PodPhase) {
+	pod := &k8sCoreV1.Pod{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: builderPodName(id), Namespace: testNamespace},
+		Status:     k8sCoreV1.PodStatus{Phase: phase},
+	}
+	if _, err := tarsRuntime.Clients.K8sClient.CoreV1().Pods(testNamespace).Create(context.TODO(), pod, k8sMetaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func newTestRunningState(id, handler string) *tarsV1beta3.TImageBuildState {
+	return &tarsV1beta3.TImageBuildState{
+		ID:      id,
+		Phase:   BuildPhasePrepareBuilding,
+		Handler: handler,
+		Image:   "registry.local/test.helloserver:" + id,
+		Digest:  "sha256:" + id,
+	}
+}
+
+// waitFinished wait the adopted tasks of engine finished
+func waitFinished(t *testing.T, engine *Engine) {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		engine.mutex.Lock()
+		building := len(engine.building)
+		engine.mutex.Unlock()
+		if building == 0 {
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("adopted tasks are not finished in time")
+}
+
+func TestRenewLease(t *testing.T) {
+	setupTestEnv(t)
+	createTestLease(t, "expired-handler", HandlerLeaseDuration*2)
+
+	for i := 0; i < 2; i++ {
+		// the lease is created at first and updated afterwards
+		if err := renewLease(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	alive, err := aliveHandlers(HandlerLeaseDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := alive[glPodName]; !ok || len(alive) != 1 {
+		t.Errorf("alive handlers = %v, want only %s", alive, glPodName)
+	}
+
+	present, err := aliveHandlers(HandlerAbandonDuration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := present["expired-handler"]; !ok {
+		t.Errorf("handlers present = %v, want expired-handler", present)
+	}
+}
+
+func TestFailoverAdoptExpiredLease(t *testing.T) {
+	setupTestEnv(t,
+		newTestTImage("lost-helloserver", newTestRunningState("v1", "lost-handler")),
+		newTestTImage("alive-helloserver", newTestRunningState("v2", "alive-handler")),
+	)
+	glRetention = newTestRetention(RetentionModeOff, nil, nil)
+	createTestLease(t, "lost-handler", HandlerLeaseDuration*2)
+	createTestLease(t, "alive-handler", 0)
+	createTestBuilderPod(t, "v1", k8sCoreV1.PodSucceeded)
+	createTestBuilderPod(t, "v2", k8sCoreV1.PodRunning)
+
+	engine := NewEngine()
+	engine.failover()
+	waitFinished(t, engine)
+
+	timage := getTestTImage(t, "lost-helloserver")
+	if timage.Build.Running != nil {
+		t.Errorf("running build = %+v, want finished", timage.Build.Running)
+	}
+	if last := timage.Build.Last; last == nil || last.ID != "v1" || last.Phase != BuildPhaseDone || last.Handler != glPodName {
+		t.Errorf("last build = %+v, want v1 done by %s", last, glPodName)
+	}
+	if len(timage.Releases) != 1 || timage.Releases[0].ID != "v1" || timage.Releases[0].Digest != "sha256:v1" {
+		t.Errorf("releases = %v, want v1 released", timage.Releases)
+	}
+
+	if running := getTestTImage(t, "alive-helloserver").Build.Running; running == nil || running.Handler != "alive-handler" {
+		t.Errorf("running build of alive handler = %+v, want kept", running)
+	}
+}
+
+func TestFailoverAdoptMissingPod(t *testing.T) {
+	setupTestEnv(t, newTestTImage("lost-helloserver", newTestRunningState("v1", "lost-handler")))
+	createTestLease(t, "lost-handler", HandlerLeaseDuration*2)
+
+	engine := NewEngine()
+	engine.failover()
+	waitFinished(t, engine)
+
+	timage := getTestTImage(t, "lost-helloserver")
+	if timage.Build.Running != nil {
+		t.Errorf("running build = %+v, want failed", timage.Build.Running)
+	}
+	last := timage.Build.Last
+	if last == nil || last.Phase != BuildPhaseFailed || !strings.Contains(last.Message, "lost before the task submitted") {
+		t.Errorf("last build = %+v, want failed because the pod is missing", last)
+	}
+	if len(timage.Releases) != 0 {
+		t.Errorf("releases = %v, want none", timage.Releases)
+	}
+}
+
+func TestFailoverAbandonStaleQueue(t *testing.T) {
+	stale := &tarsV1beta3.TImageBuildState{ID: "v1", Phase: BuildPhaseQueued, Handler: "gone-handler"}
+	expired := &tarsV1beta3.TImageBuildState{ID: "v2", Phase: BuildPhaseQueued, Handler: "expired-handler"}
+	setupTestEnv(t, newTestTImage("test-helloserver", nil, stale, expired))
+	createTestLease(t, "gone-handler", HandlerAbandonDuration*2)
+	createTestLease(t, "expired-handler", HandlerLeaseDuration*2)
+
+	engine := NewEngine()
+	engine.failover()
+
+	timage := getTestTImage(t, "test-helloserver")
+	// the queued build is kept until its handler is gone for HandlerAbandonDuration
+	if len(timage.Build.Queue) != 1 || timage.Build.Queue[0].ID != "v2" {
+		t.Errorf("queue = %v, want only v2 kept", timage.Build.Queue)
+	}
+	last := timage.Build.Last
+	if last == nil || last.ID != "v1" || last.Phase != BuildPhaseFailed || !strings.Contains(last.Message, "gone-handler lost") {
+		t.Errorf("last build = %+v, want v1 failed because its handler lost", last)
+	}
+	select {
+	case <-engine.wakeChan:
+	default:
+		t.Errorf("engine is not woken up after abandoning")
+	}
+}
@@ -3,10 +3,14 @@ package main
 import (
 	"fmt"
 	"k8s.io/apimachinery/pkg/util/runtime"
+	tarsRegistry "k8s.tars.io/registry"
 	tarsRuntime "k8s.tars.io/runtime"
 	"log"
 	"os"
 	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
 	"syscall"
 	"time"
 )
@@ -20,27 +24,86 @@ var (
 	glHostBuildDir string
 	glHostCacheDir string
 
+	glMaxUploadSize int64
+	glRetentionMode string
+	// glInsecureRegistries are the registry hosts whose certificates are not verified
+	glInsecureRegistries []string
+	// glPromotionNamespaces are the namespaces promoting releases of this namespace, retention keeps the images they reference
+	glPromotionNamespaces []string
+
 	glStopChan chan struct{}
 
-	glEngine  *Engine
-	glRestful *RestfulServer
+	glEngine        *Engine
+	glRestful       *RestfulServer
+	glAuthenticator *Authenticator
+	glRegistry      *tarsRegistry.Client
+	glRetention     *Retention
+	glPromoter      *Promoter
+
+	// glExecMutex is read locked by commands this process runs and waits for, the reaper never reaps them meanwhile
+	glExecMutex sync.RWMutex
 )
 
-func init() {
+// reapChildren reap orphaned processes inherited as pid 1, once no command is waited by exec.Cmd
+func reapChildren(reapChan chan struct{}) {
+	for range reapChan {
+		glExecMutex.Lock()
+		for {
+			var waitStatus syscall.WaitStatus
+			if pid, _ := syscall.Wait4(-1, &waitStatus, syscall.WNOHANG, nil); pid <= 0 {
+				break
+			}
+		}
+		glExecMutex.Unlock()
+	}
+}
+
+// loadEnv read settings from env and prepare the workspace dirs, it exits if any of them is invalid
+func loadEnv() {
 	glPodName = os.Getenv("PodName")
 	if glPodName == "" {
 		log.Printf("get empty PodName value")
 		os.Exit(-1)
 	}
 
+	glMaxUploadSize = DefaultMaxUploadSize * 1024 * 1024
+	if value := os.Getenv("MaxUploadSize"); value != "" {
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || size <= 0 {
+			log.Printf("get invalid MaxUploadSize value: %s", value)
+			os.Exit(-1)
+		}
+		glMaxUploadSize = size * 1024 * 1024
+	}
+
+	glRetentionMode = os.Getenv("RetentionMode")
+	switch glRetentionMode {
+	case "":
+		glRetentionMode = RetentionModeOff
+	case RetentionModeOff, RetentionModeDryRun, RetentionModeDelete:
+	default:
+		log.Printf("get invalid RetentionMode value: %s", glRetentionMode)
+		os.Exit(-1)
+	}
+
+	if value := os.Getenv("InsecureRegistries"); value != "" {
+		glInsecureRegistries = strings.Split(value, ",")
+	}
+
+	for _, namespace := range strings.Split(os.Getenv("PromotionTargetNamespaces"), ",") {
+		if namespace = strings.TrimSpace(namespace); namespace != "" {
+			glPromotionNamespaces = append(glPromotionNamespaces, namespace)
+		}
+	}
+
 	workspaceInPod := os.Getenv("WorkSpaceInPod")
 	if workspaceInPod == "" {
 		log.Printf("get empty WorkSpaceInPod value")
 		os.Exit(-1)
 	}
 
+	// upload dir is kept, queued tasks are restored from it
 	glPodUploadDir = fmt.Sprintf("%s%s/%s", workspaceInPod, UploadDir, glPodName)
-	_ = os.RemoveAll(glPodUploadDir)
 	if err := os.MkdirAll(glPodUploadDir, 0777); err != nil {
 		log.Printf("create upload dir failed: %s", err.Error())
 		os.Exit(-1)
@@ -71,18 +134,36 @@ func init() {
 }
 
 func main() {
+	loadEnv()
+
 	runtime.Must(tarsRuntime.CreateContext("", "", true))
 
 	glStopChan = make(chan struct{})
 
+	// informer of taccounts should be registered before the factories start
+	glAuthenticator = NewAuthenticator(os.Getenv("Authentication") == "true")
+
 	tarsRuntime.Factories.Start(glStopChan)
 
+	// timages are authorized by their owner labels, which are only set by webhook since this version
+	labelTImageOwners()
+
+	glRegistry = tarsRegistry.NewClient(RegistryRequestTimeout, glInsecureRegistries)
+
+	glRetention = NewRetention(glRetentionMode, glRegistry, glPromotionNamespaces)
+	go glRetention.Run(glStopChan)
+
+	glPromoter = NewPromoter(glRegistry, glAuthenticator)
+
 	glEngine = NewEngine()
 	glEngine.Start(glStopChan, MaximumConcurrencyBuildTask)
 
 	glRestful = NewRestful()
 	glRestful.Start(glStopChan)
 
+	reapChan := make(chan struct{}, 1)
+	go reapChildren(reapChan)
+
 	sigChan := make(chan os.Signal)
 
 	signal.Notify(sigChan, syscall.SIGCHLD, syscall.SIGINT, syscall.SIGTERM, syscall.SIGQUIT)
@@ -90,8 +171,14 @@ func main() {
 		sig := <-sigChan
 		switch sig {
 		case syscall.SIGCHLD:
-			var waitStatus syscall.WaitStatus
-			_, _ = syscall.Wait4(-1, &waitStatus, syscall.WNOHANG, nil)
+			// only pid 1 inherits orphaned processes, other children are waited by whom started them
+			if os.Getpid() != 1 {
+				continue
+			}
+			select {
+			case reapChan <- struct{}{}:
+			default:
+			}
 		default:
 			break
 		}
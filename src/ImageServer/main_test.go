@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sFake "k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/cache"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	crdFake "k8s.tars.io/client-go/clientset/versioned/fake"
+	tarsListerV1beta3 "k8s.tars.io/client-go/listers/tars/v1beta3"
+	tarsRuntime "k8s.tars.io/runtime"
+	"testing"
+	"time"
+)
+
+const testNamespace = "tars"
+
+const testPodName = "tars-tarsimage-0"
+
+// setupTestEnv point the globals of image server to a temporary workspace and fake clients holding objects
+func setupTestEnv(t *testing.T, objects ...runtime.Object) *crdFake.Clientset {
+	glPodName = testPodName
+	glPodUploadDir = t.TempDir()
+	glPodBuildDir = t.TempDir()
+	glPodCacheDir = t.TempDir()
+	glMaxUploadSize = DefaultMaxUploadSize * 1024 * 1024
+
+	crdClient := crdFake.NewSimpleClientset(objects...)
+	tarsRuntime.Namespace = testNamespace
+	tarsRuntime.Clients = &tarsRuntime.Client{
+		K8sClient: k8sFake.NewSimpleClientset(),
+		CrdClient: crdClient,
+	}
+	return crdClient
+}
+
+func createTestTImage(t *testing.T, timage *tarsV1beta3.TImage) {
+	if _, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(testNamespace).Create(context.TODO(), timage, k8sMetaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func getTestTImage(t *testing.T, name string) *tarsV1beta3.TImage {
+	timage, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(testNamespace).Get(context.TODO(), name, k8sMetaV1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return timage
+}
+
+// newTestTAccount return an activated taccount owning token, with role on flag
+func newTestTAccount(name, token, flag, role string) *tarsV1beta3.TAccount {
+	return &tarsV1beta3.TAccount{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Spec: tarsV1beta3.TAccountSpec{
+			Username: name,
+			Authentication: tarsV1beta3.TAccountAuthentication{
+				Activated: true,
+				Tokens: []*tarsV1beta3.TAccountAuthenticationToken{
+					{Name: "test", Content: token, Valid: true, ExpirationTime: k8sMetaV1.NewTime(time.Now().Add(time.Hour))},
+				},
+			},
+			Authorization: []*tarsV1beta3.TAccountAuthorization{{Flag: flag, Role: role}},
+		},
+	}
+}
+
+// newTestAuthenticator return an enabled authenticator whose cache holds taccounts
+func newTestAuthenticator(t *testing.T, taccounts ...*tarsV1beta3.TAccount) *Authenticator {
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{cache.NamespaceIndex: cache.MetaNamespaceIndexFunc})
+	for _, taccount := range taccounts {
+		if err := indexer.Add(taccount); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return &Authenticator{
+		enabled:  true,
+		taLister: tarsListerV1beta3.NewTAccountLister(indexer),
+		synced:   func() bool { return true },
+	}
+}
@@ -0,0 +1,376 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRegistry "k8s.tars.io/registry"
+	tarsRuntime "k8s.tars.io/runtime"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+)
+
+var errPromotionConflict = fmt.Errorf("release id already exists")
+
+// PromoteParams is the json body of promotion request, the release is copied into the timage of request path
+type PromoteParams struct {
+	SourceNamespace string `json:"sourceNamespace" validate:"required,hostname_rfc1123"`
+	// SourceTImage default to the target timage name
+	SourceTImage string `json:"sourceTImage" validate:"omitempty,hostname_rfc1123"`
+	ID           string `json:"id" validate:"required,max=63"`
+	Mark         string `json:"mark" validate:"max=1600"`
+	Person       string `json:"-"`
+}
+
+// Promoter copy releases of other namespaces into the registry of this namespace
+type Promoter struct {
+	registry      *tarsRegistry.Client
+	authenticator *Authenticator
+}
+
+func NewPromoter(registry *tarsRegistry.Client, authenticator *Authenticator) *Promoter {
+	return &Promoter{registry: registry, authenticator: authenticator}
+}
+
+type manifestDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+}
+
+type manifest struct {
+	SchemaVersion int                  `json:"schemaVersion"`
+	MediaType     string               `json:"mediaType"`
+	Config        *manifestDescriptor  `json:"config,omitempty"`
+	Layers        []manifestDescriptor `json:"layers,omitempty"`
+	Manifests     []manifestDescriptor `json:"manifests,omitempty"`
+}
+
+// registrySession copy manifests and blobs between repositories
+type registrySession struct {
+	*tarsRegistry.Session
+}
+
+func (p *Promoter) session(image, namespace, secret string) (*registrySession, error) {
+	s, err := p.registry.Session(image, namespace, secret)
+	if err != nil {
+		return nil, err
+	}
+	return &registrySession{Session: s}, nil
+}
+
+// getManifest return the manifest of reference with its media type and digest
+func (s *registrySession) getManifest(reference string) ([]byte, string, string, error) {
+	header := http.Header{}
+	header.Set("Accept", strings.Join(tarsRegistry.ManifestMediaTypes, ", "))
+	response, err := s.Do(http.MethodGet, s.ManifestPath(reference), header, nil)
+	if err != nil {
+		return nil, "", "", err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode == http.StatusNotFound {
+		return nil, "", "", tarsRegistry.ErrManifestNotFound
+	}
+	if response.StatusCode != http.StatusOK {
+		return nil, "", "", fmt.Errorf("get manifest %s/%s:%s failed: %s", s.Ref.Host, s.Ref.Repository, reference, response.Status)
+	}
+
+	content, err := ioutil.ReadAll(io.LimitReader(response.Body, MaxManifestSize))
+	if err != nil {
+		return nil, "", "", err
+	}
+	mediaType := response.Header.Get("Content-Type")
+	if i := strings.IndexByte(mediaType, ';'); i != -1 {
+		mediaType = mediaType[:i]
+	}
+	return content, mediaType, fmt.Sprintf("sha256:%x", sha256.Sum256(content)), nil
+}
+
+func (s *registrySession) putManifest(reference, mediaType string, content []byte) error {
+	header := http.Header{}
+	header.Set("Content-Type", mediaType)
+	response, err := s.Do(http.MethodPut, s.ManifestPath(reference), header, func() (io.ReadCloser, int64, error) {
+		return ioutil.NopCloser(bytes.NewReader(content)), int64(len(content)), nil
+	})
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	_ = response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated && response.StatusCode != http.StatusOK {
+		return fmt.Errorf("put manifest %s/%s:%s failed: %s", s.Ref.Host, s.Ref.Repository, reference, response.Status)
+	}
+	return nil
+}
+
+func (s *registrySession) blobExists(digest string) (bool, error) {
+	response, err := s.Do(http.MethodHead, s.BlobPath(digest), nil, nil)
+	if err != nil {
+		return false, err
+	}
+	_ = response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+		return true, nil
+	case http.StatusNotFound:
+		return false, nil
+	}
+	return false, fmt.Errorf("check blob %s/%s@%s failed: %s", s.Ref.Host, s.Ref.Repository, digest, response.Status)
+}
+
+// copyBlob copy blob digest from src, the blob is mounted instead if both repositories are in the same registry
+func (s *registrySession) copyBlob(src *registrySession, digest string) error {
+	if exists, err := s.blobExists(digest); err != nil || exists {
+		return err
+	}
+
+	uploadPath := fmt.Sprintf("/v2/%s/blobs/uploads/", s.Ref.Repository)
+	if src.Ref.Host == s.Ref.Host {
+		uploadPath = fmt.Sprintf("%s?mount=%s&from=%s", uploadPath, digest, src.Ref.Repository)
+	}
+
+	response, err := s.Do(http.MethodPost, uploadPath, nil, nil)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	_ = response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusCreated:
+		// mounted
+		return nil
+	case http.StatusAccepted:
+	default:
+		return fmt.Errorf("start blob upload to %s/%s failed: %s", s.Ref.Host, s.Ref.Repository, response.Status)
+	}
+
+	location := response.Header.Get("Location")
+	if location == "" {
+		return fmt.Errorf("registry %s returned no upload location", s.Ref.Host)
+	}
+	if strings.Contains(location, "?") {
+		location = fmt.Sprintf("%s&digest=%s", location, digest)
+	} else {
+		location = fmt.Sprintf("%s?digest=%s", location, digest)
+	}
+
+	header := http.Header{}
+	header.Set("Content-Type", "application/octet-stream")
+	response, err = s.Do(http.MethodPut, location, header, func() (io.ReadCloser, int64, error) {
+		blob, err := src.Do(http.MethodGet, src.BlobPath(digest), nil, nil)
+		if err != nil {
+			return nil, 0, err
+		}
+		if blob.StatusCode != http.StatusOK {
+			_ = blob.Body.Close()
+			return nil, 0, fmt.Errorf("get blob %s/%s@%s failed: %s", src.Ref.Host, src.Ref.Repository, digest, blob.Status)
+		}
+		return blob.Body, blob.ContentLength, nil
+	})
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	_ = response.Body.Close()
+
+	if response.StatusCode != http.StatusCreated {
+		return fmt.Errorf("upload blob %s to %s/%s failed: %s", digest, s.Ref.Host, s.Ref.Repository, response.Status)
+	}
+	return nil
+}
+
+// copyManifest copy the manifest of reference from src with its blobs or child manifests, and tag it as tag
+func (s *registrySession) copyManifest(src *registrySession, reference, tag string) (string, error) {
+	content, mediaType, digest, err := src.getManifest(reference)
+	if err != nil {
+		return "", err
+	}
+
+	var m manifest
+	if err = json.Unmarshal(content, &m); err != nil {
+		return "", fmt.Errorf("parse manifest %s/%s:%s failed: %s", src.Ref.Host, src.Ref.Repository, reference, err.Error())
+	}
+	if m.SchemaVersion != 2 {
+		return "", fmt.Errorf("manifest schema version %d is not supported", m.SchemaVersion)
+	}
+
+	for _, child := range m.Manifests {
+		if _, err = s.copyManifest(src, child.Digest, child.Digest); err != nil {
+			return "", err
+		}
+	}
+
+	if m.Config != nil {
+		if err = s.copyBlob(src, m.Config.Digest); err != nil {
+			return "", err
+		}
+	}
+	for _, layer := range m.Layers {
+		if err = s.copyBlob(src, layer.Digest); err != nil {
+			return "", err
+		}
+	}
+
+	if err = s.putManifest(tag, mediaType, content); err != nil {
+		return "", err
+	}
+	return digest, nil
+}
+
+// prependRelease put release at the head of timage releases, return the releases trimmed by the record limit
+func prependRelease(timage *tarsV1beta3.TImage, release *tarsV1beta3.TImageRelease) []*tarsV1beta3.TImageRelease {
+	max := tarsMeta.DefaultMaxTImageRelease
+	if tfc := tarsRuntime.TFCConfig.GetTFrameworkConfig(tarsRuntime.Namespace); tfc != nil {
+		max = tfc.RecordLimit.TImageRelease
+	}
+
+	var trimmed []*tarsV1beta3.TImageRelease
+	releases := append([]*tarsV1beta3.TImageRelease{release}, timage.Releases...)
+	if len(releases) > max {
+		trimmed = releases[max:]
+		releases = releases[0:max]
+	}
+	timage.Releases = releases
+	return trimmed
+}
+
+// Promote copy the release params.ID of the source timage into the registry of this namespace,
+// then append it to the releases of timageName with its provenance.
+// taccount must be able to view the server owning the source timage, it is nil if authentication is disabled
+func (p *Promoter) Promote(taccount *tarsV1beta3.TAccount, timageName string, params *PromoteParams) (*tarsV1beta3.TImageRelease, error) {
+	if params.SourceTImage == "" {
+		params.SourceTImage = timageName
+	}
+
+	timage, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Get(context.TODO(), timageName, k8sMetaV1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if timage.ImageType != TImageTypeServer {
+		return nil, newValidationError("timage", "imageType", "timage %s is not a server image", timageName)
+	}
+
+	source, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(params.SourceNamespace).Get(context.TODO(), params.SourceTImage, k8sMetaV1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+	if taccount != nil {
+		if err = p.authenticator.AuthorizeTImageOwner(taccount, source, viewRoles); err != nil {
+			return nil, err
+		}
+	}
+
+	var sourceRelease *tarsV1beta3.TImageRelease
+	for _, release := range source.Releases {
+		if release != nil && release.ID == params.ID {
+			sourceRelease = release
+			break
+		}
+	}
+	if sourceRelease == nil {
+		return nil, errors.NewNotFound(tarsV1beta3.Resource("timages"), fmt.Sprintf("%s/%s release %s", params.SourceNamespace, params.SourceTImage, params.ID))
+	}
+
+	for _, release := range timage.Releases {
+		if release != nil && release.ID == params.ID {
+			if release.Promotion != nil && release.Promotion.Namespace == params.SourceNamespace && release.Promotion.Image == sourceRelease.Image {
+				// promoted already
+				return release, nil
+			}
+			return nil, fmt.Errorf("%w: %s", errPromotionConflict, params.ID)
+		}
+	}
+
+	tfc := tarsRuntime.TFCConfig.GetTFrameworkConfig(tarsRuntime.Namespace)
+	if tfc == nil || tfc.ImageUpload.Registry == "" {
+		return nil, fmt.Errorf("no upload registry value set")
+	}
+
+	src, err := p.session(sourceRelease.Image, params.SourceNamespace, sourceRelease.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	tag := src.Ref.Reference
+	if src.Ref.IsDigest() {
+		tag = sourceRelease.Tag
+		if tag == "" {
+			tag = sourceRelease.ID
+		}
+	}
+	image := fmt.Sprintf("%s/%s:%s", strings.TrimSuffix(tfc.ImageUpload.Registry, "/"), path.Base(src.Ref.Repository), tag)
+
+	dst, err := p.session(image, tarsRuntime.Namespace, tfc.ImageUpload.Secret)
+	if err != nil {
+		return nil, err
+	}
+
+	// copy the manifest the source release is pinned to, in case its tag was moved since
+	reference := src.Ref.Reference
+	if sourceRelease.Digest != "" {
+		reference = sourceRelease.Digest
+	}
+
+	log.Printf("promotion|%s: copying %s to %s\n", params.ID, sourceRelease.Image, image)
+	digest, err := dst.copyManifest(src, reference, tag)
+	if err != nil {
+		return nil, fmt.Errorf("copy %s to %s failed: %s", sourceRelease.Image, image, err.Error())
+	}
+
+	now := k8sMetaV1.Now()
+	mark := params.Mark
+	if mark == "" && sourceRelease.Mark != nil {
+		mark = *sourceRelease.Mark
+	}
+	release := &tarsV1beta3.TImageRelease{
+		ID:           sourceRelease.ID,
+		Image:        image,
+		Secret:       tfc.ImageUpload.Secret,
+		CreatePerson: &params.Person,
+		CreateTime:   now,
+		Mark:         &mark,
+		Tag:          sourceRelease.Tag,
+		SemVer:       sourceRelease.SemVer,
+		Commit:       sourceRelease.Commit,
+		Digest:       digest,
+		Promotion: &tarsV1beta3.TImageReleasePromotion{
+			Namespace:   params.SourceNamespace,
+			TImage:      params.SourceTImage,
+			Image:       sourceRelease.Image,
+			Digest:      digest,
+			Person:      params.Person,
+			PromoteTime: now,
+		},
+	}
+
+	var trimmed []*tarsV1beta3.TImageRelease
+	_, err = updateTImage(timageName, func(timage *tarsV1beta3.TImage) (bool, error) {
+		for _, v := range timage.Releases {
+			if v != nil && v.ID == release.ID {
+				return false, fmt.Errorf("%w: %s", errPromotionConflict, release.ID)
+			}
+		}
+		trimmed = prependRelease(timage, release)
+		return true, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	glRetention.Collect(timageName, trimmed)
+	log.Printf("promotion|%s: promoted %s@%s as %s\n", params.ID, sourceRelease.Image, digest, image)
+	return release, nil
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRegistry "k8s.tars.io/registry"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testSourceNamespace = "tars-staging"
+
+func newTestSourceTImage(name, app, server string) *tarsV1beta3.TImage {
+	timage := newTestServerTImage(name, app, server)
+	timage.Namespace = testSourceNamespace
+	timage.Releases = []*tarsV1beta3.TImageRelease{{ID: "v1", Image: "registry.staging/test.helloserver:v1"}}
+	return timage
+}
+
+func TestPromoteAuthorizedBySourceTImage(t *testing.T) {
+	setupTestEnv(t,
+		newTestSourceTImage("test-helloserver", "Test", "HelloServer"),
+		newTestSourceTImage("other-helloserver", "Other", "HelloServer"),
+		newTestSourceTImage("unlabelled", "", ""),
+	)
+	glAuthenticator = newTestAuthenticator(t, newTestTAccount("alice", "alice-token", "Test", DeveloperRole))
+	glPromoter = NewPromoter(tarsRegistry.NewClient(RegistryRequestTimeout, nil), glAuthenticator)
+	createTestTImage(t, newTestServerTImage("test-helloserver", "Test", "HelloServer"))
+
+	server := httptest.NewServer((&RestfulServer{requestTimeout: RequestTimeout}).newRouter())
+	defer server.Close()
+
+	tests := []struct {
+		source  string
+		status  int
+		message string
+	}{
+		// alice could promote into test-helloserver, but could not view the release of other server
+		{"other-helloserver", http.StatusForbidden, "no admin/operator/developer role on Other.HelloServer"},
+		{"unlabelled", http.StatusForbidden, "belongs to no server"},
+		// authorized, the promotion goes on to the registry of this namespace, which is not set
+		{"test-helloserver", http.StatusInternalServerError, "no upload registry value set"},
+	}
+	for _, test := range tests {
+		body := fmt.Sprintf(`{"sourceNamespace":%q,"sourceTImage":%q,"id":"v1"}`, testSourceNamespace, test.source)
+		request, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1beta3/timage/test-helloserver/promotion", strings.NewReader(body))
+		request.Header.Set("Content-Type", "application/json")
+		request.Header.Set("Authorization", "Bearer alice-token")
+		response, err := http.DefaultClient.Do(request)
+		if err != nil {
+			t.Fatal(err)
+		}
+		result := &RestfulResponse{}
+		err = json.NewDecoder(response.Body).Decode(result)
+		_ = response.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if response.StatusCode != test.status || !strings.Contains(result.Message, test.message) {
+			t.Errorf("promote from %s: status = %d, message = %q, want %d, %q", test.source, response.StatusCode, result.Message, test.status, test.message)
+		}
+	}
+
+	if releases := getTestTImage(t, "test-helloserver").Releases; len(releases) != 0 {
+		t.Errorf("releases = %v, want none promoted", releases)
+	}
+}
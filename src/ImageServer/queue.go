@@ -0,0 +1,451 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/util/retry"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRuntime "k8s.tars.io/runtime"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TaskRecord is persisted next to the uploaded server file, so queued tasks survive image server restart
+type TaskRecord struct {
+	Image      string                       `json:"image"`
+	UserParams TaskUserParams               `json:"userParams"`
+	State      tarsV1beta3.TImageBuildState `json:"state"`
+}
+
+var errTaskNotFound = fmt.Errorf("task not found")
+
+var errTaskCancelled = fmt.Errorf("task cancelled")
+
+func taskRecordFile(id string) string {
+	return fmt.Sprintf("%s/%s%s", glPodUploadDir, id, TaskRecordFileSuffix)
+}
+
+func saveTaskRecord(task *Task) error {
+	record := TaskRecord{
+		Image:      task.image,
+		UserParams: task.userParams,
+		State:      task.taskBuildRunningState,
+	}
+	bs, _ := json.Marshal(record)
+	return ioutil.WriteFile(taskRecordFile(task.id), bs, 0666)
+}
+
+func loadTaskRecord(state *tarsV1beta3.TImageBuildState) (*Task, error) {
+	bs, err := ioutil.ReadFile(taskRecordFile(state.ID))
+	if err != nil {
+		return nil, err
+	}
+	record := &TaskRecord{}
+	if err = json.Unmarshal(bs, record); err != nil {
+		return nil, err
+	}
+	// fetched source is downloaded again when building
+	if record.UserParams.Source == nil {
+		if _, err = os.Stat(record.UserParams.ServerFile); err != nil {
+			return nil, err
+		}
+	}
+	return &Task{
+		id:                    state.ID,
+		createTime:            state.CreateTime,
+		image:                 record.Image,
+		userParams:            record.UserParams,
+		taskBuildRunningState: *state,
+		handler:               glPodName,
+	}, nil
+}
+
+func removeTaskFiles(task *Task) {
+	_ = os.Remove(taskRecordFile(task.id))
+	if task.userParams.ServerFile != "" {
+		_ = os.Remove(task.userParams.ServerFile)
+	}
+}
+
+// updateTImage apply fn to the latest timage then update it, retry on conflict.
+// fn returns false if the timage need not to be updated
+func updateTImage(name string, fn func(timage *tarsV1beta3.TImage) (bool, error)) (*tarsV1beta3.TImage, error) {
+	var result *tarsV1beta3.TImage
+	err := retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		timage, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Get(context.TODO(), name, k8sMetaV1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		if timage.Build == nil {
+			timage.Build = &tarsV1beta3.TImageBuild{}
+		}
+		update, err := fn(timage)
+		if err != nil {
+			return err
+		}
+		if !update {
+			result = timage
+			return nil
+		}
+		result, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Update(context.TODO(), timage, k8sMetaV1.UpdateOptions{})
+		return err
+	})
+	return result, err
+}
+
+// insertQueue insert state after all the states with equal or higher priority, return 1-based position
+func insertQueue(queue []*tarsV1beta3.TImageBuildState, state *tarsV1beta3.TImageBuildState) ([]*tarsV1beta3.TImageBuildState, int) {
+	index := len(queue)
+	for i, v := range queue {
+		if v.Priority < state.Priority {
+			index = i
+			break
+		}
+	}
+	queue = append(queue, nil)
+	copy(queue[index+1:], queue[index:])
+	queue[index] = state
+	return queue, index + 1
+}
+
+// cancelBuilderPod mark the kaniko pod as cancelled then delete it, the handler watching the pod see the mark on deletion
+func cancelBuilderPod(id string) error {
+	podName := builderPodName(id)
+	patch := fmt.Sprintf(`{"metadata":{"annotations":{"%s":"true"}}}`, BuilderCancelledAnnotation)
+	_, err := tarsRuntime.Clients.K8sClient.CoreV1().Pods(tarsRuntime.Namespace).Patch(context.TODO(), podName, types.MergePatchType, []byte(patch), k8sMetaV1.PatchOptions{})
+	if err != nil {
+		return err
+	}
+	deleteBuilderPod(id)
+	return nil
+}
+
+func deleteBuilderPod(id string) {
+	podName := builderPodName(id)
+	err := tarsRuntime.Clients.K8sClient.CoreV1().Pods(tarsRuntime.Namespace).Delete(context.TODO(), podName, k8sMetaV1.DeleteOptions{})
+	if err != nil && !errors.IsNotFound(err) {
+		log.Printf("task|%s: delete pod %s failed: %s\n", id, podName, err.Error())
+	}
+}
+
+// CancelTask remove a queued task of timage, or stop the running one by deleting its kaniko pod
+func (e *Engine) CancelTask(timageName, id string) error {
+	var running *tarsV1beta3.TImageBuildState
+	_, err := updateTImage(timageName, func(timage *tarsV1beta3.TImage) (bool, error) {
+		for i, state := range timage.Build.Queue {
+			if state.ID == id {
+				timage.Build.Queue = append(timage.Build.Queue[:i], timage.Build.Queue[i+1:]...)
+				return true, nil
+			}
+		}
+		if timage.Build.Running != nil && timage.Build.Running.ID == id {
+			running = timage.Build.Running
+			return false, nil
+		}
+		return false, errTaskNotFound
+	})
+	if err != nil {
+		return err
+	}
+	if running != nil {
+		return e.cancelRunning(running)
+	}
+
+	e.mutex.Lock()
+	task, ok := e.tasks[id]
+	delete(e.tasks, id)
+	e.mutex.Unlock()
+
+	if ok {
+		log.Printf("task|%s: cancelled\n", id)
+		removeTaskFiles(task)
+		if task.waitChan != nil {
+			task.waitChan <- errTaskCancelled
+		}
+	}
+	return nil
+}
+
+func (e *Engine) cancelRunning(state *tarsV1beta3.TImageBuildState) error {
+	if state.Handler != glPodName {
+		// the handler of task may be another replica, only the submitted kaniko pod could be cancelled from here
+		if err := cancelBuilderPod(state.ID); err != nil {
+			if errors.IsNotFound(err) {
+				return fmt.Errorf("task %s is preparing on handler %s, retry later", state.ID, state.Handler)
+			}
+			return err
+		}
+		log.Printf("task|%s: cancelling on handler %s\n", state.ID, state.Handler)
+		return nil
+	}
+
+	e.mutex.Lock()
+	task, ok := e.tasks[state.ID]
+	if ok {
+		task.cancelled = true
+	}
+	e.mutex.Unlock()
+
+	if !ok {
+		return errTaskNotFound
+	}
+
+	log.Printf("task|%s: cancelling\n", state.ID)
+	if err := cancelBuilderPod(state.ID); err != nil && !errors.IsNotFound(err) {
+		log.Printf("task|%s: cancel pod failed: %s\n", state.ID, err.Error())
+	}
+	return nil
+}
+
+func (e *Engine) isCancelled(task *Task) bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return task.cancelled
+}
+
+// dequeue move the head of timage queue to running if it was posted to this handler and nothing is running
+func (e *Engine) dequeue(timageName string) *Task {
+	var state *tarsV1beta3.TImageBuildState
+	var cancelled []string
+
+	timage, err := updateTImage(timageName, func(timage *tarsV1beta3.TImage) (bool, error) {
+		state, cancelled = nil, nil
+
+		queued := map[string]interface{}{}
+		for _, v := range timage.Build.Queue {
+			queued[v.ID] = nil
+		}
+		if timage.Build.Running != nil {
+			queued[timage.Build.Running.ID] = nil
+		}
+		e.mutex.Lock()
+		for id, task := range e.tasks {
+			if task.userParams.Timage != timageName || !task.queued || e.building[timageName] == id {
+				continue
+			}
+			if _, ok := queued[id]; !ok {
+				// removed from .build.queue by someone else
+				cancelled = append(cancelled, id)
+			}
+		}
+		e.mutex.Unlock()
+
+		if timage.Build.Running != nil || len(timage.Build.Queue) == 0 || timage.Build.Queue[0].Handler != glPodName {
+			return false, nil
+		}
+		startTime := k8sMetaV1.Now()
+		state = timage.Build.Queue[0]
+		state.Phase = BuildPhasePending
+		state.Message = "pending"
+		state.StartTime = &startTime
+		timage.Build.Running = state
+		timage.Build.Queue = timage.Build.Queue[1:]
+		return true, nil
+	})
+
+	for _, id := range cancelled {
+		e.mutex.Lock()
+		task, ok := e.tasks[id]
+		delete(e.tasks, id)
+		e.mutex.Unlock()
+		if !ok {
+			// cancelled by CancelTask meanwhile
+			continue
+		}
+		log.Printf("task|%s: removed from queue\n", id)
+		removeTaskFiles(task)
+		if task.waitChan != nil {
+			task.waitChan <- errTaskCancelled
+		}
+	}
+
+	if err != nil {
+		log.Printf("dequeue timage %s failed: %s\n", timageName, err.Error())
+		return nil
+	}
+
+	if state == nil {
+		return nil
+	}
+
+	e.mutex.Lock()
+	task, ok := e.tasks[state.ID]
+	e.mutex.Unlock()
+
+	if !ok {
+		task, err = loadTaskRecord(state)
+		if err != nil {
+			log.Printf("task|%s: load task record failed: %s\n", state.ID, err.Error())
+			task = &Task{id: state.ID, timage: timage, taskBuildRunningState: *state, userParams: TaskUserParams{Timage: timageName}}
+			e.onBuildFailed(task, fmt.Errorf("load task record failed: %s", err.Error()))
+			return nil
+		}
+		task.queued = true
+		e.mutex.Lock()
+		e.tasks[state.ID] = task
+		e.mutex.Unlock()
+	}
+
+	task.timage = timage
+	task.taskBuildRunningState = *state
+	return task
+}
+
+// schedule dispatch tasks to workers, at most one running task per timage
+func (e *Engine) schedule() {
+	e.mutex.Lock()
+	var timages []string
+	pending := map[string]interface{}{}
+	for _, task := range e.tasks {
+		name := task.userParams.Timage
+		if _, ok := e.building[name]; ok {
+			continue
+		}
+		if _, ok := pending[name]; !ok {
+			pending[name] = nil
+			timages = append(timages, name)
+		}
+	}
+	e.mutex.Unlock()
+
+	for _, name := range timages {
+		e.mutex.Lock()
+		full := len(e.building) >= e.threads
+		e.mutex.Unlock()
+		if full {
+			return
+		}
+
+		task := e.dequeue(name)
+		if task == nil {
+			continue
+		}
+		e.mutex.Lock()
+		e.building[name] = task.id
+		e.mutex.Unlock()
+		e.buildChan <- task
+	}
+}
+
+func (e *Engine) wake() {
+	select {
+	case e.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+func (e *Engine) finish(task *Task) {
+	e.mutex.Lock()
+	delete(e.tasks, task.id)
+	if e.building[task.userParams.Timage] == task.id {
+		delete(e.building, task.userParams.Timage)
+	}
+	e.mutex.Unlock()
+	removeTaskFiles(task)
+	e.wake()
+}
+
+// restore reload tasks queued to this handler before restart, interrupted running task is queued again at front
+func (e *Engine) restore() {
+	timages, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
+	if err != nil {
+		log.Printf("list timages failed: %s\n", err.Error())
+		return
+	}
+
+	for i := range timages.Items {
+		timage := &timages.Items[i]
+		if timage.Build == nil {
+			continue
+		}
+
+		var restored []*Task
+		_, err = updateTImage(timage.Name, func(timage *tarsV1beta3.TImage) (bool, error) {
+			restored = nil
+			update := false
+			var queue []*tarsV1beta3.TImageBuildState
+
+			if running := timage.Build.Running; running != nil && running.Handler == glPodName {
+				deleteBuilderPod(running.ID)
+				running.Phase = BuildPhaseQueued
+				running.Message = "queued again after image server restart"
+				running.StartTime = nil
+				queue = append(queue, running)
+				timage.Build.Running = nil
+				update = true
+			}
+			queue = append(queue, timage.Build.Queue...)
+
+			timage.Build.Queue = nil
+			for _, state := range queue {
+				if state.Handler != glPodName {
+					timage.Build.Queue = append(timage.Build.Queue, state)
+					continue
+				}
+				task, err := loadTaskRecord(state)
+				if err != nil {
+					log.Printf("task|%s: drop from queue because load task record failed: %s\n", state.ID, err.Error())
+					update = true
+					continue
+				}
+				restored = append(restored, task)
+				timage.Build.Queue = append(timage.Build.Queue, state)
+			}
+			return update, nil
+		})
+
+		if err != nil {
+			log.Printf("restore queue of timage %s failed: %s\n", timage.Name, err.Error())
+			continue
+		}
+
+		e.mutex.Lock()
+		for _, task := range restored {
+			log.Printf("task|%s: restored\n", task.id)
+			task.queued = true
+			e.tasks[task.id] = task
+		}
+		e.mutex.Unlock()
+	}
+
+	// files not belong to any restored task are left by finished tasks
+	files, _ := ioutil.ReadDir(glPodUploadDir)
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	for _, file := range files {
+		keep := false
+		for id := range e.tasks {
+			if strings.Contains(file.Name(), id) {
+				keep = true
+				break
+			}
+		}
+		if !keep {
+			_ = os.RemoveAll(filepath.Join(glPodUploadDir, file.Name()))
+		}
+	}
+}
+
+func (e *Engine) runScheduler(stopChan chan struct{}) {
+	e.restore()
+
+	ticker := time.NewTicker(ScheduleInterval)
+	defer ticker.Stop()
+	for {
+		e.schedule()
+		select {
+		case <-e.wakeChan:
+		case <-ticker.C:
+		case <-stopChan:
+			return
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"io/ioutil"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sTesting "k8s.io/client-go/testing"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newTestTImage(name string, running *tarsV1beta3.TImageBuildState, queue ...*tarsV1beta3.TImageBuildState) *tarsV1beta3.TImage {
+	return &tarsV1beta3.TImage{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: name, Namespace: testNamespace},
+		ImageType:  TImageTypeServer,
+		Build:      &tarsV1beta3.TImageBuild{Running: running, Queue: queue},
+	}
+}
+
+// newTestServerTImage return a timage of server app.server, whose owner labels are set
+func newTestServerTImage(name, app, server string) *tarsV1beta3.TImage {
+	timage := newTestTImage(name, nil)
+	timage.Labels = map[string]string{tarsMeta.TServerAppLabel: app, tarsMeta.TServerNameLabel: server}
+	return timage
+}
+
+// newQueuedTask create a task of timage posted to handler, with its record and server file saved
+func newQueuedTask(t *testing.T, timageName, id, handler string) (*Task, *tarsV1beta3.TImageBuildState) {
+	state := &tarsV1beta3.TImageBuildState{ID: id, Phase: BuildPhaseQueued, Handler: handler}
+	task := &Task{
+		id:                    id,
+		handler:               handler,
+		queued:                true,
+		taskBuildRunningState: *state,
+		userParams: TaskUserParams{
+			Timage:     timageName,
+			ServerFile: filepath.Join(glPodUploadDir, "Test.HelloServer-"+id+".tgz"),
+		},
+	}
+	if handler == glPodName {
+		if err := ioutil.WriteFile(task.userParams.ServerFile, []byte("server"), 0666); err != nil {
+			t.Fatal(err)
+		}
+		if err := saveTaskRecord(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return task, state
+}
+
+func TestDequeue(t *testing.T) {
+	setupTestEnv(t)
+	removed, _ := newQueuedTask(t, "test-helloserver", "v1", glPodName)
+	head, headState := newQueuedTask(t, "test-helloserver", "v2", glPodName)
+	createTestTImage(t, newTestTImage("test-helloserver", nil, headState))
+
+	engine := NewEngine()
+	removed.waitChan = make(chan error, 1)
+	engine.tasks[removed.id] = removed
+	engine.tasks[head.id] = head
+
+	task := engine.dequeue("test-helloserver")
+	if task != head {
+		t.Fatalf("dequeue should return the head of queue, got %v", task)
+	}
+	if task.taskBuildRunningState.Phase != BuildPhasePending || task.timage == nil {
+		t.Errorf("dequeued task should be pending, got %q", task.taskBuildRunningState.Phase)
+	}
+	if _, ok := engine.tasks[removed.id]; ok {
+		t.Errorf("task removed from .build.queue should be dropped")
+	}
+	if err := <-removed.waitChan; err != errTaskCancelled {
+		t.Errorf("waiter of removed task should get errTaskCancelled, got %v", err)
+	}
+	if _, err := os.Stat(removed.userParams.ServerFile); !os.IsNotExist(err) {
+		t.Errorf("server file of removed task should be deleted")
+	}
+
+	timage := getTestTImage(t, "test-helloserver")
+	if timage.Build.Running == nil || timage.Build.Running.ID != head.id || len(timage.Build.Queue) != 0 {
+		t.Errorf("head of queue should be running, got %+v", timage.Build)
+	}
+}
+
+func TestDequeueTaskCancelledMeanwhile(t *testing.T) {
+	crdClient := setupTestEnv(t)
+	cancelled, _ := newQueuedTask(t, "test-helloserver", "v1", glPodName)
+	head, headState := newQueuedTask(t, "test-helloserver", "v2", glPodName)
+	createTestTImage(t, newTestTImage("test-helloserver", nil, headState))
+
+	engine := NewEngine()
+	engine.tasks[cancelled.id] = cancelled
+	engine.tasks[head.id] = head
+
+	// CancelTask drops the task after dequeue found it missing from .build.queue
+	crdClient.PrependReactor("update", "timages", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		engine.mutex.Lock()
+		delete(engine.tasks, cancelled.id)
+		engine.mutex.Unlock()
+		return false, nil, nil
+	})
+
+	if task := engine.dequeue("test-helloserver"); task != head {
+		t.Fatalf("dequeue should return the head of queue, got %v", task)
+	}
+}
+
+func TestRestore(t *testing.T) {
+	setupTestEnv(t)
+	running, runningState := newQueuedTask(t, "test-helloserver", "v1", glPodName)
+	runningState.Phase = BuildPhasePreparePushing
+	_, othersState := newQueuedTask(t, "test-helloserver", "v2", "tars-tarsimage-1")
+	queued, queuedState := newQueuedTask(t, "test-helloserver", "v3", glPodName)
+	lost, lostState := newQueuedTask(t, "test-helloserver", "v4", glPodName)
+	_ = os.Remove(lost.userParams.ServerFile)
+
+	orphan := filepath.Join(glPodUploadDir, "Test.HelloServer-v0.tgz")
+	if err := ioutil.WriteFile(orphan, []byte("server"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	createTestTImage(t, newTestTImage("test-helloserver", runningState, othersState, queuedState, lostState))
+
+	engine := NewEngine()
+	engine.restore()
+
+	timage := getTestTImage(t, "test-helloserver")
+	if timage.Build.Running != nil {
+		t.Errorf("interrupted running task should be queued again")
+	}
+	var ids []string
+	for _, state := range timage.Build.Queue {
+		ids = append(ids, state.ID)
+	}
+	if len(ids) != 3 || ids[0] != running.id || ids[1] != othersState.ID || ids[2] != queued.id {
+		t.Errorf("queue should be [v1 v2 v3], got %v", ids)
+	}
+	if timage.Build.Queue[0].Phase != BuildPhaseQueued {
+		t.Errorf("requeued task should be %s, got %s", BuildPhaseQueued, timage.Build.Queue[0].Phase)
+	}
+
+	if len(engine.tasks) != 2 || engine.tasks[running.id] == nil || engine.tasks[queued.id] == nil {
+		t.Errorf("tasks of this handler should be restored, got %v", engine.tasks)
+	}
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Errorf("files of finished tasks should be deleted")
+	}
+	if _, err := os.Stat(queued.userParams.ServerFile); err != nil {
+		t.Errorf("files of restored tasks should be kept: %s", err.Error())
+	}
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const testManifestMediaType = "application/vnd.docker.distribution.manifest.v2+json"
+
+// testRegistry is an in-process registry serving the part of Docker Registry HTTP API V2 used by image server
+type testRegistry struct {
+	*httptest.Server
+	// username and password are required by basic auth if set
+	username string
+	password string
+
+	mutex     sync.Mutex
+	manifests map[string][]byte            // repository@digest -> content
+	tags      map[string]map[string]string // repository -> tag -> digest
+	blobs     map[string][]byte            // repository@digest -> content
+	failures  map[string]int               // repository:reference -> status code of manifest requests
+}
+
+func newTestRegistry(t *testing.T, tls bool) *testRegistry {
+	r := &testRegistry{
+		manifests: map[string][]byte{},
+		tags:      map[string]map[string]string{},
+		blobs:     map[string][]byte{},
+		failures:  map[string]int{},
+	}
+	if tls {
+		r.Server = httptest.NewTLSServer(r)
+	} else {
+		r.Server = httptest.NewServer(r)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+// Host return the registry host images are referenced by
+func (r *testRegistry) Host() string {
+	return strings.TrimPrefix(strings.TrimPrefix(r.URL, "https://"), "http://")
+}
+
+func blobDigest(content []byte) string {
+	return fmt.Sprintf("sha256:%x", sha256.Sum256(content))
+}
+
+// push store an image of repository with one layer, tagged as tag, and return its manifest digest
+func (r *testRegistry) push(repository, tag, layer string) string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	config := []byte(fmt.Sprintf(`{"layer":%q}`, layer))
+	r.blobs[repository+"@"+blobDigest(config)] = config
+	r.blobs[repository+"@"+blobDigest([]byte(layer))] = []byte(layer)
+
+	content, _ := json.Marshal(&manifest{
+		SchemaVersion: 2,
+		MediaType:     testManifestMediaType,
+		Config:        &manifestDescriptor{MediaType: "application/vnd.docker.container.image.v1+json", Digest: blobDigest(config)},
+		Layers:        []manifestDescriptor{{MediaType: "application/vnd.docker.image.rootfs.diff.tar.gzip", Digest: blobDigest([]byte(layer))}},
+	})
+	digest := blobDigest(content)
+	r.manifests[repository+"@"+digest] = content
+	r.tagLocked(repository, tag, digest)
+	return digest
+}
+
+func (r *testRegistry) tagLocked(repository, tag, digest string) {
+	if r.tags[repository] == nil {
+		r.tags[repository] = map[string]string{}
+	}
+	r.tags[repository][tag] = digest
+}
+
+// exists return whether tag or digest of repository is still in the registry
+func (r *testRegistry) exists(repository, reference string) bool {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if digest, ok := r.tags[repository][reference]; ok {
+		reference = digest
+	}
+	_, ok := r.manifests[repository+"@"+reference]
+	return ok
+}
+
+func (r *testRegistry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if r.username != "" {
+		if username, password, ok := request.BasicAuth(); !ok || username != r.username || password != r.password {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(request.URL.Path, "/v2/")
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch {
+	case strings.Contains(path, "/manifests/"):
+		i := strings.LastIndex(path, "/manifests/")
+		r.serveManifest(writer, request, path[:i], path[i+len("/manifests/"):])
+	case strings.HasSuffix(path, "/blobs/uploads/"):
+		repository := strings.TrimSuffix(path, "/blobs/uploads/")
+		if mount, from := request.URL.Query().Get("mount"), request.URL.Query().Get("from"); mount != "" {
+			if content, ok := r.blobs[from+"@"+mount]; ok {
+				r.blobs[repository+"@"+mount] = content
+				writer.WriteHeader(http.StatusCreated)
+				return
+			}
+		}
+		writer.Header().Set("Location", fmt.Sprintf("/v2/%s/blobs/uploads/session", repository))
+		writer.WriteHeader(http.StatusAccepted)
+	case strings.HasSuffix(path, "/blobs/uploads/session") && request.Method == http.MethodPut:
+		repository := strings.TrimSuffix(path, "/blobs/uploads/session")
+		content, _ := ioutil.ReadAll(request.Body)
+		if digest := request.URL.Query().Get("digest"); digest != blobDigest(content) {
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		r.blobs[repository+"@"+blobDigest(content)] = content
+		writer.WriteHeader(http.StatusCreated)
+	case strings.Contains(path, "/blobs/"):
+		i := strings.LastIndex(path, "/blobs/")
+		content, ok := r.blobs[path[:i]+"@"+path[i+len("/blobs/"):]]
+		if !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writer.Header().Set("Content-Length", fmt.Sprint(len(content)))
+		writer.WriteHeader(http.StatusOK)
+		if request.Method == http.MethodGet {
+			_, _ = writer.Write(content)
+		}
+	default:
+		writer.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (r *testRegistry) serveManifest(writer http.ResponseWriter, request *http.Request, repository, reference string) {
+	if code, ok := r.failures[repository+":"+reference]; ok {
+		writer.WriteHeader(code)
+		return
+	}
+
+	if request.Method == http.MethodPut {
+		content, _ := ioutil.ReadAll(request.Body)
+		digest := blobDigest(content)
+		r.manifests[repository+"@"+digest] = content
+		if !strings.HasPrefix(reference, "sha256:") {
+			r.tagLocked(repository, reference, digest)
+		}
+		writer.Header().Set("Docker-Content-Digest", digest)
+		writer.WriteHeader(http.StatusCreated)
+		return
+	}
+
+	digest := reference
+	if v, ok := r.tags[repository][reference]; ok {
+		digest = v
+	}
+	content, ok := r.manifests[repository+"@"+digest]
+	if !ok {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	switch request.Method {
+	case http.MethodDelete:
+		if digest != reference {
+			// manifests could only be deleted by digest
+			writer.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		delete(r.manifests, repository+"@"+digest)
+		for tag, v := range r.tags[repository] {
+			if v == digest {
+				delete(r.tags[repository], tag)
+			}
+		}
+		writer.WriteHeader(http.StatusAccepted)
+	case http.MethodHead, http.MethodGet:
+		writer.Header().Set("Content-Type", testManifestMediaType)
+		writer.Header().Set("Docker-Content-Digest", digest)
+		writer.WriteHeader(http.StatusOK)
+		if request.Method == http.MethodGet {
+			_, _ = writer.Write(content)
+		}
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -1,34 +1,84 @@
 package main
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
+	goerrors "errors"
 	"fmt"
 	"github.com/gorilla/mux"
 	"hash/crc32"
 	"io"
+	"k8s.io/apimachinery/pkg/api/errors"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/rand"
 	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsTool "k8s.tars.io/tool"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"time"
 )
 
 type BuildResult struct {
-	ID     string `json:"id"`
-	Image  string `json:"image"`
-	Secret string `json:"secret"`
-	Source string `json:"source"`
+	ID       string `json:"id"`
+	Image    string `json:"image"`
+	Secret   string `json:"secret"`
+	Source   string `json:"source"`
+	Position int    `json:"position,omitempty"`
+}
+
+type TaskResult struct {
+	ID         string          `json:"id"`
+	Source     string          `json:"source"`
+	Image      string          `json:"image"`
+	Phase      string          `json:"phase"`
+	Message    string          `json:"message"`
+	Handler    string          `json:"handler"`
+	Position   int             `json:"position,omitempty"`
+	CreateTime k8sMetaV1.Time  `json:"createTime"`
+	StartTime  *k8sMetaV1.Time `json:"startTime,omitempty"`
+	FinishTime *k8sMetaV1.Time `json:"finishTime,omitempty"`
+	Commit     string          `json:"commit,omitempty"`
+	Digest     string          `json:"digest,omitempty"`
 }
 
 type RestfulResponse struct {
-	Status  int          `json:"status"`
-	Message string       `json:"message"`
-	Result  *BuildResult `json:"result,omitempty"`
-	Handler string       `json:"handler,omitempty"`
+	Status  int                        `json:"status"`
+	Message string                     `json:"message"`
+	Result  *BuildResult               `json:"result,omitempty"`
+	Task    *TaskResult                `json:"task,omitempty"`
+	Release *tarsV1beta3.TImageRelease `json:"release,omitempty"`
+	Handler string                     `json:"handler,omitempty"`
+	Errors  []FieldError               `json:"errors,omitempty"`
+}
+
+func writeResponse(writer http.ResponseWriter, response *RestfulResponse) {
+	bs, _ := json.Marshal(response)
+	writer.WriteHeader(response.Status)
+	_, _ = writer.Write(bs)
+}
+
+// failResponse fill response with err, validation errors are reported field by field with 400
+func failResponse(response *RestfulResponse, status int, err error) {
+	response.Status = status
+	response.Message = err.Error()
+	if validationError, ok := err.(*ValidationError); ok {
+		response.Status = http.StatusBadRequest
+		response.Errors = validationError.Errors
+	}
+}
+
+// taskErrorStatus map errors of task lookup to http status
+func taskErrorStatus(err error) int {
+	if err == errTaskNotFound || err == errTaskLogNotFound || errors.IsNotFound(err) {
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
 }
 
 func Handler(engine *Engine, writer http.ResponseWriter, r *http.Request) {
@@ -65,103 +115,76 @@ func Handler(engine *Engine, writer http.ResponseWriter, r *http.Request) {
 			break
 		}
 
-		if err = r.ParseMultipartForm(1 * 1024 * 1024 * 150); err != nil {
-			err = fmt.Errorf("parse form error: %s", err.Error())
-			response.Status = http.StatusBadRequest
-			response.Message = err.Error()
+		var taccount *tarsV1beta3.TAccount
+		if taccount, err = glAuthenticator.Authenticate(r); err != nil {
+			failResponse(response, authErrorStatus(writer, err), err)
 			break
 		}
 
-		var multipartServerFile multipart.File
-		var multipartFileHandler *multipart.FileHeader
-		if multipartServerFile, multipartFileHandler, err = r.FormFile(ServerFileFormKey); err != nil {
-			err = fmt.Errorf("parse form error: %s", err.Error())
-			response.Status = http.StatusBadRequest
-			response.Message = err.Error()
-			utilRuntime.HandleError(err)
-			break
+		// authorized against the timage of request path, the server of request is not trusted until it is checked to own the timage
+		var timage *tarsV1beta3.TImage
+		if taccount != nil {
+			if timage, err = glAuthenticator.AuthorizeTImage(taccount, timageName, buildRoles); err != nil {
+				failResponse(response, authErrorStatus(writer, err), err)
+				break
+			}
 		}
 
-		task := &Task{
-			id:         fmt.Sprintf("v%s-%x-%x", time.Now().Format("20060102030405"), crc32.ChecksumIEEE([]byte(glPodName)), rand.Intn(0xefff)+0x1000),
-			createTime: k8sMetaV1.Now(),
-			handler:    glPodName,
-			userParams: TaskUserParams{
-				Timage:          timageName,
-				ServerApp:       r.FormValue(ServerAppFormKey),
-				ServerName:      r.FormValue(ServerNameFormKey),
-				ServerType:      r.FormValue(ServerTypeFormKey),
-				ServerTag:       r.FormValue(ServerTagFormKey),
-				ServerFile:      "",
-				Secret:          r.FormValue(ServerSecretFormKey),
-				BaseImage:       r.FormValue(BaseImageFormKey),
-				BaseImageSecret: r.FormValue(BaseImageSecretFormKey),
-				CreatePerson:    r.FormValue(CreatePersonFormKey),
-				Mark:            r.FormValue(MarkFormKey),
-			},
-		}
-
-		//if ok, err = validateUserParams(task.userParams); !ok {
-		//	err = fmt.Errorf("invalid fields format %s", err.Error())
-		//	response.Status = http.StatusBadRequest
-		//	response.Message = err.Error()
-		//	utilRuntime.HandleError(err)
-		//	break
-		//}
-
-		var serverFile string
-		multipartFileName := multipartFileHandler.Filename
-		if strings.HasSuffix(multipartFileName, ".tar.gz") || strings.HasSuffix(multipartFileName, ".tgz") {
-			serverFile = fmt.Sprintf("%s/%s.%s-%s%s", glPodUploadDir, task.userParams.ServerApp, task.userParams.ServerName, task.id, ".tgz")
-		} else if strings.HasSuffix(multipartFileName, ".war") || strings.HasSuffix(multipartFileName, ".jar") {
-			serverFile = fmt.Sprintf("%s/%s.%s-%s%s", glPodUploadDir, task.userParams.ServerApp, task.userParams.ServerName, task.id, filepath.Ext(multipartFileName))
+		var task *Task
+		var status int
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+			task, status, err = parseJsonRequest(r, timageName)
 		} else {
-			err = fmt.Errorf("unsupported server file type %s", serverFile)
-			response.Status = http.StatusBadRequest
-			response.Message = err.Error()
+			task, status, err = parseMultipartRequest(r, timageName)
+		}
+		if err != nil {
+			failResponse(response, status, err)
 			utilRuntime.HandleError(err)
 			break
 		}
-		task.userParams.ServerFile = serverFile
+		serverFile := task.userParams.ServerFile
 
-		f, _ := os.OpenFile(serverFile, os.O_CREATE|os.O_WRONLY, 0666)
-		if _, err = io.Copy(f, multipartServerFile); err != nil {
-			_ = os.Remove(serverFile)
-			err = fmt.Errorf("write file(%s) error: %s", serverFile, err.Error())
-			response.Status = http.StatusInternalServerError
-			response.Message = err.Error()
+		if timage != nil {
+			if err = checkTImageOwner(timage, task.userParams.ServerApp, task.userParams.ServerName); err != nil {
+				_ = os.Remove(serverFile)
+				failResponse(response, http.StatusBadRequest, err)
+				break
+			}
+			// the authenticated user is trusted instead of the request value
+			task.userParams.CreatePerson = taccount.Spec.Username
+		}
+
+		if err = resolveTaskSource(task); err != nil {
+			failResponse(response, http.StatusBadRequest, err)
 			utilRuntime.HandleError(err)
 			break
 		}
 
-		go func() {
-			time.Sleep(AutoDeleteServerFileDuration)
-			_ = os.Remove(serverFile)
-		}()
-
 		var image string
+		var position int
 
 		if wait != "1" && wait != "true" {
-			if image, err = engine.PostTask(task); err != nil {
-				response.Status = http.StatusInternalServerError
-				response.Message = err.Error()
+			if image, position, err = engine.PostTask(task); err != nil {
+				_ = os.Remove(serverFile)
+				failResponse(response, http.StatusInternalServerError, err)
 				break
 			}
 			response.Status = http.StatusCreated
 			response.Message = http.StatusText(http.StatusCreated)
 			response.Result = &BuildResult{
-				ID:     task.id,
-				Image:  image,
-				Secret: task.userParams.Secret,
-				Source: timageName,
+				ID:       task.id,
+				Image:    image,
+				Secret:   task.userParams.Secret,
+				Source:   timageName,
+				Position: position,
 			}
 			break
 		}
 
 		task.waitChan = make(chan error, 1)
-		if image, err = engine.PostTask(task); err != nil {
-			response.Status = http.StatusInternalServerError
-			response.Message = err.Error()
+		if image, _, err = engine.PostTask(task); err != nil {
+			_ = os.Remove(serverFile)
+			failResponse(response, http.StatusInternalServerError, err)
 			break
 		}
 
@@ -185,35 +208,436 @@ func Handler(engine *Engine, writer http.ResponseWriter, r *http.Request) {
 
 		break
 	}
-	bs, _ := json.Marshal(response)
-	writer.WriteHeader(response.Status)
-	_, _ = writer.Write(bs)
+	writeResponse(writer, response)
+}
+
+func validDockerfileParams(params *TaskUserParams) error {
+	if _, err := tarsTool.ParseDockerfileFragment(params.Dockerfile); err != nil {
+		return newValidationError("dockerfile", "dockerfile", "%s", err.Error())
+	}
+	if err := tarsTool.ValidBuildArgs(params.BuildArgs); err != nil {
+		return newValidationError("buildArgs", "buildArgs", "%s", err.Error())
+	}
+	return nil
+}
+
+func newTask(timageName string) *Task {
+	return &Task{
+		id:         fmt.Sprintf("v%s-%x-%x", time.Now().Format("20060102030405"), crc32.ChecksumIEEE([]byte(glPodName)), rand.Intn(0xefff)+0x1000),
+		createTime: k8sMetaV1.Now(),
+		handler:    glPodName,
+		userParams: TaskUserParams{
+			Timage: timageName,
+		},
+	}
+}
+
+// parseMultipartRequest build task from form values, and save the uploaded ServerFile
+func parseMultipartRequest(r *http.Request, timageName string) (*Task, int, error) {
+	if r.ContentLength > glMaxUploadSize {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request size should be no larger than %d bytes", glMaxUploadSize)
+	}
+
+	var err error
+	r.Body = http.MaxBytesReader(nil, r.Body, glMaxUploadSize)
+	if err = r.ParseMultipartForm(MultipartMemorySize); err != nil {
+		if strings.Contains(err.Error(), "request body too large") {
+			return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request size should be no larger than %d bytes", glMaxUploadSize)
+		}
+		return nil, http.StatusBadRequest, fmt.Errorf("parse form error: %s", err.Error())
+	}
+	defer func() { _ = r.MultipartForm.RemoveAll() }()
+
+	var multipartServerFile multipart.File
+	var multipartFileHandler *multipart.FileHeader
+	if multipartServerFile, multipartFileHandler, err = r.FormFile(ServerFileFormKey); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("parse form error: %s", err.Error())
+	}
+	defer multipartServerFile.Close()
+
+	var priority int
+	if value := r.FormValue(PriorityFormKey); value != "" {
+		if priority, err = strconv.Atoi(value); err != nil {
+			return nil, http.StatusBadRequest, newValidationError("priority", "int", "%q is not an integer", value)
+		}
+	}
+
+	task := newTask(timageName)
+	task.userParams = TaskUserParams{
+		Timage:          timageName,
+		ServerApp:       r.FormValue(ServerAppFormKey),
+		ServerName:      r.FormValue(ServerNameFormKey),
+		ServerType:      r.FormValue(ServerTypeFormKey),
+		ServerTag:       r.FormValue(ServerTagFormKey),
+		ServerFile:      "",
+		Secret:          r.FormValue(ServerSecretFormKey),
+		BaseImage:       r.FormValue(BaseImageFormKey),
+		BaseImageSecret: r.FormValue(BaseImageSecretFormKey),
+		CreatePerson:    r.FormValue(CreatePersonFormKey),
+		Mark:            r.FormValue(MarkFormKey),
+		GitSha:          r.FormValue(GitShaFormKey),
+		Priority:        int32(priority),
+		Dockerfile:      r.FormValue(DockerfileFormKey),
+	}
+
+	for _, value := range r.MultipartForm.Value[BuildArgFormKey] {
+		kv := strings.SplitN(value, "=", 2)
+		if len(kv) != 2 {
+			return nil, http.StatusBadRequest, newValidationError("buildArgs", "buildArgs", "%q should be NAME=VALUE", value)
+		}
+		if task.userParams.BuildArgs == nil {
+			task.userParams.BuildArgs = map[string]string{}
+		}
+		task.userParams.BuildArgs[kv[0]] = kv[1]
+	}
+
+	// ServerApp and ServerName are part of the upload file name, validate them before saving
+	if err = validateParams(&task.userParams); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err = validDockerfileParams(&task.userParams); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	checksum := strings.ToLower(r.FormValue(ServerFileSha256FormKey))
+	if checksum != "" && !sha256Regex.MatchString(checksum) {
+		return nil, http.StatusBadRequest, newValidationError("serverFileSha256", "sha256", "%q is not a sha256 hex digest", checksum)
+	}
+
+	var serverFile string
+	multipartFileName := multipartFileHandler.Filename
+	if strings.HasSuffix(multipartFileName, ".tar.gz") || strings.HasSuffix(multipartFileName, ".tgz") {
+		serverFile = fmt.Sprintf("%s/%s.%s-%s%s", glPodUploadDir, task.userParams.ServerApp, task.userParams.ServerName, task.id, ".tgz")
+	} else if strings.HasSuffix(multipartFileName, ".war") || strings.HasSuffix(multipartFileName, ".jar") {
+		serverFile = fmt.Sprintf("%s/%s.%s-%s%s", glPodUploadDir, task.userParams.ServerApp, task.userParams.ServerName, task.id, filepath.Ext(multipartFileName))
+	} else {
+		return nil, http.StatusBadRequest, newValidationError("serverFile", "type", "unsupported server file type %s", multipartFileName)
+	}
+	task.userParams.ServerFile = serverFile
+
+	f, err := os.OpenFile(serverFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, http.StatusInternalServerError, fmt.Errorf("create file(%s) error: %s", serverFile, err.Error())
+	}
+
+	hash := sha256.New()
+	_, err = io.Copy(io.MultiWriter(f, hash), multipartServerFile)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		_ = os.Remove(serverFile)
+		return nil, http.StatusInternalServerError, fmt.Errorf("write file(%s) error: %s", serverFile, err.Error())
+	}
+
+	if actual := hex.EncodeToString(hash.Sum(nil)); checksum != "" && actual != checksum {
+		_ = os.Remove(serverFile)
+		return nil, http.StatusBadRequest, newValidationError("serverFileSha256", "sha256", "checksum mismatch, uploaded file is %s", actual)
+	}
+	return task, http.StatusOK, nil
+}
+
+// parseJsonRequest build task from json body, whose source is fetched when building
+func parseJsonRequest(r *http.Request, timageName string) (*Task, int, error) {
+	task := newTask(timageName)
+
+	decoder := json.NewDecoder(io.LimitReader(r.Body, MaxJsonRequestSize))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&task.userParams); err != nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("parse json error: %s", err.Error())
+	}
+	task.userParams.Timage = timageName
+
+	if err := validateParams(&task.userParams); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	if err := validDockerfileParams(&task.userParams); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	source := task.userParams.Source
+	if source == nil {
+		return nil, http.StatusBadRequest, fmt.Errorf("source should be set in json build request")
+	}
+	if err := source.validate(); err != nil {
+		return nil, http.StatusBadRequest, err
+	}
+
+	ext, _ := sourceFileExt(source)
+	task.userParams.ServerFile = fmt.Sprintf("%s/%s.%s-%s%s", glPodUploadDir, task.userParams.ServerApp, task.userParams.ServerName, task.id, ext)
+	return task, http.StatusOK, nil
+}
+
+// resolveTaskSource pin the git ref of task source to a commit.
+// It reaches the repository of request, so it should be called after the request is authorized
+func resolveTaskSource(task *Task) error {
+	source := task.userParams.Source
+	if source == nil || source.Git == nil {
+		return nil
+	}
+	commit, err := resolveGitCommit(source.Git)
+	if err != nil {
+		return fmt.Errorf("resolve git ref failed: %s", err.Error())
+	}
+	source.Git.Commit = commit
+	if task.userParams.GitSha == "" {
+		task.userParams.GitSha = commit
+	}
+	return nil
+}
+
+func GetHandler(engine *Engine, writer http.ResponseWriter, r *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	response := &RestfulResponse{
+		Handler: glPodName,
+		Status:  http.StatusOK,
+		Message: http.StatusText(http.StatusOK),
+	}
+
+	vars := mux.Vars(r)
+	taccount, err := glAuthenticator.Authenticate(r)
+	if err == nil && taccount != nil {
+		_, err = glAuthenticator.AuthorizeTImage(taccount, vars["timage"], viewRoles)
+	}
+	if err != nil {
+		response.Status = authErrorStatus(writer, err)
+		response.Message = err.Error()
+		writeResponse(writer, response)
+		return
+	}
+
+	state, position, err := engine.GetTask(vars["timage"], vars["id"])
+	if err != nil {
+		response.Status = taskErrorStatus(err)
+		response.Message = err.Error()
+		writeResponse(writer, response)
+		return
+	}
+
+	response.Task = &TaskResult{
+		ID:         state.ID,
+		Source:     vars["timage"],
+		Image:      state.Image,
+		Phase:      state.Phase,
+		Message:    state.Message,
+		Handler:    state.Handler,
+		Position:   position,
+		CreateTime: state.CreateTime,
+		StartTime:  state.StartTime,
+		FinishTime: state.FinishTime,
+		Commit:     state.Commit,
+		Digest:     state.Digest,
+	}
+	writeResponse(writer, response)
+}
+
+// LogHandler stream the kaniko output of task as chunked text/plain
+func LogHandler(engine *Engine, writer http.ResponseWriter, r *http.Request) {
+
+	vars := mux.Vars(r)
+	taccount, err := glAuthenticator.Authenticate(r)
+	if err == nil && taccount != nil {
+		_, err = glAuthenticator.AuthorizeTImage(taccount, vars["timage"], viewRoles)
+	}
+	if err != nil {
+		writer.Header().Add("Content-Type", "application/json")
+		writeResponse(writer, &RestfulResponse{
+			Handler: glPodName,
+			Status:  authErrorStatus(writer, err),
+			Message: err.Error(),
+		})
+		return
+	}
+
+	stream, err := engine.OpenTaskLog(r.Context(), vars["timage"], vars["id"])
+	if err != nil {
+		writer.Header().Add("Content-Type", "application/json")
+		writeResponse(writer, &RestfulResponse{
+			Handler: glPodName,
+			Status:  taskErrorStatus(err),
+			Message: err.Error(),
+		})
+		return
+	}
+	defer stream.Close()
+
+	writer.Header().Add("Content-Type", "text/plain; charset=utf-8")
+	writer.Header().Add("X-Content-Type-Options", "nosniff")
+	writer.WriteHeader(http.StatusOK)
+
+	flusher, _ := writer.(http.Flusher)
+	buf := make([]byte, 4096)
+	for {
+		n, err := stream.Read(buf)
+		if n > 0 {
+			if _, err := writer.Write(buf[:n]); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+		if err != nil {
+			if err != io.EOF {
+				utilRuntime.HandleError(fmt.Errorf("task|%s: read build log failed: %s", vars["id"], err.Error()))
+			}
+			return
+		}
+	}
+}
+
+func CancelHandler(engine *Engine, writer http.ResponseWriter, r *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	response := &RestfulResponse{
+		Handler: glPodName,
+		Status:  http.StatusOK,
+		Message: http.StatusText(http.StatusOK),
+	}
+
+	vars := mux.Vars(r)
+	taccount, err := glAuthenticator.Authenticate(r)
+	if err == nil && taccount != nil {
+		_, err = glAuthenticator.AuthorizeTImage(taccount, vars["timage"], buildRoles)
+	}
+	if err != nil {
+		response.Status = authErrorStatus(writer, err)
+		response.Message = err.Error()
+		writeResponse(writer, response)
+		return
+	}
+
+	if err := engine.CancelTask(vars["timage"], vars["id"]); err != nil {
+		response.Status = taskErrorStatus(err)
+		if response.Status == http.StatusInternalServerError {
+			response.Status = http.StatusConflict
+		}
+		response.Message = err.Error()
+	}
+	writeResponse(writer, response)
+}
+
+// PromoteHandler copy a release of another namespace into the timage of request path
+func PromoteHandler(promoter *Promoter, writer http.ResponseWriter, r *http.Request) {
+
+	writer.Header().Add("Content-Type", "application/json")
+
+	response := &RestfulResponse{
+		Handler: glPodName,
+		Status:  http.StatusCreated,
+		Message: http.StatusText(http.StatusCreated),
+	}
+
+	vars := mux.Vars(r)
+	taccount, err := glAuthenticator.Authenticate(r)
+	if err == nil && taccount != nil {
+		_, err = glAuthenticator.AuthorizeTImage(taccount, vars["timage"], buildRoles)
+	}
+	if err != nil {
+		failResponse(response, authErrorStatus(writer, err), err)
+		writeResponse(writer, response)
+		return
+	}
+
+	params := &PromoteParams{}
+	decoder := json.NewDecoder(io.LimitReader(r.Body, MaxJsonRequestSize))
+	decoder.DisallowUnknownFields()
+	if err = decoder.Decode(params); err != nil {
+		failResponse(response, http.StatusBadRequest, fmt.Errorf("parse json error: %s", err.Error()))
+		writeResponse(writer, response)
+		return
+	}
+	if err = validateParams(params); err != nil {
+		failResponse(response, http.StatusBadRequest, err)
+		writeResponse(writer, response)
+		return
+	}
+	if taccount != nil {
+		params.Person = taccount.Spec.Username
+	}
+
+	if response.Release, err = promoter.Promote(taccount, vars["timage"], params); err != nil {
+		status := authErrorStatus(writer, err)
+		if goerrors.Is(err, errPromotionConflict) {
+			status = http.StatusConflict
+		}
+		failResponse(response, status, err)
+		utilRuntime.HandleError(err)
+	}
+	writeResponse(writer, response)
 }
 
 type RestfulServer struct {
+	// requestTimeout limit the handling of requests except log streaming, which lasts as long as the build
+	requestTimeout time.Duration
 }
 
 func NewRestful() *RestfulServer {
-	return &RestfulServer{}
+	return &RestfulServer{requestTimeout: RequestTimeout}
 }
 
-func (s *RestfulServer) Start(stopCh chan struct{}) {
+// withTimeout reply 503 if handler does not finish in requestTimeout
+func (s *RestfulServer) withTimeout(handler http.HandlerFunc) http.Handler {
+	bs, _ := json.Marshal(&RestfulResponse{
+		Handler: glPodName,
+		Status:  http.StatusServiceUnavailable,
+		Message: fmt.Sprintf("request not finished in %s", s.requestTimeout),
+	})
+	return http.TimeoutHandler(handler, s.requestTimeout, string(bs))
+}
+
+func (s *RestfulServer) newRouter() *mux.Router {
 	router := mux.NewRouter()
-	router.HandleFunc("/api/{version}/timage/{timage}/building", func(writer http.ResponseWriter, request *http.Request) {
+	router.Handle("/api/{version}/timage/{timage}/building", s.withTimeout(func(writer http.ResponseWriter, request *http.Request) {
 		switch request.Method {
 		case http.MethodPost:
 			Handler(glEngine, writer, request)
 		default:
 			writer.WriteHeader(http.StatusMethodNotAllowed)
 		}
+	}))
+	router.Handle("/api/{version}/timage/{timage}/building/{id}", s.withTimeout(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			GetHandler(glEngine, writer, request)
+		case http.MethodDelete:
+			CancelHandler(glEngine, writer, request)
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	router.Handle("/api/{version}/timage/{timage}/promotion", s.withTimeout(func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodPost:
+			PromoteHandler(glPromoter, writer, request)
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
+	}))
+	// log is streamed until the build finished, so it is not limited by requestTimeout
+	router.HandleFunc("/api/{version}/timage/{timage}/building/{id}/log", func(writer http.ResponseWriter, request *http.Request) {
+		switch request.Method {
+		case http.MethodGet:
+			LogHandler(glEngine, writer, request)
+		default:
+			writer.WriteHeader(http.StatusMethodNotAllowed)
+		}
 	})
+	return router
+}
 
+func (s *RestfulServer) Start(stopCh chan struct{}) {
+	// there is no WriteTimeout, which would cut the log streams, handlers are limited by requestTimeout instead
 	srv := &http.Server{
 		Addr:              ":80",
-		Handler:           router,
+		Handler:           s.newRouter(),
 		ReadTimeout:       300 * time.Second,
 		ReadHeaderTimeout: 60 * time.Second,
-		WriteTimeout:      600 * time.Second,
 		IdleTimeout:       900 * time.Second,
 	}
 	go func() {
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	k8sFake "k8s.io/client-go/kubernetes/fake"
+	k8sTesting "k8s.io/client-go/testing"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRuntime "k8s.tars.io/runtime"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestRequestTimeout(t *testing.T) {
+	setupTestEnv(t)
+	glAuthenticator = NewAuthenticator(false)
+	glEngine = NewEngine()
+
+	const id = "v20220102030405-1"
+	createTestTImage(t, newTestTImage("test-helloserver", &tarsV1beta3.TImageBuildState{ID: id, Phase: BuildPhasePrepareBuilding, Handler: "tars-tarsimage-1"}))
+
+	k8sClient := k8sFake.NewSimpleClientset(&k8sCoreV1.Pod{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: builderPodName(id), Namespace: testNamespace},
+		Status:     k8sCoreV1.PodStatus{Phase: k8sCoreV1.PodRunning},
+	})
+	tarsRuntime.Clients.K8sClient = k8sClient
+
+	const timeout = time.Millisecond * 50
+	// both log and cancel requests take longer than timeout
+	k8sClient.PrependReactor("*", "pods", func(action k8sTesting.Action) (bool, runtime.Object, error) {
+		time.Sleep(timeout * 4)
+		return false, nil, nil
+	})
+
+	server := httptest.NewServer((&RestfulServer{requestTimeout: timeout}).newRouter())
+	defer server.Close()
+
+	response, err := http.Get(server.URL + "/api/v1beta3/timage/test-helloserver/building/" + id + "/log")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bs, _ := ioutil.ReadAll(response.Body)
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusOK || string(bs) != "fake logs" {
+		t.Errorf("log stream should not be limited by request timeout, got %d %s", response.StatusCode, bs)
+	}
+
+	request, _ := http.NewRequest(http.MethodDelete, server.URL+"/api/v1beta3/timage/test-helloserver/building/"+id, nil)
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+	if response.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("requests except log stream should be limited by request timeout, got %d", response.StatusCode)
+	}
+}
+
+func TestBuildSourceResolvedAfterAuthorization(t *testing.T) {
+	setupTestEnv(t)
+	glEngine = NewEngine()
+	glAuthenticator = newTestAuthenticator(t, newTestTAccount("alice", "alice-token", "Other", DeveloperRole))
+	createTestTImage(t, newTestServerTImage("test-helloserver", "Test", "HelloServer"))
+
+	// the repository of request should not be reached before the request is authorized
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var connections int32
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			atomic.AddInt32(&connections, 1)
+			_ = conn.Close()
+		}
+	}()
+	defer listener.Close()
+
+	server := httptest.NewServer((&RestfulServer{requestTimeout: RequestTimeout}).newRouter())
+	defer server.Close()
+
+	body := fmt.Sprintf(`{"serverApp":"Test","serverName":"HelloServer","serverType":"cpp","baseImage":"tarscloud/tars.cppbase",
+		"source":{"git":{"repository":"https://%s/repo.git","ref":"main"}}}`, listener.Addr().String())
+	request, _ := http.NewRequest(http.MethodPost, server.URL+"/api/v1beta3/timage/test-helloserver/building", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", BearerPrefix+"alice-token")
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = response.Body.Close()
+
+	if response.StatusCode != http.StatusForbidden {
+		t.Errorf("build of server not authorized should be forbidden, got %d", response.StatusCode)
+	}
+	if n := atomic.LoadInt32(&connections); n != 0 {
+		t.Errorf("repository should not be reached by unauthorized request, got %d connections", n)
+	}
+}
@@ -0,0 +1,249 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRegistry "k8s.tars.io/registry"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"log"
+	"strings"
+)
+
+const (
+	RetentionModeOff    = "off"
+	RetentionModeDryRun = "dry-run"
+	RetentionModeDelete = "delete"
+)
+
+type retentionJob struct {
+	timage   string
+	releases []*tarsV1beta3.TImageRelease
+}
+
+// RetentionReport is the result of collecting the releases trimmed from a timage
+type RetentionReport struct {
+	TImage  string
+	DryRun  bool
+	Deleted []string
+	// Kept images are still referenced by tservers or timages
+	Kept   []string
+	Failed map[string]string
+}
+
+func (r *RetentionReport) String() string {
+	action := "deleted"
+	if r.DryRun {
+		action = "would delete"
+	}
+	message := fmt.Sprintf("%s %d images, kept %d referenced images", action, len(r.Deleted), len(r.Kept))
+	if len(r.Deleted) != 0 {
+		message += fmt.Sprintf(": %s", strings.Join(r.Deleted, ", "))
+	}
+	if len(r.Failed) != 0 {
+		failed := make([]string, 0, len(r.Failed))
+		for image, reason := range r.Failed {
+			failed = append(failed, fmt.Sprintf("%s(%s)", image, reason))
+		}
+		message += fmt.Sprintf(", failed %d: %s", len(r.Failed), strings.Join(failed, ", "))
+	}
+	return message
+}
+
+// Retention delete the images of releases trimmed from timages out of the registry,
+// images referenced by any tserver release, release history or timage release are kept,
+// of this namespace and of the namespaces promoting releases from it
+type Retention struct {
+	mode     string
+	registry *tarsRegistry.Client
+	// promotionNamespaces are the namespaces promoting releases of this namespace
+	promotionNamespaces []string
+	jobs                chan retentionJob
+	eventRecorder       record.EventRecorder
+}
+
+func NewRetention(mode string, registry *tarsRegistry.Client, promotionNamespaces []string) *Retention {
+	return &Retention{
+		mode:                mode,
+		registry:            registry,
+		promotionNamespaces: promotionNamespaces,
+		jobs:                make(chan retentionJob, RetentionQueueSize),
+		eventRecorder:       tarsRuntime.NewEventRecorder("tarsimage"),
+	}
+}
+
+// Collect queue the releases trimmed from timage, it never blocks the caller
+func (r *Retention) Collect(timage string, releases []*tarsV1beta3.TImageRelease) {
+	if r.mode == RetentionModeOff || len(releases) == 0 {
+		return
+	}
+	select {
+	case r.jobs <- retentionJob{timage: timage, releases: releases}:
+	default:
+		log.Printf("retention|%s: queue is full, %d trimmed releases are left in registry\n", timage, len(releases))
+	}
+}
+
+func (r *Retention) Run(stopCh chan struct{}) {
+	for {
+		select {
+		case <-stopCh:
+			return
+		case job := <-r.jobs:
+			report, err := r.collect(job)
+			if err != nil {
+				log.Printf("retention|%s: %s\n", job.timage, err.Error())
+				continue
+			}
+			log.Printf("retention|%s: %s\n", job.timage, report.String())
+			r.recordEvent(report)
+		}
+	}
+}
+
+// referencedImages return images still in use by namespaces, the release history is kept for rollback.
+// pinned images are returned with their digest as well, the tag may have been moved since they were released.
+// images promoted from are kept too, in case the source and target namespaces share a registry
+func referencedImages(namespaces []string) (map[string]interface{}, error) {
+	images := map[string]interface{}{}
+
+	for _, namespace := range namespaces {
+		tservers, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list resource %s %s failed: %s", "tservers", namespace, err.Error())
+		}
+		for _, tserver := range tservers.Items {
+			if tserver.Spec.Release != nil {
+				images[tserver.Spec.Release.Image] = nil
+				images[tarsTool.PinnedImage(tserver.Spec.Release.Image, tserver.Spec.Release.Digest)] = nil
+			}
+			for _, record := range tserver.Spec.ReleaseHistory {
+				if record != nil {
+					images[record.Image] = nil
+					images[tarsTool.PinnedImage(record.Image, record.Digest)] = nil
+				}
+			}
+		}
+
+		timages, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(namespace).List(context.TODO(), k8sMetaV1.ListOptions{})
+		if err != nil {
+			return nil, fmt.Errorf("list resource %s %s failed: %s", "timages", namespace, err.Error())
+		}
+		for _, timage := range timages.Items {
+			for _, release := range timage.Releases {
+				if release == nil {
+					continue
+				}
+				images[release.Image] = nil
+				images[tarsTool.PinnedImage(release.Image, release.Digest)] = nil
+				if release.Promotion != nil && release.Promotion.Namespace == tarsRuntime.Namespace {
+					images[release.Promotion.Image] = nil
+				}
+			}
+		}
+	}
+	return images, nil
+}
+
+func (r *Retention) collect(job retentionJob) (*RetentionReport, error) {
+	referenced, err := referencedImages(append([]string{tarsRuntime.Namespace}, r.promotionNamespaces...))
+	if err != nil {
+		return nil, err
+	}
+
+	report := &RetentionReport{
+		TImage: job.timage,
+		DryRun: r.mode == RetentionModeDryRun,
+		Failed: map[string]string{},
+	}
+
+	// deleting a manifest removes every tag pointing to it, so digests of referenced images in the same repository are kept too.
+	// nothing of the repository is deleted if any of them could not be resolved
+	keptDigests := map[string]interface{}{}
+	resolvedRepositories := map[string]error{}
+	resolveKept := func(repository string, secret string) error {
+		if err, ok := resolvedRepositories[repository]; ok {
+			return err
+		}
+		var err error
+		for image := range referenced {
+			if ref, parseErr := tarsRegistry.ParseImageReference(image); parseErr != nil || ref.Host+"/"+ref.Repository != repository {
+				continue
+			}
+			digest := tarsTool.ImageDigest(image)
+			if digest == "" {
+				if digest, err = r.registry.Digest(image, tarsRuntime.Namespace, secret); err == tarsRegistry.ErrManifestNotFound {
+					err = nil
+					continue
+				}
+				if err != nil {
+					err = fmt.Errorf("resolve referenced image %s failed: %s", image, err.Error())
+					break
+				}
+			}
+			keptDigests[repository+"@"+digest] = nil
+		}
+		resolvedRepositories[repository] = err
+		return err
+	}
+
+	for _, release := range job.releases {
+		if release == nil {
+			continue
+		}
+		if _, ok := referenced[release.Image]; ok {
+			report.Kept = append(report.Kept, release.Image)
+			continue
+		}
+
+		ref, err := tarsRegistry.ParseImageReference(release.Image)
+		if err != nil {
+			report.Failed[release.Image] = err.Error()
+			continue
+		}
+		repository := ref.Host + "/" + ref.Repository
+
+		digest, err := r.registry.Digest(release.Image, tarsRuntime.Namespace, release.Secret)
+		if err == tarsRegistry.ErrManifestNotFound {
+			continue
+		}
+		if err != nil {
+			report.Failed[release.Image] = err.Error()
+			continue
+		}
+
+		if err = resolveKept(repository, release.Secret); err != nil {
+			report.Failed[release.Image] = err.Error()
+			continue
+		}
+		if _, ok := keptDigests[repository+"@"+digest]; ok {
+			report.Kept = append(report.Kept, release.Image)
+			continue
+		}
+
+		if !report.DryRun {
+			if err = r.registry.DeleteManifest(release.Image, tarsRuntime.Namespace, release.Secret, digest); err != nil && err != tarsRegistry.ErrManifestNotFound {
+				report.Failed[release.Image] = err.Error()
+				continue
+			}
+		}
+		report.Deleted = append(report.Deleted, release.Image)
+	}
+	return report, nil
+}
+
+func (r *Retention) recordEvent(report *RetentionReport) {
+	timage, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Get(context.TODO(), report.TImage, k8sMetaV1.GetOptions{})
+	if err != nil {
+		return
+	}
+	eventType := k8sCoreV1.EventTypeNormal
+	if len(report.Failed) != 0 {
+		eventType = k8sCoreV1.EventTypeWarning
+	}
+	r.eventRecorder.Event(timage, eventType, RetentionReason, report.String())
+}
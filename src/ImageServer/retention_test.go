@@ -0,0 +1,205 @@
+package main
+
+import (
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRegistry "k8s.tars.io/registry"
+	"net/http"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+const testPromotionNamespace = "tars-prod"
+
+func newTestRetention(mode string, registry *tarsRegistry.Client, promotionNamespaces []string) *Retention {
+	return &Retention{
+		mode:                mode,
+		registry:            registry,
+		promotionNamespaces: promotionNamespaces,
+		jobs:                make(chan retentionJob, RetentionQueueSize),
+		eventRecorder:       record.NewFakeRecorder(10),
+	}
+}
+
+func sortedStrings(values []string) []string {
+	values = append([]string{}, values...)
+	sort.Strings(values)
+	return values
+}
+
+func TestRetentionCollect(t *testing.T) {
+	registry := newTestRegistry(t, false)
+	image := func(tag string) string {
+		return registry.Host() + "/app.server:" + tag
+	}
+
+	registry.push("app.server", "v1", "layer-v1")
+	v2 := registry.push("app.server", "v2", "layer-v2")
+	registry.push("app.server", "v3", "layer-v3")
+	v4 := registry.push("app.server", "v4", "layer-v4")
+	registry.mutex.Lock()
+	// v5 is the same manifest as v4, deleting it would remove v4 as well
+	registry.tagLocked("app.server", "v5", v4)
+	registry.mutex.Unlock()
+
+	tserver := &tarsV1beta3.TServer{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: "app-server", Namespace: testNamespace},
+		Spec: tarsV1beta3.TServerSpec{
+			App:     "App",
+			Server:  "Server",
+			Release: &tarsV1beta3.TServerRelease{ID: "v2", Image: image("v2"), Digest: v2},
+			ReleaseHistory: []*tarsV1beta3.TServerReleaseRecord{
+				{ID: "v4", Image: image("v4"), Digest: v4},
+			},
+		},
+	}
+	// the promoted release lives in another namespace, which shares the registry
+	promoted := &tarsV1beta3.TImage{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: "app-server", Namespace: testPromotionNamespace},
+		ImageType:  TImageTypeServer,
+		Releases: []*tarsV1beta3.TImageRelease{
+			{
+				ID:    "v3",
+				Image: registry.Host() + "/prod/app.server:v3",
+				Promotion: &tarsV1beta3.TImageReleasePromotion{
+					Namespace: testNamespace,
+					TImage:    "app-server",
+					Image:     image("v3"),
+				},
+			},
+		},
+	}
+	setupTestEnv(t, tserver, promoted)
+
+	trimmed := []*tarsV1beta3.TImageRelease{
+		{ID: "v1", Image: image("v1")},
+		{ID: "v2", Image: image("v2")},
+		{ID: "v3", Image: image("v3")},
+		{ID: "v5", Image: image("v5")},
+		// removed from registry already
+		{ID: "v6", Image: image("v6")},
+		nil,
+	}
+	job := retentionJob{timage: "app-server", releases: trimmed}
+	client := tarsRegistry.NewClient(RegistryRequestTimeout, []string{registry.Host()})
+
+	report, err := newTestRetention(RetentionModeDryRun, client, []string{testPromotionNamespace}).collect(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !report.DryRun || !reflect.DeepEqual(report.Deleted, []string{image("v1")}) || len(report.Failed) != 0 {
+		t.Fatalf("dry-run report = %+v, want v1 deleted", report)
+	}
+	if !registry.exists("app.server", "v1") {
+		t.Errorf("dry-run deleted %s", image("v1"))
+	}
+
+	// the promoted reference is not seen if the promoting namespace is not scanned
+	report, err = newTestRetention(RetentionModeDryRun, client, nil).collect(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{image("v1"), image("v3")}; !reflect.DeepEqual(sortedStrings(report.Deleted), want) {
+		t.Errorf("report without promotion namespaces deleted %v, want %v", report.Deleted, want)
+	}
+
+	report, err = newTestRetention(RetentionModeDelete, client, []string{testPromotionNamespace}).collect(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DryRun || !reflect.DeepEqual(report.Deleted, []string{image("v1")}) || len(report.Failed) != 0 {
+		t.Fatalf("delete report = %+v, want v1 deleted", report)
+	}
+	if want := []string{image("v2"), image("v3"), image("v5")}; !reflect.DeepEqual(sortedStrings(report.Kept), want) {
+		t.Errorf("report kept %v, want %v", report.Kept, want)
+	}
+	if registry.exists("app.server", "v1") {
+		t.Errorf("%s is not deleted", image("v1"))
+	}
+	for _, tag := range []string{"v2", "v3", "v4", "v5"} {
+		if !registry.exists("app.server", tag) {
+			t.Errorf("referenced %s is deleted", image(tag))
+		}
+	}
+}
+
+func TestRetentionCollectRegistryError(t *testing.T) {
+	registry := newTestRegistry(t, false)
+	registry.username, registry.password = "user", "password"
+	registry.push("server", "v1", "layer-v1")
+	setupTestEnv(t)
+
+	image := registry.Host() + "/server:v1"
+	job := retentionJob{timage: "server", releases: []*tarsV1beta3.TImageRelease{{ID: "v1", Image: image}}}
+	report, err := newTestRetention(RetentionModeDelete, tarsRegistry.NewClient(RegistryRequestTimeout, []string{registry.Host()}), nil).collect(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := report.Failed[image]; !ok || len(report.Deleted) != 0 {
+		t.Errorf("report = %+v, want %s failed", report, image)
+	}
+	if !registry.exists("server", "v1") {
+		t.Errorf("%s is deleted", image)
+	}
+}
+
+func TestRetentionCollectUnresolvedReference(t *testing.T) {
+	registry := newTestRegistry(t, false)
+	image := func(tag string) string {
+		return registry.Host() + "/app.server:" + tag
+	}
+
+	registry.push("app.server", "v1", "layer-v1")
+	registry.push("app.server", "v2", "layer-v2")
+	v3 := registry.push("app.server", "v3", "layer-v3")
+
+	tserver := &tarsV1beta3.TServer{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: "app-server", Namespace: testNamespace},
+		Spec: tarsV1beta3.TServerSpec{
+			App:    "App",
+			Server: "Server",
+			// v4 is pinned to the manifest of v3, its tag is gone since
+			Release: &tarsV1beta3.TServerRelease{ID: "v4", Image: image("v4"), Digest: v3},
+			ReleaseHistory: []*tarsV1beta3.TServerReleaseRecord{
+				{ID: "v2", Image: image("v2")},
+			},
+		},
+	}
+	setupTestEnv(t, tserver)
+
+	job := retentionJob{timage: "app-server", releases: []*tarsV1beta3.TImageRelease{
+		{ID: "v1", Image: image("v1")},
+		{ID: "v3", Image: image("v3")},
+	}}
+	retention := newTestRetention(RetentionModeDelete, tarsRegistry.NewClient(RegistryRequestTimeout, []string{registry.Host()}), nil)
+
+	// v1 or v3 may be the manifest of referenced v2, which could not be resolved
+	registry.mutex.Lock()
+	registry.failures["app.server:v2"] = http.StatusInternalServerError
+	registry.mutex.Unlock()
+	report, err := retention.collect(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Deleted) != 0 || len(report.Failed) != 2 {
+		t.Errorf("report = %+v, want v1 and v3 failed", report)
+	}
+	for _, tag := range []string{"v1", "v2", "v3"} {
+		if !registry.exists("app.server", tag) {
+			t.Errorf("%s is deleted", image(tag))
+		}
+	}
+
+	registry.mutex.Lock()
+	delete(registry.failures, "app.server:v2")
+	registry.mutex.Unlock()
+	report, err = retention.collect(job)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(report.Deleted, []string{image("v1")}) || !reflect.DeepEqual(report.Kept, []string{image("v3")}) || len(report.Failed) != 0 {
+		t.Errorf("report = %+v, want v1 deleted and v3 kept by the pinned digest", report)
+	}
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// GitSource build context is the SubDir of Repository at Ref
+type GitSource struct {
+	Repository string `json:"repository"`
+	Ref        string `json:"ref"`
+	SubDir     string `json:"subDir,omitempty"`
+	// Commit is resolved from Ref when the build posted, so a queued build is not affected by later pushes
+	Commit string `json:"commit,omitempty"`
+}
+
+// URLSource build context is the archive at URL, whose content must match Sha256
+type URLSource struct {
+	URL    string `json:"url"`
+	Sha256 string `json:"sha256"`
+}
+
+// BuildSource is fetched by the image server into ServerFile before preparing, exactly one field should be set
+type BuildSource struct {
+	Git *GitSource `json:"git,omitempty"`
+	URL *URLSource `json:"url,omitempty"`
+}
+
+var gitCommitRegex = regexp.MustCompile(`^[0-9a-f]{40}$`)
+
+var sha256Regex = regexp.MustCompile(`^[0-9a-f]{64}$`)
+
+// gitAllowProtocol is the GIT_ALLOW_PROTOCOL of git commands, so repositories are never read from local paths or by other transports
+var gitAllowProtocol = "https:ssh"
+
+// sourceAllowPrivate let url sources be downloaded from loopback, link-local and private addresses
+var sourceAllowPrivate = false
+
+var privateNetworks = func() []*net.IPNet {
+	var networks []*net.IPNet
+	for _, cidr := range []string{"10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "100.64.0.0/10", "fc00::/7"} {
+		_, network, _ := net.ParseCIDR(cidr)
+		networks = append(networks, network)
+	}
+	return networks
+}()
+
+// sourceDialControl check the address resolved from url host, so url sources never reach the apiserver,
+// cloud metadata or other services inside the cluster
+func sourceDialControl(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return fmt.Errorf("invalid address %s", address)
+	}
+	if sourceAllowPrivate {
+		return nil
+	}
+	if ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() || ip.IsUnspecified() {
+		return fmt.Errorf("address %s is not allowed", host)
+	}
+	for _, privateNetwork := range privateNetworks {
+		if privateNetwork.Contains(ip) {
+			return fmt.Errorf("address %s is not allowed", host)
+		}
+	}
+	return nil
+}
+
+// sourceHTTPClient download url sources, unlike http.DefaultClient it never waits forever on a stuck server.
+// proxies are not used, the addresses they connect could not be checked
+var sourceHTTPClient = &http.Client{
+	Timeout: SourceFetchTimeout,
+	Transport: &http.Transport{
+		DialContext:           (&net.Dialer{Timeout: 30 * time.Second, KeepAlive: 30 * time.Second, Control: sourceDialControl}).DialContext,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: 30 * time.Second,
+		IdleConnTimeout:       90 * time.Second,
+	},
+}
+
+// validGitRepository check repository is a https, ssh or scp-like ssh address
+func validGitRepository(repository string) bool {
+	if strings.HasPrefix(repository, "-") || strings.Contains(repository, "::") {
+		return false
+	}
+	if i := strings.Index(repository, "://"); i != -1 {
+		u, err := url.Parse(repository)
+		return err == nil && (u.Scheme == "https" || u.Scheme == "ssh") && u.Host != ""
+	}
+	// [user@]host:path, git takes it as a local path if there is a slash before the colon
+	i := strings.IndexByte(repository, ':')
+	return i > 0 && !strings.ContainsRune(repository[:i], '/')
+}
+
+func (s *BuildSource) validate() error {
+	if (s.Git == nil) == (s.URL == nil) {
+		return fmt.Errorf("exactly one of source.git and source.url should be set")
+	}
+
+	if s.Git != nil {
+		if !validGitRepository(s.Git.Repository) {
+			return fmt.Errorf("invalid source.git.repository value: %q, only https and ssh repositories are supported", s.Git.Repository)
+		}
+		if s.Git.Ref == "" || strings.HasPrefix(s.Git.Ref, "-") {
+			return fmt.Errorf("invalid source.git.ref value: %q", s.Git.Ref)
+		}
+		for _, element := range strings.Split(s.Git.SubDir, "/") {
+			if element == ".." {
+				return fmt.Errorf("invalid source.git.subDir value: %q", s.Git.SubDir)
+			}
+		}
+		return nil
+	}
+
+	u, err := url.Parse(s.URL.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return fmt.Errorf("invalid source.url.url value: %q", s.URL.URL)
+	}
+	if _, err = sourceFileExt(s); err != nil {
+		return err
+	}
+	if !sha256Regex.MatchString(strings.ToLower(s.URL.Sha256)) {
+		return fmt.Errorf("invalid source.url.sha256 value: %q", s.URL.Sha256)
+	}
+	return nil
+}
+
+// sourceFileExt return the ServerFile extension the fetched source is saved with
+func sourceFileExt(s *BuildSource) (string, error) {
+	if s.Git != nil {
+		return ".tgz", nil
+	}
+	u, _ := url.Parse(s.URL.URL)
+	name := path.Base(u.Path)
+	switch {
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return ".tgz", nil
+	case strings.HasSuffix(name, ".war"), strings.HasSuffix(name, ".jar"):
+		return path.Ext(name), nil
+	}
+	return "", fmt.Errorf("unsupported source.url file type %s", name)
+}
+
+func runGit(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Env = append(os.Environ(), "GIT_TERMINAL_PROMPT=0", "GIT_ALLOW_PROTOCOL="+gitAllowProtocol)
+	glExecMutex.RLock()
+	out, err := cmd.CombinedOutput()
+	glExecMutex.RUnlock()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed: %s, %s", args[0], err.Error(), strings.TrimSpace(string(out)))
+	}
+	return strings.TrimSpace(string(out)), nil
+}
+
+// resolveGitCommit return the commit ref points to, ref could be a branch, a tag or a full commit id
+func resolveGitCommit(source *GitSource) (string, error) {
+	if gitCommitRegex.MatchString(source.Ref) {
+		return source.Ref, nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), SourceResolveTimeout)
+	defer cancel()
+
+	out, err := runGit(ctx, "ls-remote", "--", source.Repository, source.Ref, source.Ref+"^{}")
+	if err != nil {
+		return "", err
+	}
+
+	// annotated tags are listed twice, the peeled "^{}" line is the commit
+	var commit string
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			continue
+		}
+		if commit == "" || strings.HasSuffix(fields[1], "^{}") {
+			commit = fields[0]
+		}
+	}
+	if commit == "" {
+		return "", fmt.Errorf("ref %s not found in %s", source.Ref, source.Repository)
+	}
+	return commit, nil
+}
+
+// fetchSource download the source of task into its ServerFile
+func fetchSource(task *Task) error {
+	ctx, cancel := context.WithTimeout(context.Background(), SourceFetchTimeout)
+	defer cancel()
+
+	source := task.userParams.Source
+	if source.Git != nil {
+		log.Printf("task|%s: cloning %s@%s...\n", task.id, source.Git.Repository, source.Git.Commit)
+		return fetchGitSource(ctx, source.Git, task.userParams.ServerFile, MaxGitCloneSize)
+	}
+	log.Printf("task|%s: downloading %s...\n", task.id, source.URL.URL)
+	return fetchURLSource(ctx, source.URL, task.userParams.ServerFile, glMaxUploadSize)
+}
+
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.Walk(dir, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// limitDirSize return a ctx cancelled once dir grows larger than limit,
+// the returned stop func should be called when done, it reports whether limit exceeded
+func limitDirSize(ctx context.Context, dir string, limit int64) (context.Context, func() bool) {
+	ctx, cancel := context.WithCancel(ctx)
+	var exceeded int32
+	go func() {
+		ticker := time.NewTicker(SourceSizeCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if dirSize(dir) > limit {
+					atomic.StoreInt32(&exceeded, 1)
+					cancel()
+					return
+				}
+			}
+		}
+	}()
+	return ctx, func() bool {
+		cancel()
+		return atomic.LoadInt32(&exceeded) == 1 || dirSize(dir) > limit
+	}
+}
+
+// fetchGitSource archive SubDir of the repository at Commit into serverFile, the cloned repository should be no larger than limit
+func fetchGitSource(ctx context.Context, source *GitSource, serverFile string, limit int64) error {
+	repoDir := fmt.Sprintf("%s.src", serverFile)
+	defer os.RemoveAll(repoDir)
+
+	cloneCtx, stop := limitDirSize(ctx, repoDir, limit)
+	_, err := runGit(cloneCtx, "clone", "--quiet", "--no-checkout", "--", source.Repository, repoDir)
+	if err == nil {
+		_, err = runGit(cloneCtx, "-C", repoDir, "checkout", "--quiet", "--detach", source.Commit)
+	}
+	if stop() {
+		return fmt.Errorf("repository %s is larger than %d bytes", source.Repository, limit)
+	}
+	if err != nil {
+		return err
+	}
+
+	contextDir, err := filepath.EvalSymlinks(filepath.Join(repoDir, source.SubDir))
+	if err != nil {
+		return fmt.Errorf("subDir %s not found in %s", source.SubDir, source.Repository)
+	}
+	if root, _ := filepath.EvalSymlinks(repoDir); contextDir != root && !strings.HasPrefix(contextDir, root+"/") {
+		return fmt.Errorf("subDir %s is outside of %s", source.SubDir, source.Repository)
+	}
+	if info, err := os.Stat(contextDir); err != nil || !info.IsDir() {
+		return fmt.Errorf("subDir %s is not a directory", source.SubDir)
+	}
+
+	if err = archiveDir(contextDir, serverFile); err != nil {
+		_ = os.Remove(serverFile)
+		return fmt.Errorf("archive %s failed: %s", source.SubDir, err.Error())
+	}
+	return nil
+}
+
+// fetchURLSource download the archive into serverFile, which should be no larger than limit
+func fetchURLSource(ctx context.Context, source *URLSource, serverFile string, limit int64) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, source.URL, nil)
+	if err != nil {
+		return err
+	}
+
+	response, err := sourceHTTPClient.Do(request)
+	if err != nil {
+		return err
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		return fmt.Errorf("download %s failed: %s", source.URL, response.Status)
+	}
+
+	if response.ContentLength > limit {
+		return fmt.Errorf("download %s failed: size should be no larger than %d bytes", source.URL, limit)
+	}
+
+	f, err := os.OpenFile(serverFile, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+
+	hash := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hash), io.LimitReader(response.Body, limit+1))
+	_ = f.Close()
+	if err == nil && n > limit {
+		err = fmt.Errorf("size should be no larger than %d bytes", limit)
+	}
+	if err != nil {
+		_ = os.Remove(serverFile)
+		return fmt.Errorf("download %s failed: %s", source.URL, err.Error())
+	}
+
+	if sum := hex.EncodeToString(hash.Sum(nil)); sum != strings.ToLower(source.Sha256) {
+		_ = os.Remove(serverFile)
+		return fmt.Errorf("sha256 of %s mismatch, expected %s, got %s", source.URL, source.Sha256, sum)
+	}
+	return nil
+}
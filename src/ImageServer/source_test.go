@@ -0,0 +1,260 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestValidGitRepository(t *testing.T) {
+	tests := []struct {
+		repository string
+		valid      bool
+	}{
+		{"https://github.com/TarsCloud/K8SFramework.git", true},
+		{"ssh://git@github.com/TarsCloud/K8SFramework.git", true},
+		{"git@github.com:TarsCloud/K8SFramework.git", true},
+		{"http://github.com/TarsCloud/K8SFramework.git", false},
+		{"git://github.com/TarsCloud/K8SFramework.git", false},
+		{"file:///etc", false},
+		{"/var/lib/repo.git", false},
+		{"./repo:name", false},
+		{"ext::sh -c touch% /tmp/pwned", false},
+		{"--upload-pack=touch /tmp/pwned", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		if validGitRepository(test.repository) != test.valid {
+			t.Errorf("validGitRepository(%q) should be %v", test.repository, test.valid)
+		}
+	}
+}
+
+// newTestGitRepository create a bare repository whose main branch has two commits, tag v1 is annotated on the first one.
+// Both commits have server/version.txt, and a symlink escaping the repository
+func newTestGitRepository(t *testing.T) (repository string, first string, second string) {
+	dir := t.TempDir()
+	work := filepath.Join(dir, "work")
+	repository = filepath.Join(dir, "repo.git")
+
+	git := func(args ...string) string {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=tars", "-c", "user.email=tars@tars.io"}, args...)...)
+		cmd.Dir = work
+		out, err := cmd.CombinedOutput()
+		if err != nil {
+			t.Fatalf("git %s failed: %s, %s", args[0], err.Error(), out)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	commit := func(version string) string {
+		if err := ioutil.WriteFile(filepath.Join(work, "server", "version.txt"), []byte(version), 0666); err != nil {
+			t.Fatal(err)
+		}
+		git("add", "-A")
+		git("commit", "--quiet", "-m", version)
+		return git("rev-parse", "HEAD")
+	}
+
+	if err := os.MkdirAll(filepath.Join(work, "server"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(work, "outside")); err != nil {
+		t.Fatal(err)
+	}
+	git("init", "--quiet", "-b", "main")
+	first = commit("v1")
+	git("tag", "-a", "-m", "v1", "v1")
+	second = commit("v2")
+	git("init", "--quiet", "--bare", repository)
+	git("push", "--quiet", "--tags", repository, "main")
+	return repository, first, second
+}
+
+// allowLocalGit let git commands read the repositories created by tests
+func allowLocalGit(t *testing.T) {
+	gitAllowProtocol = "file"
+	t.Cleanup(func() { gitAllowProtocol = "https:ssh" })
+}
+
+// allowPrivateSource let url sources be downloaded from the servers started by tests
+func allowPrivateSource(t *testing.T) {
+	sourceAllowPrivate = true
+	t.Cleanup(func() { sourceAllowPrivate = false })
+}
+
+// readTestArchive return the regular files of a tgz, keyed by their names
+func readTestArchive(t *testing.T, file string) map[string]string {
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := map[string]string{}
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return files
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			bs, _ := ioutil.ReadAll(reader)
+			files[header.Name] = string(bs)
+		}
+	}
+}
+
+func TestResolveGitCommit(t *testing.T) {
+	repository, first, second := newTestGitRepository(t)
+
+	if _, err := resolveGitCommit(&GitSource{Repository: repository, Ref: "main"}); err == nil {
+		t.Fatalf("local repository should not be allowed")
+	}
+
+	allowLocalGit(t)
+	tests := []struct {
+		ref    string
+		commit string
+	}{
+		{"main", second},
+		{"v1", first},
+		{first, first},
+		{"unknown", ""},
+	}
+	for _, test := range tests {
+		commit, err := resolveGitCommit(&GitSource{Repository: repository, Ref: test.ref})
+		if test.commit == "" {
+			if err == nil {
+				t.Errorf("resolve unknown ref should fail, got %s", commit)
+			}
+			continue
+		}
+		if err != nil || commit != test.commit {
+			t.Errorf("resolve %s = %s, %v, want %s", test.ref, commit, err, test.commit)
+		}
+	}
+}
+
+func TestFetchGitSource(t *testing.T) {
+	repository, first, _ := newTestGitRepository(t)
+	allowLocalGit(t)
+	dir := t.TempDir()
+
+	serverFile := filepath.Join(dir, "Test.HelloServer-v1.tgz")
+	if err := fetchGitSource(context.TODO(), &GitSource{Repository: repository, SubDir: "server", Commit: first}, serverFile, MaxGitCloneSize); err != nil {
+		t.Fatal(err)
+	}
+	files := readTestArchive(t, serverFile)
+	if len(files) != 1 || files["server/version.txt"] != "v1" {
+		t.Errorf("archive should only contain server/version.txt of v1, got %v", files)
+	}
+	if _, err := os.Stat(serverFile + ".src"); !os.IsNotExist(err) {
+		t.Errorf("cloned repository should be removed")
+	}
+
+	serverFile = filepath.Join(dir, "Test.HelloServer-v2.tgz")
+	if err := fetchGitSource(context.TODO(), &GitSource{Repository: repository, SubDir: "outside", Commit: first}, serverFile, MaxGitCloneSize); err == nil {
+		t.Errorf("subDir linked outside of the repository should be rejected")
+	}
+
+	serverFile = filepath.Join(dir, "Test.HelloServer-v3.tgz")
+	err := fetchGitSource(context.TODO(), &GitSource{Repository: repository, SubDir: "server", Commit: first}, serverFile, 16)
+	if err == nil || !strings.Contains(err.Error(), "larger than") {
+		t.Errorf("repository larger than limit should be rejected, got %v", err)
+	}
+}
+
+func TestSourceDialControl(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"127.0.0.1:80", false},
+		{"[::1]:80", false},
+		{"169.254.169.254:80", false},
+		{"10.96.0.1:443", false},
+		{"172.20.0.1:443", false},
+		{"192.168.1.1:80", false},
+		{"100.64.0.1:80", false},
+		{"0.0.0.0:80", false},
+		{"[fd00::1]:80", false},
+		{"[::ffff:10.0.0.1]:80", false},
+	}
+	for _, test := range tests {
+		if err := sourceDialControl("tcp", test.address, nil); (err == nil) != test.allowed {
+			t.Errorf("dial %s error = %v, want allowed %v", test.address, err, test.allowed)
+		}
+	}
+}
+
+func TestFetchURLSource(t *testing.T) {
+	content := []byte(strings.Repeat("server", 100))
+	sum := sha256.Sum256(content)
+	checksum := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(writer http.ResponseWriter, request *http.Request) {
+		if request.URL.Path != "/server.tgz" {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		// no Content-Length, the size is only known when reading
+		writer.(http.Flusher).Flush()
+		_, _ = writer.Write(content)
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	// the test server listens on loopback, which is rejected unless allowed
+	err := fetchURLSource(context.TODO(), &URLSource{URL: server.URL + "/server.tgz", Sha256: checksum}, filepath.Join(dir, "loopback.tgz"), 1024)
+	if err == nil || !strings.Contains(err.Error(), "is not allowed") {
+		t.Errorf("download from loopback address error = %v, want not allowed", err)
+	}
+	allowPrivateSource(t)
+
+	tests := []struct {
+		name   string
+		path   string
+		sha256 string
+		limit  int64
+		valid  bool
+	}{
+		{"download", "/server.tgz", checksum, 1024, true},
+		{"checksum mismatch", "/server.tgz", strings.Repeat("0", 64), 1024, false},
+		{"larger than limit", "/server.tgz", checksum, 64, false},
+		{"not found", "/other.tgz", checksum, 1024, false},
+	}
+	for i, test := range tests {
+		serverFile := filepath.Join(dir, test.name+".tgz")
+		err := fetchURLSource(context.TODO(), &URLSource{URL: server.URL + test.path, Sha256: test.sha256}, serverFile, test.limit)
+		if (err == nil) != test.valid {
+			t.Errorf("%d %s: error = %v, want valid %v", i, test.name, err, test.valid)
+			continue
+		}
+		bs, readErr := ioutil.ReadFile(serverFile)
+		if test.valid && string(bs) != string(content) {
+			t.Errorf("%s: downloaded file mismatch", test.name)
+		}
+		if !test.valid && !os.IsNotExist(readErr) {
+			t.Errorf("%s: file of failed download should be removed", test.name)
+		}
+	}
+}
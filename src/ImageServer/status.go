@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsRuntime "k8s.tars.io/runtime"
+	"time"
+)
+
+var errTaskLogNotFound = fmt.Errorf("build log not available")
+
+// GetTask return the build state of task and its 1-based queue position, position is 0 if the task is not queued
+func (e *Engine) GetTask(timageName, id string) (*tarsV1beta3.TImageBuildState, int, error) {
+	timage, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(tarsRuntime.Namespace).Get(context.TODO(), timageName, k8sMetaV1.GetOptions{})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if timage.Build != nil {
+		for i, state := range timage.Build.Queue {
+			if state.ID == id {
+				return state, i + 1, nil
+			}
+		}
+		if timage.Build.Running != nil && timage.Build.Running.ID == id {
+			return timage.Build.Running, 0, nil
+		}
+		if timage.Build.Last != nil && timage.Build.Last.ID == id {
+			return timage.Build.Last, 0, nil
+		}
+	}
+
+	// older builds only leave their releases
+	for _, release := range timage.Releases {
+		if release.ID == id {
+			state := &tarsV1beta3.TImageBuildState{
+				ID:         release.ID,
+				Image:      release.Image,
+				Secret:     release.Secret,
+				CreateTime: release.CreateTime,
+				Phase:      BuildPhaseDone,
+				Message:    "Success",
+				Tag:        release.Tag,
+				SemVer:     release.SemVer,
+				Commit:     release.Commit,
+				Digest:     release.Digest,
+			}
+			if release.CreatePerson != nil {
+				state.CreatePerson = *release.CreatePerson
+			}
+			if release.Mark != nil {
+				state.Mark = *release.Mark
+			}
+			return state, 0, nil
+		}
+	}
+	return nil, 0, errTaskNotFound
+}
+
+func taskFinished(state *tarsV1beta3.TImageBuildState) bool {
+	switch state.Phase {
+	case BuildPhaseDone, BuildPhaseFailed, BuildPhaseCancelled:
+		return true
+	}
+	return false
+}
+
+// OpenTaskLog wait until the kaniko pod of task started, then follow its output until the pod exits or ctx done
+func (e *Engine) OpenTaskLog(ctx context.Context, timageName, id string) (io.ReadCloser, error) {
+	podInterface := tarsRuntime.Clients.K8sClient.CoreV1().Pods(tarsRuntime.Namespace)
+	for {
+		state, _, err := e.GetTask(timageName, id)
+		if err != nil {
+			return nil, err
+		}
+
+		pod, err := podInterface.Get(ctx, builderPodName(id), k8sMetaV1.GetOptions{})
+		if err == nil && pod.Status.Phase != k8sCoreV1.PodPending {
+			return podInterface.GetLogs(pod.Name, &k8sCoreV1.PodLogOptions{Container: "kaniko", Follow: true}).Stream(ctx)
+		}
+
+		if err != nil && !errors.IsNotFound(err) {
+			return nil, err
+		}
+
+		if taskFinished(state) {
+			return nil, errTaskLogNotFound
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(LogPollInterval):
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	tarsTool "k8s.tars.io/tool"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FieldError describe why a request field is rejected
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// ValidationError collect all the FieldError of a request
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, 0, len(e.Errors))
+	for _, fieldError := range e.Errors {
+		messages = append(messages, fmt.Sprintf("%s: %s", fieldError.Field, fieldError.Message))
+	}
+	return fmt.Sprintf("invalid request, %s", strings.Join(messages, "; "))
+}
+
+func newValidationError(field, rule, format string, a ...interface{}) *ValidationError {
+	return &ValidationError{Errors: []FieldError{{Field: field, Rule: rule, Message: fmt.Sprintf(format, a...)}}}
+}
+
+var hostnameRFC1123Regex = regexp.MustCompile(`^([a-zA-Z0-9][a-zA-Z0-9-]{0,62})(\.[a-zA-Z0-9][a-zA-Z0-9-]{0,62})*$`)
+
+var imageReferenceRegex = regexp.MustCompile(`^[a-zA-Z0-9]+([.-][a-zA-Z0-9]+)*(:[0-9]+)?(/[a-z0-9]+(([._]|__|-+)[a-z0-9]+)*)*(:\w[\w.-]{0,127})?(@sha256:[0-9a-f]{64})?$`)
+
+// validateParams check fields of v against their validate tags, the supported rules are:
+//
+//	required           value should not be empty
+//	omitempty          skip the other rules if value is empty
+//	hostname_rfc1123   value is a rfc1123 hostname
+//	image_tag          value is a lower case image tag
+//	image_reference    value is an image reference, with optional tag and digest
+//	oneof=a b c        value is one of the space separated items
+//	max=n              value is no longer than n
+func validateParams(v interface{}) error {
+	value := reflect.Indirect(reflect.ValueOf(v))
+	valueType := value.Type()
+
+	var fieldErrors []FieldError
+	for i := 0; i < valueType.NumField(); i++ {
+		field := valueType.Field(i)
+		tag := field.Tag.Get("validate")
+		if tag == "" || field.Type.Kind() != reflect.String {
+			continue
+		}
+
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+
+		if fieldError := validateField(name, value.Field(i).String(), tag); fieldError != nil {
+			fieldErrors = append(fieldErrors, *fieldError)
+		}
+	}
+
+	if len(fieldErrors) != 0 {
+		return &ValidationError{Errors: fieldErrors}
+	}
+	return nil
+}
+
+func validateField(name, value, tag string) *FieldError {
+	for _, rule := range strings.Split(tag, ",") {
+		ruleName, arg := rule, ""
+		if i := strings.IndexByte(rule, '='); i != -1 {
+			ruleName, arg = rule[:i], rule[i+1:]
+		}
+
+		var message string
+		switch ruleName {
+		case "required":
+			if value == "" {
+				message = "value is required"
+			}
+		case "omitempty":
+			if value == "" {
+				return nil
+			}
+		case "hostname_rfc1123":
+			if !hostnameRFC1123Regex.MatchString(value) {
+				message = fmt.Sprintf("%q is not a rfc1123 hostname", value)
+			}
+		case "image_tag":
+			if tarsTool.ValidImageTag(value) != nil {
+				message = fmt.Sprintf("%q is not a valid image tag", value)
+			}
+		case "image_reference":
+			if !imageReferenceRegex.MatchString(value) {
+				message = fmt.Sprintf("%q is not a valid image reference", value)
+			}
+		case "oneof":
+			found := false
+			for _, item := range strings.Fields(arg) {
+				if item == value {
+					found = true
+					break
+				}
+			}
+			if !found {
+				message = fmt.Sprintf("%q should be one of %s", value, strings.Join(strings.Fields(arg), ", "))
+			}
+		case "max":
+			if max, _ := strconv.Atoi(arg); len(value) > max {
+				message = fmt.Sprintf("value should be no longer than %d", max)
+			}
+		default:
+			panic(fmt.Sprintf("unknown validate rule %s of %s", ruleName, name))
+		}
+
+		if message != "" {
+			return &FieldError{Field: name, Rule: ruleName, Message: message}
+		}
+	}
+	return nil
+}
@@ -46,6 +46,8 @@ var (
 	timageName                     = ""
 	timageSnap *tarsV1beta3.TImage = nil
 	k8sContext *K8SContext         = nil
+	// imageDigest is the manifest digest of the pushed image, reported to image server through the running state
+	imageDigest = ""
 )
 
 func init() {
@@ -54,6 +56,7 @@ func init() {
 	RootCmd.PersistentFlags().StringVarP(&opts.DockerfilePath, "dockerfile", "f", "Dockerfile", "Path to the dockerfile to be built.")
 	RootCmd.PersistentFlags().StringVarP(&opts.SrcContext, "context", "c", "/workspace/", "Path to the dockerfile build context.")
 	RootCmd.PersistentFlags().VarP(&opts.Destinations, "destination", "d", "Registry the final image should be pushed to. Set it repeatedly for multiple destinations.")
+	RootCmd.PersistentFlags().VarP(&opts.BuildArgs, "build-arg", "", "This flag allows you to pass in ARG values at build time. Set it repeatedly for multiple values.")
 	RootCmd.PersistentFlags().StringVarP(&opts.SnapshotMode, "snapshotMode", "", "full", "Change the file attributes inspected during snapshotting")
 	RootCmd.PersistentFlags().BoolVarP(&opts.SkipTLSVerify, "skip-tls-verify", "", true, "Push to insecure registry ignoring TLS verify")
 	RootCmd.PersistentFlags().IntVar(&opts.PushRetry, "push-retry", 3, "Number of retries for the push operation")
@@ -75,15 +78,26 @@ func init() {
 }
 
 func pushStateOrDie(phase string, message string) {
-	timageSnap.Build.Running.Phase = phase
-	timageSnap.Build.Running.Message = message
 	var err error
 	for i := 0; i < 3; i++ {
-		timageSnap, err = k8sContext.crdClient.TarsV1beta3().TImages(k8sContext.namespace).Update(context.TODO(), timageSnap, k8sMetaV1.UpdateOptions{})
-		if err == nil {
+		if i != 0 {
+			// the build queue of timage is updated by image server at the same time, refresh before retry
+			time.Sleep(time.Duration(300) * time.Millisecond)
+			if timageSnap, err = k8sContext.crdClient.TarsV1beta3().TImages(k8sContext.namespace).Get(context.TODO(), timageName, k8sMetaV1.GetOptions{}); err != nil {
+				continue
+			}
+			if timageSnap.Build == nil || timageSnap.Build.Running == nil || timageSnap.Build.Running.ID != id {
+				exit(fmt.Errorf("build id missing or changed"))
+			}
+		}
+		timageSnap.Build.Running.Phase = phase
+		timageSnap.Build.Running.Message = message
+		timageSnap.Build.Running.Digest = imageDigest
+		var timage *tarsV1beta3.TImage
+		if timage, err = k8sContext.crdClient.TarsV1beta3().TImages(k8sContext.namespace).Update(context.TODO(), timageSnap, k8sMetaV1.UpdateOptions{}); err == nil {
+			timageSnap = timage
 			return
 		}
-		time.Sleep(time.Duration(300) * time.Millisecond)
 	}
 	if err != nil {
 		exit(fmt.Errorf("update running state failed: %s", err.Error()))
@@ -170,6 +184,13 @@ var RootCmd = &cobra.Command{
 			exit(err)
 		}
 
+		digest, err := image.Digest()
+		if err != nil {
+			exit(errors.Wrap(err, "error getting digest of image"))
+		}
+		imageDigest = digest.String()
+		pushStateOrDie(BuildPhasePreparePushing, "image pushed")
+
 		return
 	},
 }
@@ -3,14 +3,40 @@ package v1beta3
 import (
 	k8sAppsV1 "k8s.io/api/apps/v1"
 	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
 )
 
 type TServerAppend1b21b3 struct {
-	Command        []string `json:"command"`
-	Args           []string `json:"args"`
-	ReadinessGates []string `json:"readinessGates"`
+	Command        []string               `json:"command"`
+	Args           []string               `json:"args"`
+	ReadinessGates []string               `json:"readinessGates"`
+	LivenessProbe  *tarsV1beta3.TK8SProbe `json:"livenessProbe,omitempty"`
+	ReadinessProbe *tarsV1beta3.TK8SProbe `json:"readinessProbe,omitempty"`
+	StartupProbe   *tarsV1beta3.TK8SProbe `json:"startupProbe,omitempty"`
+
+	Tolerations               []k8sCoreV1.Toleration               `json:"tolerations,omitempty"`
+	TopologySpreadConstraints []k8sCoreV1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	ZoneSpread                bool                                 `json:"zoneSpread,omitempty"`
+	PriorityClassName         string                               `json:"priorityClassName,omitempty"`
+
+	Sidecars       []tarsV1beta3.TK8SContainer `json:"sidecars,omitempty"`
+	InitContainers []tarsV1beta3.TK8SContainer `json:"initContainers,omitempty"`
+
+	DisruptionBudget *tarsV1beta3.TK8SDisruptionBudget `json:"disruptionBudget,omitempty"`
+	Autoscaler       *tarsV1beta3.TK8SAutoscaler       `json:"autoscaler,omitempty"`
+
+	ReleaseCanary  *tarsV1beta3.TServerCanary          `json:"releaseCanary,omitempty"`
+	ReleaseDigest  string                              `json:"releaseDigest,omitempty"`
+	ReleaseHistory []*tarsV1beta3.TServerReleaseRecord `json:"releaseHistory,omitempty"`
+
+	External *tarsV1beta3.TServerExternal `json:"external,omitempty"`
+
+	ObservedGeneration int64                            `json:"observedGeneration,omitempty"`
+	Conditions         []k8sMetaV1.Condition            `json:"conditions,omitempty"`
+	StableRelease      *tarsV1beta3.TServerRelease      `json:"stableRelease,omitempty"`
+	Canary             *tarsV1beta3.TServerCanaryStatus `json:"canary,omitempty"`
 }
 
 type TServerDrop1b21b3 struct {
@@ -26,9 +52,34 @@ type TServerAppend1b11b3 struct {
 	ImagePullPolicy                 k8sCoreV1.PullPolicy                `json:"imagePullPolicy"`
 	LauncherType                    tarsMeta.LauncherType               `json:"launcherType"`
 	*tarsV1beta3.TServerReleaseNode `json:",inline"`
-	Command                         []string `json:"command"`
-	Args                            []string `json:"args"`
-	ReadinessGates                  []string `json:"readinessGates"`
+	Command                         []string               `json:"command"`
+	Args                            []string               `json:"args"`
+	ReadinessGates                  []string               `json:"readinessGates"`
+	LivenessProbe                   *tarsV1beta3.TK8SProbe `json:"livenessProbe,omitempty"`
+	ReadinessProbe                  *tarsV1beta3.TK8SProbe `json:"readinessProbe,omitempty"`
+	StartupProbe                    *tarsV1beta3.TK8SProbe `json:"startupProbe,omitempty"`
+
+	Tolerations               []k8sCoreV1.Toleration               `json:"tolerations,omitempty"`
+	TopologySpreadConstraints []k8sCoreV1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+	ZoneSpread                bool                                 `json:"zoneSpread,omitempty"`
+	PriorityClassName         string                               `json:"priorityClassName,omitempty"`
+
+	Sidecars       []tarsV1beta3.TK8SContainer `json:"sidecars,omitempty"`
+	InitContainers []tarsV1beta3.TK8SContainer `json:"initContainers,omitempty"`
+
+	DisruptionBudget *tarsV1beta3.TK8SDisruptionBudget `json:"disruptionBudget,omitempty"`
+	Autoscaler       *tarsV1beta3.TK8SAutoscaler       `json:"autoscaler,omitempty"`
+
+	ReleaseCanary  *tarsV1beta3.TServerCanary          `json:"releaseCanary,omitempty"`
+	ReleaseDigest  string                              `json:"releaseDigest,omitempty"`
+	ReleaseHistory []*tarsV1beta3.TServerReleaseRecord `json:"releaseHistory,omitempty"`
+
+	External *tarsV1beta3.TServerExternal `json:"external,omitempty"`
+
+	ObservedGeneration int64                            `json:"observedGeneration,omitempty"`
+	Conditions         []k8sMetaV1.Condition            `json:"conditions,omitempty"`
+	StableRelease      *tarsV1beta3.TServerRelease      `json:"stableRelease,omitempty"`
+	Canary             *tarsV1beta3.TServerCanaryStatus `json:"canary,omitempty"`
 }
 
 type TServerDrop1b11b3 struct {
@@ -40,7 +91,8 @@ type TServerConversion1b11b3 struct {
 }
 
 type TFCAppend1b21b3 struct {
-	Executor tarsV1beta3.TFrameworkImage `json:"executor"`
+	Executor       tarsV1beta3.TFrameworkImage `json:"executor"`
+	TServerRelease int                         `json:"tserverRelease,omitempty"`
 }
 
 type TFCDrop1b21b3 struct {
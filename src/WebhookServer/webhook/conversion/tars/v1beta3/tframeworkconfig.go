@@ -47,10 +47,14 @@ func CvTFC1b2To1b3(s []runtime.RawExtension) []runtime.RawExtension {
 				Registry: src.ImageRegistry.Registry,
 				Secret:   src.ImageRegistry.Secret,
 			},
-			RecordLimit: tarsV1beta3.TFrameworkRecordLimit(src.RecordLimit),
-			NodeImage:   tarsV1beta3.TFrameworkImage(src.NodeImage),
-			UPChain:     conversionUpChainV1b2ToV1b3(src.UPChain),
-			Expand:      src.Expand,
+			RecordLimit: tarsV1beta3.TFrameworkRecordLimit{
+				TExitedPod:     src.RecordLimit.TExitedPod,
+				TConfigHistory: src.RecordLimit.TConfigHistory,
+				TImageRelease:  src.RecordLimit.TImageRelease,
+			},
+			NodeImage: tarsV1beta3.TFrameworkImage(src.NodeImage),
+			UPChain:   conversionUpChainV1b2ToV1b3(src.UPChain),
+			Expand:    src.Expand,
 		}
 
 		for ii := 0; ii < 1; ii++ {
@@ -70,6 +74,7 @@ func CvTFC1b2To1b3(s []runtime.RawExtension) []runtime.RawExtension {
 				break
 			}
 			dst.ImageBuild.Executor = diff.Append.Executor
+			dst.RecordLimit.TServerRelease = diff.Append.TServerRelease
 		}
 		d[i].Raw, _ = json.Marshal(dst)
 	}
@@ -111,15 +116,20 @@ func CvTFC1b3To1b2(s []runtime.RawExtension) []runtime.RawExtension {
 				Registry: src.ImageUpload.Registry,
 				Secret:   src.ImageUpload.Secret,
 			},
-			RecordLimit: tarsV1beta2.TFrameworkRecordLimit(src.RecordLimit),
-			NodeImage:   tarsV1beta2.TFrameworkNodeImage(src.NodeImage),
-			UPChain:     conversionUpChainV1b3ToV1b2(src.UPChain),
-			Expand:      src.Expand,
+			RecordLimit: tarsV1beta2.TFrameworkRecordLimit{
+				TExitedPod:     src.RecordLimit.TExitedPod,
+				TConfigHistory: src.RecordLimit.TConfigHistory,
+				TImageRelease:  src.RecordLimit.TImageRelease,
+			},
+			NodeImage: tarsV1beta2.TFrameworkNodeImage(src.NodeImage),
+			UPChain:   conversionUpChainV1b3ToV1b2(src.UPChain),
+			Expand:    src.Expand,
 		}
 
 		diff := TFCConversion1b21b3{
 			Append: TFCAppend1b21b3{
-				Executor: src.ImageBuild.Executor,
+				Executor:       src.ImageBuild.Executor,
+				TServerRelease: src.RecordLimit.TServerRelease,
 			},
 		}
 		bs, _ := json.Marshal(diff)
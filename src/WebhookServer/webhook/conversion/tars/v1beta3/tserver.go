@@ -10,7 +10,6 @@ import (
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
 	"tarswebhook/webhook/conversion"
-	"unsafe"
 )
 
 func conversionTars1b1To1b3(src *tarsV1beta1.TServerTars) *tarsV1beta3.TServerTars {
@@ -110,7 +109,12 @@ func CvTServer1b1To1b3(s []runtime.RawExtension) []runtime.RawExtension {
 				},
 				Release: nil,
 			},
-			Status: tarsV1beta3.TServerStatus(src.Status),
+			Status: tarsV1beta3.TServerStatus{
+				Replicas:        src.Status.Replicas,
+				ReadyReplicas:   src.Status.ReadyReplicas,
+				CurrentReplicas: src.Status.CurrentReplicas,
+				Selector:        src.Status.Selector,
+			},
 		}
 
 		if src.Spec.Release != nil {
@@ -148,8 +152,27 @@ func CvTServer1b1To1b3(s []runtime.RawExtension) []runtime.RawExtension {
 			dst.Spec.K8S.Command = diff.Append.Command
 			dst.Spec.K8S.Args = diff.Append.Args
 			dst.Spec.K8S.ReadinessGates = append(dst.Spec.K8S.ReadinessGates, diff.Append.ReadinessGates...)
+			dst.Spec.K8S.LivenessProbe = diff.Append.LivenessProbe
+			dst.Spec.K8S.ReadinessProbe = diff.Append.ReadinessProbe
+			dst.Spec.K8S.StartupProbe = diff.Append.StartupProbe
+			dst.Spec.K8S.Tolerations = diff.Append.Tolerations
+			dst.Spec.K8S.TopologySpreadConstraints = diff.Append.TopologySpreadConstraints
+			dst.Spec.K8S.ZoneSpread = diff.Append.ZoneSpread
+			dst.Spec.K8S.PriorityClassName = diff.Append.PriorityClassName
+			dst.Spec.K8S.Sidecars = diff.Append.Sidecars
+			dst.Spec.K8S.InitContainers = diff.Append.InitContainers
+			dst.Spec.K8S.DisruptionBudget = diff.Append.DisruptionBudget
+			dst.Spec.K8S.Autoscaler = diff.Append.Autoscaler
+			dst.Spec.ReleaseHistory = diff.Append.ReleaseHistory
+			dst.Spec.External = diff.Append.External
+			dst.Status.ObservedGeneration = diff.Append.ObservedGeneration
+			dst.Status.Conditions = diff.Append.Conditions
+			dst.Status.StableRelease = diff.Append.StableRelease
+			dst.Status.Canary = diff.Append.Canary
 			if dst.Spec.Release != nil {
 				dst.Spec.Release.TServerReleaseNode = diff.Append.TServerReleaseNode
+				dst.Spec.Release.Canary = diff.Append.ReleaseCanary
+				dst.Spec.Release.Digest = diff.Append.ReleaseDigest
 			}
 		}
 		d[i].Raw, _ = json.Marshal(dst)
@@ -256,7 +279,12 @@ func CvTServer1b3To1b1(s []runtime.RawExtension) []runtime.RawExtension {
 				},
 				Release: nil,
 			},
-			Status: tarsV1beta1.TServerStatus(src.Status),
+			Status: tarsV1beta1.TServerStatus{
+				Replicas:        src.Status.Replicas,
+				ReadyReplicas:   src.Status.ReadyReplicas,
+				CurrentReplicas: src.Status.CurrentReplicas,
+				Selector:        src.Status.Selector,
+			},
 		}
 
 		if src.Spec.Release != nil {
@@ -275,6 +303,29 @@ func CvTServer1b3To1b1(s []runtime.RawExtension) []runtime.RawExtension {
 				LauncherType:    src.Spec.K8S.LauncherType,
 				Command:         src.Spec.K8S.Command,
 				Args:            src.Spec.K8S.Args,
+				LivenessProbe:   src.Spec.K8S.LivenessProbe,
+				ReadinessProbe:  src.Spec.K8S.ReadinessProbe,
+				StartupProbe:    src.Spec.K8S.StartupProbe,
+
+				Tolerations:               src.Spec.K8S.Tolerations,
+				TopologySpreadConstraints: src.Spec.K8S.TopologySpreadConstraints,
+				ZoneSpread:                src.Spec.K8S.ZoneSpread,
+				PriorityClassName:         src.Spec.K8S.PriorityClassName,
+
+				Sidecars:       src.Spec.K8S.Sidecars,
+				InitContainers: src.Spec.K8S.InitContainers,
+
+				DisruptionBudget: src.Spec.K8S.DisruptionBudget,
+				Autoscaler:       src.Spec.K8S.Autoscaler,
+
+				ReleaseHistory: src.Spec.ReleaseHistory,
+
+				External: src.Spec.External,
+
+				ObservedGeneration: src.Status.ObservedGeneration,
+				Conditions:         src.Status.Conditions,
+				StableRelease:      src.Status.StableRelease,
+				Canary:             src.Status.Canary,
 			},
 		}
 
@@ -284,6 +335,8 @@ func CvTServer1b3To1b1(s []runtime.RawExtension) []runtime.RawExtension {
 
 		if src.Spec.Release != nil {
 			diff.Append.TServerReleaseNode = src.Spec.Release.TServerReleaseNode
+			diff.Append.ReleaseCanary = src.Spec.Release.Canary
+			diff.Append.ReleaseDigest = src.Spec.Release.Digest
 		}
 
 		bs, _ := json.Marshal(diff)
@@ -393,11 +446,22 @@ func CvTServer1b2To1b3(s []runtime.RawExtension) []runtime.RawExtension {
 				},
 				Release: nil,
 			},
-			Status: tarsV1beta3.TServerStatus(src.Status),
+			Status: tarsV1beta3.TServerStatus{
+				Replicas:        src.Status.Replicas,
+				ReadyReplicas:   src.Status.ReadyReplicas,
+				CurrentReplicas: src.Status.CurrentReplicas,
+				Selector:        src.Status.Selector,
+			},
 		}
 
 		if src.Spec.Release != nil {
-			dst.Spec.Release = (*tarsV1beta3.TServerRelease)(unsafe.Pointer(src.Spec.Release))
+			dst.Spec.Release = &tarsV1beta3.TServerRelease{
+				ID:                 src.Spec.Release.ID,
+				Image:              src.Spec.Release.Image,
+				Secret:             src.Spec.Release.Secret,
+				Time:               src.Spec.Release.Time,
+				TServerReleaseNode: (*tarsV1beta3.TServerReleaseNode)(src.Spec.Release.TServerReleaseNode),
+			}
 		}
 
 		if src.Spec.K8S.ReadinessGate != "" {
@@ -426,6 +490,27 @@ func CvTServer1b2To1b3(s []runtime.RawExtension) []runtime.RawExtension {
 			dst.Spec.K8S.Args = diff.Append.Args
 			dst.Spec.K8S.Command = diff.Append.Command
 			dst.Spec.K8S.ReadinessGates = append(dst.Spec.K8S.ReadinessGates, diff.Append.ReadinessGates...)
+			dst.Spec.K8S.LivenessProbe = diff.Append.LivenessProbe
+			dst.Spec.K8S.ReadinessProbe = diff.Append.ReadinessProbe
+			dst.Spec.K8S.StartupProbe = diff.Append.StartupProbe
+			dst.Spec.K8S.Tolerations = diff.Append.Tolerations
+			dst.Spec.K8S.TopologySpreadConstraints = diff.Append.TopologySpreadConstraints
+			dst.Spec.K8S.ZoneSpread = diff.Append.ZoneSpread
+			dst.Spec.K8S.PriorityClassName = diff.Append.PriorityClassName
+			dst.Spec.K8S.Sidecars = diff.Append.Sidecars
+			dst.Spec.K8S.InitContainers = diff.Append.InitContainers
+			dst.Spec.K8S.DisruptionBudget = diff.Append.DisruptionBudget
+			dst.Spec.K8S.Autoscaler = diff.Append.Autoscaler
+			dst.Spec.ReleaseHistory = diff.Append.ReleaseHistory
+			dst.Spec.External = diff.Append.External
+			dst.Status.ObservedGeneration = diff.Append.ObservedGeneration
+			dst.Status.Conditions = diff.Append.Conditions
+			dst.Status.StableRelease = diff.Append.StableRelease
+			dst.Status.Canary = diff.Append.Canary
+			if dst.Spec.Release != nil {
+				dst.Spec.Release.Canary = diff.Append.ReleaseCanary
+				dst.Spec.Release.Digest = diff.Append.ReleaseDigest
+			}
 		}
 		d[i].Raw, _ = json.Marshal(dst)
 	}
@@ -534,17 +619,51 @@ func CvTServer1b3To1b2(s []runtime.RawExtension) []runtime.RawExtension {
 				},
 				Release: nil,
 			},
-			Status: tarsV1beta2.TServerStatus(src.Status),
+			Status: tarsV1beta2.TServerStatus{
+				Replicas:        src.Status.Replicas,
+				ReadyReplicas:   src.Status.ReadyReplicas,
+				CurrentReplicas: src.Status.CurrentReplicas,
+				Selector:        src.Status.Selector,
+			},
 		}
 
 		if src.Spec.Release != nil {
-			dst.Spec.Release = (*tarsV1beta2.TServerRelease)(unsafe.Pointer(src.Spec.Release))
+			dst.Spec.Release = &tarsV1beta2.TServerRelease{
+				ID:                 src.Spec.Release.ID,
+				Image:              src.Spec.Release.Image,
+				Secret:             src.Spec.Release.Secret,
+				Time:               src.Spec.Release.Time,
+				TServerReleaseNode: (*tarsV1beta2.TServerReleaseNode)(src.Spec.Release.TServerReleaseNode),
+			}
 		}
 
 		diff := TServerConversion1b21b3{
 			Append: TServerAppend1b21b3{
-				Command: src.Spec.K8S.Command,
-				Args:    src.Spec.K8S.Args,
+				Command:        src.Spec.K8S.Command,
+				Args:           src.Spec.K8S.Args,
+				LivenessProbe:  src.Spec.K8S.LivenessProbe,
+				ReadinessProbe: src.Spec.K8S.ReadinessProbe,
+				StartupProbe:   src.Spec.K8S.StartupProbe,
+
+				Tolerations:               src.Spec.K8S.Tolerations,
+				TopologySpreadConstraints: src.Spec.K8S.TopologySpreadConstraints,
+				ZoneSpread:                src.Spec.K8S.ZoneSpread,
+				PriorityClassName:         src.Spec.K8S.PriorityClassName,
+
+				Sidecars:       src.Spec.K8S.Sidecars,
+				InitContainers: src.Spec.K8S.InitContainers,
+
+				DisruptionBudget: src.Spec.K8S.DisruptionBudget,
+				Autoscaler:       src.Spec.K8S.Autoscaler,
+
+				ReleaseHistory: src.Spec.ReleaseHistory,
+
+				External: src.Spec.External,
+
+				ObservedGeneration: src.Status.ObservedGeneration,
+				Conditions:         src.Status.Conditions,
+				StableRelease:      src.Status.StableRelease,
+				Canary:             src.Status.Canary,
 			},
 		}
 
@@ -552,6 +671,11 @@ func CvTServer1b3To1b2(s []runtime.RawExtension) []runtime.RawExtension {
 			diff.Append.ReadinessGates = src.Spec.K8S.ReadinessGates[1:]
 		}
 
+		if src.Spec.Release != nil {
+			diff.Append.ReleaseCanary = src.Spec.Release.Canary
+			diff.Append.ReleaseDigest = src.Spec.Release.Digest
+		}
+
 		bs, _ := json.Marshal(diff)
 		if dst.Annotations == nil {
 			dst.Annotations = map[string]string{}
@@ -6,16 +6,29 @@ import (
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/json"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
 	tarsTool "k8s.tars.io/tool"
 	"strings"
 	"tarswebhook/webhook/lister"
 	"tarswebhook/webhook/mutating"
 )
 
-func mutatingCreateTImage(listers *lister.Listers, requestAdmissionView *k8sAdmissionV1.AdmissionReview) ([]byte, error) {
-	timage := &tarsV1beta3.TImage{}
-	_ = json.Unmarshal(requestAdmissionView.Request.Object.Raw, timage)
+// timageOwner return the app and server owning timage, the labels of old timage are kept, or they are taken from the same named tserver
+func timageOwner(listers *lister.Listers, timage, oldTImage *tarsV1beta3.TImage) (string, string) {
+	if oldTImage != nil && oldTImage.Labels[tarsMeta.TServerAppLabel] != "" {
+		return oldTImage.Labels[tarsMeta.TServerAppLabel], oldTImage.Labels[tarsMeta.TServerNameLabel]
+	}
+	if timage.Labels[tarsMeta.TServerAppLabel] != "" || timage.ImageType != "server" || !listers.TSSynced() {
+		return "", ""
+	}
+	tserver, err := listers.TSLister.TServers(timage.Namespace).Get(timage.Name)
+	if err != nil {
+		return "", ""
+	}
+	return tserver.Spec.App, tserver.Spec.Server
+}
 
+func mutatingTImage(listers *lister.Listers, timage, oldTImage *tarsV1beta3.TImage) ([]byte, error) {
 	var jsonPatch tarsTool.JsonPatch
 
 	if timage.Labels == nil {
@@ -33,6 +46,19 @@ func mutatingCreateTImage(listers *lister.Listers, requestAdmissionView *k8sAdmi
 		Value: timage.ImageType,
 	})
 
+	// ImageServer authorizes builds of timage by its owner
+	if app, server := timageOwner(listers, timage, oldTImage); app != "" {
+		jsonPatch = append(jsonPatch, tarsTool.JsonPatchItem{
+			OP:    tarsTool.JsonPatchAdd,
+			Path:  "/metadata/labels/" + strings.ReplaceAll(tarsMeta.TServerAppLabel, "/", "~1"),
+			Value: app,
+		}, tarsTool.JsonPatchItem{
+			OP:    tarsTool.JsonPatchAdd,
+			Path:  "/metadata/labels/" + strings.ReplaceAll(tarsMeta.TServerNameLabel, "/", "~1"),
+			Value: server,
+		})
+	}
+
 	shouldAddSupportedLabel := make(map[string]string, len(timage.SupportedType))
 
 	if timage.ImageType == "base" && timage.SupportedType != nil {
@@ -101,8 +127,25 @@ func mutatingCreateTImage(listers *lister.Listers, requestAdmissionView *k8sAdmi
 	return nil, nil
 }
 
+func mutatingCreateTImage(listers *lister.Listers, requestAdmissionView *k8sAdmissionV1.AdmissionReview) ([]byte, error) {
+	timage := &tarsV1beta3.TImage{}
+	_ = json.Unmarshal(requestAdmissionView.Request.Object.Raw, timage)
+	if timage.Namespace == "" {
+		timage.Namespace = requestAdmissionView.Request.Namespace
+	}
+	return mutatingTImage(listers, timage, nil)
+}
+
 func mutatingUpdateTImage(listers *lister.Listers, requestAdmissionView *k8sAdmissionV1.AdmissionReview) ([]byte, error) {
-	return mutatingCreateTImage(listers, requestAdmissionView)
+	timage := &tarsV1beta3.TImage{}
+	_ = json.Unmarshal(requestAdmissionView.Request.Object.Raw, timage)
+	if timage.Namespace == "" {
+		timage.Namespace = requestAdmissionView.Request.Namespace
+	}
+
+	oldTImage := &tarsV1beta3.TImage{}
+	_ = json.Unmarshal(requestAdmissionView.Request.OldObject.Raw, oldTImage)
+	return mutatingTImage(listers, timage, oldTImage)
 }
 
 func init() {
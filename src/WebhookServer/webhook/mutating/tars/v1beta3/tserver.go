@@ -3,7 +3,9 @@ package v1beta3
 import (
 	"fmt"
 	k8sAdmissionV1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/util/json"
 	"k8s.io/utils/integer"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
@@ -17,10 +19,7 @@ import (
 	"tarswebhook/webhook/mutating"
 )
 
-func mutatingCreateTServer(listers *lister.Listers, requestAdmissionView *k8sAdmissionV1.AdmissionReview) ([]byte, error) {
-	tserver := &tarsV1beta3.TServer{}
-	_ = json.Unmarshal(requestAdmissionView.Request.Object.Raw, tserver)
-
+func mutatingTServer(tserver *tarsV1beta3.TServer) (tarsTool.JsonPatch, error) {
 	var jsonPatch tarsTool.JsonPatch
 
 	if tserver.Labels == nil {
@@ -110,6 +109,15 @@ func mutatingCreateTServer(listers *lister.Listers, requestAdmissionView *k8sAdm
 		}
 	}
 
+	if tserver.Spec.External != nil {
+		if _, ok := tserver.Labels[tarsMeta.TTemplateLabel]; ok {
+			jsonPatch = append(jsonPatch, tarsTool.JsonPatchItem{
+				OP:   tarsTool.JsonPatchRemove,
+				Path: "/metadata/labels/tars.io~1Template",
+			})
+		}
+	}
+
 	if len(tserver.Spec.K8S.HostPorts) > 0 || tserver.Spec.K8S.HostIPC {
 		jsonPatch = append(jsonPatch, tarsTool.JsonPatchItem{
 			OP:    tarsTool.JsonPatchAdd,
@@ -168,6 +176,7 @@ func mutatingCreateTServer(listers *lister.Listers, requestAdmissionView *k8sAdm
 				Path:  "/spec/release/time",
 				Value: now.ToUnstructured(),
 			})
+			tserver.Spec.Release.Time = &now
 		}
 
 		jsonPatch = append(jsonPatch, tarsTool.JsonPatchItem{
@@ -194,6 +203,7 @@ func mutatingCreateTServer(listers *lister.Listers, requestAdmissionView *k8sAdm
 					Path:  "/spec/release/nodeSecret",
 					Value: secret,
 				})
+				tserver.Spec.Release.TServerReleaseNode = &tarsV1beta3.TServerReleaseNode{Image: image, Secret: secret}
 			}
 		}
 
@@ -212,10 +222,166 @@ func mutatingCreateTServer(listers *lister.Listers, requestAdmissionView *k8sAdm
 						Path: "/spec/release/nodeSecret",
 					})
 				}
+				tserver.Spec.Release.TServerReleaseNode = nil
 			}
 		}
 	}
 
+	return jsonPatch, nil
+}
+
+// resolveReleaseDigest find the digest pushed for image in the timage releases of namespace.
+// "" is returned if the timage informer has not synced yet or no release has a digest of image
+func resolveReleaseDigest(listers *lister.Listers, namespace string, image string) (string, error) {
+	if !listers.TISynced() {
+		return "", nil
+	}
+
+	timages, err := listers.TILister.TImages(namespace).List(labels.Everything())
+	if err != nil {
+		return "", err
+	}
+
+	for _, timage := range timages {
+		for _, release := range timage.Releases {
+			if release != nil && release.Image == image && release.Digest != "" {
+				return release.Digest, nil
+			}
+		}
+	}
+	return "", nil
+}
+
+// mutatingTServerReleaseDigest pin the release image to the digest recorded by timage when it is released,
+// so retagging the image never changes what the pods run. the digests are resolved by tarsimage when it builds or promotes
+// the release, the webhook never asks the registry, a release found in no timage is left unpinned
+func mutatingTServerReleaseDigest(listers *lister.Listers, tserver *tarsV1beta3.TServer, oldTServer *tarsV1beta3.TServer) (tarsTool.JsonPatch, error) {
+	release := tserver.Spec.Release
+	if release == nil {
+		return nil, nil
+	}
+
+	digest := release.Digest
+	if d := tarsTool.ImageDigest(release.Image); d != "" {
+		digest = d
+	} else if oldTServer != nil && oldTServer.Spec.Release != nil && oldTServer.Spec.Release.Image != release.Image && oldTServer.Spec.Release.Digest == digest {
+		// the image changed but the digest was left over from the previous release
+		digest = ""
+	}
+
+	if digest == "" {
+		var err error
+		if digest, err = resolveReleaseDigest(listers, tserver.Namespace, release.Image); err != nil {
+			return nil, err
+		}
+	}
+
+	if digest == release.Digest {
+		return nil, nil
+	}
+	release.Digest = digest
+
+	if digest == "" {
+		return tarsTool.JsonPatch{
+			{
+				OP:   tarsTool.JsonPatchRemove,
+				Path: "/spec/release/digest",
+			},
+		}, nil
+	}
+
+	return tarsTool.JsonPatch{
+		{
+			OP:    tarsTool.JsonPatchAdd,
+			Path:  "/spec/release/digest",
+			Value: digest,
+		},
+	}, nil
+}
+
+func equalReleaseRecord(release *tarsV1beta3.TServerRelease, record *tarsV1beta3.TServerReleaseRecord) bool {
+	if release.ID != record.ID || release.Image != record.Image || release.Secret != record.Secret || release.Digest != record.Digest {
+		return false
+	}
+	var releaseNode, recordNode tarsV1beta3.TServerReleaseNode
+	if release.TServerReleaseNode != nil {
+		releaseNode = *release.TServerReleaseNode
+	}
+	if record.TServerReleaseNode != nil {
+		recordNode = *record.TServerReleaseNode
+	}
+	return releaseNode == recordNode
+}
+
+// mutatingTServerReleaseHistory prepend the current release to the history when the release changed,
+// the history is owned by the webhook, so any change to it from the request is discarded
+func mutatingTServerReleaseHistory(tserver *tarsV1beta3.TServer, history []*tarsV1beta3.TServerReleaseRecord, person string, rollbackFrom string) tarsTool.JsonPatch {
+	release := tserver.Spec.Release
+	if release != nil && (len(history) == 0 || !equalReleaseRecord(release, history[0]) || rollbackFrom != "") {
+		var node *tarsV1beta3.TServerReleaseNode
+		if release.TServerReleaseNode != nil {
+			node = release.TServerReleaseNode.DeepCopy()
+		}
+		record := &tarsV1beta3.TServerReleaseRecord{
+			ID:                 release.ID,
+			Image:              release.Image,
+			Secret:             release.Secret,
+			Digest:             release.Digest,
+			Time:               release.Time,
+			TServerReleaseNode: node,
+			Person:             person,
+			RollbackFrom:       rollbackFrom,
+		}
+		history = append([]*tarsV1beta3.TServerReleaseRecord{record}, history...)
+	}
+
+	limit := tarsMeta.DefaultMaxTServerRelease
+	if tfc := tarsRuntime.TFCConfig.GetTFrameworkConfig(tserver.Namespace); tfc != nil && tfc.RecordLimit.TServerRelease > 0 {
+		limit = tfc.RecordLimit.TServerRelease
+	}
+	if len(history) > limit {
+		history = history[0:limit]
+	}
+
+	if equality.Semantic.DeepEqual(history, tserver.Spec.ReleaseHistory) {
+		return nil
+	}
+
+	if len(history) == 0 {
+		return tarsTool.JsonPatch{
+			{
+				OP:   tarsTool.JsonPatchRemove,
+				Path: "/spec/releaseHistory",
+			},
+		}
+	}
+
+	return tarsTool.JsonPatch{
+		{
+			OP:    tarsTool.JsonPatchAdd,
+			Path:  "/spec/releaseHistory",
+			Value: history,
+		},
+	}
+}
+
+func mutatingCreateTServer(listers *lister.Listers, requestAdmissionView *k8sAdmissionV1.AdmissionReview) ([]byte, error) {
+	tserver := &tarsV1beta3.TServer{}
+	_ = json.Unmarshal(requestAdmissionView.Request.Object.Raw, tserver)
+
+	jsonPatch, err := mutatingTServer(tserver)
+	if err != nil {
+		return nil, err
+	}
+
+	patch, err := mutatingTServerReleaseDigest(listers, tserver, nil)
+	if err != nil {
+		return nil, err
+	}
+	jsonPatch = append(jsonPatch, patch...)
+
+	jsonPatch = append(jsonPatch, mutatingTServerReleaseHistory(tserver, nil, requestAdmissionView.Request.UserInfo.Username, "")...)
+
 	if jsonPatch != nil {
 		return json.Marshal(jsonPatch)
 	}
@@ -223,7 +389,70 @@ func mutatingCreateTServer(listers *lister.Listers, requestAdmissionView *k8sAdm
 }
 
 func mutatingUpdateTServer(listers *lister.Listers, requestAdmissionView *k8sAdmissionV1.AdmissionReview) ([]byte, error) {
-	return mutatingCreateTServer(listers, requestAdmissionView)
+	tserver := &tarsV1beta3.TServer{}
+	_ = json.Unmarshal(requestAdmissionView.Request.Object.Raw, tserver)
+
+	oldTServer := &tarsV1beta3.TServer{}
+	_ = json.Unmarshal(requestAdmissionView.Request.OldObject.Raw, oldTServer)
+
+	var jsonPatch tarsTool.JsonPatch
+	var rollbackFrom string
+
+	if rollbackTo, ok := tserver.Annotations[tarsMeta.TRollbackToAnnotation]; ok {
+		var record *tarsV1beta3.TServerReleaseRecord
+		for _, v := range oldTServer.Spec.ReleaseHistory {
+			if v.ID == rollbackTo {
+				record = v
+				break
+			}
+		}
+		if record == nil {
+			return nil, fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("release %s not found in .spec.releaseHistory", rollbackTo))
+		}
+
+		if oldTServer.Spec.Release != nil {
+			rollbackFrom = oldTServer.Spec.Release.ID
+		}
+
+		release := &tarsV1beta3.TServerRelease{
+			ID:     record.ID,
+			Image:  record.Image,
+			Secret: record.Secret,
+			Digest: record.Digest,
+		}
+		if record.TServerReleaseNode != nil {
+			release.TServerReleaseNode = record.TServerReleaseNode.DeepCopy()
+		}
+		tserver.Spec.Release = release
+
+		jsonPatch = append(jsonPatch, tarsTool.JsonPatchItem{
+			OP:    tarsTool.JsonPatchAdd,
+			Path:  "/spec/release",
+			Value: release,
+		})
+		jsonPatch = append(jsonPatch, tarsTool.JsonPatchItem{
+			OP:   tarsTool.JsonPatchRemove,
+			Path: "/metadata/annotations/tars.io~1RollbackTo",
+		})
+	}
+
+	patch, err := mutatingTServer(tserver)
+	if err != nil {
+		return nil, err
+	}
+	jsonPatch = append(jsonPatch, patch...)
+
+	if patch, err = mutatingTServerReleaseDigest(listers, tserver, oldTServer); err != nil {
+		return nil, err
+	}
+	jsonPatch = append(jsonPatch, patch...)
+
+	jsonPatch = append(jsonPatch, mutatingTServerReleaseHistory(tserver, oldTServer.Spec.ReleaseHistory, requestAdmissionView.Request.UserInfo.Username, rollbackFrom)...)
+
+	if jsonPatch != nil {
+		return json.Marshal(jsonPatch)
+	}
+	return nil, nil
 }
 
 func init() {
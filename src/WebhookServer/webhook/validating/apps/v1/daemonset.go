@@ -22,8 +22,9 @@ func validDaemonset(newDaemonset, oldDaemonset *k8sAppsV1.DaemonSet, listers *li
 		return fmt.Errorf(tarsMeta.ResourceGetError, "tserver", namespace, newDaemonset.Name, err.Error())
 	}
 
-	equal, _ := tarsRuntime.TarsTranslator.DryRunSyncDaemonset(tserver, newDaemonset)
-	if !equal {
+	// fields of others are accepted, only the fields applied by controller should be modified through tserver
+	apply, _ := tarsRuntime.TarsTranslator.DryRunApplyDaemonset(tserver, newDaemonset)
+	if apply {
 		return fmt.Errorf("resource should be modified through tserver")
 	}
 
@@ -22,8 +22,9 @@ func validStatefulSet(newStatefulset *k8sAppsV1.StatefulSet, oldStatefulset *k8s
 		return fmt.Errorf(tarsMeta.ResourceGetError, "tserver", namespace, newStatefulset.Name, err.Error())
 	}
 
-	equal, _ := tarsRuntime.TarsTranslator.DryRunSyncStatefulset(tserver, newStatefulset)
-	if !equal {
+	// fields of others are accepted, only the fields applied by controller should be modified through tserver
+	apply, _ := tarsRuntime.TarsTranslator.DryRunApplyStatefulset(tserver, newStatefulset)
+	if apply {
 		return fmt.Errorf("resource should be modified through tserver")
 	}
 
@@ -22,8 +22,9 @@ func validService(newService *k8sCoreV1.Service, oldService *k8sCoreV1.Service,
 		return fmt.Errorf(tarsMeta.ResourceGetError, "tserver", namespace, newService.Name, err.Error())
 	}
 
-	equal, _ := tarsRuntime.TarsTranslator.DryRunSyncService(tserver, newService)
-	if !equal {
+	// fields of others are accepted, only the fields applied by controller should be modified through tserver
+	apply, _ := tarsRuntime.TarsTranslator.DryRunApplyService(tserver, newService)
+	if apply {
 		return fmt.Errorf("resource should be modified through tserver")
 	}
 
@@ -0,0 +1,44 @@
+package tars
+
+import (
+	"fmt"
+	k8sAdmissionV1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1beta2 "k8s.tars.io/apis/tars/v1beta2"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsTool "k8s.tars.io/tool"
+	"tarswebhook/webhook/lister"
+	"tarswebhook/webhook/validating"
+)
+
+// tframeworkConfig is the part of TFrameworkConfig to be validated, whose layout is the same in v1beta2 and v1beta3
+type tframeworkConfig struct {
+	ImageBuild struct {
+		TagFormat string `json:"tagFormat"`
+	} `json:"imageBuild"`
+}
+
+func validTFrameworkConfig(listers *lister.Listers, view *k8sAdmissionV1.AdmissionReview) error {
+	newTFC := &tframeworkConfig{}
+	_ = json.Unmarshal(view.Request.Object.Raw, newTFC)
+
+	if newTFC.ImageBuild.TagFormat != "" {
+		if _, err := tarsTool.ParseTagFormat(newTFC.ImageBuild.TagFormat); err != nil {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tframeworkconfig", fmt.Sprintf(".imageBuild.tagFormat %s", err.Error()))
+		}
+	}
+	return nil
+}
+
+func init() {
+	for _, gvr := range []schema.GroupVersionResource{
+		tarsV1beta2.SchemeGroupVersion.WithResource("tframeworkconfigs"),
+		tarsV1beta3.SchemeGroupVersion.WithResource("tframeworkconfigs"),
+	} {
+		gvr := gvr
+		validating.Registry(k8sAdmissionV1.Create, &gvr, validTFrameworkConfig)
+		validating.Registry(k8sAdmissionV1.Update, &gvr, validTFrameworkConfig)
+	}
+}
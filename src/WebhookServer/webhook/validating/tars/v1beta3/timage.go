@@ -0,0 +1,54 @@
+package v1beta3
+
+import (
+	"fmt"
+	k8sAdmissionV1 "k8s.io/api/admission/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsTool "k8s.tars.io/tool"
+	"tarswebhook/webhook/lister"
+	"tarswebhook/webhook/validating"
+)
+
+func validTImage(newTImage *tarsV1beta3.TImage, oldTImage *tarsV1beta3.TImage, listers *lister.Listers) error {
+	if newTImage.Dockerfile == nil {
+		return nil
+	}
+
+	if oldTImage != nil && equality.Semantic.DeepEqual(oldTImage.Dockerfile, newTImage.Dockerfile) {
+		return nil
+	}
+
+	if _, err := tarsTool.ParseDockerfileFragment(newTImage.Dockerfile.Fragment); err != nil {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "timage", fmt.Sprintf(".dockerfile.fragment %s", err.Error()))
+	}
+
+	if err := tarsTool.ValidBuildArgs(newTImage.Dockerfile.BuildArgs); err != nil {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "timage", fmt.Sprintf(".dockerfile.buildArgs %s", err.Error()))
+	}
+	return nil
+}
+
+func validCreateTImage(listers *lister.Listers, view *k8sAdmissionV1.AdmissionReview) error {
+	newTImage := &tarsV1beta3.TImage{}
+	_ = json.Unmarshal(view.Request.Object.Raw, newTImage)
+	return validTImage(newTImage, nil, listers)
+}
+
+func validUpdateTImage(listers *lister.Listers, view *k8sAdmissionV1.AdmissionReview) error {
+	newTImage := &tarsV1beta3.TImage{}
+	_ = json.Unmarshal(view.Request.Object.Raw, newTImage)
+
+	oldTImage := &tarsV1beta3.TImage{}
+	_ = json.Unmarshal(view.Request.OldObject.Raw, oldTImage)
+
+	return validTImage(newTImage, oldTImage, listers)
+}
+
+func init() {
+	gvr := tarsV1beta3.SchemeGroupVersion.WithResource("timages")
+	validating.Registry(k8sAdmissionV1.Create, &gvr, validCreateTImage)
+	validating.Registry(k8sAdmissionV1.Update, &gvr, validUpdateTImage)
+}
@@ -3,16 +3,347 @@ package v1beta3
 import (
 	"fmt"
 	k8sAdmissionV1 "k8s.io/api/admission/v1"
+	k8sCoreV1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/validation/path"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/json"
+	"k8s.io/apimachinery/pkg/util/validation"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
+	"net"
+	"strconv"
 	"strings"
 	"tarswebhook/webhook/lister"
 
 	"tarswebhook/webhook/validating"
 )
 
+func validTServerProbe(tserver *tarsV1beta3.TServer, field string, probe *tarsV1beta3.TK8SProbe) error {
+	if probe == nil {
+		return nil
+	}
+
+	handlers := 0
+	if probe.Exec != nil {
+		handlers++
+	}
+	if probe.HTTPGet != nil {
+		handlers++
+	}
+	if probe.TCPSocket != nil {
+		handlers++
+	}
+	if probe.Servant != "" {
+		handlers++
+	}
+
+	if handlers != 1 {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s must specify exactly one of exec, httpGet, tcpSocket, servant", field))
+	}
+
+	if probe.Servant != "" {
+		if tserver.Spec.Tars == nil {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s.servant only supported when .spec.subType value is %s", field, tarsV1beta3.TARS))
+		}
+
+		var target *tarsV1beta3.TServerServant
+		for _, servant := range tserver.Spec.Tars.Servants {
+			if strings.EqualFold(servant.Name, probe.Servant) {
+				target = servant
+				break
+			}
+		}
+
+		if target == nil {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s.servant %s not exist", field, probe.Servant))
+		}
+
+		if !target.IsTcp {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s.servant %s should be a tcp servant", field, probe.Servant))
+		}
+	}
+
+	if probe.InitialDelaySeconds < 0 || probe.TimeoutSeconds < 0 || probe.PeriodSeconds < 0 || probe.SuccessThreshold < 0 || probe.FailureThreshold < 0 {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s values should not be negative", field))
+	}
+	return nil
+}
+
+func validTServerTolerations(tolerations []k8sCoreV1.Toleration) error {
+	for i := range tolerations {
+		toleration := &tolerations[i]
+
+		if toleration.Key != "" {
+			for _, msg := range validation.IsQualifiedName(toleration.Key) {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.tolerations[%d].key %s", i, msg))
+			}
+		}
+
+		switch toleration.Operator {
+		case k8sCoreV1.TolerationOpEqual, "":
+			if toleration.Key == "" {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.tolerations[%d].operator must be Exists when key is empty", i))
+			}
+		case k8sCoreV1.TolerationOpExists:
+			if toleration.Value != "" {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.tolerations[%d].value must be empty when operator is Exists", i))
+			}
+		default:
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.tolerations[%d].operator %s not supported", i, toleration.Operator))
+		}
+
+		switch toleration.Effect {
+		case k8sCoreV1.TaintEffectNoSchedule, k8sCoreV1.TaintEffectPreferNoSchedule, k8sCoreV1.TaintEffectNoExecute, "":
+		default:
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.tolerations[%d].effect %s not supported", i, toleration.Effect))
+		}
+
+		if toleration.TolerationSeconds != nil && toleration.Effect != k8sCoreV1.TaintEffectNoExecute {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.tolerations[%d].effect must be NoExecute when tolerationSeconds is set", i))
+		}
+	}
+	return nil
+}
+
+func validTServerTopologySpreadConstraints(constraints []k8sCoreV1.TopologySpreadConstraint) error {
+	existed := map[string]interface{}{}
+
+	for i := range constraints {
+		constraint := &constraints[i]
+
+		if constraint.MaxSkew <= 0 {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.topologySpreadConstraints[%d].maxSkew must be greater than zero", i))
+		}
+
+		if constraint.TopologyKey == "" {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.topologySpreadConstraints[%d].topologyKey can not be empty", i))
+		}
+
+		for _, msg := range validation.IsQualifiedName(constraint.TopologyKey) {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.topologySpreadConstraints[%d].topologyKey %s", i, msg))
+		}
+
+		switch constraint.WhenUnsatisfiable {
+		case k8sCoreV1.DoNotSchedule, k8sCoreV1.ScheduleAnyway:
+		default:
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.topologySpreadConstraints[%d].whenUnsatisfiable %s not supported", i, constraint.WhenUnsatisfiable))
+		}
+
+		key := fmt.Sprintf("%s/%s", constraint.TopologyKey, constraint.WhenUnsatisfiable)
+		if _, ok := existed[key]; ok {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("duplicate .spec.k8s.topologySpreadConstraints value {%s, %s}", constraint.TopologyKey, constraint.WhenUnsatisfiable))
+		}
+		existed[key] = nil
+	}
+	return nil
+}
+
+func validTServerContainers(tserver *tarsV1beta3.TServer, mountsNames map[string]interface{}) error {
+	containerNames := map[string]interface{}{
+		"tarsnode":   nil,
+		tserver.Name: nil,
+	}
+
+	valid := func(field string, containers []tarsV1beta3.TK8SContainer) error {
+		for i := range containers {
+			container := &containers[i]
+
+			for _, msg := range validation.IsDNS1123Label(container.Name) {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s[%d].name %s", field, i, msg))
+			}
+
+			if _, ok := containerNames[container.Name]; ok {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("duplicate %s.name value %s", field, container.Name))
+			}
+			containerNames[container.Name] = nil
+
+			if container.Image == "" {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s[%d].image can not be empty", field, i))
+			}
+
+			mountPaths := map[string]interface{}{}
+			for _, mount := range container.Mounts {
+				if _, ok := mountsNames[mount.NameRef]; !ok {
+					return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s[%d].mounts.nameRef %s not exist", field, i, mount.NameRef))
+				}
+
+				if mount.MountPath == "" {
+					return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s[%d].mounts.mountPath can not be empty", field, i))
+				}
+
+				if _, ok := mountPaths[mount.MountPath]; ok {
+					return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("duplicate %s[%d].mounts.mountPath value %s", field, i, mount.MountPath))
+				}
+				mountPaths[mount.MountPath] = nil
+			}
+		}
+		return nil
+	}
+
+	if err := valid(".spec.k8s.sidecars", tserver.Spec.K8S.Sidecars); err != nil {
+		return err
+	}
+
+	if err := valid(".spec.k8s.initContainers", tserver.Spec.K8S.InitContainers); err != nil {
+		return err
+	}
+	return nil
+}
+
+func validTServerDisruptionBudget(tserver *tarsV1beta3.TServer) error {
+	budget := tserver.Spec.K8S.DisruptionBudget
+	if budget == nil {
+		return nil
+	}
+
+	if tserver.Spec.K8S.DaemonSet {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", "can not use disruptionBudget when .daemonSet value is true")
+	}
+
+	if budget.MinAvailable != nil && budget.MaxUnavailable != nil {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.k8s.disruptionBudget minAvailable and maxUnavailable cannot be both set")
+	}
+
+	valid := func(field string, value *intstr.IntOrString) error {
+		if value == nil {
+			return nil
+		}
+		if value.Type == intstr.Int {
+			if value.IntVal < 0 {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s should not be negative", field))
+			}
+			return nil
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%"))
+		if err != nil || !strings.HasSuffix(value.StrVal, "%") || percent < 0 || percent > 100 {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("%s should be an integer or a percentage between 0%% and 100%%", field))
+		}
+		return nil
+	}
+
+	if err := valid(".spec.k8s.disruptionBudget.minAvailable", budget.MinAvailable); err != nil {
+		return err
+	}
+	return valid(".spec.k8s.disruptionBudget.maxUnavailable", budget.MaxUnavailable)
+}
+
+func validTServerAutoscaler(tserver *tarsV1beta3.TServer) error {
+	autoscaler := tserver.Spec.K8S.Autoscaler
+	if autoscaler == nil {
+		return nil
+	}
+
+	if tserver.Spec.K8S.DaemonSet {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", "can not use autoscaler when .daemonSet value is true")
+	}
+
+	switch autoscaler.Metric {
+	case tarsV1beta3.CPUMetric:
+	case tarsV1beta3.PropertyMetric:
+		if autoscaler.Property == "" {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.k8s.autoscaler.property is required when metric is property")
+		}
+		// property is read from custom metrics api by name
+		if msgs := path.IsValidPathSegmentName(autoscaler.Property); len(msgs) != 0 {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.autoscaler.property value %s is invalid: %s", autoscaler.Property, strings.Join(msgs, ",")))
+		}
+	default:
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("unsupported .spec.k8s.autoscaler.metric value %s", autoscaler.Metric))
+	}
+
+	if autoscaler.Target <= 0 {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.k8s.autoscaler.target should be greater than 0")
+	}
+
+	if autoscaler.ScaleUpStabilizationSeconds < 0 || autoscaler.ScaleDownStabilizationSeconds < 0 || autoscaler.CooldownSeconds < 0 {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.k8s.autoscaler seconds value should not be negative")
+	}
+	return nil
+}
+
+func validTServerCanary(tserver *tarsV1beta3.TServer) error {
+	if tserver.Spec.Release == nil || tserver.Spec.Release.Canary == nil {
+		return nil
+	}
+	canary := tserver.Spec.Release.Canary
+
+	if tserver.Spec.K8S.DaemonSet {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", "can not use release canary when .daemonSet value is true")
+	}
+
+	if len(canary.Steps) == 0 {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.release.canary.steps should not be empty")
+	}
+
+	for i := range canary.Steps {
+		value := canary.Steps[i].Replicas
+		if value.Type == intstr.Int {
+			if value.IntVal <= 0 {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.release.canary.steps[%d].replicas should be greater than 0", i))
+			}
+			continue
+		}
+		percent, err := strconv.Atoi(strings.TrimSuffix(value.StrVal, "%"))
+		if err != nil || !strings.HasSuffix(value.StrVal, "%") || percent <= 0 || percent > 100 {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.release.canary.steps[%d].replicas should be an integer or a percentage between 1%% and 100%%", i))
+		}
+	}
+
+	if canary.BakeSeconds < 0 || canary.ProgressDeadlineSeconds < 0 || canary.FailureThreshold < 0 {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.release.canary seconds and failureThreshold value should not be negative")
+	}
+	return nil
+}
+
+// validTServerExternal check upstream names and ip:port pairs of external server are unique,
+// and no workload related field is set because external server has no pod
+func validTServerExternal(tserver *tarsV1beta3.TServer, portNames map[string]interface{}) error {
+	if tserver.Spec.External == nil {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.external is required when .spec.subType value is external")
+	}
+
+	if tserver.Spec.K8S.DaemonSet || len(tserver.Spec.K8S.HostPorts) != 0 || tserver.Spec.K8S.HostNetwork {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", "can not use daemonSet, hostPorts and hostNetwork when .spec.subType value is external")
+	}
+
+	if tserver.Spec.K8S.Autoscaler != nil || tserver.Spec.K8S.DisruptionBudget != nil {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", "can not use autoscaler and disruptionBudget when .spec.subType value is external")
+	}
+
+	if tserver.Spec.Release != nil && tserver.Spec.Release.Canary != nil {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", "can not use release canary when .spec.subType value is external")
+	}
+
+	for _, upstream := range tserver.Spec.External.Upstreams {
+		portName := strings.ToLower(upstream.Name)
+		if _, ok := portNames[portName]; ok {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("duplicate upstream name value %s", upstream.Name))
+		}
+		portNames[portName] = nil
+
+		if len(upstream.Addresses) == 0 {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("upstream %s should have at least one address", upstream.Name))
+		}
+
+		addresses := map[string]interface{}{}
+		for _, address := range upstream.Addresses {
+			if net.ParseIP(address.IP) == nil {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("upstream %s has invalid ip value %s", upstream.Name, address.IP))
+			}
+			if address.Port <= 0 || address.Port > 65535 {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("upstream %s has invalid port value %d", upstream.Name, address.Port))
+			}
+			key := net.JoinHostPort(address.IP, strconv.Itoa(int(address.Port)))
+			if _, ok := addresses[key]; ok {
+				return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf("upstream %s has duplicate address value %s", upstream.Name, key))
+			}
+			addresses[key] = nil
+		}
+	}
+	return nil
+}
+
 func validTServer(newTServer, oldTServer *tarsV1beta3.TServer, listers *lister.Listers) error {
 
 	if oldTServer != nil {
@@ -39,6 +370,12 @@ func validTServer(newTServer, oldTServer *tarsV1beta3.TServer, listers *lister.L
 				return fmt.Errorf(tarsMeta.FiledImmutableError, "tserver", ".spec.normal")
 			}
 		}
+
+		if oldTServer.Spec.External == nil {
+			if newTServer.Spec.External != nil {
+				return fmt.Errorf(tarsMeta.FiledImmutableError, "tserver", ".spec.external")
+			}
+		}
 	}
 
 	namespace := newTServer.Namespace
@@ -122,6 +459,10 @@ func validTServer(newTServer, oldTServer *tarsV1beta3.TServer, listers *lister.L
 			portNames[portName] = nil
 			portValues[portValue] = nil
 		}
+	} else if newTServer.Spec.SubType == tarsV1beta3.External {
+		if err := validTServerExternal(newTServer, portNames); err != nil {
+			return err
+		}
 	}
 
 	if newTServer.Spec.K8S.HostPorts != nil {
@@ -148,9 +489,9 @@ func validTServer(newTServer, oldTServer *tarsV1beta3.TServer, listers *lister.L
 		}
 	}
 
-	if newTServer.Spec.K8S.Mounts != nil {
-		mountsNames := map[string]interface{}{}
+	mountsNames := map[string]interface{}{}
 
+	if newTServer.Spec.K8S.Mounts != nil {
 		for i := range newTServer.Spec.K8S.Mounts {
 
 			mount := &newTServer.Spec.K8S.Mounts[i]
@@ -168,6 +509,62 @@ func validTServer(newTServer, oldTServer *tarsV1beta3.TServer, listers *lister.L
 			mountsNames[mount.Name] = nil
 		}
 	}
+
+	if err := validTServerContainers(newTServer, mountsNames); err != nil {
+		return err
+	}
+
+	if err := validTServerDisruptionBudget(newTServer); err != nil {
+		return err
+	}
+
+	if err := validTServerAutoscaler(newTServer); err != nil {
+		return err
+	}
+
+	if err := validTServerCanary(newTServer); err != nil {
+		return err
+	}
+
+	if err := validTServerTolerations(newTServer.Spec.K8S.Tolerations); err != nil {
+		return err
+	}
+
+	if err := validTServerTopologySpreadConstraints(newTServer.Spec.K8S.TopologySpreadConstraints); err != nil {
+		return err
+	}
+
+	if newTServer.Spec.K8S.DaemonSet {
+		if len(newTServer.Spec.K8S.TopologySpreadConstraints) != 0 || newTServer.Spec.K8S.ZoneSpread {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", "can not use topologySpreadConstraints and zoneSpread when .daemonSet value is true")
+		}
+	}
+
+	if newTServer.Spec.K8S.PriorityClassName != "" {
+		for _, msg := range validation.IsDNS1123Subdomain(newTServer.Spec.K8S.PriorityClassName) {
+			return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", fmt.Sprintf(".spec.k8s.priorityClassName %s", msg))
+		}
+	}
+
+	if err := validTServerProbe(newTServer, ".spec.k8s.livenessProbe", newTServer.Spec.K8S.LivenessProbe); err != nil {
+		return err
+	}
+
+	if err := validTServerProbe(newTServer, ".spec.k8s.readinessProbe", newTServer.Spec.K8S.ReadinessProbe); err != nil {
+		return err
+	}
+
+	if err := validTServerProbe(newTServer, ".spec.k8s.startupProbe", newTServer.Spec.K8S.StartupProbe); err != nil {
+		return err
+	}
+
+	if probe := newTServer.Spec.K8S.LivenessProbe; probe != nil && probe.SuccessThreshold > 1 {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.k8s.livenessProbe.successThreshold must be 1")
+	}
+
+	if probe := newTServer.Spec.K8S.StartupProbe; probe != nil && probe.SuccessThreshold > 1 {
+		return fmt.Errorf(tarsMeta.ResourceInvalidError, "tserver", ".spec.k8s.startupProbe.successThreshold must be 1")
+	}
 	return nil
 }
 
@@ -37,6 +37,7 @@ type Webhook struct {
 
 func New() *Webhook {
 	tsInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TServers()
+	tiInformer := tarsRuntime.Factories.TarsInformerFactory.Tars().V1beta3().TImages()
 	ttInformer := tarsRuntime.Factories.MetadataInformerFactor.ForResource(tarsV1beta3.SchemeGroupVersion.WithResource("ttemplates"))
 	tcInformer := tarsRuntime.Factories.MetadataInformerFactor.ForResource(tarsV1beta3.SchemeGroupVersion.WithResource("tconfigs"))
 	trInformer := tarsRuntime.Factories.MetadataInformerFactor.ForResource(tarsV1beta3.SchemeGroupVersion.WithResource("ttrees"))
@@ -45,6 +46,9 @@ func New() *Webhook {
 		TSLister: tsInformer.Lister(),
 		TSSynced: tsInformer.Informer().HasSynced,
 
+		TILister: tiInformer.Lister(),
+		TISynced: tiInformer.Informer().HasSynced,
+
 		TTLister: ttInformer.Lister(),
 		TTSynced: ttInformer.Informer().HasSynced,
 
@@ -20,6 +20,7 @@ import (
 	k8sAppsV1 "k8s.io/api/apps/v1"
 	k8sCoreV1 "k8s.io/api/core/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	tarsMeta "k8s.tars.io/meta"
 )
 
@@ -119,12 +120,44 @@ type TServerReleaseNode struct {
 	Secret string `json:"nodeSecret,omitempty"`
 }
 
+type TServerCanaryStep struct {
+	// Replicas is the replicas count or the percentage of .spec.k8s.replicas running the new release in this step
+	Replicas intstr.IntOrString `json:"replicas"`
+	// Pause stop the rollout after this step baked, until the "tars.io/CanaryResume" annotation value equals the step index
+	Pause bool `json:"pause,omitempty"`
+}
+
+// TServerCanary rollout the release step by step through the statefulset partition,
+// each step is gated on all new release pods becoming Active for BakeSeconds
+type TServerCanary struct {
+	Steps                   []TServerCanaryStep `json:"steps"`
+	BakeSeconds             int32               `json:"bakeSeconds,omitempty"`
+	ProgressDeadlineSeconds int32               `json:"progressDeadlineSeconds,omitempty"`
+	// FailureThreshold is the container restart count of a new release pod that considered as failed
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
 type TServerRelease struct {
+	ID     string `json:"id"`
+	Image  string `json:"image"`
+	Secret string `json:"secret"`
+	// Digest pin Image to the manifest digest, it is resolved from timage releases by the webhook if not set
+	Digest              string          `json:"digest,omitempty"`
+	Time                *k8sMetaV1.Time `json:"time,omitempty"`
+	*TServerReleaseNode `json:",inline"`
+	Canary              *TServerCanary `json:"canary,omitempty"`
+}
+
+type TServerReleaseRecord struct {
 	ID                  string          `json:"id"`
 	Image               string          `json:"image"`
 	Secret              string          `json:"secret"`
+	Digest              string          `json:"digest,omitempty"`
 	Time                *k8sMetaV1.Time `json:"time,omitempty"`
 	*TServerReleaseNode `json:",inline"`
+	Person              string `json:"person,omitempty"`
+	// RollbackFrom is the replaced release id when the record is created by rollback
+	RollbackFrom string `json:"rollbackFrom,omitempty"`
 }
 
 type AbilityAffinityType string
@@ -136,6 +169,97 @@ const (
 	None                 AbilityAffinityType = "None"
 )
 
+type TK8SProbeHandler struct {
+	// Exec specifies the action to take.
+	// +optional
+	Exec *k8sCoreV1.ExecAction `json:"exec,omitempty"`
+	// HTTPGet specifies the http request to perform.
+	// +optional
+	HTTPGet *k8sCoreV1.HTTPGetAction `json:"httpGet,omitempty"`
+	// TCPSocket specifies an action involving a TCP port.
+	// +optional
+	TCPSocket *k8sCoreV1.TCPSocketAction `json:"tcpSocket,omitempty"`
+	// Servant is a shortcut of TCPSocket, the probe will connect to the port of the named TServerServant
+	// +optional
+	Servant string `json:"servant,omitempty"`
+}
+
+type TK8SProbe struct {
+	TK8SProbeHandler `json:",inline"`
+	// Number of seconds after the container has started before probes are initiated.
+	// +optional
+	InitialDelaySeconds int32 `json:"initialDelaySeconds,omitempty"`
+	// Number of seconds after which the probe times out.
+	// Defaults to 1 second. Minimum value is 1.
+	// +optional
+	TimeoutSeconds int32 `json:"timeoutSeconds,omitempty"`
+	// How often (in seconds) to perform the probe.
+	// Default to 10 seconds. Minimum value is 1.
+	// +optional
+	PeriodSeconds int32 `json:"periodSeconds,omitempty"`
+	// Minimum consecutive successes for the probe to be considered successful after having failed.
+	// Defaults to 1. Must be 1 for liveness and startup. Minimum value is 1.
+	// +optional
+	SuccessThreshold int32 `json:"successThreshold,omitempty"`
+	// Minimum consecutive failures for the probe to be considered failed after having succeeded.
+	// Defaults to 3. Minimum value is 1.
+	// +optional
+	FailureThreshold int32 `json:"failureThreshold,omitempty"`
+}
+
+type TK8SContainerMount struct {
+	// NameRef refers to the name of a TK8SMount in .spec.k8s.mounts
+	NameRef   string `json:"nameRef"`
+	MountPath string `json:"mountPath"`
+	SubPath   string `json:"subPath,omitempty"`
+	ReadOnly  bool   `json:"readOnly,omitempty"`
+}
+
+type TK8SContainer struct {
+	Name            string                         `json:"name"`
+	Image           string                         `json:"image"`
+	ImagePullPolicy k8sCoreV1.PullPolicy           `json:"imagePullPolicy,omitempty"`
+	Command         []string                       `json:"command,omitempty"`
+	Args            []string                       `json:"args,omitempty"`
+	Env             []k8sCoreV1.EnvVar             `json:"env,omitempty"`
+	EnvFrom         []k8sCoreV1.EnvFromSource      `json:"envFrom,omitempty"`
+	Ports           []k8sCoreV1.ContainerPort      `json:"ports,omitempty"`
+	Resources       k8sCoreV1.ResourceRequirements `json:"resources,omitempty"`
+	Mounts          []TK8SContainerMount           `json:"mounts,omitempty"`
+}
+
+// TK8SDisruptionBudget describe the PodDisruptionBudget of TServer,
+// at most one of MinAvailable and MaxUnavailable can be set, if neither is set, the value will be derived from .spec.important
+type TK8SDisruptionBudget struct {
+	MinAvailable   *intstr.IntOrString `json:"minAvailable,omitempty"`
+	MaxUnavailable *intstr.IntOrString `json:"maxUnavailable,omitempty"`
+}
+
+type TK8SAutoscalerMetric string
+
+const (
+	// CPUMetric is the average cpu utilization percentage of pod resources requests, read from metrics api
+	CPUMetric TK8SAutoscalerMetric = "cpu"
+	// PropertyMetric is the average value of the tars property, read from the registered metrics source
+	PropertyMetric TK8SAutoscalerMetric = "property"
+)
+
+// TK8SAutoscaler scale the .spec.k8s.replicas according to the metric,
+// the replicas is bounded by the "tars.io/MinReplicas" and "tars.io/MaxReplicas" annotations
+type TK8SAutoscaler struct {
+	Metric TK8SAutoscalerMetric `json:"metric"`
+	// Property is the tars property name, required when Metric is property
+	Property string `json:"property,omitempty"`
+	// Target is the desired average metric value per pod
+	Target int64 `json:"target"`
+	// ScaleUpStabilizationSeconds is the window of recommendations considered when scaling up
+	ScaleUpStabilizationSeconds int32 `json:"scaleUpStabilizationSeconds,omitempty"`
+	// ScaleDownStabilizationSeconds is the window of recommendations considered when scaling down
+	ScaleDownStabilizationSeconds int32 `json:"scaleDownStabilizationSeconds,omitempty"`
+	// CooldownSeconds is the minimum interval between two scaling
+	CooldownSeconds int32 `json:"cooldownSeconds,omitempty"`
+}
+
 type TServerK8S struct {
 	ServiceAccount string `json:"serviceAccount,omitempty"`
 
@@ -163,12 +287,37 @@ type TServerK8S struct {
 
 	NotStacked bool `json:"notStacked"`
 
+	Tolerations []k8sCoreV1.Toleration `json:"tolerations,omitempty"`
+
+	TopologySpreadConstraints []k8sCoreV1.TopologySpreadConstraint `json:"topologySpreadConstraints,omitempty"`
+
+	// ZoneSpread is a shortcut of TopologySpreadConstraints, spread pods across zones as evenly as possible
+	ZoneSpread bool `json:"zoneSpread,omitempty"`
+
+	PriorityClassName string `json:"priorityClassName,omitempty"`
+
+	DisruptionBudget *TK8SDisruptionBudget `json:"disruptionBudget,omitempty"`
+
+	Autoscaler *TK8SAutoscaler `json:"autoscaler,omitempty"`
+
 	PodManagementPolicy k8sAppsV1.PodManagementPolicyType `json:"podManagementPolicy,omitempty"`
 
 	Replicas int32 `json:"replicas"`
 
 	ReadinessGates []string `json:"readinessGates,omitempty"`
 
+	LivenessProbe *TK8SProbe `json:"livenessProbe,omitempty"`
+
+	ReadinessProbe *TK8SProbe `json:"readinessProbe,omitempty"`
+
+	StartupProbe *TK8SProbe `json:"startupProbe,omitempty"`
+
+	// Sidecars will be appended to the pod containers, after the server container
+	Sidecars []TK8SContainer `json:"sidecars,omitempty"`
+
+	// InitContainers will be appended to the pod init containers, after the "tarsnode" init container
+	InitContainers []TK8SContainer `json:"initContainers,omitempty"`
+
 	Resources       k8sCoreV1.ResourceRequirements      `json:"resources,omitempty"`
 	UpdateStrategy  k8sAppsV1.StatefulSetUpdateStrategy `json:"updateStrategy"`
 	ImagePullPolicy k8sCoreV1.PullPolicy                `json:"imagePullPolicy"`
@@ -220,24 +369,69 @@ type TServerSubType string
 const (
 	TARS   TServerSubType = "tars"
 	Normal TServerSubType = "normal"
+	// External means the server runs out of cluster, only Service, EndpointSlices and TEndpoint are published for it
+	External TServerSubType = "external"
 )
 
 type TServerSpec struct {
-	App       string          `json:"app"`
-	Server    string          `json:"server"`
-	SubType   TServerSubType  `json:"subType"`
-	Important int32           `json:"important"`
-	Tars      *TServerTars    `json:"tars,omitempty"`
-	Normal    *TServerNormal  `json:"normal,omitempty"`
-	K8S       TServerK8S      `json:"k8s"`
-	Release   *TServerRelease `json:"release,omitempty"`
+	App       string           `json:"app"`
+	Server    string           `json:"server"`
+	SubType   TServerSubType   `json:"subType"`
+	Important int32            `json:"important"`
+	Tars      *TServerTars     `json:"tars,omitempty"`
+	Normal    *TServerNormal   `json:"normal,omitempty"`
+	External  *TServerExternal `json:"external,omitempty"`
+	K8S       TServerK8S       `json:"k8s"`
+	Release   *TServerRelease  `json:"release,omitempty"`
+	// ReleaseHistory is maintained by the webhook, the latest release first
+	ReleaseHistory []*TServerReleaseRecord `json:"releaseHistory,omitempty"`
+}
+
+const (
+	// TServerAvailable means the ready pods reach the desired replicas
+	TServerAvailable = "Available"
+	// TServerProgressing means the workload has not caught up with the latest spec
+	TServerProgressing = "Progressing"
+	// TServerReleaseComplete means all pods of the current release are Active
+	TServerReleaseComplete = "ReleaseComplete"
+	// TServerConfigActivated means every config of the server has an activated version
+	TServerConfigActivated = "ConfigActivated"
+	// TServerDegraded means some pods are failing
+	TServerDegraded = "Degraded"
+	// TServerScaled record the last scaling decision of the autoscaler
+	TServerScaled = "Scaled"
+)
+
+type TServerCanaryPhase string
+
+const (
+	CanaryProgressing TServerCanaryPhase = "Progressing"
+	CanaryPaused      TServerCanaryPhase = "Paused"
+	CanaryCompleted   TServerCanaryPhase = "Completed"
+	CanaryRolledBack  TServerCanaryPhase = "RolledBack"
+)
+
+type TServerCanaryStatus struct {
+	ReleaseID string             `json:"releaseID"`
+	Step      int32              `json:"step"`
+	Phase     TServerCanaryPhase `json:"phase"`
+	// StepTime is the time the current step started
+	StepTime k8sMetaV1.Time `json:"stepTime,omitempty"`
+	// BakeTime is the time all pods of the current step became Active
+	BakeTime *k8sMetaV1.Time `json:"bakeTime,omitempty"`
+	Message  string          `json:"message,omitempty"`
 }
 
 type TServerStatus struct {
-	Replicas        int32  `json:"replicas"`
-	ReadyReplicas   int32  `json:"readyReplicas"`
-	CurrentReplicas int32  `json:"currentReplicas"`
-	Selector        string `json:"selector"`
+	Replicas           int32                 `json:"replicas"`
+	ReadyReplicas      int32                 `json:"readyReplicas"`
+	CurrentReplicas    int32                 `json:"currentReplicas"`
+	Selector           string                `json:"selector"`
+	ObservedGeneration int64                 `json:"observedGeneration,omitempty"`
+	Conditions         []k8sMetaV1.Condition `json:"conditions,omitempty"`
+	// StableRelease is the last release rolled out to all pods, canary rollback to it when failed
+	StableRelease *TServerRelease      `json:"stableRelease,omitempty"`
+	Canary        *TServerCanaryStatus `json:"canary,omitempty"`
 }
 
 // +genclient
@@ -257,14 +451,15 @@ type TServerList struct {
 }
 
 type TEndpointSpec struct {
-	App       string          `json:"app"`
-	Server    string          `json:"server"`
-	SubType   TServerSubType  `json:"subType"`
-	Important int32           `json:"important"`
-	Tars      *TServerTars    `json:"tars,omitempty"`
-	Normal    *TServerNormal  `json:"normal,omitempty"`
-	HostPorts []*TK8SHostPort `json:"hostPorts,omitempty"`
-	Release   *TServerRelease `json:"release,omitempty"`
+	App       string           `json:"app"`
+	Server    string           `json:"server"`
+	SubType   TServerSubType   `json:"subType"`
+	Important int32            `json:"important"`
+	Tars      *TServerTars     `json:"tars,omitempty"`
+	Normal    *TServerNormal   `json:"normal,omitempty"`
+	External  *TServerExternal `json:"external,omitempty"`
+	HostPorts []*TK8SHostPort  `json:"hostPorts,omitempty"`
+	Release   *TServerRelease  `json:"release,omitempty"`
 }
 
 type TEndpointPodStatus struct {
@@ -279,6 +474,8 @@ type TEndpointPodStatus struct {
 	PresentState      string                      `json:"presentState"`
 	PresentMessage    string                      `json:"presentMessage"`
 	ID                string                      `json:"id"`
+	// Image is the release image of pod as tagged, while the container may run it by digest
+	Image string `json:"image,omitempty"`
 }
 
 type TEndpointStatus struct {
@@ -468,26 +665,61 @@ type TImageRelease struct {
 	CreatePerson *string        `json:"createPerson,omitempty"`
 	CreateTime   k8sMetaV1.Time `json:"createTime,omitempty"`
 	Mark         *string        `json:"mark,omitempty"`
+	Tag          string         `json:"tag,omitempty"`
+	SemVer       string         `json:"semver,omitempty"`
+	Commit       string         `json:"commit,omitempty"`
+	// Digest is the manifest digest pushed for Image
+	Digest string `json:"digest,omitempty"`
+	// Promotion is set if the release is copied from a release of another namespace
+	Promotion *TImageReleasePromotion `json:"promotion,omitempty"`
+}
+
+// TImageReleasePromotion record where a promoted release comes from
+type TImageReleasePromotion struct {
+	Namespace   string         `json:"namespace"`
+	TImage      string         `json:"timage"`
+	Image       string         `json:"image"`
+	Digest      string         `json:"digest"`
+	Person      string         `json:"person,omitempty"`
+	PromoteTime k8sMetaV1.Time `json:"promoteTime"`
 }
 
 type TImageBuildState struct {
-	ID              string         `json:"id"`
-	BaseImage       string         `json:"baseImage"`
-	BaseImageSecret string         `json:"baseImageSecret"`
-	Image           string         `json:"image"`
-	Secret          string         `json:"secret"`
-	ServerType      string         `json:"serverType"`
-	CreatePerson    string         `json:"createPerson"`
-	CreateTime      k8sMetaV1.Time `json:"createTime,omitempty"`
-	Mark            string         `json:"mark"`
-	Phase           string         `json:"phase"`
-	Message         string         `json:"message"`
-	Handler         string         `json:"handler"`
+	ID              string          `json:"id"`
+	BaseImage       string          `json:"baseImage"`
+	BaseImageSecret string          `json:"baseImageSecret"`
+	Image           string          `json:"image"`
+	Secret          string          `json:"secret"`
+	ServerType      string          `json:"serverType"`
+	CreatePerson    string          `json:"createPerson"`
+	CreateTime      k8sMetaV1.Time  `json:"createTime,omitempty"`
+	Mark            string          `json:"mark"`
+	Phase           string          `json:"phase"`
+	Message         string          `json:"message"`
+	Handler         string          `json:"handler"`
+	Tag             string          `json:"tag,omitempty"`
+	SemVer          string          `json:"semver,omitempty"`
+	Priority        int32           `json:"priority,omitempty"`
+	StartTime       *k8sMetaV1.Time `json:"startTime,omitempty"`
+	FinishTime      *k8sMetaV1.Time `json:"finishTime,omitempty"`
+	Commit          string          `json:"commit,omitempty"`
+	Dockerfile      string          `json:"dockerfile,omitempty"`
+	// Digest is reported by the builder after the image is pushed
+	Digest string `json:"digest,omitempty"`
+}
+
+// TImageDockerfile is merged into the Dockerfile generated for every build of the timage
+type TImageDockerfile struct {
+	// Fragment is appended after the server files copied, FROM and instructions might escape the build are forbidden
+	Fragment  string            `json:"fragment,omitempty"`
+	BuildArgs map[string]string `json:"buildArgs,omitempty"`
 }
 
 type TImageBuild struct {
 	Last    *TImageBuildState `json:"last,omitempty"`
 	Running *TImageBuildState `json:"running,omitempty"`
+	// Queue holds builds waiting for Running, higher priority first and FIFO within the same priority
+	Queue []*TImageBuildState `json:"queue,omitempty"`
 }
 
 // +genclient
@@ -496,12 +728,13 @@ type TImageBuild struct {
 type TImage struct {
 	k8sMetaV1.TypeMeta   `json:",inline"`
 	k8sMetaV1.ObjectMeta `json:"metadata,omitempty"`
-	ImageType            string           `json:"imageType"`
-	SupportedType        []string         `json:"supportedType,omitempty"`
-	Releases             []*TImageRelease `json:"releases"`
-	Default              *string          `json:"default,omitempty"`
-	Build                *TImageBuild     `json:"build,omitempty"`
-	Mark                 string           `json:"mark"`
+	ImageType            string            `json:"imageType"`
+	SupportedType        []string          `json:"supportedType,omitempty"`
+	Releases             []*TImageRelease  `json:"releases"`
+	Default              *string           `json:"default,omitempty"`
+	Build                *TImageBuild      `json:"build,omitempty"`
+	Dockerfile           *TImageDockerfile `json:"dockerfile,omitempty"`
+	Mark                 string            `json:"mark"`
 }
 
 // +k8s:deepcopy-gen:interfaces=k8s.io/apimachinery/pkg/runtime.Object
@@ -526,6 +759,7 @@ type TFrameworkRecordLimit struct {
 	TExitedPod     int `json:"texitedPod"`
 	TConfigHistory int `json:"tconfigHistory"`
 	TImageRelease  int `json:"timageRelease"`
+	TServerRelease int `json:"tserverRelease,omitempty"`
 }
 
 type TFrameworkImage struct {
@@ -23,7 +23,9 @@ package v1beta3
 
 import (
 	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	runtime "k8s.io/apimachinery/pkg/runtime"
+	intstr "k8s.io/apimachinery/pkg/util/intstr"
 )
 
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
@@ -370,6 +372,11 @@ func (in *TEndpointSpec) DeepCopyInto(out *TEndpointSpec) {
 		*out = new(TServerNormal)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(TServerExternal)
+		(*in).DeepCopyInto(*out)
+	}
 	if in.HostPorts != nil {
 		in, out := &in.HostPorts, &out.HostPorts
 		*out = make([]*TK8SHostPort, len(*in))
@@ -718,6 +725,11 @@ func (in *TImage) DeepCopyInto(out *TImage) {
 		*out = new(TImageBuild)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Dockerfile != nil {
+		in, out := &in.Dockerfile, &out.Dockerfile
+		*out = new(TImageDockerfile)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -752,6 +764,17 @@ func (in *TImageBuild) DeepCopyInto(out *TImageBuild) {
 		*out = new(TImageBuildState)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.Queue != nil {
+		in, out := &in.Queue, &out.Queue
+		*out = make([]*TImageBuildState, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(TImageBuildState)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
 	return
 }
 
@@ -769,6 +792,14 @@ func (in *TImageBuild) DeepCopy() *TImageBuild {
 func (in *TImageBuildState) DeepCopyInto(out *TImageBuildState) {
 	*out = *in
 	in.CreateTime.DeepCopyInto(&out.CreateTime)
+	if in.StartTime != nil {
+		in, out := &in.StartTime, &out.StartTime
+		*out = (*in).DeepCopy()
+	}
+	if in.FinishTime != nil {
+		in, out := &in.FinishTime, &out.FinishTime
+		*out = (*in).DeepCopy()
+	}
 	return
 }
 
@@ -782,6 +813,29 @@ func (in *TImageBuildState) DeepCopy() *TImageBuildState {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TImageDockerfile) DeepCopyInto(out *TImageDockerfile) {
+	*out = *in
+	if in.BuildArgs != nil {
+		in, out := &in.BuildArgs, &out.BuildArgs
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TImageDockerfile.
+func (in *TImageDockerfile) DeepCopy() *TImageDockerfile {
+	if in == nil {
+		return nil
+	}
+	out := new(TImageDockerfile)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TImageList) DeepCopyInto(out *TImageList) {
 	*out = *in
@@ -829,6 +883,11 @@ func (in *TImageRelease) DeepCopyInto(out *TImageRelease) {
 		*out = new(string)
 		**out = **in
 	}
+	if in.Promotion != nil {
+		in, out := &in.Promotion, &out.Promotion
+		*out = new(TImageReleasePromotion)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -842,6 +901,132 @@ func (in *TImageRelease) DeepCopy() *TImageRelease {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TImageReleasePromotion) DeepCopyInto(out *TImageReleasePromotion) {
+	*out = *in
+	in.PromoteTime.DeepCopyInto(&out.PromoteTime)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TImageReleasePromotion.
+func (in *TImageReleasePromotion) DeepCopy() *TImageReleasePromotion {
+	if in == nil {
+		return nil
+	}
+	out := new(TImageReleasePromotion)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TK8SAutoscaler) DeepCopyInto(out *TK8SAutoscaler) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TK8SAutoscaler.
+func (in *TK8SAutoscaler) DeepCopy() *TK8SAutoscaler {
+	if in == nil {
+		return nil
+	}
+	out := new(TK8SAutoscaler)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TK8SContainer) DeepCopyInto(out *TK8SContainer) {
+	*out = *in
+	if in.Command != nil {
+		in, out := &in.Command, &out.Command
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Args != nil {
+		in, out := &in.Args, &out.Args
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Env != nil {
+		in, out := &in.Env, &out.Env
+		*out = make([]v1.EnvVar, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.EnvFrom != nil {
+		in, out := &in.EnvFrom, &out.EnvFrom
+		*out = make([]v1.EnvFromSource, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]v1.ContainerPort, len(*in))
+		copy(*out, *in)
+	}
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.Mounts != nil {
+		in, out := &in.Mounts, &out.Mounts
+		*out = make([]TK8SContainerMount, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TK8SContainer.
+func (in *TK8SContainer) DeepCopy() *TK8SContainer {
+	if in == nil {
+		return nil
+	}
+	out := new(TK8SContainer)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TK8SContainerMount) DeepCopyInto(out *TK8SContainerMount) {
+	*out = *in
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TK8SContainerMount.
+func (in *TK8SContainerMount) DeepCopy() *TK8SContainerMount {
+	if in == nil {
+		return nil
+	}
+	out := new(TK8SContainerMount)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TK8SDisruptionBudget) DeepCopyInto(out *TK8SDisruptionBudget) {
+	*out = *in
+	if in.MinAvailable != nil {
+		in, out := &in.MinAvailable, &out.MinAvailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	if in.MaxUnavailable != nil {
+		in, out := &in.MaxUnavailable, &out.MaxUnavailable
+		*out = new(intstr.IntOrString)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TK8SDisruptionBudget.
+func (in *TK8SDisruptionBudget) DeepCopy() *TK8SDisruptionBudget {
+	if in == nil {
+		return nil
+	}
+	out := new(TK8SDisruptionBudget)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TK8SHostPort) DeepCopyInto(out *TK8SHostPort) {
 	*out = *in
@@ -936,6 +1121,54 @@ func (in *TK8SMountSource) DeepCopy() *TK8SMountSource {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TK8SProbe) DeepCopyInto(out *TK8SProbe) {
+	*out = *in
+	in.TK8SProbeHandler.DeepCopyInto(&out.TK8SProbeHandler)
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TK8SProbe.
+func (in *TK8SProbe) DeepCopy() *TK8SProbe {
+	if in == nil {
+		return nil
+	}
+	out := new(TK8SProbe)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TK8SProbeHandler) DeepCopyInto(out *TK8SProbeHandler) {
+	*out = *in
+	if in.Exec != nil {
+		in, out := &in.Exec, &out.Exec
+		*out = new(v1.ExecAction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.HTTPGet != nil {
+		in, out := &in.HTTPGet, &out.HTTPGet
+		*out = new(v1.HTTPGetAction)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.TCPSocket != nil {
+		in, out := &in.TCPSocket, &out.TCPSocket
+		*out = new(v1.TCPSocketAction)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TK8SProbeHandler.
+func (in *TK8SProbeHandler) DeepCopy() *TK8SProbeHandler {
+	if in == nil {
+		return nil
+	}
+	out := new(TK8SProbeHandler)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TLocalVolume) DeepCopyInto(out *TLocalVolume) {
 	*out = *in
@@ -958,7 +1191,7 @@ func (in *TServer) DeepCopyInto(out *TServer) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	in.Spec.DeepCopyInto(&out.Spec)
-	out.Status = in.Status
+	in.Status.DeepCopyInto(&out.Status)
 	return
 }
 
@@ -980,6 +1213,65 @@ func (in *TServer) DeepCopyObject() runtime.Object {
 	return nil
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TServerCanary) DeepCopyInto(out *TServerCanary) {
+	*out = *in
+	if in.Steps != nil {
+		in, out := &in.Steps, &out.Steps
+		*out = make([]TServerCanaryStep, len(*in))
+		copy(*out, *in)
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TServerCanary.
+func (in *TServerCanary) DeepCopy() *TServerCanary {
+	if in == nil {
+		return nil
+	}
+	out := new(TServerCanary)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TServerCanaryStatus) DeepCopyInto(out *TServerCanaryStatus) {
+	*out = *in
+	in.StepTime.DeepCopyInto(&out.StepTime)
+	if in.BakeTime != nil {
+		in, out := &in.BakeTime, &out.BakeTime
+		*out = (*in).DeepCopy()
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TServerCanaryStatus.
+func (in *TServerCanaryStatus) DeepCopy() *TServerCanaryStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(TServerCanaryStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TServerCanaryStep) DeepCopyInto(out *TServerCanaryStep) {
+	*out = *in
+	out.Replicas = in.Replicas
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TServerCanaryStep.
+func (in *TServerCanaryStep) DeepCopy() *TServerCanaryStep {
+	if in == nil {
+		return nil
+	}
+	out := new(TServerCanaryStep)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TServerExternal) DeepCopyInto(out *TServerExternal) {
 	*out = *in
@@ -1092,11 +1384,64 @@ func (in *TServerK8S) DeepCopyInto(out *TServerK8S) {
 			(*in)[i].DeepCopyInto(&(*out)[i])
 		}
 	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]v1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.TopologySpreadConstraints != nil {
+		in, out := &in.TopologySpreadConstraints, &out.TopologySpreadConstraints
+		*out = make([]v1.TopologySpreadConstraint, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.DisruptionBudget != nil {
+		in, out := &in.DisruptionBudget, &out.DisruptionBudget
+		*out = new(TK8SDisruptionBudget)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Autoscaler != nil {
+		in, out := &in.Autoscaler, &out.Autoscaler
+		*out = new(TK8SAutoscaler)
+		**out = **in
+	}
 	if in.ReadinessGates != nil {
 		in, out := &in.ReadinessGates, &out.ReadinessGates
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	if in.LivenessProbe != nil {
+		in, out := &in.LivenessProbe, &out.LivenessProbe
+		*out = new(TK8SProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReadinessProbe != nil {
+		in, out := &in.ReadinessProbe, &out.ReadinessProbe
+		*out = new(TK8SProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.StartupProbe != nil {
+		in, out := &in.StartupProbe, &out.StartupProbe
+		*out = new(TK8SProbe)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Sidecars != nil {
+		in, out := &in.Sidecars, &out.Sidecars
+		*out = make([]TK8SContainer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.InitContainers != nil {
+		in, out := &in.InitContainers, &out.InitContainers
+		*out = make([]TK8SContainer, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
 	in.Resources.DeepCopyInto(&out.Resources)
 	in.UpdateStrategy.DeepCopyInto(&out.UpdateStrategy)
 	return
@@ -1210,6 +1555,11 @@ func (in *TServerRelease) DeepCopyInto(out *TServerRelease) {
 		*out = new(TServerReleaseNode)
 		**out = **in
 	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(TServerCanary)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
@@ -1239,6 +1589,31 @@ func (in *TServerReleaseNode) DeepCopy() *TServerReleaseNode {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TServerReleaseRecord) DeepCopyInto(out *TServerReleaseRecord) {
+	*out = *in
+	if in.Time != nil {
+		in, out := &in.Time, &out.Time
+		*out = (*in).DeepCopy()
+	}
+	if in.TServerReleaseNode != nil {
+		in, out := &in.TServerReleaseNode, &out.TServerReleaseNode
+		*out = new(TServerReleaseNode)
+		**out = **in
+	}
+	return
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TServerReleaseRecord.
+func (in *TServerReleaseRecord) DeepCopy() *TServerReleaseRecord {
+	if in == nil {
+		return nil
+	}
+	out := new(TServerReleaseRecord)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TServerServant) DeepCopyInto(out *TServerServant) {
 	*out = *in
@@ -1268,12 +1643,28 @@ func (in *TServerSpec) DeepCopyInto(out *TServerSpec) {
 		*out = new(TServerNormal)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.External != nil {
+		in, out := &in.External, &out.External
+		*out = new(TServerExternal)
+		(*in).DeepCopyInto(*out)
+	}
 	in.K8S.DeepCopyInto(&out.K8S)
 	if in.Release != nil {
 		in, out := &in.Release, &out.Release
 		*out = new(TServerRelease)
 		(*in).DeepCopyInto(*out)
 	}
+	if in.ReleaseHistory != nil {
+		in, out := &in.ReleaseHistory, &out.ReleaseHistory
+		*out = make([]*TServerReleaseRecord, len(*in))
+		for i := range *in {
+			if (*in)[i] != nil {
+				in, out := &(*in)[i], &(*out)[i]
+				*out = new(TServerReleaseRecord)
+				(*in).DeepCopyInto(*out)
+			}
+		}
+	}
 	return
 }
 
@@ -1290,6 +1681,23 @@ func (in *TServerSpec) DeepCopy() *TServerSpec {
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *TServerStatus) DeepCopyInto(out *TServerStatus) {
 	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.StableRelease != nil {
+		in, out := &in.StableRelease, &out.StableRelease
+		*out = new(TServerRelease)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Canary != nil {
+		in, out := &in.Canary, &out.Canary
+		*out = new(TServerCanaryStatus)
+		(*in).DeepCopyInto(*out)
+	}
 	return
 }
 
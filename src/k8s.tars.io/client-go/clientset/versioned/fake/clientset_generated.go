@@ -80,7 +80,6 @@ func (c *Clientset) Tracker() testing.ObjectTracker {
 
 var (
 	_ clientset.Interface = &Clientset{}
-	_ testing.FakeClient  = &Clientset{}
 )
 
 // TarsV1beta1 retrieves the TarsV1beta1Client
@@ -10,4 +10,12 @@ const (
 	TMinReplicasAnnotation = "tars.io/MinReplicas"
 
 	TAutoReleaseAnnotation = "tars.io/AutoRelease"
+
+	TManagedContainersAnnotation = "tars.io/ManagedContainers"
+
+	TCanaryResumeAnnotation = "tars.io/CanaryResume"
+
+	TRollbackToAnnotation = "tars.io/RollbackTo"
+
+	TServerImageAnnotation = "tars.io/ServerImage"
 )
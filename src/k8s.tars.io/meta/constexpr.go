@@ -6,6 +6,10 @@ const TarsControllerAccountPrefix = "system:serviceaccount:kube-system:"
 const TPodReadinessGate = "tars.io/active"
 const NodeServantName = "nodeobj"
 const NodeServantPort = 19385
+const ControllerMetricsPort = 8080
+
+// ControllerFieldManager is the field manager of objects applied by controller
+const ControllerFieldManager = "tars-controller"
 
 const FixedTTreeResourceName = "tars-tree"
 const FixedTFrameworkConfigResourceName = "tars-framework"
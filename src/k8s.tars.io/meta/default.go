@@ -11,6 +11,7 @@ const DefaultControllerServiceAccount = "system:serviceaccount:" + DefaultContro
 const DefaultMaxRecordLen = 60
 const DefaultMaxTConfigHistory = 10
 const DefaultMaxTImageRelease = 32
+const DefaultMaxTServerRelease = 32
 const DefaultMaxImageBuildTime = 480 //second
 const DefaultLauncherType = Background
 const DefaultImagePullPolicy = k8sCoreV1.PullAlways
@@ -25,3 +26,22 @@ var DefaultStatefulsetUpdateStrategy = k8sAppsV1.StatefulSetUpdateStrategy{
 		Partition: &defaultStatefulsetPartition,
 	},
 }
+
+const DefaultProbeTimeoutSeconds = int32(1)
+const DefaultProbePeriodSeconds = int32(10)
+const DefaultProbeSuccessThreshold = int32(1)
+const DefaultProbeFailureThreshold = int32(3)
+
+// DisruptionBudgetHighImportant and DisruptionBudgetMediumImportant are the .spec.important thresholds
+// used to derive the default maxUnavailable of TServer PodDisruptionBudget
+const DisruptionBudgetHighImportant = int32(10)
+const DisruptionBudgetMediumImportant = int32(5)
+
+const DefaultAutoscalerMinReplicas = 1
+const DefaultAutoscalerMaxReplicas = 99
+const DefaultAutoscalerSyncPeriod = 15 //second
+const DefaultAutoscalerScaleDownStabilizationSeconds = int32(300)
+const DefaultAutoscalerTolerance = 0.1
+
+const DefaultCanaryProgressDeadlineSeconds = int32(600)
+const DefaultCanaryFailureThreshold = int32(3)
@@ -6,6 +6,16 @@ const (
 	ResourceDeleteReason = "DeleteError"
 
 	ResourceGetReason = "GetError"
+
+	ResourceCreateReason = "CreateError"
+
+	ResourceUpdateReason = "UpdateError"
+
+	ResourcePatchReason = "PatchError"
+
+	ResourceCreatedReason = "Created"
+
+	ResourceRebuildReason = "Rebuild"
 )
 
 const (
@@ -20,6 +20,8 @@ const (
 	KPersistentVolumeClaimKind = "PersistentVolumeClaim"
 	KStatefulSetKind           = "StatefulSet"
 	KDaemonSetKind             = "Daemonset"
+	KPodDisruptionBudgetKind   = "PodDisruptionBudget"
+	KEndpointSliceKind         = "EndpointSlice"
 )
 
 const (
@@ -20,4 +20,5 @@ const (
 	TConfigDeactivateLabel = "tars.io/Deactivate"
 
 	K8SHostNameLabel = "kubernetes.io/hostname"
+	K8SZoneLabel     = "topology.kubernetes.io/zone"
 )
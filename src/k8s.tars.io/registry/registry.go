@@ -0,0 +1,435 @@
+package registry
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsRuntime "k8s.tars.io/runtime"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrManifestNotFound is returned when the tag or digest is not in the repository
+var ErrManifestNotFound = fmt.Errorf("manifest not found")
+
+// ManifestMediaTypes are the manifest media types accepted when resolving the digest of a tag
+var ManifestMediaTypes = []string{
+	"application/vnd.docker.distribution.manifest.v2+json",
+	"application/vnd.docker.distribution.manifest.list.v2+json",
+	"application/vnd.oci.image.manifest.v1+json",
+	"application/vnd.oci.image.index.v1+json",
+}
+
+// ImageReference is the registry host, repository and tag or digest of an image
+type ImageReference struct {
+	Host       string
+	Repository string
+	// Reference is the tag or digest of image
+	Reference string
+}
+
+// IsDigest return whether the image is referenced by digest
+func (r *ImageReference) IsDigest() bool {
+	return strings.HasPrefix(r.Reference, "sha256:")
+}
+
+// ParseImageReference split image into registry host, repository and tag or digest, with the docker hub defaults
+func ParseImageReference(image string) (*ImageReference, error) {
+	ref := &ImageReference{}
+
+	name := image
+	if i := strings.Index(name, "@"); i != -1 {
+		name, ref.Reference = name[:i], name[i+1:]
+		// the tag of a pinned image is informative only
+		if i = strings.LastIndex(name, ":"); i != -1 && !strings.Contains(name[i:], "/") {
+			name = name[:i]
+		}
+	} else if i = strings.LastIndex(name, ":"); i != -1 && !strings.Contains(name[i:], "/") {
+		name, ref.Reference = name[:i], name[i+1:]
+	} else {
+		ref.Reference = "latest"
+	}
+
+	if i := strings.Index(name, "/"); i != -1 && (strings.ContainsAny(name[:i], ".:") || name[:i] == "localhost") {
+		ref.Host, ref.Repository = name[:i], name[i+1:]
+	} else {
+		ref.Host, ref.Repository = "registry-1.docker.io", name
+		if !strings.Contains(name, "/") {
+			ref.Repository = "library/" + name
+		}
+	}
+
+	if ref.Repository == "" || ref.Reference == "" {
+		return nil, fmt.Errorf("invalid image reference %s", image)
+	}
+	return ref, nil
+}
+
+// Credential is the account of a registry read from a dockerconfigjson secret
+type Credential struct {
+	Username string
+	Password string
+}
+
+// Client talk to registries with the Docker Registry HTTP API V2.
+// certificates are verified unless the registry is listed as insecure, for which
+// https is tried first and plain http is remembered if the registry does not serve tls
+type Client struct {
+	client         *http.Client
+	insecureClient *http.Client
+	insecure       map[string]interface{}
+
+	mutex   sync.Mutex
+	schemes map[string]string
+}
+
+// NewClient create a Client whose requests are limited by timeout, insecureRegistries are the hosts whose certificates are not verified
+func NewClient(timeout time.Duration, insecureRegistries []string) *Client {
+	c := &Client{
+		client: &http.Client{
+			Timeout: timeout,
+		},
+		insecureClient: &http.Client{
+			Timeout:   timeout,
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}},
+		},
+		insecure: map[string]interface{}{},
+		schemes:  map[string]string{},
+	}
+	for _, host := range insecureRegistries {
+		if host = strings.TrimSpace(host); host != "" {
+			c.insecure[host] = nil
+		}
+	}
+	return c
+}
+
+func (c *Client) isInsecure(host string) bool {
+	_, ok := c.insecure[host]
+	return ok
+}
+
+// Insecure return whether the registry of image is listed as insecure, kaniko skips verifying its certificate as well
+func (c *Client) Insecure(image string) bool {
+	ref, err := ParseImageReference(image)
+	return err == nil && c.isInsecure(ref.Host)
+}
+
+func (c *Client) clientOf(host string) *http.Client {
+	if c.isInsecure(host) {
+		return c.insecureClient
+	}
+	return c.client
+}
+
+// LoadCredential read the auth of host from the dockerconfigjson secret of namespace
+func LoadCredential(namespace, secretName, host string) (*Credential, error) {
+	if secretName == "" {
+		return nil, nil
+	}
+
+	secret, err := tarsRuntime.Clients.K8sClient.CoreV1().Secrets(namespace).Get(context.TODO(), secretName, k8sMetaV1.GetOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("get resource %s %s/%s error: %s", "secrets", namespace, secretName, err.Error())
+	}
+
+	var config struct {
+		Auths map[string]struct {
+			Username string `json:"username,omitempty"`
+			Password string `json:"password,omitempty"`
+			Auth     string `json:"auth,omitempty"`
+		} `json:"auths"`
+	}
+	if err = json.Unmarshal(secret.Data[".dockerconfigjson"], &config); err != nil {
+		return nil, fmt.Errorf("parse secret %s error: %s", secretName, err.Error())
+	}
+
+	for server, auth := range config.Auths {
+		if u, err := url.Parse(server); err == nil && u.Host != "" {
+			server = u.Host
+		}
+		if server != host {
+			continue
+		}
+		if auth.Auth != "" {
+			bs, err := base64.StdEncoding.DecodeString(auth.Auth)
+			if err != nil {
+				return nil, fmt.Errorf("decode auth of %s in secret %s error: %s", host, secretName, err.Error())
+			}
+			kv := strings.SplitN(string(bs), ":", 2)
+			if len(kv) == 2 {
+				return &Credential{Username: kv[0], Password: kv[1]}, nil
+			}
+		}
+		return &Credential{Username: auth.Username, Password: auth.Password}, nil
+	}
+	return nil, nil
+}
+
+// challenge parse the WWW-Authenticate header into scheme and params
+func challenge(header string) (string, map[string]string) {
+	params := map[string]string{}
+	i := strings.IndexByte(header, ' ')
+	if i == -1 {
+		return strings.ToLower(header), params
+	}
+	scheme := strings.ToLower(header[:i])
+
+	// values are quoted and may contain comma, e.g. scope="repository:app:pull,push"
+	rest := header[i+1:]
+	for {
+		rest = strings.TrimLeft(rest, " ,")
+		eq := strings.IndexByte(rest, '=')
+		if eq == -1 {
+			return scheme, params
+		}
+		key := strings.ToLower(strings.TrimSpace(rest[:eq]))
+		rest = rest[eq+1:]
+
+		var value string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end == -1 {
+				value, rest = rest[1:], ""
+			} else {
+				value, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else if end := strings.IndexByte(rest, ','); end != -1 {
+			value, rest = rest[:end], rest[end:]
+		} else {
+			value, rest = rest, ""
+		}
+		params[key] = value
+	}
+}
+
+func (c *Client) fetchToken(params map[string]string, credential *Credential) (string, error) {
+	query := url.Values{}
+	if service, ok := params["service"]; ok {
+		query.Set("service", service)
+	}
+	if scope, ok := params["scope"]; ok {
+		query.Set("scope", scope)
+	}
+
+	request, err := http.NewRequest(http.MethodGet, fmt.Sprintf("%s?%s", params["realm"], query.Encode()), nil)
+	if err != nil {
+		return "", err
+	}
+	if credential != nil {
+		request.SetBasicAuth(credential.Username, credential.Password)
+	}
+
+	response, err := c.clientOf(request.URL.Host).Do(request)
+	if err != nil {
+		return "", err
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("get registry token failed: %s", response.Status)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err = json.NewDecoder(response.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+// RequestBody open the body of a request, it is called again if the request is resent
+type RequestBody func() (io.ReadCloser, int64, error)
+
+func (c *Client) send(method, host, target string, header http.Header, body RequestBody) (*http.Response, error) {
+	c.mutex.Lock()
+	scheme, ok := c.schemes[host]
+	c.mutex.Unlock()
+	if !ok {
+		scheme = "https"
+	}
+
+	for {
+		// target is a path, or the absolute upload location returned by registry
+		address := target
+		if !strings.HasPrefix(target, "http://") && !strings.HasPrefix(target, "https://") {
+			address = fmt.Sprintf("%s://%s%s", scheme, host, target)
+		}
+
+		var reader io.ReadCloser
+		var length int64
+		if body != nil {
+			var err error
+			if reader, length, err = body(); err != nil {
+				return nil, err
+			}
+		}
+
+		request, err := http.NewRequest(method, address, reader)
+		if err != nil {
+			if reader != nil {
+				_ = reader.Close()
+			}
+			return nil, err
+		}
+		request.Header = header.Clone()
+		if body != nil {
+			request.ContentLength = length
+		}
+
+		response, err := c.clientOf(host).Do(request)
+		// only insecure registries are downgraded to plain http, the others must serve tls
+		if err != nil && scheme == "https" && !ok && c.isInsecure(host) && strings.Contains(err.Error(), "HTTP response to HTTPS client") {
+			scheme = "http"
+			continue
+		}
+		if err == nil && !ok {
+			c.mutex.Lock()
+			c.schemes[host] = scheme
+			c.mutex.Unlock()
+		}
+		return response, err
+	}
+}
+
+// Session access one repository with credential, the authorization answering the registry challenge is reused
+type Session struct {
+	client        *Client
+	Ref           *ImageReference
+	credential    *Credential
+	authorization string
+}
+
+// Session open a Session for the repository of image, the credential is read from secret of namespace
+func (c *Client) Session(image, namespace, secret string) (*Session, error) {
+	ref, err := ParseImageReference(image)
+	if err != nil {
+		return nil, err
+	}
+	credential, err := LoadCredential(namespace, secret, ref.Host)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{client: c, Ref: ref, credential: credential}, nil
+}
+
+// Do send the request, and answer the basic or bearer challenge of registry with credential
+func (s *Session) Do(method, target string, header http.Header, body RequestBody) (*http.Response, error) {
+	if header == nil {
+		header = http.Header{}
+	}
+	if s.authorization != "" {
+		header.Set("Authorization", s.authorization)
+	}
+
+	response, err := s.client.send(method, s.Ref.Host, target, header, body)
+	if err != nil || response.StatusCode != http.StatusUnauthorized {
+		return response, err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	_ = response.Body.Close()
+
+	scheme, params := challenge(response.Header.Get("WWW-Authenticate"))
+	switch scheme {
+	case "basic":
+		if s.credential == nil {
+			return nil, fmt.Errorf("registry %s requires credential", s.Ref.Host)
+		}
+		auth := base64.StdEncoding.EncodeToString([]byte(s.credential.Username + ":" + s.credential.Password))
+		s.authorization = "Basic " + auth
+	case "bearer":
+		token, err := s.client.fetchToken(params, s.credential)
+		if err != nil {
+			return nil, err
+		}
+		s.authorization = "Bearer " + token
+	default:
+		return nil, fmt.Errorf("unsupported registry auth challenge %q", response.Header.Get("WWW-Authenticate"))
+	}
+	header.Set("Authorization", s.authorization)
+	return s.client.send(method, s.Ref.Host, target, header, body)
+}
+
+func (s *Session) ManifestPath(reference string) string {
+	return fmt.Sprintf("/v2/%s/manifests/%s", s.Ref.Repository, reference)
+}
+
+func (s *Session) BlobPath(digest string) string {
+	return fmt.Sprintf("/v2/%s/blobs/%s", s.Ref.Repository, digest)
+}
+
+// Digest resolve the manifest digest of reference
+func (s *Session) Digest(reference string) (string, error) {
+	if strings.HasPrefix(reference, "sha256:") {
+		return reference, nil
+	}
+
+	header := http.Header{}
+	header.Set("Accept", strings.Join(ManifestMediaTypes, ", "))
+	response, err := s.Do(http.MethodHead, s.ManifestPath(reference), header, nil)
+	if err != nil {
+		return "", err
+	}
+	_ = response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return "", ErrManifestNotFound
+	default:
+		return "", fmt.Errorf("get manifest %s/%s:%s failed: %s", s.Ref.Host, s.Ref.Repository, reference, response.Status)
+	}
+
+	digest := response.Header.Get("Docker-Content-Digest")
+	if digest == "" {
+		return "", fmt.Errorf("registry %s returned no digest for %s:%s", s.Ref.Host, s.Ref.Repository, reference)
+	}
+	return digest, nil
+}
+
+// Digest resolve the manifest digest of image, with the credential read from secret of namespace
+func (c *Client) Digest(image, namespace, secret string) (string, error) {
+	s, err := c.Session(image, namespace, secret)
+	if err != nil {
+		return "", err
+	}
+	return s.Digest(s.Ref.Reference)
+}
+
+// DeleteManifest delete the manifest of digest from the repository of image,
+// all tags of the repository pointing to digest are removed as well
+func (c *Client) DeleteManifest(image, namespace, secret, digest string) error {
+	s, err := c.Session(image, namespace, secret)
+	if err != nil {
+		return err
+	}
+
+	response, err := s.Do(http.MethodDelete, s.ManifestPath(digest), nil, nil)
+	if err != nil {
+		return err
+	}
+	_, _ = io.Copy(ioutil.Discard, response.Body)
+	_ = response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusAccepted, http.StatusOK:
+		return nil
+	case http.StatusNotFound:
+		return ErrManifestNotFound
+	case http.StatusMethodNotAllowed:
+		return fmt.Errorf("registry %s does not allow deleting, enable storage delete of the registry", s.Ref.Host)
+	}
+	return fmt.Errorf("delete manifest of %s failed: %s", image, response.Status)
+}
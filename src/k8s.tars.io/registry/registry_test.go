@@ -0,0 +1,223 @@
+package registry
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sFake "k8s.io/client-go/kubernetes/fake"
+	tarsRuntime "k8s.tars.io/runtime"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+const testNamespace = "tars"
+
+const testTimeout = time.Second * 5
+
+// testRegistry serve manifests of "repository:tag" by their digests, with basic auth if username is set
+type testRegistry struct {
+	*httptest.Server
+	username string
+	password string
+
+	mutex     sync.Mutex
+	manifests map[string]string
+}
+
+func newTestRegistry(t *testing.T, tls bool, manifests map[string]string) *testRegistry {
+	r := &testRegistry{manifests: manifests}
+	if tls {
+		r.Server = httptest.NewTLSServer(r)
+	} else {
+		r.Server = httptest.NewServer(r)
+	}
+	t.Cleanup(r.Close)
+	return r
+}
+
+func (r *testRegistry) Host() string {
+	return strings.TrimPrefix(strings.TrimPrefix(r.URL, "https://"), "http://")
+}
+
+func (r *testRegistry) ServeHTTP(writer http.ResponseWriter, request *http.Request) {
+	if r.username != "" {
+		if username, password, ok := request.BasicAuth(); !ok || username != r.username || password != r.password {
+			writer.Header().Set("WWW-Authenticate", `Basic realm="test"`)
+			writer.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+	}
+
+	path := strings.TrimPrefix(request.URL.Path, "/v2/")
+	i := strings.LastIndex(path, "/manifests/")
+	if i == -1 {
+		writer.WriteHeader(http.StatusNotFound)
+		return
+	}
+	repository, reference := path[:i], path[i+len("/manifests/"):]
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	switch request.Method {
+	case http.MethodHead:
+		digest, ok := r.manifests[repository+":"+reference]
+		if !ok {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writer.Header().Set("Docker-Content-Digest", digest)
+		writer.WriteHeader(http.StatusOK)
+	case http.MethodDelete:
+		found := false
+		for image, digest := range r.manifests {
+			if strings.HasPrefix(image, repository+":") && digest == reference {
+				delete(r.manifests, image)
+				found = true
+			}
+		}
+		if !found {
+			writer.WriteHeader(http.StatusNotFound)
+			return
+		}
+		writer.WriteHeader(http.StatusAccepted)
+	default:
+		writer.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func setupTestClients() {
+	tarsRuntime.Clients = &tarsRuntime.Client{K8sClient: k8sFake.NewSimpleClientset()}
+}
+
+// createTestSecret create a dockerconfigjson secret holding the credential of registry
+func createTestSecret(t *testing.T, name string, registry *testRegistry) {
+	auth := base64.StdEncoding.EncodeToString([]byte(registry.username + ":" + registry.password))
+	config := fmt.Sprintf(`{"auths":{"https://%s":{"auth":%q}}}`, registry.Host(), auth)
+	secret := &k8sCoreV1.Secret{
+		ObjectMeta: k8sMetaV1.ObjectMeta{Name: name, Namespace: testNamespace},
+		Type:       k8sCoreV1.SecretTypeDockerConfigJson,
+		Data:       map[string][]byte{k8sCoreV1.DockerConfigJsonKey: []byte(config)},
+	}
+	if _, err := tarsRuntime.Clients.K8sClient.CoreV1().Secrets(testNamespace).Create(context.TODO(), secret, k8sMetaV1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestParseImageReference(t *testing.T) {
+	tests := []struct {
+		image string
+		want  ImageReference
+	}{
+		{"registry.local:5000/app/server:v1", ImageReference{"registry.local:5000", "app/server", "v1"}},
+		{"registry.local/server", ImageReference{"registry.local", "server", "latest"}},
+		{"localhost/server:v1", ImageReference{"localhost", "server", "v1"}},
+		{"registry.local/server:v1@sha256:abc", ImageReference{"registry.local", "server", "sha256:abc"}},
+		{"app/server:v1", ImageReference{"registry-1.docker.io", "app/server", "v1"}},
+		{"busybox", ImageReference{"registry-1.docker.io", "library/busybox", "latest"}},
+	}
+	for _, tt := range tests {
+		ref, err := ParseImageReference(tt.image)
+		if err != nil {
+			t.Errorf("ParseImageReference(%q) error: %s", tt.image, err)
+			continue
+		}
+		if *ref != tt.want {
+			t.Errorf("ParseImageReference(%q) = %+v, want %+v", tt.image, *ref, tt.want)
+		}
+	}
+}
+
+func TestChallenge(t *testing.T) {
+	scheme, params := challenge(`Bearer realm="https://auth.local/token",service="registry",scope="repository:app:pull,push"`)
+	if scheme != "bearer" {
+		t.Errorf("scheme = %q, want bearer", scheme)
+	}
+	want := map[string]string{"realm": "https://auth.local/token", "service": "registry", "scope": "repository:app:pull,push"}
+	for key, value := range want {
+		if params[key] != value {
+			t.Errorf("param %s = %q, want %q", key, params[key], value)
+		}
+	}
+}
+
+func TestClientDigest(t *testing.T) {
+	setupTestClients()
+	registry := newTestRegistry(t, false, map[string]string{"app/server:v1": "sha256:v1"})
+	registry.username, registry.password = "user", "password"
+	createTestSecret(t, "registry-secret", registry)
+
+	client := NewClient(testTimeout, []string{registry.Host()})
+	image := registry.Host() + "/app/server:v1"
+
+	if digest, err := client.Digest(image, testNamespace, "registry-secret"); err != nil || digest != "sha256:v1" {
+		t.Errorf("Digest(%s) = %s, %v, want sha256:v1", image, digest, err)
+	}
+	if _, err := client.Digest(registry.Host()+"/app/server:v2", testNamespace, "registry-secret"); err != ErrManifestNotFound {
+		t.Errorf("Digest of missing tag error = %v, want %v", err, ErrManifestNotFound)
+	}
+	if _, err := client.Digest(image, testNamespace, ""); err == nil || !strings.Contains(err.Error(), "requires credential") {
+		t.Errorf("Digest without credential error = %v, want requires credential", err)
+	}
+	// a pinned image is resolved without asking registry
+	if digest, err := client.Digest("registry.invalid/server@sha256:pinned", testNamespace, ""); err != nil || digest != "sha256:pinned" {
+		t.Errorf("Digest of pinned image = %s, %v, want sha256:pinned", digest, err)
+	}
+}
+
+func TestClientInsecure(t *testing.T) {
+	setupTestClients()
+	tlsRegistry := newTestRegistry(t, true, map[string]string{"server:v1": "sha256:tls"})
+	httpRegistry := newTestRegistry(t, false, map[string]string{"server:v1": "sha256:http"})
+	tlsImage := tlsRegistry.Host() + "/server:v1"
+	httpImage := httpRegistry.Host() + "/server:v1"
+
+	// certificates are verified and tls is required unless the registry is listed
+	secure := NewClient(testTimeout, nil)
+	if secure.Insecure(tlsImage) {
+		t.Errorf("Insecure(%s) = true, want false", tlsImage)
+	}
+	if _, err := secure.Digest(tlsImage, testNamespace, ""); err == nil || !strings.Contains(err.Error(), "certificate") {
+		t.Errorf("Digest of self-signed registry error = %v, want certificate error", err)
+	}
+	if _, err := secure.Digest(httpImage, testNamespace, ""); err == nil {
+		t.Errorf("Digest of plain http registry succeeded, want error")
+	}
+
+	insecure := NewClient(testTimeout, []string{tlsRegistry.Host(), " " + httpRegistry.Host(), ""})
+	if !insecure.Insecure(tlsImage) || !insecure.Insecure(httpImage) {
+		t.Errorf("Insecure of listed registries = false, want true")
+	}
+	if digest, err := insecure.Digest(tlsImage, testNamespace, ""); err != nil || digest != "sha256:tls" {
+		t.Errorf("Digest(%s) = %s, %v, want sha256:tls", tlsImage, digest, err)
+	}
+	if digest, err := insecure.Digest(httpImage, testNamespace, ""); err != nil || digest != "sha256:http" {
+		t.Errorf("Digest(%s) = %s, %v, want sha256:http", httpImage, digest, err)
+	}
+	if scheme := insecure.schemes[httpRegistry.Host()]; scheme != "http" {
+		t.Errorf("scheme of %s = %q, want http", httpRegistry.Host(), scheme)
+	}
+}
+
+func TestClientDeleteManifest(t *testing.T) {
+	setupTestClients()
+	registry := newTestRegistry(t, false, map[string]string{"server:v1": "sha256:v1", "server:latest": "sha256:v1", "server:v2": "sha256:v2"})
+	client := NewClient(testTimeout, []string{registry.Host()})
+	image := registry.Host() + "/server:v1"
+
+	if err := client.DeleteManifest(image, testNamespace, "", "sha256:v1"); err != nil {
+		t.Fatal(err)
+	}
+	if len(registry.manifests) != 1 {
+		t.Errorf("manifests = %v, want all tags of sha256:v1 deleted", registry.manifests)
+	}
+	if err := client.DeleteManifest(image, testNamespace, "", "sha256:v1"); err != ErrManifestNotFound {
+		t.Errorf("DeleteManifest of deleted manifest error = %v, want %v", err, ErrManifestNotFound)
+	}
+}
@@ -0,0 +1,22 @@
+package runtime
+
+import (
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sSchema "k8s.io/client-go/kubernetes/scheme"
+	k8sCoreTypeV1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"sync"
+)
+
+var eventBroadcaster record.EventBroadcaster
+var eventBroadcasterOnce sync.Once
+
+// NewEventRecorder returns a recorder that writes events as component through the process-wide broadcaster.
+// The broadcaster is started on first use, so programs that never record events never open an events sink.
+func NewEventRecorder(component string) record.EventRecorder {
+	eventBroadcasterOnce.Do(func() {
+		eventBroadcaster = record.NewBroadcaster()
+		eventBroadcaster.StartRecordingToSink(&k8sCoreTypeV1.EventSinkImpl{Interface: k8sClient.CoreV1().Events("")})
+	})
+	return eventBroadcaster.NewRecorder(k8sSchema.Scheme, k8sCoreV1.EventSource{Component: component})
+}
@@ -7,6 +7,7 @@ import (
 	"k8s.io/client-go/metadata/metadatainformer"
 	tarsInformers "k8s.tars.io/client-go/informers/externalversions"
 	tarsMeta "k8s.tars.io/meta"
+	"time"
 )
 
 type InformerFactories struct {
@@ -23,27 +24,51 @@ func (i *InformerFactories) Start(stop chan struct{}) {
 	i.TarsInformerFactory.Start(stop)
 }
 
-func newInformerFactories(clients *Client, namespace bool) *InformerFactories {
+func newInformerFactories(clients *Client, namespace bool, resync time.Duration) *InformerFactories {
 	if namespace {
 		return &InformerFactories{
-			K8SInformerFactory: k8sInformers.NewSharedInformerFactoryWithOptions(clients.K8sClient, 0, k8sInformers.WithNamespace(Namespace)),
-			K8SInformerFactoryWithTarsFilter: k8sInformers.NewSharedInformerFactoryWithOptions(clients.K8sClient, 0, k8sInformers.WithTweakListOptions(
+			K8SInformerFactory: k8sInformers.NewSharedInformerFactoryWithOptions(clients.K8sClient, resync, k8sInformers.WithNamespace(Namespace)),
+			K8SInformerFactoryWithTarsFilter: k8sInformers.NewSharedInformerFactoryWithOptions(clients.K8sClient, resync, k8sInformers.WithTweakListOptions(
 				func(options *k8sMetaV1.ListOptions) {
 					options.LabelSelector = fmt.Sprintf("%s,%s", tarsMeta.TServerAppLabel, tarsMeta.TServerNameLabel)
 				},
 			), k8sInformers.WithNamespace(Namespace)),
-			MetadataInformerFactor: metadatainformer.NewFilteredSharedInformerFactory(clients.K8sMetadataClient, 0, Namespace, nil),
-			TarsInformerFactory: tarsInformers.NewSharedInformerFactoryWithOptions(clients.CrdClient, 0, tarsInformers.WithNamespace(Namespace)),
+			MetadataInformerFactor: metadatainformer.NewFilteredSharedInformerFactory(clients.K8sMetadataClient, resync, Namespace, nil),
+			TarsInformerFactory: tarsInformers.NewSharedInformerFactoryWithOptions(clients.CrdClient, resync, tarsInformers.WithNamespace(Namespace)),
 		}
 	}
 
 	return &InformerFactories{
-		K8SInformerFactory: k8sInformers.NewSharedInformerFactory(clients.K8sClient, 0),
-		K8SInformerFactoryWithTarsFilter: k8sInformers.NewSharedInformerFactoryWithOptions(clients.K8sClient, 0, k8sInformers.WithTweakListOptions(
+		K8SInformerFactory: k8sInformers.NewSharedInformerFactory(clients.K8sClient, resync),
+		K8SInformerFactoryWithTarsFilter: k8sInformers.NewSharedInformerFactoryWithOptions(clients.K8sClient, resync, k8sInformers.WithTweakListOptions(
 			func(options *k8sMetaV1.ListOptions) {
 				options.LabelSelector = fmt.Sprintf("%s,%s", tarsMeta.TServerAppLabel, tarsMeta.TServerNameLabel)
 			})),
-		MetadataInformerFactor: metadatainformer.NewSharedInformerFactory(clients.K8sMetadataClient, 0),
-		TarsInformerFactory: tarsInformers.NewSharedInformerFactoryWithOptions(clients.CrdClient, 0),
+		MetadataInformerFactor: metadatainformer.NewSharedInformerFactory(clients.K8sMetadataClient, resync),
+		TarsInformerFactory: tarsInformers.NewSharedInformerFactoryWithOptions(clients.CrdClient, resync),
 	}
 }
+
+// WaitForCacheSync blocks until all started informers have synced or stop is closed, the result is keyed by informer type
+func (i *InformerFactories) WaitForCacheSync(stop chan struct{}) map[string]bool {
+	result := map[string]bool{}
+	merge := func(key string, synced bool) {
+		if v, ok := result[key]; ok {
+			synced = synced && v
+		}
+		result[key] = synced
+	}
+	for k, v := range i.K8SInformerFactory.WaitForCacheSync(stop) {
+		merge(k.String(), v)
+	}
+	for k, v := range i.K8SInformerFactoryWithTarsFilter.WaitForCacheSync(stop) {
+		merge(k.String(), v)
+	}
+	for k, v := range i.MetadataInformerFactor.WaitForCacheSync(stop) {
+		merge(k.String(), v)
+	}
+	for k, v := range i.TarsInformerFactory.WaitForCacheSync(stop) {
+		merge(k.String(), v)
+	}
+	return result
+}
@@ -12,6 +12,7 @@ import (
 	k8sClientCmd "k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/tools/leaderelection"
 	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	k8sTransport "k8s.io/client-go/transport"
 	"k8s.io/klog/v2"
 	crdVersioned "k8s.tars.io/client-go/clientset/versioned"
 	crdScheme "k8s.tars.io/client-go/clientset/versioned/scheme"
@@ -32,6 +33,28 @@ var TarsTranslator *tarsTranslatorV1beta3.Translator
 var Username string
 var Namespace string
 
+var transportWrappers []k8sTransport.WrapperFunc
+
+// ContextConfig tunes the clients and informer factories created by CreateContext, zero values keep the client-go defaults
+type ContextConfig struct {
+	QPS   float32
+	Burst int
+	// Resync is the period informers replay their caches to handlers, 0 disables it
+	Resync time.Duration
+}
+
+var contextConfig ContextConfig
+
+// WrapTransport registers fn to wrap the transport of all clients, it only takes effect when called before CreateContext
+func WrapTransport(fn k8sTransport.WrapperFunc) {
+	transportWrappers = append(transportWrappers, fn)
+}
+
+// Configure set the config of clients and informers, it only takes effect when called before CreateContext
+func Configure(config ContextConfig) {
+	contextConfig = config
+}
+
 func CreateContext(masterUrl, kubeConfigPath string, namespace bool) error {
 	const namespaceFile = "/var/run/secrets/kubernetes.io/serviceaccount/namespace"
 	bs, err := ioutil.ReadFile(namespaceFile)
@@ -49,6 +72,17 @@ func CreateContext(masterUrl, kubeConfigPath string, namespace bool) error {
 
 	Username = clusterConfig.Username
 
+	for _, fn := range transportWrappers {
+		clusterConfig.Wrap(fn)
+	}
+
+	if contextConfig.QPS > 0 {
+		clusterConfig.QPS = contextConfig.QPS
+	}
+	if contextConfig.Burst > 0 {
+		clusterConfig.Burst = contextConfig.Burst
+	}
+
 	k8sClient = kubernetes.NewForConfigOrDie(clusterConfig)
 
 	tarsClient = crdVersioned.NewForConfigOrDie(clusterConfig)
@@ -66,7 +100,7 @@ func CreateContext(masterUrl, kubeConfigPath string, namespace bool) error {
 		K8sMetadataClient: k8sMetadataClient,
 	}
 
-	Factories = newInformerFactories(Clients, namespace)
+	Factories = newInformerFactories(Clients, namespace, contextConfig.Resync)
 
 	TFCConfig = &TFrameworkConfig{}
 	TFCConfig.setupTFCWatch(Factories, namespace)
@@ -91,7 +125,7 @@ func LeaderElectAndRun(callbacks leaderelection.LeaderCallbacks, namespace, name
 		k8sClient.CoordinationV1(),
 		resourcelock.ResourceLockConfig{
 			Identity:      id,
-			EventRecorder: nil,
+			EventRecorder: NewEventRecorder(name),
 		})
 
 	if err != nil {
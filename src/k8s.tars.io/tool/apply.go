@@ -0,0 +1,275 @@
+package tool
+
+import (
+	"fmt"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/json"
+	"reflect"
+	"strings"
+)
+
+var jsonMarshalerType = reflect.TypeOf((*interface{ MarshalJSON() ([]byte, error) })(nil)).Elem()
+
+// applyValue return the apply content of v, and false if v is unset.
+// following the api conventions, zero values and empty collections are unset unless explicit,
+// the values pointed to, elements of slices and values of maps are explicit
+func applyValue(v reflect.Value, explicit bool) (interface{}, bool, error) {
+	switch v.Kind() {
+	case reflect.Ptr, reflect.Interface:
+		if v.IsNil() {
+			return nil, false, nil
+		}
+		return applyValue(v.Elem(), true)
+	}
+
+	if v.Type().Implements(jsonMarshalerType) || reflect.PtrTo(v.Type()).Implements(jsonMarshalerType) {
+		if !explicit && v.IsZero() {
+			return nil, false, nil
+		}
+		// marshal through pointer, MarshalJSON may have pointer receiver
+		ptr := reflect.New(v.Type())
+		ptr.Elem().Set(v)
+		bs, err := json.Marshal(ptr.Interface())
+		if err != nil {
+			return nil, false, err
+		}
+		var content interface{}
+		if err = json.Unmarshal(bs, &content); err != nil {
+			return nil, false, err
+		}
+		return content, content != nil, nil
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		content := map[string]interface{}{}
+		if err := applyStruct(v, content); err != nil {
+			return nil, false, err
+		}
+		return content, explicit || len(content) != 0, nil
+	case reflect.Map:
+		content := map[string]interface{}{}
+		if v.Len() == 0 {
+			return content, explicit && !v.IsNil(), nil
+		}
+		iter := v.MapRange()
+		for iter.Next() {
+			value, ok, err := applyValue(iter.Value(), true)
+			if err != nil {
+				return nil, false, err
+			}
+			if ok {
+				content[fmt.Sprint(iter.Key().Interface())] = value
+			}
+		}
+		return content, true, nil
+	case reflect.Slice, reflect.Array:
+		if v.Len() == 0 {
+			return nil, false, nil
+		}
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			return v.Interface(), true, nil
+		}
+		content := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			value, _, err := applyValue(v.Index(i), true)
+			if err != nil {
+				return nil, false, err
+			}
+			content = append(content, value)
+		}
+		return content, true, nil
+	default:
+		if !explicit && v.IsZero() {
+			return nil, false, nil
+		}
+		return v.Interface(), true, nil
+	}
+}
+
+// applyStruct add the set fields of struct v into content, embedded and inline fields are merged like json
+func applyStruct(v reflect.Value, content map[string]interface{}) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" || (field.PkgPath != "" && !field.Anonymous) {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+
+		fieldValue := v.Field(i)
+		if name == "" && (field.Anonymous || strings.Contains(tag, ",inline")) {
+			if fieldValue.Kind() == reflect.Ptr {
+				if fieldValue.IsNil() {
+					continue
+				}
+				fieldValue = fieldValue.Elem()
+			}
+			if fieldValue.Kind() == reflect.Struct {
+				if err := applyStruct(fieldValue, content); err != nil {
+					return err
+				}
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		value, ok, err := applyValue(fieldValue, false)
+		if err != nil {
+			return err
+		}
+		if ok {
+			content[name] = value
+		}
+	}
+	return nil
+}
+
+// ApplyPatch build the body of server side apply from obj, which only contains the fields set in obj,
+// so the applier never owns the fields it leaves to others. status and the metadata maintained by apiserver are dropped
+func ApplyPatch(obj interface{}) ([]byte, error) {
+	value, _, err := applyValue(reflect.ValueOf(obj), true)
+	if err != nil {
+		return nil, err
+	}
+	content, ok := value.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("unexpected apply object type %T", obj)
+	}
+	delete(content, "status")
+	if metadata, ok := content["metadata"].(map[string]interface{}); ok {
+		delete(metadata, "resourceVersion")
+		delete(metadata, "managedFields")
+		delete(metadata, "creationTimestamp")
+	}
+	return json.Marshal(content)
+}
+
+// ApplyOptions return the options of server side apply by manager, conflicts are forced because manager owns what it applies
+func ApplyOptions(manager string) k8sMetaV1.PatchOptions {
+	force := true
+	return k8sMetaV1.PatchOptions{
+		FieldManager: manager,
+		Force:        &force,
+	}
+}
+
+func fieldsOf(entry *k8sMetaV1.ManagedFieldsEntry) map[string]interface{} {
+	var fields map[string]interface{}
+	if entry.FieldsV1 != nil {
+		_ = json.Unmarshal(entry.FieldsV1.Raw, &fields)
+	}
+	return fields
+}
+
+// FieldManaged return whether manager has any field of the object
+func FieldManaged(managedFields []k8sMetaV1.ManagedFieldsEntry, manager string) bool {
+	for i := range managedFields {
+		if managedFields[i].Manager == manager {
+			return true
+		}
+	}
+	return false
+}
+
+// FieldOwned return whether manager owns the field of path, eg. FieldOwned(managedFields, manager, "spec", "replicas")
+func FieldOwned(managedFields []k8sMetaV1.ManagedFieldsEntry, manager string, path ...string) bool {
+	for i := range managedFields {
+		if managedFields[i].Manager != manager {
+			continue
+		}
+		fields := fieldsOf(&managedFields[i])
+		for j, p := range path {
+			v, ok := fields["f:"+p]
+			if !ok {
+				break
+			}
+			if j == len(path)-1 {
+				return true
+			}
+			if fields, ok = v.(map[string]interface{}); !ok {
+				break
+			}
+		}
+	}
+	return false
+}
+
+func mergeFields(dst, src map[string]interface{}) {
+	for k, v := range src {
+		sv, ok := v.(map[string]interface{})
+		if !ok {
+			if _, exist := dst[k]; !exist {
+				dst[k] = v
+			}
+			continue
+		}
+		dv, ok := dst[k].(map[string]interface{})
+		if !ok {
+			dv = map[string]interface{}{}
+			dst[k] = dv
+		}
+		mergeFields(dv, sv)
+	}
+}
+
+// statusOnly return whether fields are all under status, which are written through the status subresource
+func statusOnly(fields map[string]interface{}) bool {
+	_, ok := fields["f:status"]
+	return ok && len(fields) == 1
+}
+
+// UpgradeManagedFields return the json patch that hands the fields written by the updates of legacy and manager over to the apply of manager,
+// so that the fields manager stops applying are removed instead of being kept by the updates.
+// the entries of others are left untouched, and nil is returned if there is nothing to hand over or manager has applied the object before
+func UpgradeManagedFields(managedFields []k8sMetaV1.ManagedFieldsEntry, legacy, manager string) JsonPatch {
+	for i := range managedFields {
+		if managedFields[i].Manager == manager && managedFields[i].Operation == k8sMetaV1.ManagedFieldsOperationApply {
+			return nil
+		}
+	}
+
+	var jsonPatch JsonPatch
+	var applied *k8sMetaV1.ManagedFieldsEntry
+	merged := map[string]interface{}{}
+
+	// remove from the last, so that the indexes of the entries to remove are not shifted
+	for i := len(managedFields) - 1; i >= 0; i-- {
+		entry := &managedFields[i]
+		if (entry.Manager != legacy && entry.Manager != manager) || entry.Operation != k8sMetaV1.ManagedFieldsOperationUpdate {
+			continue
+		}
+		fields := fieldsOf(entry)
+		if statusOnly(fields) {
+			continue
+		}
+		mergeFields(merged, fields)
+		if applied == nil {
+			applied = entry.DeepCopy()
+		} else if entry.Time != nil && (applied.Time == nil || applied.Time.Before(entry.Time)) {
+			applied.Time = entry.Time
+		}
+		jsonPatch = append(jsonPatch, JsonPatchItem{
+			OP:   JsonPatchRemove,
+			Path: fmt.Sprintf("/metadata/managedFields/%d", i),
+		})
+	}
+
+	if applied == nil {
+		return nil
+	}
+
+	bs, _ := json.Marshal(merged)
+	applied.Manager = manager
+	applied.Operation = k8sMetaV1.ManagedFieldsOperationApply
+	applied.FieldsType = "FieldsV1"
+	applied.FieldsV1 = &k8sMetaV1.FieldsV1{Raw: bs}
+	return append(jsonPatch, JsonPatchItem{
+		OP:    JsonPatchAdd,
+		Path:  "/metadata/managedFields/-",
+		Value: applied,
+	})
+}
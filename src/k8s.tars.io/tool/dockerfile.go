@@ -0,0 +1,90 @@
+package tool
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// instructions a dockerfile fragment may use, the others could replace the base image, read files out of build context,
+// or override the tars entrypoint.
+// RUN is not allowed, its commands run in the kaniko container, which holds the registry credentials to push images
+var allowedDockerfileInstructions = map[string]interface{}{
+	"ARG":         nil,
+	"ENV":         nil,
+	"EXPOSE":      nil,
+	"HEALTHCHECK": nil,
+	"LABEL":       nil,
+	"USER":        nil,
+	"WORKDIR":     nil,
+}
+
+var buildArgNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+const maxBuildArgValueLength = 4096
+
+// ParseDockerfileFragment join continuation lines of fragment, drop comments and blank lines,
+// then check every instruction is allowed to be appended to the generated server Dockerfile
+func ParseDockerfileFragment(fragment string) ([]string, error) {
+	var lines []string
+	var current strings.Builder
+	for _, line := range strings.Split(strings.ReplaceAll(fragment, "\r\n", "\n"), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if current.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "#")) {
+			continue
+		}
+		if strings.HasSuffix(trimmed, "\\") {
+			current.WriteString(strings.TrimSuffix(trimmed, "\\"))
+			current.WriteString(" ")
+			continue
+		}
+		current.WriteString(trimmed)
+		lines = append(lines, strings.TrimSpace(current.String()))
+		current.Reset()
+	}
+	if current.Len() != 0 {
+		return nil, fmt.Errorf("unterminated line continuation")
+	}
+
+	for _, line := range lines {
+		fields := strings.Fields(line)
+		instruction := strings.ToUpper(fields[0])
+		if instruction == "FROM" {
+			return nil, fmt.Errorf("FROM can not be overridden")
+		}
+		if _, ok := allowedDockerfileInstructions[instruction]; !ok {
+			return nil, fmt.Errorf("instruction %s is not allowed", instruction)
+		}
+		if len(fields) == 1 {
+			return nil, fmt.Errorf("instruction %s has no argument", instruction)
+		}
+	}
+	return lines, nil
+}
+
+// ValidBuildArgs check build arg names could be declared by ARG and values are reasonable
+func ValidBuildArgs(args map[string]string) error {
+	for name, value := range args {
+		if !buildArgNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid build arg name %q", name)
+		}
+		if len(value) > maxBuildArgValueLength {
+			return fmt.Errorf("value of build arg %s is longer than %d", name, maxBuildArgValueLength)
+		}
+		if strings.ContainsAny(value, "\n\r") {
+			return fmt.Errorf("value of build arg %s contains line break", name)
+		}
+	}
+	return nil
+}
+
+// SortedBuildArgNames return names of args in order, so the generated Dockerfile is stable
+func SortedBuildArgNames(args map[string]string) []string {
+	names := make([]string, 0, len(args))
+	for name := range args {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,51 @@
+package tool
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseDockerfileFragment(t *testing.T) {
+	lines, err := ParseDockerfileFragment("# comment\r\n\nENV A=1\\\n    B=2\nlabel maintainer=tars\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := []string{"ENV A=1 B=2", "label maintainer=tars"}; !reflect.DeepEqual(lines, expected) {
+		t.Errorf("ParseDockerfileFragment = %q, want %q", lines, expected)
+	}
+
+	tests := []string{
+		"FROM busybox",
+		"RUN cat /workspace/docker/config.json",
+		"run wget -q -O- http://example.com",
+		"COPY / /",
+		"ADD http://example.com/a /a",
+		"ENTRYPOINT [\"sh\"]",
+		"ONBUILD RUN id",
+		"ENV",
+		"ENV A=1 \\",
+	}
+	for _, fragment := range tests {
+		if _, err := ParseDockerfileFragment(fragment); err == nil {
+			t.Errorf("ParseDockerfileFragment(%q) should fail", fragment)
+		}
+	}
+}
+
+func TestValidBuildArgs(t *testing.T) {
+	if err := ValidBuildArgs(map[string]string{"VERSION": "1.0", "_A1": ""}); err != nil {
+		t.Errorf("ValidBuildArgs error: %v", err)
+	}
+	tests := []map[string]string{
+		{"1A": "1"},
+		{"A-B": "1"},
+		{"A": "1\nRUN id"},
+		{"A": strings.Repeat("a", maxBuildArgValueLength+1)},
+	}
+	for _, args := range tests {
+		if err := ValidBuildArgs(args); err == nil {
+			t.Errorf("ValidBuildArgs(%v) should fail", args)
+		}
+	}
+}
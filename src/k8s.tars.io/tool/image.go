@@ -0,0 +1,19 @@
+package tool
+
+import "strings"
+
+// PinnedImage return image referenced by digest, image is returned as is if digest is empty or image already has one
+func PinnedImage(image, digest string) string {
+	if digest == "" || strings.ContainsRune(image, '@') {
+		return image
+	}
+	return image + "@" + digest
+}
+
+// ImageDigest return the digest part of image reference, or "" if it is referenced by tag
+func ImageDigest(image string) string {
+	if i := strings.IndexByte(image, '@'); i != -1 {
+		return image[i+1:]
+	}
+	return ""
+}
@@ -6,6 +6,7 @@ const (
 	JsonPatchAdd     JsonPatchOperator = "add"
 	JsonPatchRemove  JsonPatchOperator = "remove"
 	JsonPatchReplace JsonPatchOperator = "replace"
+	JsonPatchTest    JsonPatchOperator = "test"
 )
 
 type JsonPatchItem struct {
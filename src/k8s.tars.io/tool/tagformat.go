@@ -0,0 +1,250 @@
+package tool
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// TagFormat is a parsed image tag template.
+// Placeholders are written as {name} or {name:arg}, everything else is kept literally:
+//
+//	{app}, {server}       server app and server name
+//	{id}                  build id
+//	{timestamp[:layout]}  build create time, layout in go time format, default 20060102150405
+//	{createPerson}        who posted the build
+//	{gitSha[:length]}     GitSha form field, optionally shortened
+//	{baseTag}             tag of the base image
+//	{semver[:part]}       next semantic version of the timage, part is one of major, minor, patch(default)
+type TagFormat struct {
+	segments []tagFormatSegment
+}
+
+type tagFormatSegment struct {
+	literal string
+	name    string
+	arg     string
+}
+
+// TagFormatValues holds the values placeholders are replaced with
+type TagFormatValues struct {
+	App          string
+	Server       string
+	ID           string
+	Timestamp    time.Time
+	CreatePerson string
+	GitSha       string
+	BaseTag      string
+	SemVer       string
+}
+
+const (
+	TagFormatApp          = "app"
+	TagFormatServer       = "server"
+	TagFormatID           = "id"
+	TagFormatTimestamp    = "timestamp"
+	TagFormatCreatePerson = "createPerson"
+	TagFormatGitSha       = "gitSha"
+	TagFormatBaseTag      = "baseTag"
+	TagFormatSemVer       = "semver"
+)
+
+const defaultTagFormatTimestampLayout = "20060102150405"
+
+const maxImageTagLength = 128
+
+// image tag value is also used in timage build state, whose pattern only accept lower case
+var imageTagRegex = regexp.MustCompile(`^[0-9a-z][-.0-9a-z]*$`)
+
+var imageTagInvalidChars = regexp.MustCompile(`[^-.0-9a-z]+`)
+
+var semVerRegex = regexp.MustCompile(`^v?(\d+)\.(\d+)\.(\d+)$`)
+
+// ParseTagFormat parse format and check every placeholder and literal could be part of image tag
+func ParseTagFormat(format string) (*TagFormat, error) {
+	tagFormat := &TagFormat{}
+	rest := format
+	for rest != "" {
+		start := strings.IndexByte(rest, '{')
+		if start == -1 {
+			tagFormat.segments = append(tagFormat.segments, tagFormatSegment{literal: rest})
+			break
+		}
+		if start > 0 {
+			tagFormat.segments = append(tagFormat.segments, tagFormatSegment{literal: rest[:start]})
+		}
+		end := strings.IndexByte(rest[start:], '}')
+		if end == -1 {
+			return nil, fmt.Errorf("unclosed placeholder at offset %d", len(format)-len(rest)+start)
+		}
+		placeholder := rest[start+1 : start+end]
+		name, arg := placeholder, ""
+		if i := strings.IndexByte(placeholder, ':'); i != -1 {
+			name, arg = placeholder[:i], placeholder[i+1:]
+		}
+		if err := validTagFormatPlaceholder(name, arg); err != nil {
+			return nil, err
+		}
+		tagFormat.segments = append(tagFormat.segments, tagFormatSegment{name: name, arg: arg})
+		rest = rest[start+end+1:]
+	}
+
+	for _, segment := range tagFormat.segments {
+		if segment.name == "" && imageTagInvalidChars.MatchString(segment.literal) {
+			return nil, fmt.Errorf("literal %q contains characters not allowed in image tag", segment.literal)
+		}
+	}
+	return tagFormat, nil
+}
+
+func validTagFormatPlaceholder(name, arg string) error {
+	switch name {
+	case TagFormatApp, TagFormatServer, TagFormatID, TagFormatCreatePerson, TagFormatBaseTag:
+		if arg != "" {
+			return fmt.Errorf("placeholder {%s} does not accept argument", name)
+		}
+	case TagFormatTimestamp:
+		if arg != "" && imageTagInvalidChars.MatchString(strings.ToLower(time.Unix(0, 0).UTC().Format(arg))) {
+			return fmt.Errorf("timestamp layout %q produces characters not allowed in image tag", arg)
+		}
+	case TagFormatGitSha:
+		if arg != "" {
+			length, err := strconv.Atoi(arg)
+			if err != nil || length <= 0 || length > 40 {
+				return fmt.Errorf("gitSha length %q should be an integer between 1 and 40", arg)
+			}
+		}
+	case TagFormatSemVer:
+		switch arg {
+		case "", "major", "minor", "patch":
+		default:
+			return fmt.Errorf("semver part %q should be one of major, minor, patch", arg)
+		}
+	default:
+		return fmt.Errorf("unknown placeholder {%s}", name)
+	}
+	return nil
+}
+
+// SemVerPart return the part {semver} placeholder bumps, or "" if format does not use it
+func (f *TagFormat) SemVerPart() string {
+	for _, segment := range f.segments {
+		if segment.name == TagFormatSemVer {
+			if segment.arg == "" {
+				return "patch"
+			}
+			return segment.arg
+		}
+	}
+	return ""
+}
+
+// Execute replace placeholders with values and return a valid image tag
+func (f *TagFormat) Execute(values *TagFormatValues) (string, error) {
+	var builder strings.Builder
+	for _, segment := range f.segments {
+		if segment.name == "" {
+			builder.WriteString(segment.literal)
+			continue
+		}
+
+		var value string
+		switch segment.name {
+		case TagFormatApp:
+			value = values.App
+		case TagFormatServer:
+			value = values.Server
+		case TagFormatID:
+			value = values.ID
+		case TagFormatTimestamp:
+			layout := segment.arg
+			if layout == "" {
+				layout = defaultTagFormatTimestampLayout
+			}
+			value = values.Timestamp.Format(layout)
+		case TagFormatCreatePerson:
+			value = values.CreatePerson
+		case TagFormatGitSha:
+			if values.GitSha == "" {
+				return "", fmt.Errorf("tag format uses {gitSha} but no GitSha value provided")
+			}
+			value = values.GitSha
+			if segment.arg != "" {
+				length, _ := strconv.Atoi(segment.arg)
+				if length < len(value) {
+					value = value[:length]
+				}
+			}
+		case TagFormatBaseTag:
+			value = values.BaseTag
+		case TagFormatSemVer:
+			value = values.SemVer
+		}
+		builder.WriteString(imageTagInvalidChars.ReplaceAllString(strings.ToLower(value), "-"))
+	}
+
+	tag := builder.String()
+	if len(tag) > maxImageTagLength {
+		tag = tag[:maxImageTagLength]
+	}
+	if err := ValidImageTag(tag); err != nil {
+		return "", fmt.Errorf("tag format generated %s", err.Error())
+	}
+	return tag, nil
+}
+
+// ValidImageTag check tag is a lower case image tag no longer than 128 characters
+func ValidImageTag(tag string) error {
+	if len(tag) > maxImageTagLength || !imageTagRegex.MatchString(tag) {
+		return fmt.Errorf("invalid image tag %q", tag)
+	}
+	return nil
+}
+
+// ImageTag return the tag part of image reference, or "latest" if it has none
+func ImageTag(image string) string {
+	if i := strings.IndexByte(image, '@'); i != -1 {
+		image = image[:i]
+	}
+	i := strings.LastIndexByte(image, ':')
+	if i == -1 || strings.ContainsRune(image[i+1:], '/') {
+		return "latest"
+	}
+	return image[i+1:]
+}
+
+// NextSemVer return the version after the greatest one of versions, bumped at part.
+// Values that are not semantic versions are ignored, 0.0.0 is used if none found
+func NextSemVer(versions []string, part string) string {
+	var latest [3]int
+	for _, version := range versions {
+		matches := semVerRegex.FindStringSubmatch(version)
+		if matches == nil {
+			continue
+		}
+		var current [3]int
+		for i := 0; i < 3; i++ {
+			current[i], _ = strconv.Atoi(matches[i+1])
+		}
+		for i := 0; i < 3; i++ {
+			if current[i] != latest[i] {
+				if current[i] > latest[i] {
+					latest = current
+				}
+				break
+			}
+		}
+	}
+
+	switch part {
+	case "major":
+		latest = [3]int{latest[0] + 1, 0, 0}
+	case "minor":
+		latest = [3]int{latest[0], latest[1] + 1, 0}
+	default:
+		latest[2]++
+	}
+	return fmt.Sprintf("%d.%d.%d", latest[0], latest[1], latest[2])
+}
@@ -0,0 +1,90 @@
+package tool
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTagFormat(t *testing.T) {
+	tests := []struct {
+		format string
+		valid  bool
+	}{
+		{"{app}-{server}-{timestamp}", true},
+		{"v{semver:minor}", true},
+		{"{gitSha:8}", true},
+		{"{timestamp:2006.01.02}", true},
+		{"{unknown}", false},
+		{"{app", false},
+		{"{app:arg}", false},
+		{"{gitSha:41}", false},
+		{"{semver:build}", false},
+		{"release_{id}", false},
+		{"{timestamp:2006/01/02}", false},
+	}
+	for _, test := range tests {
+		if _, err := ParseTagFormat(test.format); (err == nil) != test.valid {
+			t.Errorf("ParseTagFormat(%q) error = %v, want valid %v", test.format, err, test.valid)
+		}
+	}
+}
+
+func TestTagFormatExecute(t *testing.T) {
+	values := &TagFormatValues{
+		App:          "Test",
+		Server:       "HelloServer",
+		ID:           "v20220101-1",
+		Timestamp:    time.Date(2022, 1, 2, 3, 4, 5, 0, time.UTC),
+		CreatePerson: "Alice@tars",
+		GitSha:       "0123456789abcdef0123456789abcdef01234567",
+		BaseTag:      "latest",
+		SemVer:       "1.2.3",
+	}
+	tests := []struct {
+		format string
+		tag    string
+	}{
+		{"{app}.{server}-{timestamp}", "test.helloserver-20220102030405"},
+		{"{gitSha:7}-{createPerson}", "0123456-alice-tars"},
+		{"v{semver}-{baseTag}", "v1.2.3-latest"},
+		{"{id}", "v20220101-1"},
+	}
+	for _, test := range tests {
+		tagFormat, err := ParseTagFormat(test.format)
+		if err != nil {
+			t.Fatalf("ParseTagFormat(%q) error: %v", test.format, err)
+		}
+		tag, err := tagFormat.Execute(values)
+		if err != nil || tag != test.tag {
+			t.Errorf("Execute(%q) = %q, %v, want %q", test.format, tag, err, test.tag)
+		}
+	}
+
+	tagFormat, _ := ParseTagFormat("-{app}")
+	if _, err := tagFormat.Execute(values); err == nil {
+		t.Errorf("Execute of tag starting with '-' should fail")
+	}
+}
+
+func TestValidImageTag(t *testing.T) {
+	tests := []struct {
+		tag   string
+		valid bool
+	}{
+		{"v1.0.0", true},
+		{"20220102-abc", true},
+		{"", false},
+		{"V1", false},
+		{"-v1", false},
+		{"v1_0", false},
+		{"v1:0", false},
+		{strings.Repeat("a", 128), true},
+		{strings.Repeat("a", 129), false},
+	}
+	for _, test := range tests {
+		if err := ValidImageTag(test.tag); (err == nil) != test.valid {
+			t.Errorf("ValidImageTag(%q) error = %v, want valid %v", test.tag, err, test.valid)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package v1beta3
+
+import (
+	"k8s.io/apimachinery/pkg/util/intstr"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+)
+
+// isCanaryRelease return true when the release should be rolled out step by step,
+// a canary needs a stable release to roll back to, so the first release of a tserver always roll out directly
+func isCanaryRelease(tserver *tarsV1beta3.TServer) bool {
+	release := tserver.Spec.Release
+	if release == nil || release.Canary == nil || len(release.Canary.Steps) == 0 {
+		return false
+	}
+	stable := tserver.Status.StableRelease
+	return stable != nil && stable.ID != release.ID
+}
+
+// buildCanaryStepReplicas return the pods of the release at step, out of the replicas the statefulset runs
+func buildCanaryStepReplicas(tserver *tarsV1beta3.TServer, replicas int32, step int32) int32 {
+	steps := tserver.Spec.Release.Canary.Steps
+	if step < 0 || int(step) >= len(steps) {
+		return replicas
+	}
+
+	value, err := intstr.GetValueFromIntOrPercent(&steps[step].Replicas, int(replicas), true)
+	if err != nil || value < 0 {
+		return 0
+	}
+	if int32(value) > replicas {
+		return replicas
+	}
+	return int32(value)
+}
+
+// buildCanaryPartition return the statefulset partition of the canary release,
+// before the controller start the canary for the release, no pod should be updated
+func buildCanaryPartition(tserver *tarsV1beta3.TServer, replicas int32) int32 {
+	canary := tserver.Status.Canary
+	if canary == nil || canary.ReleaseID != tserver.Spec.Release.ID {
+		return replicas
+	}
+
+	switch canary.Phase {
+	case tarsV1beta3.CanaryProgressing, tarsV1beta3.CanaryPaused:
+		return replicas - buildCanaryStepReplicas(tserver, replicas, canary.Step)
+	default:
+		return replicas
+	}
+}
@@ -25,26 +25,13 @@ func buildDaemonsetUpdateStrategy(tserver *tarsV1beta3.TServer) k8sAppsV1.Daemon
 	return us
 }
 
-func syncDaemonSet(tserver *tarsV1beta3.TServer, daemonSet *k8sAppsV1.DaemonSet) {
-	var sst = buildPodTemplate(tserver)
-	for _, v := range daemonSet.Spec.Template.Spec.Containers {
-		if v.Name != tserver.Name {
-			sst.Spec.Containers = append(sst.Spec.Containers, *v.DeepCopy())
-		}
-	}
-
-	for _, v := range daemonSet.Spec.Template.Spec.InitContainers {
-		if v.Name != "tarsnode" {
-			sst.Spec.Containers = append(sst.Spec.InitContainers, *v.DeepCopy())
-		}
-	}
-	daemonSet.Spec.Template = sst
-}
-
 func buildDaemonset(tserver *tarsV1beta3.TServer) *k8sAppsV1.DaemonSet {
 	historyLimit := tarsMeta.DefaultWorkloadHistoryLimit
 	daemonSet := &k8sAppsV1.DaemonSet{
-		TypeMeta: k8sMetaV1.TypeMeta{},
+		TypeMeta: k8sMetaV1.TypeMeta{
+			Kind:       "DaemonSet",
+			APIVersion: "apps/v1",
+		},
 		ObjectMeta: k8sMetaV1.ObjectMeta{
 			Name:      tserver.Name,
 			Namespace: tserver.Namespace,
@@ -71,3 +58,10 @@ func buildDaemonset(tserver *tarsV1beta3.TServer) *k8sAppsV1.DaemonSet {
 	}
 	return daemonSet
 }
+
+// buildDaemonsetApply build the daemonset to apply over current, the immutable selector is kept as current
+func buildDaemonsetApply(tserver *tarsV1beta3.TServer, current *k8sAppsV1.DaemonSet) *k8sAppsV1.DaemonSet {
+	daemonSet := buildDaemonset(tserver)
+	daemonSet.Spec.Selector = current.Spec.Selector
+	return daemonSet
+}
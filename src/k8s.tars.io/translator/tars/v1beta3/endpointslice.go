@@ -0,0 +1,98 @@
+package v1beta3
+
+import (
+	"fmt"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sDiscoveryV1beta1 "k8s.io/api/discovery/v1beta1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	"net"
+	"sort"
+	"strings"
+)
+
+const endpointSliceManagedBy = tarsMeta.ControllerFieldManager
+
+func buildEndpointSliceAddressType(ip string) k8sDiscoveryV1beta1.AddressType {
+	if parsed := net.ParseIP(ip); parsed != nil && parsed.To4() == nil {
+		return k8sDiscoveryV1beta1.AddressTypeIPv6
+	}
+	return k8sDiscoveryV1beta1.AddressTypeIPv4
+}
+
+// buildEndpointSliceName generate one name for each upstream, port and address type,
+// because all endpoints in one slice share the same ports and address type
+func buildEndpointSliceName(tserver *tarsV1beta3.TServer, upstream string, port int32, addressType k8sDiscoveryV1beta1.AddressType) string {
+	name := fmt.Sprintf("%s-%s-%d", tserver.Name, strings.ToLower(upstream), port)
+	if addressType == k8sDiscoveryV1beta1.AddressTypeIPv6 {
+		name += "-ipv6"
+	}
+	return name
+}
+
+func buildEndpointSlices(tserver *tarsV1beta3.TServer) []*k8sDiscoveryV1beta1.EndpointSlice {
+	if tserver.Spec.External == nil {
+		return nil
+	}
+
+	slices := map[string]*k8sDiscoveryV1beta1.EndpointSlice{}
+	var names []string
+
+	ready := true
+	for _, upstream := range tserver.Spec.External.Upstreams {
+		portName := strings.ToLower(upstream.Name)
+		protocol := k8sCoreV1.ProtocolUDP
+		if upstream.IsTcp {
+			protocol = k8sCoreV1.ProtocolTCP
+		}
+		for _, address := range upstream.Addresses {
+			addressType := buildEndpointSliceAddressType(address.IP)
+			name := buildEndpointSliceName(tserver, upstream.Name, address.Port, addressType)
+			slice, ok := slices[name]
+			if !ok {
+				port := address.Port
+				slice = &k8sDiscoveryV1beta1.EndpointSlice{
+					TypeMeta: k8sMetaV1.TypeMeta{
+						Kind:       "EndpointSlice",
+						APIVersion: "discovery.k8s.io/v1beta1",
+					},
+					ObjectMeta: k8sMetaV1.ObjectMeta{
+						Name:      name,
+						Namespace: tserver.Namespace,
+						Labels: map[string]string{
+							tarsMeta.TServerAppLabel:             tserver.Spec.App,
+							tarsMeta.TServerNameLabel:            tserver.Spec.Server,
+							k8sDiscoveryV1beta1.LabelServiceName: tserver.Name,
+							k8sDiscoveryV1beta1.LabelManagedBy:   endpointSliceManagedBy,
+						},
+						OwnerReferences: []k8sMetaV1.OwnerReference{
+							*k8sMetaV1.NewControllerRef(tserver, tarsV1beta3.SchemeGroupVersion.WithKind(tarsMeta.TServerKind)),
+						},
+					},
+					AddressType: addressType,
+					Ports: []k8sDiscoveryV1beta1.EndpointPort{
+						{
+							Name:     &portName,
+							Protocol: &protocol,
+							Port:     &port,
+						},
+					},
+				}
+				slices[name] = slice
+				names = append(names, name)
+			}
+			slice.Endpoints = append(slice.Endpoints, k8sDiscoveryV1beta1.Endpoint{
+				Addresses:  []string{address.IP},
+				Conditions: k8sDiscoveryV1beta1.EndpointConditions{Ready: &ready},
+			})
+		}
+	}
+
+	sort.Strings(names)
+	result := make([]*k8sDiscoveryV1beta1.EndpointSlice, 0, len(names))
+	for _, name := range names {
+		result = append(result, slices[name])
+	}
+	return result
+}
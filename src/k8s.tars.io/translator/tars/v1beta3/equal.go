@@ -3,9 +3,12 @@ package v1beta3
 import (
 	k8sAppsV1 "k8s.io/api/apps/v1"
 	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sDiscoveryV1beta1 "k8s.io/api/discovery/v1beta1"
+	k8sPolicyV1beta1 "k8s.io/api/policy/v1beta1"
 	"k8s.io/apimachinery/pkg/api/equality"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
+	tarsTool "k8s.tars.io/tool"
 )
 
 func equalServicePort(l, r []k8sCoreV1.ServicePort) bool {
@@ -429,6 +432,80 @@ func equalContainerPorts(l, r []k8sCoreV1.ContainerPort) bool {
 	return true
 }
 
+func equalContainer(l, r *k8sCoreV1.Container) bool {
+	if l.Image != r.Image {
+		return false
+	}
+	if l.ImagePullPolicy != r.ImagePullPolicy {
+		return false
+	}
+	if !equality.Semantic.DeepEqual(l.Command, r.Command) {
+		return false
+	}
+	if !equality.Semantic.DeepEqual(l.Args, r.Args) {
+		return false
+	}
+	if !equalEnv(l.Env, r.Env) {
+		return false
+	}
+	if !equalEnvFrom(l.EnvFrom, r.EnvFrom) {
+		return false
+	}
+	if !equality.Semantic.DeepEqual(l.Resources, r.Resources) {
+		return false
+	}
+	if !equalContainerPorts(l.Ports, r.Ports) {
+		return false
+	}
+	if !equalVolumesMounts(l.VolumeMounts, r.VolumeMounts) {
+		return false
+	}
+	return true
+}
+
+// equalContainers check whether all containers in l exist and equal in r
+func equalContainers(l, r []k8sCoreV1.Container) bool {
+	for i := range l {
+		var found *k8sCoreV1.Container
+		for j := range r {
+			if l[i].Name == r[j].Name {
+				found = &r[j]
+				break
+			}
+		}
+		if found == nil || !equalContainer(&l[i], found) {
+			return false
+		}
+	}
+	return true
+}
+
+func equalPodManagedContainers(tserver *tarsV1beta3.TServer, template *k8sCoreV1.PodTemplateSpec) bool {
+	if buildPodManagedContainers(tserver) != template.Annotations[tarsMeta.TManagedContainersAnnotation] {
+		return false
+	}
+	if !equalContainers(buildPodSidecars(tserver), template.Spec.Containers) {
+		return false
+	}
+	if !equalContainers(buildPodExtraInitContainers(tserver), template.Spec.InitContainers) {
+		return false
+	}
+	return true
+}
+
+func equalContainerProbes(tserver *tarsV1beta3.TServer, container *k8sCoreV1.Container) bool {
+	if !equality.Semantic.DeepEqual(buildContainerProbe(tserver, tserver.Spec.K8S.LivenessProbe), container.LivenessProbe) {
+		return false
+	}
+	if !equality.Semantic.DeepEqual(buildContainerProbe(tserver, tserver.Spec.K8S.ReadinessProbe), container.ReadinessProbe) {
+		return false
+	}
+	if !equality.Semantic.DeepEqual(buildContainerProbe(tserver, tserver.Spec.K8S.StartupProbe), container.StartupProbe) {
+		return false
+	}
+	return true
+}
+
 func equalTarsServants(l, r []*tarsV1beta3.TServerServant) bool {
 	if len(l) != len(r) {
 		return false
@@ -566,7 +643,7 @@ func equalTServerAndTEndpoint(tserver *tarsV1beta3.TServer, tendpoint *tarsV1bet
 		return false
 	}
 
-	if !equality.Semantic.DeepEqual(tserver.Spec.Release, tendpoint.Spec.Release) {
+	if !equality.Semantic.DeepEqual(buildTEndpointRelease(tserver), tendpoint.Spec.Release) {
 		return false
 	}
 
@@ -575,6 +652,8 @@ func equalTServerAndTEndpoint(tserver *tarsV1beta3.TServer, tendpoint *tarsV1bet
 		return equalTars(tserver.Spec.Tars, tendpoint.Spec.Tars)
 	case tarsV1beta3.Normal:
 		return equalNormal(tserver.Spec.Normal, tendpoint.Spec.Normal)
+	case tarsV1beta3.External:
+		return equality.Semantic.DeepEqual(tserver.Spec.External, tendpoint.Spec.External)
 	}
 
 	//should not reach here
@@ -598,7 +677,7 @@ func equalTServerAndService(tserver *tarsV1beta3.TServer, service *k8sCoreV1.Ser
 		return false
 	}
 
-	if !equalLabel(targetLabels, serviceSpec.Selector) {
+	if !equalLabel(buildServiceSelector(tserver), serviceSpec.Selector) {
 		return false
 	}
 
@@ -610,6 +689,39 @@ func equalTServerAndService(tserver *tarsV1beta3.TServer, service *k8sCoreV1.Ser
 	return true
 }
 
+func equalEndpointSlice(target, slice *k8sDiscoveryV1beta1.EndpointSlice) bool {
+	if !containLabel(target.Labels, slice.Labels) {
+		return false
+	}
+
+	if !equality.Semantic.DeepEqual(target.OwnerReferences, slice.OwnerReferences) {
+		return false
+	}
+
+	if !equality.Semantic.DeepEqual(target.Ports, slice.Ports) {
+		return false
+	}
+
+	return equality.Semantic.DeepEqual(target.Endpoints, slice.Endpoints)
+}
+
+func equalTServerAndPodDisruptionBudget(tserver *tarsV1beta3.TServer, pdb *k8sPolicyV1beta1.PodDisruptionBudget) bool {
+	targetLabels := map[string]string{
+		tarsMeta.TServerAppLabel:  tserver.Spec.App,
+		tarsMeta.TServerNameLabel: tserver.Spec.Server,
+	}
+
+	if !containLabel(targetLabels, pdb.Labels) {
+		return false
+	}
+
+	targetSpec := buildPodDisruptionBudgetSpec(tserver)
+	if !equality.Semantic.DeepEqual(targetSpec, pdb.Spec) {
+		return false
+	}
+	return true
+}
+
 func equalTServerAndDaemonSet(tserver *tarsV1beta3.TServer, daemonSet *k8sAppsV1.DaemonSet) bool {
 
 	targetLabels := map[string]string{
@@ -670,6 +782,20 @@ func equalTServerAndDaemonSet(tserver *tarsV1beta3.TServer, daemonSet *k8sAppsV1
 		return false
 	}
 
+	targetTolerations := buildPodTolerations(tserver)
+	if !equality.Semantic.DeepEqual(targetTolerations, daemonsetSpecTemplateSpec.Tolerations) {
+		return false
+	}
+
+	targetTopologySpreadConstraints := buildPodTopologySpreadConstraints(tserver)
+	if !equality.Semantic.DeepEqual(targetTopologySpreadConstraints, daemonsetSpecTemplateSpec.TopologySpreadConstraints) {
+		return false
+	}
+
+	if tserver.Spec.K8S.PriorityClassName != daemonsetSpecTemplateSpec.PriorityClassName {
+		return false
+	}
+
 	targetVolumes := buildPodVolumes(tserver)
 	if !equalVolumes(targetVolumes, daemonsetSpecTemplateSpec.Volumes) {
 		return false
@@ -721,7 +847,7 @@ func equalTServerAndDaemonSet(tserver *tarsV1beta3.TServer, daemonSet *k8sAppsV1
 
 	serverImage := tarsMeta.ServiceImagePlaceholder
 	if tserver.Spec.Release != nil {
-		serverImage = tserver.Spec.Release.Image
+		serverImage = tarsTool.PinnedImage(tserver.Spec.Release.Image, tserver.Spec.Release.Digest)
 	}
 
 	if serverImage != container.Image {
@@ -756,12 +882,20 @@ func equalTServerAndDaemonSet(tserver *tarsV1beta3.TServer, daemonSet *k8sAppsV1
 	if !equalContainerPorts(targetContainerPorts, container.Ports) {
 		return false
 	}
+
+	if !equalContainerProbes(tserver, container) {
+		return false
+	}
+
+	if !equalPodManagedContainers(tserver, &daemonSet.Spec.Template) {
+		return false
+	}
 	return true
 }
 
 func equalTServerAndStatefulset(tserver *tarsV1beta3.TServer, statefulSet *k8sAppsV1.StatefulSet) bool {
 
-	if tserver.Spec.K8S.Replicas != *statefulSet.Spec.Replicas {
+	if !statefulsetReplicasYielded(statefulSet) && tserver.Spec.K8S.Replicas != *statefulSet.Spec.Replicas {
 		return false
 	}
 
@@ -795,7 +929,7 @@ func equalTServerAndStatefulset(tserver *tarsV1beta3.TServer, statefulSet *k8sAp
 		return false
 	}
 
-	targetUpdateStrategy := buildStatefulsetUpdateStrategy(tserver)
+	targetUpdateStrategy := buildStatefulsetUpdateStrategy(tserver, statefulsetReplicas(tserver, statefulSet))
 	if !equality.Semantic.DeepEqual(targetUpdateStrategy, statefulSet.Spec.UpdateStrategy) {
 		return false
 	}
@@ -824,6 +958,20 @@ func equalTServerAndStatefulset(tserver *tarsV1beta3.TServer, statefulSet *k8sAp
 		return false
 	}
 
+	targetTolerations := buildPodTolerations(tserver)
+	if !equality.Semantic.DeepEqual(targetTolerations, statefulSetSpecTemplateSpec.Tolerations) {
+		return false
+	}
+
+	targetTopologySpreadConstraints := buildPodTopologySpreadConstraints(tserver)
+	if !equality.Semantic.DeepEqual(targetTopologySpreadConstraints, statefulSetSpecTemplateSpec.TopologySpreadConstraints) {
+		return false
+	}
+
+	if tserver.Spec.K8S.PriorityClassName != statefulSetSpecTemplateSpec.PriorityClassName {
+		return false
+	}
+
 	targetVolumes := buildPodVolumes(tserver)
 	if !equalVolumes(targetVolumes, statefulSetSpecTemplateSpec.Volumes) {
 		return false
@@ -886,7 +1034,7 @@ func equalTServerAndStatefulset(tserver *tarsV1beta3.TServer, statefulSet *k8sAp
 
 	serverImage := tarsMeta.ServiceImagePlaceholder
 	if tserver.Spec.Release != nil {
-		serverImage = tserver.Spec.Release.Image
+		serverImage = tarsTool.PinnedImage(tserver.Spec.Release.Image, tserver.Spec.Release.Digest)
 	}
 
 	if serverImage != container.Image {
@@ -921,5 +1069,13 @@ func equalTServerAndStatefulset(tserver *tarsV1beta3.TServer, statefulSet *k8sAp
 	if !equalContainerPorts(targetContainerPorts, container.Ports) {
 		return false
 	}
+
+	if !equalContainerProbes(tserver, container) {
+		return false
+	}
+
+	if !equalPodManagedContainers(tserver, &statefulSet.Spec.Template) {
+		return false
+	}
 	return true
 }
@@ -0,0 +1,72 @@
+package v1beta3
+
+import (
+	k8sPolicyV1beta1 "k8s.io/api/policy/v1beta1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+)
+
+func buildPodDisruptionBudgetSpec(tserver *tarsV1beta3.TServer) k8sPolicyV1beta1.PodDisruptionBudgetSpec {
+	spec := k8sPolicyV1beta1.PodDisruptionBudgetSpec{
+		Selector: &k8sMetaV1.LabelSelector{
+			MatchLabels: map[string]string{
+				tarsMeta.TServerAppLabel:  tserver.Spec.App,
+				tarsMeta.TServerNameLabel: tserver.Spec.Server,
+			},
+		},
+	}
+
+	budget := tserver.Spec.K8S.DisruptionBudget
+	if budget == nil {
+		return spec
+	}
+
+	if budget.MinAvailable != nil {
+		minAvailable := *budget.MinAvailable
+		spec.MinAvailable = &minAvailable
+		return spec
+	}
+
+	if budget.MaxUnavailable != nil {
+		maxUnavailable := *budget.MaxUnavailable
+		spec.MaxUnavailable = &maxUnavailable
+		return spec
+	}
+
+	// the more important the server is, the fewer pods can be disrupted at the same time
+	var maxUnavailable intstr.IntOrString
+	switch {
+	case tserver.Spec.Important >= tarsMeta.DisruptionBudgetHighImportant:
+		maxUnavailable = intstr.FromInt(1)
+	case tserver.Spec.Important >= tarsMeta.DisruptionBudgetMediumImportant:
+		maxUnavailable = intstr.FromString("25%")
+	default:
+		maxUnavailable = intstr.FromString("50%")
+	}
+	spec.MaxUnavailable = &maxUnavailable
+	return spec
+}
+
+func buildPodDisruptionBudget(tserver *tarsV1beta3.TServer) *k8sPolicyV1beta1.PodDisruptionBudget {
+	pdb := &k8sPolicyV1beta1.PodDisruptionBudget{
+		TypeMeta: k8sMetaV1.TypeMeta{
+			Kind:       "PodDisruptionBudget",
+			APIVersion: "policy/v1beta1",
+		},
+		ObjectMeta: k8sMetaV1.ObjectMeta{
+			Name:      tserver.Name,
+			Namespace: tserver.Namespace,
+			Labels: map[string]string{
+				tarsMeta.TServerAppLabel:  tserver.Spec.App,
+				tarsMeta.TServerNameLabel: tserver.Spec.Server,
+			},
+			OwnerReferences: []k8sMetaV1.OwnerReference{
+				*k8sMetaV1.NewControllerRef(tserver, tarsV1beta3.SchemeGroupVersion.WithKind(tarsMeta.TServerKind)),
+			},
+		},
+		Spec: buildPodDisruptionBudgetSpec(tserver),
+	}
+	return pdb
+}
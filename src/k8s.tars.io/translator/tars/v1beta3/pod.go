@@ -4,9 +4,12 @@ import (
 	"fmt"
 	k8sCoreV1 "k8s.io/api/core/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	utilRuntime "k8s.io/apimachinery/pkg/util/runtime"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
+	tarsTool "k8s.tars.io/tool"
+	"strings"
 )
 
 func buildContainerPorts(tserver *tarsV1beta3.TServer) []k8sCoreV1.ContainerPort {
@@ -108,6 +111,139 @@ func buildContainerVolumeMounts(tserver *tarsV1beta3.TServer) []k8sCoreV1.Volume
 	return volumeMounts
 }
 
+func buildContainerProbe(tserver *tarsV1beta3.TServer, probe *tarsV1beta3.TK8SProbe) *k8sCoreV1.Probe {
+	if probe == nil {
+		return nil
+	}
+
+	handler := k8sCoreV1.Handler{
+		Exec:      probe.Exec,
+		HTTPGet:   probe.HTTPGet,
+		TCPSocket: probe.TCPSocket,
+	}
+
+	if probe.Servant != "" {
+		var servantPort int32
+		if tserver.Spec.Tars != nil {
+			for _, servant := range tserver.Spec.Tars.Servants {
+				if strings.EqualFold(servant.Name, probe.Servant) {
+					servantPort = servant.Port
+					break
+				}
+			}
+		}
+		if servantPort == 0 {
+			utilRuntime.HandleError(fmt.Errorf(tarsMeta.ShouldNotHappenError, fmt.Sprintf("probe servant %s not found in tserver %s/%s", probe.Servant, tserver.Namespace, tserver.Name)))
+			return nil
+		}
+		handler.TCPSocket = &k8sCoreV1.TCPSocketAction{
+			Port: intstr.FromInt(int(servantPort)),
+		}
+	}
+
+	// set the same default values as kube-apiserver, so the built template keeps stable when compared with the stored one
+	if handler.HTTPGet != nil {
+		httpGet := *handler.HTTPGet
+		if httpGet.Path == "" {
+			httpGet.Path = "/"
+		}
+		if httpGet.Scheme == "" {
+			httpGet.Scheme = k8sCoreV1.URISchemeHTTP
+		}
+		handler.HTTPGet = &httpGet
+	}
+
+	target := &k8sCoreV1.Probe{
+		Handler:             handler,
+		InitialDelaySeconds: probe.InitialDelaySeconds,
+		TimeoutSeconds:      probe.TimeoutSeconds,
+		PeriodSeconds:       probe.PeriodSeconds,
+		SuccessThreshold:    probe.SuccessThreshold,
+		FailureThreshold:    probe.FailureThreshold,
+	}
+
+	if target.TimeoutSeconds == 0 {
+		target.TimeoutSeconds = tarsMeta.DefaultProbeTimeoutSeconds
+	}
+	if target.PeriodSeconds == 0 {
+		target.PeriodSeconds = tarsMeta.DefaultProbePeriodSeconds
+	}
+	if target.SuccessThreshold == 0 {
+		target.SuccessThreshold = tarsMeta.DefaultProbeSuccessThreshold
+	}
+	if target.FailureThreshold == 0 {
+		target.FailureThreshold = tarsMeta.DefaultProbeFailureThreshold
+	}
+	return target
+}
+
+func buildContainer(container *tarsV1beta3.TK8SContainer) k8sCoreV1.Container {
+	var volumeMounts []k8sCoreV1.VolumeMount
+	for _, mount := range container.Mounts {
+		volumeMounts = append(volumeMounts, k8sCoreV1.VolumeMount{
+			Name:      mount.NameRef,
+			ReadOnly:  mount.ReadOnly,
+			MountPath: mount.MountPath,
+			SubPath:   mount.SubPath,
+		})
+	}
+
+	var ports []k8sCoreV1.ContainerPort
+	for _, port := range container.Ports {
+		if port.Protocol == "" {
+			port.Protocol = k8sCoreV1.ProtocolTCP
+		}
+		ports = append(ports, port)
+	}
+
+	imagePullPolicy := container.ImagePullPolicy
+	if imagePullPolicy == "" {
+		imagePullPolicy = tarsMeta.DefaultImagePullPolicy
+	}
+
+	return k8sCoreV1.Container{
+		Name:            container.Name,
+		Image:           container.Image,
+		Command:         container.Command,
+		Args:            container.Args,
+		Ports:           ports,
+		EnvFrom:         container.EnvFrom,
+		Env:             container.Env,
+		Resources:       container.Resources,
+		VolumeMounts:    volumeMounts,
+		ImagePullPolicy: imagePullPolicy,
+	}
+}
+
+func buildPodSidecars(tserver *tarsV1beta3.TServer) []k8sCoreV1.Container {
+	var containers []k8sCoreV1.Container
+	for i := range tserver.Spec.K8S.Sidecars {
+		containers = append(containers, buildContainer(&tserver.Spec.K8S.Sidecars[i]))
+	}
+	return containers
+}
+
+func buildPodExtraInitContainers(tserver *tarsV1beta3.TServer) []k8sCoreV1.Container {
+	var containers []k8sCoreV1.Container
+	for i := range tserver.Spec.K8S.InitContainers {
+		containers = append(containers, buildContainer(&tserver.Spec.K8S.InitContainers[i]))
+	}
+	return containers
+}
+
+// buildPodManagedContainers return the names of sidecars and extra init containers,
+// it is recorded in the pod template annotations, so we can distinguish them from containers added by others
+func buildPodManagedContainers(tserver *tarsV1beta3.TServer) string {
+	var names []string
+	for _, v := range tserver.Spec.K8S.Sidecars {
+		names = append(names, v.Name)
+	}
+	for _, v := range tserver.Spec.K8S.InitContainers {
+		names = append(names, v.Name)
+	}
+	return strings.Join(names, ",")
+}
+
 func buildPodReadinessGates(tserver *tarsV1beta3.TServer) []k8sCoreV1.PodReadinessGate {
 	var gates []k8sCoreV1.PodReadinessGate
 	for _, v := range tserver.Spec.K8S.ReadinessGates {
@@ -209,6 +345,40 @@ func buildPodAffinity(tserver *tarsV1beta3.TServer) *k8sCoreV1.Affinity {
 	return affinity
 }
 
+func buildPodTolerations(tserver *tarsV1beta3.TServer) []k8sCoreV1.Toleration {
+	return tserver.Spec.K8S.Tolerations
+}
+
+func buildPodTopologySpreadConstraints(tserver *tarsV1beta3.TServer) []k8sCoreV1.TopologySpreadConstraint {
+	if tserver.Spec.K8S.DaemonSet {
+		return nil
+	}
+
+	var constraints []k8sCoreV1.TopologySpreadConstraint
+	var hasZoneConstraint bool
+	for _, constraint := range tserver.Spec.K8S.TopologySpreadConstraints {
+		if constraint.TopologyKey == tarsMeta.K8SZoneLabel {
+			hasZoneConstraint = true
+		}
+		constraints = append(constraints, constraint)
+	}
+
+	if tserver.Spec.K8S.ZoneSpread && !hasZoneConstraint {
+		constraints = append(constraints, k8sCoreV1.TopologySpreadConstraint{
+			MaxSkew:           1,
+			TopologyKey:       tarsMeta.K8SZoneLabel,
+			WhenUnsatisfiable: k8sCoreV1.ScheduleAnyway,
+			LabelSelector: &k8sMetaV1.LabelSelector{
+				MatchLabels: map[string]string{
+					tarsMeta.TServerAppLabel:  tserver.Spec.App,
+					tarsMeta.TServerNameLabel: tserver.Spec.Server,
+				},
+			},
+		})
+	}
+	return constraints
+}
+
 func buildPodTemplate(tserver *tarsV1beta3.TServer) k8sCoreV1.PodTemplateSpec {
 	var enableServiceLinks = false
 	var fixedDNSConfigNDOTS = "2"
@@ -221,7 +391,7 @@ func buildPodTemplate(tserver *tarsV1beta3.TServer) k8sCoreV1.PodTemplateSpec {
 	serverImage := tarsMeta.ServiceImagePlaceholder
 
 	if tserver.Spec.Release != nil {
-		serverImage = tserver.Spec.Release.Image
+		serverImage = tarsTool.PinnedImage(tserver.Spec.Release.Image, tserver.Spec.Release.Digest)
 	}
 
 	spec := k8sCoreV1.PodTemplateSpec{
@@ -246,6 +416,9 @@ func buildPodTemplate(tserver *tarsV1beta3.TServer) k8sCoreV1.PodTemplateSpec {
 					Env:             tserver.Spec.K8S.Env,
 					Resources:       tserver.Spec.K8S.Resources,
 					VolumeMounts:    buildContainerVolumeMounts(tserver),
+					LivenessProbe:   buildContainerProbe(tserver, tserver.Spec.K8S.LivenessProbe),
+					ReadinessProbe:  buildContainerProbe(tserver, tserver.Spec.K8S.ReadinessProbe),
+					StartupProbe:    buildContainerProbe(tserver, tserver.Spec.K8S.StartupProbe),
 					ImagePullPolicy: tserver.Spec.K8S.ImagePullPolicy,
 				},
 			},
@@ -257,6 +430,8 @@ func buildPodTemplate(tserver *tarsV1beta3.TServer) k8sCoreV1.PodTemplateSpec {
 			HostIPC:             tserver.Spec.K8S.HostIPC,
 			ImagePullSecrets:    buildPodImagePullSecrets(tserver),
 			Affinity:            buildPodAffinity(tserver),
+			Tolerations:         buildPodTolerations(tserver),
+			PriorityClassName:   tserver.Spec.K8S.PriorityClassName,
 			DNSConfig: &k8sCoreV1.PodDNSConfig{
 				Options: []k8sCoreV1.PodDNSConfigOption{
 					{
@@ -265,13 +440,29 @@ func buildPodTemplate(tserver *tarsV1beta3.TServer) k8sCoreV1.PodTemplateSpec {
 					},
 				},
 			},
-			ReadinessGates:     buildPodReadinessGates(tserver),
-			EnableServiceLinks: &enableServiceLinks,
+			ReadinessGates:            buildPodReadinessGates(tserver),
+			TopologySpreadConstraints: buildPodTopologySpreadConstraints(tserver),
+			EnableServiceLinks:        &enableServiceLinks,
 		},
 	}
 
+	spec.Spec.Containers = append(spec.Spec.Containers, buildPodSidecars(tserver)...)
+
+	if managedContainers := buildPodManagedContainers(tserver); managedContainers != "" {
+		spec.Annotations = map[string]string{
+			tarsMeta.TManagedContainersAnnotation: managedContainers,
+		}
+	}
+
 	if tserver.Spec.Release != nil {
 		spec.Labels[tarsMeta.TServerIdLabel] = tserver.Spec.Release.ID
+		// the container may run the image by digest, keep the tagged one for display
+		if tserver.Spec.Release.Digest != "" {
+			if spec.Annotations == nil {
+				spec.Annotations = map[string]string{}
+			}
+			spec.Annotations[tarsMeta.TServerImageAnnotation] = tserver.Spec.Release.Image
+		}
 	}
 
 	return spec
@@ -319,7 +510,7 @@ func buildPodVolumes(tserver *tarsV1beta3.TServer) []k8sCoreV1.Volume {
 
 func buildPodInitContainers(tserver *tarsV1beta3.TServer) []k8sCoreV1.Container {
 	if tserver.Spec.SubType != tarsV1beta3.TARS {
-		return nil
+		return buildPodExtraInitContainers(tserver)
 	}
 
 	var image string
@@ -392,6 +583,7 @@ func buildPodInitContainers(tserver *tarsV1beta3.TServer) []k8sCoreV1.Container
 			})
 	}
 
+	containers = append(containers, buildPodExtraInitContainers(tserver)...)
 	return containers
 }
 
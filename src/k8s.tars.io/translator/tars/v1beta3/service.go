@@ -48,11 +48,40 @@ func buildServicePorts(tserver *tarsV1beta3.TServer) []k8sCoreV1.ServicePort {
 			})
 		}
 	}
+
+	if tserver.Spec.External != nil {
+		for _, v := range tserver.Spec.External.Upstreams {
+			if len(v.Addresses) == 0 {
+				continue
+			}
+			ports = append(ports, k8sCoreV1.ServicePort{
+				Name:       strings.ToLower(v.Name),
+				Protocol:   getProtocol(v.IsTcp),
+				Port:       v.Addresses[0].Port,
+				TargetPort: intstr.FromInt(int(v.Addresses[0].Port)),
+			})
+		}
+	}
 	return ports
 }
 
+// buildServiceSelector return nil for external server, whose endpoints are published by EndpointSlices
+func buildServiceSelector(tserver *tarsV1beta3.TServer) map[string]string {
+	if tserver.Spec.SubType == tarsV1beta3.External {
+		return nil
+	}
+	return map[string]string{
+		tarsMeta.TServerAppLabel:  tserver.Spec.App,
+		tarsMeta.TServerNameLabel: tserver.Spec.Server,
+	}
+}
+
 func buildService(tserver *tarsV1beta3.TServer) *k8sCoreV1.Service {
 	service := &k8sCoreV1.Service{
+		TypeMeta: k8sMetaV1.TypeMeta{
+			Kind:       "Service",
+			APIVersion: "v1",
+		},
 		ObjectMeta: k8sMetaV1.ObjectMeta{
 			Name:      tserver.Name,
 			Namespace: tserver.Namespace,
@@ -65,18 +94,11 @@ func buildService(tserver *tarsV1beta3.TServer) *k8sCoreV1.Service {
 			},
 		},
 		Spec: k8sCoreV1.ServiceSpec{
-			Ports: buildServicePorts(tserver),
-			Selector: map[string]string{
-				tarsMeta.TServerAppLabel:  tserver.Spec.App,
-				tarsMeta.TServerNameLabel: tserver.Spec.Server,
-			},
+			Ports:     buildServicePorts(tserver),
+			Selector:  buildServiceSelector(tserver),
 			ClusterIP: k8sCoreV1.ClusterIPNone,
 			Type:      k8sCoreV1.ServiceTypeClusterIP,
 		},
 	}
 	return service
 }
-
-func syncService(tserver *tarsV1beta3.TServer, service *k8sCoreV1.Service) {
-	service.Spec.Ports = buildServicePorts(tserver)
-}
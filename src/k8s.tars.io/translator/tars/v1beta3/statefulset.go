@@ -7,6 +7,7 @@ import (
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
+	tarsTool "k8s.tars.io/tool"
 )
 
 func buildTVolumeClaimTemplates(tserver *tarsV1beta3.TServer, name string) *k8sCoreV1.PersistentVolumeClaim {
@@ -71,14 +72,26 @@ func buildStatefulsetVolumeClaimTemplates(tserver *tarsV1beta3.TServer) []k8sCor
 	return volumeClaimTemplates
 }
 
-func buildStatefulsetUpdateStrategy(tserver *tarsV1beta3.TServer) k8sAppsV1.StatefulSetUpdateStrategy {
+func buildStatefulsetUpdateStrategy(tserver *tarsV1beta3.TServer, replicas int32) k8sAppsV1.StatefulSetUpdateStrategy {
+	if isCanaryRelease(tserver) {
+		partition := buildCanaryPartition(tserver, replicas)
+		return k8sAppsV1.StatefulSetUpdateStrategy{
+			Type: k8sAppsV1.RollingUpdateStatefulSetStrategyType,
+			RollingUpdate: &k8sAppsV1.RollingUpdateStatefulSetStrategy{
+				Partition: &partition,
+			},
+		}
+	}
 	return tserver.Spec.K8S.UpdateStrategy
 }
 
 func buildStatefulset(tserver *tarsV1beta3.TServer) *k8sAppsV1.StatefulSet {
 	historyLimit := tarsMeta.DefaultWorkloadHistoryLimit
 	statefulSet := &k8sAppsV1.StatefulSet{
-		TypeMeta: k8sMetaV1.TypeMeta{},
+		TypeMeta: k8sMetaV1.TypeMeta{
+			Kind:       "StatefulSet",
+			APIVersion: "apps/v1",
+		},
 		ObjectMeta: k8sMetaV1.ObjectMeta{
 			Name:      tserver.Name,
 			Namespace: tserver.Namespace,
@@ -102,31 +115,38 @@ func buildStatefulset(tserver *tarsV1beta3.TServer) *k8sAppsV1.StatefulSet {
 			VolumeClaimTemplates: buildStatefulsetVolumeClaimTemplates(tserver),
 			ServiceName:          tserver.Name,
 			PodManagementPolicy:  tserver.Spec.K8S.PodManagementPolicy,
-			UpdateStrategy:       buildStatefulsetUpdateStrategy(tserver),
+			UpdateStrategy:       buildStatefulsetUpdateStrategy(tserver, tserver.Spec.K8S.Replicas),
 			RevisionHistoryLimit: &historyLimit,
 		},
 	}
 	return statefulSet
 }
 
-func syncStatefulSet(tserver *tarsV1beta3.TServer, statefulSet *k8sAppsV1.StatefulSet) {
-
-	statefulSet.Spec.Replicas = &tserver.Spec.K8S.Replicas
-	statefulSet.Spec.UpdateStrategy = tserver.Spec.K8S.UpdateStrategy
-
-	var sst = buildPodTemplate(tserver)
+// statefulsetReplicasYielded return whether replicas has been taken over from controller by another field manager, eg. HorizontalPodAutoscaler
+func statefulsetReplicasYielded(statefulSet *k8sAppsV1.StatefulSet) bool {
+	return tarsTool.FieldManaged(statefulSet.ManagedFields, tarsMeta.ControllerFieldManager) &&
+		!tarsTool.FieldOwned(statefulSet.ManagedFields, tarsMeta.ControllerFieldManager, "spec", "replicas")
+}
 
-	for _, v := range statefulSet.Spec.Template.Spec.Containers {
-		if v.Name != tserver.Name {
-			sst.Spec.Containers = append(sst.Spec.Containers, *v.DeepCopy())
-		}
+// statefulsetReplicas return the replicas statefulset runs, which is left to the manager who has taken it over
+func statefulsetReplicas(tserver *tarsV1beta3.TServer, statefulSet *k8sAppsV1.StatefulSet) int32 {
+	if statefulSet.Spec.Replicas != nil && statefulsetReplicasYielded(statefulSet) {
+		return *statefulSet.Spec.Replicas
 	}
+	return tserver.Spec.K8S.Replicas
+}
 
-	for _, v := range statefulSet.Spec.Template.Spec.InitContainers {
-		if v.Name != "tarsnode" {
-			sst.Spec.Containers = append(sst.Spec.InitContainers, *v.DeepCopy())
-		}
+// buildStatefulsetApply build the statefulset to apply over current, the immutable fields are kept as current,
+// and replicas is left to the manager who has taken it over
+func buildStatefulsetApply(tserver *tarsV1beta3.TServer, current *k8sAppsV1.StatefulSet) *k8sAppsV1.StatefulSet {
+	statefulSet := buildStatefulset(tserver)
+	statefulSet.Spec.Selector = current.Spec.Selector
+	statefulSet.Spec.ServiceName = current.Spec.ServiceName
+	statefulSet.Spec.PodManagementPolicy = current.Spec.PodManagementPolicy
+	statefulSet.Spec.VolumeClaimTemplates = current.Spec.VolumeClaimTemplates
+	statefulSet.Spec.UpdateStrategy = buildStatefulsetUpdateStrategy(tserver, statefulsetReplicas(tserver, current))
+	if statefulsetReplicasYielded(current) {
+		statefulSet.Spec.Replicas = nil
 	}
-
-	statefulSet.Spec.Template = sst
+	return statefulSet
 }
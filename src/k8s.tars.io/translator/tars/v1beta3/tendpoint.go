@@ -6,8 +6,22 @@ import (
 	tarsMeta "k8s.tars.io/meta"
 )
 
+// buildTEndpointRelease strip the canary setting, which only used by the controller
+func buildTEndpointRelease(tserver *tarsV1beta3.TServer) *tarsV1beta3.TServerRelease {
+	if tserver.Spec.Release == nil || tserver.Spec.Release.Canary == nil {
+		return tserver.Spec.Release
+	}
+	release := *tserver.Spec.Release
+	release.Canary = nil
+	return &release
+}
+
 func buildTEndpoint(tserver *tarsV1beta3.TServer) *tarsV1beta3.TEndpoint {
 	tendpoint := &tarsV1beta3.TEndpoint{
+		TypeMeta: k8sMetaV1.TypeMeta{
+			Kind:       tarsMeta.TEndpointKind,
+			APIVersion: tarsMeta.TarsGroupVersionV1B3,
+		},
 		ObjectMeta: k8sMetaV1.ObjectMeta{
 			Name:      tserver.Name,
 			Namespace: tserver.Namespace,
@@ -26,24 +40,19 @@ func buildTEndpoint(tserver *tarsV1beta3.TServer) *tarsV1beta3.TEndpoint {
 			Important: tserver.Spec.Important,
 			Tars:      tserver.Spec.Tars,
 			Normal:    tserver.Spec.Normal,
+			External:  tserver.Spec.External,
 			HostPorts: tserver.Spec.K8S.HostPorts,
-			Release:   tserver.Spec.Release,
+			Release:   buildTEndpointRelease(tserver),
 		},
 	}
 	return tendpoint
 }
 
-func syncTEndpoint(tserver *tarsV1beta3.TServer, tendpoint *tarsV1beta3.TEndpoint) {
-	tendpoint.Labels = tserver.Labels
-	tendpoint.OwnerReferences = []k8sMetaV1.OwnerReference{
-		*k8sMetaV1.NewControllerRef(tserver, tarsV1beta3.SchemeGroupVersion.WithKind(tarsMeta.TServerKind)),
+// buildTEndpointApply build the tendpoint to apply over the existing one, which carries the labels of tserver
+func buildTEndpointApply(tserver *tarsV1beta3.TServer) *tarsV1beta3.TEndpoint {
+	tendpoint := buildTEndpoint(tserver)
+	for k, v := range tserver.Labels {
+		tendpoint.Labels[k] = v
 	}
-	tendpoint.Spec.App = tserver.Spec.App
-	tendpoint.Spec.Server = tserver.Spec.Server
-	tendpoint.Spec.SubType = tserver.Spec.SubType
-	tendpoint.Spec.Important = tserver.Spec.Important
-	tendpoint.Spec.Tars = tserver.Spec.Tars
-	tendpoint.Spec.Normal = tserver.Spec.Normal
-	tendpoint.Spec.HostPorts = tserver.Spec.K8S.HostPorts
-	tendpoint.Spec.Release = tserver.Spec.Release
+	return tendpoint
 }
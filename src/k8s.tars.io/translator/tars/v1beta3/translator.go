@@ -3,6 +3,8 @@ package v1beta3
 import (
 	k8sAppsV1 "k8s.io/api/apps/v1"
 	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sDiscoveryV1beta1 "k8s.io/api/discovery/v1beta1"
+	k8sPolicyV1beta1 "k8s.io/api/policy/v1beta1"
 	tarsV1beta3 "k8s.tars.io/apis/tars/v1beta3"
 	"k8s.tars.io/translator"
 )
@@ -41,39 +43,56 @@ func (*Translator) BuildTExitedRecord(tserver *tarsV1beta3.TServer) *tarsV1beta3
 	return buildTExitedRecord(tserver)
 }
 
-func (*Translator) DryRunSyncService(tserver *tarsV1beta3.TServer, service *k8sCoreV1.Service) (bool, *k8sCoreV1.Service) {
+func (*Translator) BuildPodDisruptionBudget(tserver *tarsV1beta3.TServer) *k8sPolicyV1beta1.PodDisruptionBudget {
+	return buildPodDisruptionBudget(tserver)
+}
+
+func (*Translator) BuildEndpointSlices(tserver *tarsV1beta3.TServer) []*k8sDiscoveryV1beta1.EndpointSlice {
+	return buildEndpointSlices(tserver)
+}
+
+func (*Translator) BuildCanaryStepReplicas(tserver *tarsV1beta3.TServer, statefulSet *k8sAppsV1.StatefulSet, step int32) int32 {
+	return buildCanaryStepReplicas(tserver, statefulsetReplicas(tserver, statefulSet), step)
+}
+
+func (*Translator) DryRunApplyService(tserver *tarsV1beta3.TServer, service *k8sCoreV1.Service) (bool, *k8sCoreV1.Service) {
 	if !equalTServerAndService(tserver, service) {
-		cp := service.DeepCopy()
-		syncService(tserver, cp)
-		return true, cp
+		return true, buildService(tserver)
 	}
 	return false, nil
 }
 
-func (*Translator) DryRunSyncStatefulset(tserver *tarsV1beta3.TServer, statefulset *k8sAppsV1.StatefulSet) (bool, *k8sAppsV1.StatefulSet) {
+func (*Translator) DryRunApplyStatefulset(tserver *tarsV1beta3.TServer, statefulset *k8sAppsV1.StatefulSet) (bool, *k8sAppsV1.StatefulSet) {
 	if !equalTServerAndStatefulset(tserver, statefulset) {
-		cp := statefulset.DeepCopy()
-		syncStatefulSet(tserver, cp)
-		return true, cp
+		return true, buildStatefulsetApply(tserver, statefulset)
 	}
-
 	return false, nil
 }
 
-func (*Translator) DryRunSyncDaemonset(tserver *tarsV1beta3.TServer, daemonset *k8sAppsV1.DaemonSet) (bool, *k8sAppsV1.DaemonSet) {
+func (*Translator) DryRunApplyDaemonset(tserver *tarsV1beta3.TServer, daemonset *k8sAppsV1.DaemonSet) (bool, *k8sAppsV1.DaemonSet) {
 	if !equalTServerAndDaemonSet(tserver, daemonset) {
-		cp := daemonset.DeepCopy()
-		syncDaemonSet(tserver, cp)
-		return true, cp
+		return true, buildDaemonsetApply(tserver, daemonset)
 	}
 	return false, nil
 }
 
-func (*Translator) DryRunSyncTEndpoint(tserver *tarsV1beta3.TServer, tendpoint *tarsV1beta3.TEndpoint) (bool, *tarsV1beta3.TEndpoint) {
+func (*Translator) DryRunApplyTEndpoint(tserver *tarsV1beta3.TServer, tendpoint *tarsV1beta3.TEndpoint) (bool, *tarsV1beta3.TEndpoint) {
 	if !equalTServerAndTEndpoint(tserver, tendpoint) {
-		cp := tendpoint.DeepCopy()
-		syncTEndpoint(tserver, cp)
-		return true, cp
+		return true, buildTEndpointApply(tserver)
+	}
+	return false, nil
+}
+
+func (*Translator) DryRunApplyPodDisruptionBudget(tserver *tarsV1beta3.TServer, pdb *k8sPolicyV1beta1.PodDisruptionBudget) (bool, *k8sPolicyV1beta1.PodDisruptionBudget) {
+	if !equalTServerAndPodDisruptionBudget(tserver, pdb) {
+		return true, buildPodDisruptionBudget(tserver)
+	}
+	return false, nil
+}
+
+func (*Translator) DryRunApplyEndpointSlice(target, slice *k8sDiscoveryV1beta1.EndpointSlice) (bool, *k8sDiscoveryV1beta1.EndpointSlice) {
+	if !equalEndpointSlice(target, slice) {
+		return true, target
 	}
 	return false, nil
 }
@@ -0,0 +1,80 @@
+package controller
+
+import (
+	"context"
+	"e2e/scaffold"
+	"fmt"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const controllerNamespace = "tars-system"
+
+var _ = ginkgo.Describe("check metrics and probes of tars controller", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	_ = scaffold.NewScaffold(opts)
+
+	// proxyGet get the path of running controller pods through apiserver proxy, and return the responses
+	proxyGet := func(path string) []string {
+		pods, err := tarsRuntime.Clients.K8sClient.CoreV1().Pods(controllerNamespace).List(context.TODO(), k8sMetaV1.ListOptions{LabelSelector: "tars.io/Controller=true"})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		var responses []string
+		for _, pod := range pods.Items {
+			if pod.Status.Phase != k8sCoreV1.PodRunning {
+				continue
+			}
+			bs, err := tarsRuntime.Clients.K8sClient.CoreV1().Pods(controllerNamespace).ProxyGet("http", pod.Name, strconv.Itoa(tarsMeta.ControllerMetricsPort), path, nil).DoRaw(context.TODO())
+			assert.Nil(ginkgo.GinkgoT(), err)
+			responses = append(responses, string(bs))
+		}
+		assert.NotEqual(ginkgo.GinkgoT(), 0, len(responses))
+		return responses
+	}
+
+	ginkgo.It("healthz and readyz", func() {
+		for _, path := range []string{"/healthz", "/readyz"} {
+			for _, response := range proxyGet(path) {
+				assert.Equal(ginkgo.GinkgoT(), "ok", response)
+			}
+		}
+	})
+
+	ginkgo.It("metrics", func() {
+		for _, response := range proxyGet("/metrics") {
+			assert.True(ginkgo.GinkgoT(), strings.Contains(response, "tars_controller_informer_synced"))
+			for _, name := range []string{"tserver", "statefulset", "service"} {
+				assert.True(ginkgo.GinkgoT(), strings.Contains(response, fmt.Sprintf(`tars_controller_workqueue_depth{name="%s"}`, name)), "missing workqueue metrics of %s", name)
+			}
+		}
+	})
+
+	ginkgo.It("controllers enabled by default config", func() {
+		controllers := []string{"node", "daemonset", "ttree", "service", "endpointslice", "poddisruptionbudget", "texitedrecord", "statefulset",
+			"tserver", "autoscaler", "tendpoint", "taccount", "tconfig-add", "timage", "persistentvolumeclaim"}
+		for _, response := range proxyGet("/metrics") {
+			for _, name := range controllers {
+				assert.True(ginkgo.GinkgoT(), strings.Contains(response, fmt.Sprintf(`tars_controller_workqueue_depth{name="%s"}`, name)), "controller %s not enabled", name)
+			}
+		}
+	})
+
+	ginkgo.It("tconfig queues", func() {
+		for _, response := range proxyGet("/metrics") {
+			for _, name := range []string{"tconfig-add", "tconfig-modify", "tconfig-delete"} {
+				assert.True(ginkgo.GinkgoT(), strings.Contains(response, fmt.Sprintf(`tars_controller_workqueue_depth{name="%s"}`, name)), "missing queue %s", name)
+			}
+		}
+	})
+})
@@ -1,6 +1,7 @@
 package e2e
 
 import (
+	_ "e2e/controller"
 	_ "e2e/taccount/v1beta2"
 	_ "e2e/taccount/v1beta3"
 	_ "e2e/tconfig/v1beta2"
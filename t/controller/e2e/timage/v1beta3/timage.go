@@ -5,10 +5,12 @@ import (
 	"e2e/scaffold"
 	"github.com/onsi/ginkgo"
 	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	patchTypes "k8s.io/apimachinery/pkg/types"
 	"k8s.io/apimachinery/pkg/util/json"
 	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
 	tarsRuntime "k8s.tars.io/runtime"
 	tarsTool "k8s.tars.io/tool"
 	"time"
@@ -104,4 +106,72 @@ var _ = ginkgo.Describe("test timage", func() {
 		assert.Equal(ginkgo.GinkgoT(), 1, len(timage.Releases))
 		assert.Equal(ginkgo.GinkgoT(), "testserver:v1", timage.Releases[0].Image)
 	})
+
+	ginkgo.It("owner labels from tserver", func() {
+		const Template = "tt.cpp"
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      "test-testserver",
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       "Test",
+				Server:    "TestServer",
+				SubType:   tarsV1Beta3.Normal,
+				Important: 5,
+				Normal: &tarsV1Beta3.TServerNormal{
+					Ports: []*tarsV1Beta3.TServerPort{},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					Replicas:        1,
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		tiLayout := &tarsV1Beta3.TImage{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      "test-testserver",
+				Namespace: s.Namespace,
+			},
+			ImageType:     "server",
+			SupportedType: []string{"cpp"},
+			Releases:      []*tarsV1Beta3.TImageRelease{},
+		}
+		timage, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(s.Namespace).Create(context.TODO(), tiLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), "Test", timage.Labels[tarsMeta.TServerAppLabel])
+		assert.Equal(ginkgo.GinkgoT(), "TestServer", timage.Labels[tarsMeta.TServerNameLabel])
+
+		// owner labels are kept when updated
+		patch := map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels": map[string]interface{}{tarsMeta.TServerAppLabel: "Other", tarsMeta.TServerNameLabel: nil},
+			},
+		}
+		bs, _ := json.Marshal(patch)
+		timage, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(s.Namespace).Patch(context.TODO(), "test-testserver", patchTypes.MergePatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), "Test", timage.Labels[tarsMeta.TServerAppLabel])
+		assert.Equal(ginkgo.GinkgoT(), "TestServer", timage.Labels[tarsMeta.TServerNameLabel])
+	})
 })
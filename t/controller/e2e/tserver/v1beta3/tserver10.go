@@ -0,0 +1,192 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"time"
+)
+
+var _ = ginkgo.Describe("try create/update tars server and check poddisruptionbudget", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var Resource = "test-testserver"
+	var App = "Test"
+	var Server = "TestServer"
+	var Template = "tt.cpp"
+	var FirstObj = "FirstObj"
+	var SecondObj = "SecondObj"
+
+	ginkgo.BeforeEach(func() {
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    Server,
+				SubType:   tarsV1Beta3.TARS,
+				Important: 5,
+				Tars: &tarsV1Beta3.TServerTars{
+					Template:    Template,
+					Profile:     "",
+					AsyncThread: 3,
+					Servants: []*tarsV1Beta3.TServerServant{
+						{
+							Name:       FirstObj,
+							Port:       10000,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+						{
+							Name:       SecondObj,
+							Port:       10001,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Delete(context.TODO(), Resource, k8sMetaV1.DeleteOptions{})
+	})
+
+	ginkgo.It("before update", func() {
+		_, err := tarsRuntime.Clients.K8sClient.PolicyV1beta1().PodDisruptionBudgets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.True(ginkgo.GinkgoT(), errors.IsNotFound(err))
+	})
+
+	ginkgo.It("default disruptionBudget", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchAdd,
+				Path:  "/spec/k8s/disruptionBudget",
+				Value: map[string]interface{}{},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		pdb, err := tarsRuntime.Clients.K8sClient.PolicyV1beta1().PodDisruptionBudgets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.NotNil(ginkgo.GinkgoT(), pdb)
+
+		expectedLabels := map[string]string{
+			tarsMeta.TServerAppLabel:  App,
+			tarsMeta.TServerNameLabel: Server,
+		}
+		assert.True(ginkgo.GinkgoT(), scaffold.CheckLeftInRight(expectedLabels, pdb.Labels))
+		assert.Equal(ginkgo.GinkgoT(), expectedLabels, pdb.Spec.Selector.MatchLabels)
+		assert.Nil(ginkgo.GinkgoT(), pdb.Spec.MinAvailable)
+
+		expectedMaxUnavailable := intstr.FromString("25%")
+		assert.Equal(ginkgo.GinkgoT(), &expectedMaxUnavailable, pdb.Spec.MaxUnavailable)
+	})
+
+	ginkgo.It("minAvailable", func() {
+		minAvailable := intstr.FromInt(1)
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:   tarsTool.JsonPatchAdd,
+				Path: "/spec/k8s/disruptionBudget",
+				Value: &tarsV1Beta3.TK8SDisruptionBudget{
+					MinAvailable: &minAvailable,
+				},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		pdb, err := tarsRuntime.Clients.K8sClient.PolicyV1beta1().PodDisruptionBudgets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.NotNil(ginkgo.GinkgoT(), pdb)
+		assert.Equal(ginkgo.GinkgoT(), &minAvailable, pdb.Spec.MinAvailable)
+		assert.Nil(ginkgo.GinkgoT(), pdb.Spec.MaxUnavailable)
+
+		jsonPatch = tarsTool.JsonPatch{
+			{
+				OP:   tarsTool.JsonPatchRemove,
+				Path: "/spec/k8s/disruptionBudget",
+			},
+		}
+		bs, _ = json.Marshal(jsonPatch)
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		_, err = tarsRuntime.Clients.K8sClient.PolicyV1beta1().PodDisruptionBudgets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.True(ginkgo.GinkgoT(), errors.IsNotFound(err))
+	})
+
+	ginkgo.It("both minAvailable and maxUnavailable", func() {
+		value := intstr.FromInt(1)
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:   tarsTool.JsonPatchAdd,
+				Path: "/spec/k8s/disruptionBudget",
+				Value: &tarsV1Beta3.TK8SDisruptionBudget{
+					MinAvailable:   &value,
+					MaxUnavailable: &value,
+				},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.NotNil(ginkgo.GinkgoT(), err)
+	})
+})
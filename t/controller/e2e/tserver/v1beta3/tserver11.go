@@ -0,0 +1,221 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/api/meta"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"time"
+)
+
+var _ = ginkgo.Describe("try create/update tars server and check autoscaler", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var Resource = "test-testserver"
+	var App = "Test"
+	var Server = "TestServer"
+	var Template = "tt.cpp"
+	var FirstObj = "FirstObj"
+	var SecondObj = "SecondObj"
+
+	ginkgo.BeforeEach(func() {
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    Server,
+				SubType:   tarsV1Beta3.TARS,
+				Important: 5,
+				Tars: &tarsV1Beta3.TServerTars{
+					Template:    Template,
+					Profile:     "",
+					AsyncThread: 3,
+					Servants: []*tarsV1Beta3.TServerServant{
+						{
+							Name:       FirstObj,
+							Port:       10000,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+						{
+							Name:       SecondObj,
+							Port:       10001,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Delete(context.TODO(), Resource, k8sMetaV1.DeleteOptions{})
+	})
+
+	ginkgo.It("autoscaler", func() {
+		autoscaler := &tarsV1Beta3.TK8SAutoscaler{
+			Metric:          tarsV1Beta3.CPUMetric,
+			Target:          60,
+			CooldownSeconds: 60,
+		}
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchAdd,
+				Path:  "/spec/k8s/autoscaler",
+				Value: autoscaler,
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), autoscaler, tserver.Spec.K8S.Autoscaler)
+	})
+
+	ginkgo.It("scale into replicas bounds", func() {
+		patch := map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]interface{}{
+					tarsMeta.TMinReplicasAnnotation: "3",
+				},
+			},
+			"spec": map[string]interface{}{
+				"release": &tarsV1Beta3.TServerRelease{
+					ID:    "v1",
+					Image: "www.docker.com:5050/test123:v1",
+					TServerReleaseNode: &tarsV1Beta3.TServerReleaseNode{
+						Image: "www.docker.com:5050/node:v1",
+					},
+				},
+				"k8s": map[string]interface{}{
+					"replicas": 1,
+					"autoscaler": &tarsV1Beta3.TK8SAutoscaler{
+						Metric: tarsV1Beta3.CPUMetric,
+						Target: 60,
+					},
+				},
+			},
+		}
+		bs, _ := json.Marshal(patch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.MergePatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		var tserver *tarsV1Beta3.TServer
+		var condition *k8sMetaV1.Condition
+		for i := 0; i < 10; i++ {
+			time.Sleep(s.Opts.SyncTime)
+			tserver, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			condition = k8sMeta.FindStatusCondition(tserver.Status.Conditions, tarsV1Beta3.TServerScaled)
+			if condition != nil {
+				break
+			}
+		}
+		assert.Equal(ginkgo.GinkgoT(), int32(3), tserver.Spec.K8S.Replicas)
+
+		assert.NotNil(ginkgo.GinkgoT(), condition)
+		assert.Equal(ginkgo.GinkgoT(), k8sMetaV1.ConditionTrue, condition.Status)
+		assert.Equal(ginkgo.GinkgoT(), "ScaleUp", condition.Reason)
+	})
+
+	ginkgo.It("invalid target", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:   tarsTool.JsonPatchAdd,
+				Path: "/spec/k8s/autoscaler",
+				Value: &tarsV1Beta3.TK8SAutoscaler{
+					Metric: tarsV1Beta3.CPUMetric,
+					Target: 0,
+				},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.NotNil(ginkgo.GinkgoT(), err)
+	})
+
+	ginkgo.It("property metric without property", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:   tarsTool.JsonPatchAdd,
+				Path: "/spec/k8s/autoscaler",
+				Value: &tarsV1Beta3.TK8SAutoscaler{
+					Metric: tarsV1Beta3.PropertyMetric,
+					Target: 100,
+				},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.NotNil(ginkgo.GinkgoT(), err)
+	})
+
+	ginkgo.It("autoscaler with daemonSet", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchAdd,
+				Path:  "/spec/k8s/daemonSet",
+				Value: true,
+			},
+			{
+				OP:   tarsTool.JsonPatchAdd,
+				Path: "/spec/k8s/autoscaler",
+				Value: &tarsV1Beta3.TK8SAutoscaler{
+					Metric: tarsV1Beta3.CPUMetric,
+					Target: 60,
+				},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.NotNil(ginkgo.GinkgoT(), err)
+	})
+})
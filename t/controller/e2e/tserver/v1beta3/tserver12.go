@@ -0,0 +1,204 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"time"
+)
+
+var _ = ginkgo.Describe("try create/update tars server and check canary release", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var Resource = "test-testserver"
+	var App = "Test"
+	var Server = "TestServer"
+	var Template = "tt.cpp"
+	var FirstObj = "FirstObj"
+	var SecondObj = "SecondObj"
+
+	ginkgo.BeforeEach(func() {
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    Server,
+				SubType:   tarsV1Beta3.TARS,
+				Important: 5,
+				Tars: &tarsV1Beta3.TServerTars{
+					Template:    Template,
+					Profile:     "",
+					AsyncThread: 3,
+					Servants: []*tarsV1Beta3.TServerServant{
+						{
+							Name:       FirstObj,
+							Port:       10000,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+						{
+							Name:       SecondObj,
+							Port:       10001,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					Replicas:        4,
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+					UpdateStrategy:  tarsMeta.DefaultStatefulsetUpdateStrategy,
+				},
+				Release: &tarsV1Beta3.TServerRelease{
+					ID:     "v1",
+					Image:  "www.docker.com:5050/test123:v1",
+					Secret: "",
+					TServerReleaseNode: &tarsV1Beta3.TServerReleaseNode{
+						Image:  "www.docker.com:5050/node:v1",
+						Secret: "tars-image-secret",
+					},
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	canaryRelease := func() *tarsV1Beta3.TServerRelease {
+		return &tarsV1Beta3.TServerRelease{
+			ID:     "v2",
+			Image:  "www.docker.com:5050/test123:v2",
+			Secret: "",
+			TServerReleaseNode: &tarsV1Beta3.TServerReleaseNode{
+				Image:  "www.docker.com:5050/node:v2",
+				Secret: "tars-image-secret",
+			},
+			Canary: &tarsV1Beta3.TServerCanary{
+				Steps: []tarsV1Beta3.TServerCanaryStep{
+					{Replicas: intstr.FromString("25%"), Pause: true},
+					{Replicas: intstr.FromString("100%")},
+				},
+				BakeSeconds: 60,
+			},
+		}
+	}
+
+	ginkgo.AfterEach(func() {
+		_ = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Delete(context.TODO(), Resource, k8sMetaV1.DeleteOptions{})
+	})
+
+	ginkgo.It("canary without stable release", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/release",
+				Value: canaryRelease(),
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), int32(0), *statefulset.Spec.UpdateStrategy.RollingUpdate.Partition)
+	})
+
+	ginkgo.It("canary with stable release", func() {
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		patch := map[string]interface{}{
+			"status": map[string]interface{}{
+				"stableRelease": tserver.Spec.Release,
+			},
+		}
+		bs, _ := json.Marshal(patch)
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.MergePatchType, bs, k8sMetaV1.PatchOptions{}, "status")
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/release",
+				Value: canaryRelease(),
+			},
+		}
+		bs, _ = json.Marshal(jsonPatch)
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime * 2)
+
+		tserver, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.NotNil(ginkgo.GinkgoT(), tserver.Status.Canary)
+		assert.Equal(ginkgo.GinkgoT(), "v2", tserver.Status.Canary.ReleaseID)
+		assert.Equal(ginkgo.GinkgoT(), int32(0), tserver.Status.Canary.Step)
+		assert.Equal(ginkgo.GinkgoT(), "v1", tserver.Status.StableRelease.ID)
+
+		statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), int32(3), *statefulset.Spec.UpdateStrategy.RollingUpdate.Partition)
+	})
+
+	ginkgo.It("canary with invalid step", func() {
+		release := canaryRelease()
+		release.Canary.Steps[0].Replicas = intstr.FromInt(0)
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/release",
+				Value: release,
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.NotNil(ginkgo.GinkgoT(), err)
+	})
+})
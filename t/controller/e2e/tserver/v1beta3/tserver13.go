@@ -0,0 +1,194 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"time"
+)
+
+var _ = ginkgo.Describe("try create/update tars server and check release history", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var Resource = "test-testserver"
+	var App = "Test"
+	var Server = "TestServer"
+	var Template = "tt.cpp"
+	var FirstObj = "FirstObj"
+	var SecondObj = "SecondObj"
+
+	ginkgo.BeforeEach(func() {
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    Server,
+				SubType:   tarsV1Beta3.TARS,
+				Important: 5,
+				Tars: &tarsV1Beta3.TServerTars{
+					Template:    Template,
+					Profile:     "",
+					AsyncThread: 3,
+					Servants: []*tarsV1Beta3.TServerServant{
+						{
+							Name:       FirstObj,
+							Port:       10000,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+						{
+							Name:       SecondObj,
+							Port:       10001,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					Replicas:        4,
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+					UpdateStrategy:  tarsMeta.DefaultStatefulsetUpdateStrategy,
+				},
+				Release: &tarsV1Beta3.TServerRelease{
+					ID:     "v1",
+					Image:  "www.docker.com:5050/test123:v1",
+					Secret: "",
+					TServerReleaseNode: &tarsV1Beta3.TServerReleaseNode{
+						Image:  "www.docker.com:5050/node:v1",
+						Secret: "tars-image-secret",
+					},
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	newRelease := func(id string) *tarsV1Beta3.TServerRelease {
+		return &tarsV1Beta3.TServerRelease{
+			ID:     id,
+			Image:  "www.docker.com:5050/test123:" + id,
+			Secret: "",
+			TServerReleaseNode: &tarsV1Beta3.TServerReleaseNode{
+				Image:  "www.docker.com:5050/node:" + id,
+				Secret: "tars-image-secret",
+			},
+		}
+	}
+
+	ginkgo.AfterEach(func() {
+		_ = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Delete(context.TODO(), Resource, k8sMetaV1.DeleteOptions{})
+	})
+
+	ginkgo.It("before update", func() {
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), 1, len(tserver.Spec.ReleaseHistory))
+		assert.Equal(ginkgo.GinkgoT(), "v1", tserver.Spec.ReleaseHistory[0].ID)
+		assert.NotEqual(ginkgo.GinkgoT(), "", tserver.Spec.ReleaseHistory[0].Person)
+	})
+
+	ginkgo.It("release and rollback", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/release",
+				Value: newRelease("v2"),
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), 2, len(tserver.Spec.ReleaseHistory))
+		assert.Equal(ginkgo.GinkgoT(), "v2", tserver.Spec.ReleaseHistory[0].ID)
+		assert.Equal(ginkgo.GinkgoT(), "v1", tserver.Spec.ReleaseHistory[1].ID)
+
+		jsonPatch = tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchAdd,
+				Path:  "/metadata/annotations",
+				Value: map[string]string{tarsMeta.TRollbackToAnnotation: "v1"},
+			},
+		}
+		bs, _ = json.Marshal(jsonPatch)
+		tserver, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		_, ok := tserver.Annotations[tarsMeta.TRollbackToAnnotation]
+		assert.False(ginkgo.GinkgoT(), ok)
+		assert.Equal(ginkgo.GinkgoT(), "v1", tserver.Spec.Release.ID)
+		assert.Equal(ginkgo.GinkgoT(), "www.docker.com:5050/test123:v1", tserver.Spec.Release.Image)
+		assert.Equal(ginkgo.GinkgoT(), 3, len(tserver.Spec.ReleaseHistory))
+		assert.Equal(ginkgo.GinkgoT(), "v1", tserver.Spec.ReleaseHistory[0].ID)
+		assert.Equal(ginkgo.GinkgoT(), "v2", tserver.Spec.ReleaseHistory[0].RollbackFrom)
+	})
+
+	ginkgo.It("rollback to unknown release", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchAdd,
+				Path:  "/metadata/annotations",
+				Value: map[string]string{tarsMeta.TRollbackToAnnotation: "v0"},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.NotNil(ginkgo.GinkgoT(), err)
+	})
+
+	ginkgo.It("history can not be modified", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:   tarsTool.JsonPatchRemove,
+				Path: "/spec/releaseHistory",
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), 1, len(tserver.Spec.ReleaseHistory))
+	})
+})
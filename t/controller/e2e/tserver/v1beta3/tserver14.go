@@ -0,0 +1,118 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMeta "k8s.io/apimachinery/pkg/api/meta"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	"time"
+)
+
+var _ = ginkgo.Describe("try create/update tars server and check status conditions", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var Resource = "test-testserver"
+	var App = "Test"
+	var Server = "TestServer"
+	var Template = "tt.cpp"
+	var FirstObj = "FirstObj"
+	var SecondObj = "SecondObj"
+
+	ginkgo.BeforeEach(func() {
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    Server,
+				SubType:   tarsV1Beta3.TARS,
+				Important: 5,
+				Tars: &tarsV1Beta3.TServerTars{
+					Template:    Template,
+					Profile:     "",
+					AsyncThread: 3,
+					Servants: []*tarsV1Beta3.TServerServant{
+						{
+							Name:       FirstObj,
+							Port:       10000,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+						{
+							Name:       SecondObj,
+							Port:       10001,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Delete(context.TODO(), Resource, k8sMetaV1.DeleteOptions{})
+	})
+
+	ginkgo.It("conditions", func() {
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), tserver.Generation, tserver.Status.ObservedGeneration)
+
+		for _, conditionType := range []string{tarsV1Beta3.TServerAvailable, tarsV1Beta3.TServerProgressing, tarsV1Beta3.TServerReleaseComplete,
+			tarsV1Beta3.TServerConfigActivated, tarsV1Beta3.TServerDegraded} {
+			condition := k8sMeta.FindStatusCondition(tserver.Status.Conditions, conditionType)
+			assert.NotNil(ginkgo.GinkgoT(), condition)
+			assert.Equal(ginkgo.GinkgoT(), tserver.Generation, condition.ObservedGeneration)
+		}
+
+		assert.True(ginkgo.GinkgoT(), k8sMeta.IsStatusConditionFalse(tserver.Status.Conditions, tarsV1Beta3.TServerReleaseComplete))
+		assert.True(ginkgo.GinkgoT(), k8sMeta.IsStatusConditionTrue(tserver.Status.Conditions, tarsV1Beta3.TServerAvailable))
+		assert.True(ginkgo.GinkgoT(), k8sMeta.IsStatusConditionTrue(tserver.Status.Conditions, tarsV1Beta3.TServerConfigActivated))
+		assert.True(ginkgo.GinkgoT(), k8sMeta.IsStatusConditionFalse(tserver.Status.Conditions, tarsV1Beta3.TServerDegraded))
+	})
+})
@@ -0,0 +1,118 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"fmt"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sDiscoveryV1beta1 "k8s.io/api/discovery/v1beta1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"time"
+)
+
+var _ = ginkgo.Describe("try create/update external server and check service and endpointslices", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var Resource = "test-externalserver"
+	var App = "Test"
+	var Server = "ExternalServer"
+	var FirstObj = "FirstObj"
+
+	ginkgo.BeforeEach(func() {
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    Server,
+				SubType:   tarsV1Beta3.External,
+				Important: 5,
+				External: &tarsV1Beta3.TServerExternal{
+					Upstreams: []tarsV1Beta3.TServerExternalUPStream{
+						{
+							Name:  FirstObj,
+							IsTcp: true,
+							Addresses: []tarsV1Beta3.TServerExternalAddress{
+								{IP: "10.0.0.1", Port: 10000},
+								{IP: "10.0.0.2", Port: 10000},
+							},
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+				},
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Delete(context.TODO(), Resource, k8sMetaV1.DeleteOptions{})
+	})
+
+	ginkgo.It("service and endpointslices", func() {
+		service, err := tarsRuntime.Clients.K8sClient.CoreV1().Services(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Nil(ginkgo.GinkgoT(), service.Spec.Selector)
+
+		_, err = tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.True(ginkgo.GinkgoT(), errors.IsNotFound(err))
+
+		sliceName := fmt.Sprintf("%s-firstobj-10000", Resource)
+		slice, err := tarsRuntime.Clients.K8sClient.DiscoveryV1beta1().EndpointSlices(s.Namespace).Get(context.TODO(), sliceName, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), Resource, slice.Labels[k8sDiscoveryV1beta1.LabelServiceName])
+		assert.Equal(ginkgo.GinkgoT(), 2, len(slice.Endpoints))
+
+		tendpoint, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TEndpoints(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), 2, len(tendpoint.Status.PodStatus))
+		for _, podStatus := range tendpoint.Status.PodStatus {
+			assert.Equal(ginkgo.GinkgoT(), "Active", podStatus.PresentState)
+		}
+	})
+
+	ginkgo.It("update addresses", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/external/upstreams/0/addresses",
+				Value: []tarsV1Beta3.TServerExternalAddress{{IP: "10.0.0.3", Port: 10001}},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		_, err = tarsRuntime.Clients.K8sClient.DiscoveryV1beta1().EndpointSlices(s.Namespace).Get(context.TODO(), fmt.Sprintf("%s-firstobj-10000", Resource), k8sMetaV1.GetOptions{})
+		assert.True(ginkgo.GinkgoT(), errors.IsNotFound(err))
+
+		slice, err := tarsRuntime.Clients.K8sClient.DiscoveryV1beta1().EndpointSlices(s.Namespace).Get(context.TODO(), fmt.Sprintf("%s-firstobj-10001", Resource), k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), 1, len(slice.Endpoints))
+		assert.Equal(ginkgo.GinkgoT(), []string{"10.0.0.3"}, slice.Endpoints[0].Addresses)
+	})
+})
@@ -0,0 +1,181 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"time"
+)
+
+var _ = ginkgo.Describe("try create/update tars server and check server side apply", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var Resource = "test-testserver"
+	var App = "Test"
+	var Server = "TestServer"
+	var Template = "tt.cpp"
+	var FirstObj = "FirstObj"
+
+	ginkgo.BeforeEach(func() {
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    Server,
+				SubType:   tarsV1Beta3.TARS,
+				Important: 5,
+				Tars: &tarsV1Beta3.TServerTars{
+					Template:    Template,
+					Profile:     "",
+					AsyncThread: 3,
+					Servants: []*tarsV1Beta3.TServerServant{
+						{
+							Name:       FirstObj,
+							Port:       10000,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					Replicas:        2,
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+					UpdateStrategy:  tarsMeta.DefaultStatefulsetUpdateStrategy,
+				},
+				Release: &tarsV1Beta3.TServerRelease{
+					ID:     "v1",
+					Image:  "www.docker.com:5050/test123:v1",
+					Secret: "",
+					TServerReleaseNode: &tarsV1Beta3.TServerReleaseNode{
+						Image:  "www.docker.com:5050/node:v1",
+						Secret: "tars-image-secret",
+					},
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Delete(context.TODO(), Resource, k8sMetaV1.DeleteOptions{})
+	})
+
+	ginkgo.It("applied by controller", func() {
+		statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.True(ginkgo.GinkgoT(), tarsTool.FieldOwned(statefulset.ManagedFields, tarsMeta.ControllerFieldManager, "spec", "replicas"))
+		assert.True(ginkgo.GinkgoT(), tarsTool.FieldOwned(statefulset.ManagedFields, tarsMeta.ControllerFieldManager, "spec", "template"))
+
+		service, err := tarsRuntime.Clients.K8sClient.CoreV1().Services(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.True(ginkgo.GinkgoT(), tarsTool.FieldOwned(service.ManagedFields, tarsMeta.ControllerFieldManager, "spec", "ports"))
+	})
+
+	ginkgo.It("keep fields of others", func() {
+		const Annotation = "e2e.tars.io/owner"
+		const Autoscaler = "e2e-autoscaler"
+
+		patch := map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": map[string]string{Annotation: "others"},
+			},
+		}
+		bs, _ := json.Marshal(patch)
+		_, err := tarsRuntime.Clients.K8sClient.CoreV1().Services(s.Namespace).Patch(context.TODO(), Resource, patchTypes.MergePatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		patch["spec"] = map[string]interface{}{"replicas": 3}
+		bs, _ = json.Marshal(patch)
+		_, err = tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Patch(context.TODO(), Resource, patchTypes.MergePatchType, bs, k8sMetaV1.PatchOptions{FieldManager: Autoscaler})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchAdd,
+				Path:  "/spec/k8s/env",
+				Value: []k8sCoreV1.EnvVar{{Name: "E2E", Value: "apply"}},
+			},
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/tars/servants/0/port",
+				Value: 10002,
+			},
+		}
+		bs, _ = json.Marshal(jsonPatch)
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), "others", statefulset.Annotations[Annotation])
+		assert.Equal(ginkgo.GinkgoT(), int32(3), *statefulset.Spec.Replicas)
+		assert.True(ginkgo.GinkgoT(), tarsTool.FieldOwned(statefulset.ManagedFields, Autoscaler, "spec", "replicas"))
+
+		var env []k8sCoreV1.EnvVar
+		for _, container := range statefulset.Spec.Template.Spec.Containers {
+			if container.Name == Resource {
+				env = container.Env
+			}
+		}
+		assert.Contains(ginkgo.GinkgoT(), env, k8sCoreV1.EnvVar{Name: "E2E", Value: "apply"})
+
+		service, err := tarsRuntime.Clients.K8sClient.CoreV1().Services(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), "others", service.Annotations[Annotation])
+		assert.Equal(ginkgo.GinkgoT(), int32(10002), service.Spec.Ports[0].Port)
+
+		// objects are created once, the applies of updates are not creations
+		selector := fields.Set{
+			"involvedObject.kind": tarsMeta.TServerKind,
+			"involvedObject.name": Resource,
+			"reason":              tarsMeta.ResourceCreatedReason,
+		}.AsSelector().String()
+		events, err := tarsRuntime.Clients.K8sClient.CoreV1().Events(s.Namespace).List(context.TODO(), k8sMetaV1.ListOptions{FieldSelector: selector})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		for _, event := range events.Items {
+			assert.Equal(ginkgo.GinkgoT(), int32(1), event.Count, event.Message)
+		}
+	})
+})
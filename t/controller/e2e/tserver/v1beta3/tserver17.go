@@ -0,0 +1,156 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"fmt"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sAppsV1 "k8s.io/api/apps/v1"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	"strings"
+	"time"
+)
+
+var _ = ginkgo.Describe("try create tars server and check events", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var App = "Test"
+	var Template = "tt.cpp"
+	var FirstObj = "FirstObj"
+
+	newTServer := func(name, server string) *tarsV1Beta3.TServer {
+		return &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      name,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    server,
+				SubType:   tarsV1Beta3.TARS,
+				Important: 5,
+				Tars: &tarsV1Beta3.TServerTars{
+					Template:    Template,
+					Profile:     "",
+					AsyncThread: 3,
+					Servants: []*tarsV1Beta3.TServerServant{
+						{
+							Name:       FirstObj,
+							Port:       10000,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					Replicas:        1,
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+				},
+			},
+		}
+	}
+
+	// waitForEvents wait at least count events of tserver with reason, and return the messages of the reason
+	waitForEvents := func(name, reason string, count int) []string {
+		selector := fields.Set{
+			"involvedObject.kind": tarsMeta.TServerKind,
+			"involvedObject.name": name,
+			"reason":              reason,
+		}.AsSelector().String()
+
+		var messages []string
+		for i := 0; i < 10 && len(messages) < count; i++ {
+			time.Sleep(s.Opts.SyncTime)
+			messages = nil
+			events, err := tarsRuntime.Clients.K8sClient.CoreV1().Events(s.Namespace).List(context.TODO(), k8sMetaV1.ListOptions{FieldSelector: selector})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			for _, event := range events.Items {
+				messages = append(messages, event.Message)
+			}
+		}
+		return messages
+	}
+
+	ginkgo.BeforeEach(func() {
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	ginkgo.It("created events", func() {
+		resource := "test-testserver"
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), newTServer(resource, "TestServer"), k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		messages := waitForEvents(resource, tarsMeta.ResourceCreatedReason, 3)
+		expected := map[string]bool{
+			fmt.Sprintf("created statefulset %s/%s", s.Namespace, resource): false,
+			fmt.Sprintf("created service %s/%s", s.Namespace, resource):     false,
+			fmt.Sprintf("created tendpoint %s/%s", s.Namespace, resource):   false,
+		}
+		for _, message := range messages {
+			if _, ok := expected[message]; ok {
+				expected[message] = true
+			}
+		}
+		for message, found := range expected {
+			assert.True(ginkgo.GinkgoT(), found, "event %q not found in %s", message, strings.Join(messages, ","))
+		}
+	})
+
+	ginkgo.It("out of control event", func() {
+		resource := "test-otherserver"
+		labels := map[string]string{"app": resource}
+		statefulset := &k8sAppsV1.StatefulSet{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      resource,
+				Namespace: s.Namespace,
+			},
+			Spec: k8sAppsV1.StatefulSetSpec{
+				Selector: &k8sMetaV1.LabelSelector{MatchLabels: labels},
+				Template: k8sCoreV1.PodTemplateSpec{
+					ObjectMeta: k8sMetaV1.ObjectMeta{Labels: labels},
+					Spec: k8sCoreV1.PodSpec{
+						Containers: []k8sCoreV1.Container{{Name: "main", Image: "www.docker.com:5050/other:v1"}},
+					},
+				},
+			},
+		}
+		_, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Create(context.TODO(), statefulset, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), newTServer(resource, "OtherServer"), k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		messages := waitForEvents(resource, tarsMeta.ResourceOutControlReason, 1)
+		assert.NotEqual(ginkgo.GinkgoT(), 0, len(messages))
+	})
+})
@@ -0,0 +1,210 @@
+package v1beta3
+
+import (
+	"context"
+	"e2e/scaffold"
+	"github.com/onsi/ginkgo"
+	"github.com/stretchr/testify/assert"
+	k8sCoreV1 "k8s.io/api/core/v1"
+	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/json"
+	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
+	tarsMeta "k8s.tars.io/meta"
+	tarsRuntime "k8s.tars.io/runtime"
+	tarsTool "k8s.tars.io/tool"
+	"strings"
+	"time"
+)
+
+var _ = ginkgo.Describe("try release tars server and check image digest", func() {
+	opts := &scaffold.Options{
+		Name:     "default",
+		SyncTime: 800 * time.Millisecond,
+	}
+
+	s := scaffold.NewScaffold(opts)
+
+	var Resource = "test-testserver"
+	var App = "Test"
+	var Server = "TestServer"
+	var Template = "tt.cpp"
+	var FirstObj = "FirstObj"
+
+	// only BuiltImage is released by timage, the webhook never asks registry.e2e.invalid for digests
+	var BuiltImage = "registry.e2e.invalid/test.testserver:v1"
+	var BuiltDigest = "sha256:" + strings.Repeat("1", 64)
+	var OtherImage = "registry.e2e.invalid/test.testserver:v2"
+	var PinnedDigest = "sha256:" + strings.Repeat("3", 64)
+
+	ginkgo.BeforeEach(func() {
+		ttLayout := &tarsV1Beta3.TTemplate{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Template,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TTemplateSpec{
+				Content: "tt.cpp content",
+				Parent:  Template,
+			},
+		}
+		_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TTemplates(s.Namespace).Create(context.TODO(), ttLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+
+		tiLayout := &tarsV1Beta3.TImage{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			ImageType:     "server",
+			SupportedType: []string{"cpp"},
+			Releases: []*tarsV1Beta3.TImageRelease{
+				{
+					ID:     "v1",
+					Image:  BuiltImage,
+					Digest: BuiltDigest,
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TImages(s.Namespace).Create(context.TODO(), tiLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+
+		tsLayout := &tarsV1Beta3.TServer{
+			ObjectMeta: k8sMetaV1.ObjectMeta{
+				Name:      Resource,
+				Namespace: s.Namespace,
+			},
+			Spec: tarsV1Beta3.TServerSpec{
+				App:       App,
+				Server:    Server,
+				SubType:   tarsV1Beta3.TARS,
+				Important: 5,
+				Tars: &tarsV1Beta3.TServerTars{
+					Template:    Template,
+					Profile:     "",
+					AsyncThread: 3,
+					Servants: []*tarsV1Beta3.TServerServant{
+						{
+							Name:       FirstObj,
+							Port:       10000,
+							Thread:     3,
+							Connection: 1000,
+							Capacity:   1000,
+							Timeout:    1000,
+							IsTars:     true,
+							IsTcp:      true,
+						},
+					},
+				},
+				K8S: tarsV1Beta3.TServerK8S{
+					Replicas:        1,
+					AbilityAffinity: tarsV1Beta3.None,
+					NodeSelector:    []k8sCoreV1.NodeSelectorRequirement{},
+					ImagePullPolicy: k8sCoreV1.PullAlways,
+					LauncherType:    tarsMeta.Background,
+				},
+				Release: &tarsV1Beta3.TServerRelease{
+					ID:    "v1",
+					Image: BuiltImage,
+				},
+			},
+		}
+		_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Create(context.TODO(), tsLayout, k8sMetaV1.CreateOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+	})
+
+	ginkgo.AfterEach(func() {
+		_ = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Delete(context.TODO(), Resource, k8sMetaV1.DeleteOptions{})
+	})
+
+	release := func(id, image string) *tarsV1Beta3.TServer {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/release",
+				Value: &tarsV1Beta3.TServerRelease{ID: id, Image: image},
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		time.Sleep(s.Opts.SyncTime)
+		return tserver
+	}
+
+	serverImage := func() (string, string) {
+		statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		for _, container := range statefulset.Spec.Template.Spec.Containers {
+			if container.Name == Resource {
+				return container.Image, statefulset.Spec.Template.Annotations[tarsMeta.TServerImageAnnotation]
+			}
+		}
+		return "", ""
+	}
+
+	ginkgo.It("pinned to digest of timage release", func() {
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), BuiltDigest, tserver.Spec.Release.Digest)
+		assert.Equal(ginkgo.GinkgoT(), BuiltDigest, tserver.Spec.ReleaseHistory[0].Digest)
+
+		image, tagged := serverImage()
+		assert.Equal(ginkgo.GinkgoT(), BuiltImage+"@"+BuiltDigest, image)
+		assert.Equal(ginkgo.GinkgoT(), BuiltImage, tagged)
+	})
+
+	ginkgo.It("left unpinned if no timage release has digest", func() {
+		tserver := release("v2", OtherImage)
+		assert.Equal(ginkgo.GinkgoT(), OtherImage, tserver.Spec.Release.Image)
+		assert.Equal(ginkgo.GinkgoT(), "", tserver.Spec.Release.Digest)
+
+		image, tagged := serverImage()
+		assert.Equal(ginkgo.GinkgoT(), OtherImage, image)
+		assert.Equal(ginkgo.GinkgoT(), "", tagged)
+
+		// updates of other fields do not pin the release afterwards
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/important",
+				Value: 6,
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), "", tserver.Spec.Release.Digest)
+	})
+
+	ginkgo.It("pinned to digest of image reference", func() {
+		tserver := release("v3", OtherImage+"@"+PinnedDigest)
+		assert.Equal(ginkgo.GinkgoT(), PinnedDigest, tserver.Spec.Release.Digest)
+
+		image, _ := serverImage()
+		assert.Equal(ginkgo.GinkgoT(), OtherImage+"@"+PinnedDigest, image)
+	})
+
+	ginkgo.It("digest of previous release is not kept", func() {
+		jsonPatch := tarsTool.JsonPatch{
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/release/id",
+				Value: "v2",
+			},
+			{
+				OP:    tarsTool.JsonPatchReplace,
+				Path:  "/spec/release/image",
+				Value: OtherImage,
+			},
+		}
+		bs, _ := json.Marshal(jsonPatch)
+		tserver, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+		assert.Nil(ginkgo.GinkgoT(), err)
+		assert.Equal(ginkgo.GinkgoT(), "", tserver.Spec.Release.Digest)
+		assert.Equal(ginkgo.GinkgoT(), 2, len(tserver.Spec.ReleaseHistory))
+		assert.Equal(ginkgo.GinkgoT(), BuiltDigest, tserver.Spec.ReleaseHistory[1].Digest)
+	})
+})
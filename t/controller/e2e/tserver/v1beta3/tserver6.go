@@ -12,6 +12,7 @@ import (
 	"k8s.io/apimachinery/pkg/api/resource"
 	k8sMetaV1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	patchTypes "k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 	"k8s.io/apimachinery/pkg/util/json"
 	tarsV1Beta3 "k8s.tars.io/apis/tars/v1beta3"
 	tarsMeta "k8s.tars.io/meta"
@@ -1362,6 +1363,288 @@ var _ = ginkgo.Describe("try create/update tars server and check statefulset", f
 		})
 	})
 
+	ginkgo.Context("sidecars & initContainers", func() {
+		ginkgo.It("sidecars", func() {
+			jsonPatch := tarsTool.JsonPatch{
+				{
+					OP:   tarsTool.JsonPatchAdd,
+					Path: "/spec/k8s/mounts",
+					Value: []tarsV1Beta3.TK8SMount{
+						{
+							Name:      "logs",
+							MountPath: "/usr/local/app/tars/app_log",
+							Source: tarsV1Beta3.TK8SMountSource{
+								EmptyDir: &k8sCoreV1.EmptyDirVolumeSource{},
+							},
+						},
+					},
+				},
+				{
+					OP:   tarsTool.JsonPatchAdd,
+					Path: "/spec/k8s/sidecars",
+					Value: []tarsV1Beta3.TK8SContainer{
+						{
+							Name:  "shipper",
+							Image: "busybox",
+							Mounts: []tarsV1Beta3.TK8SContainerMount{
+								{
+									NameRef:   "logs",
+									MountPath: "/logs",
+									ReadOnly:  true,
+								},
+							},
+						},
+					},
+				},
+				{
+					OP:   tarsTool.JsonPatchAdd,
+					Path: "/spec/k8s/initContainers",
+					Value: []tarsV1Beta3.TK8SContainer{
+						{
+							Name:  "fetcher",
+							Image: "busybox",
+						},
+					},
+				},
+			}
+			bs, _ := json.Marshal(jsonPatch)
+			_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			time.Sleep(s.Opts.SyncTime)
+
+			statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			assert.NotNil(ginkgo.GinkgoT(), statefulset)
+
+			spec := &statefulset.Spec.Template.Spec
+			assert.Equal(ginkgo.GinkgoT(), 2, len(spec.Containers))
+			assert.Equal(ginkgo.GinkgoT(), "shipper", spec.Containers[1].Name)
+			assert.Equal(ginkgo.GinkgoT(), "logs", spec.Containers[1].VolumeMounts[0].Name)
+			assert.Equal(ginkgo.GinkgoT(), 2, len(spec.InitContainers))
+			assert.Equal(ginkgo.GinkgoT(), "tarsnode", spec.InitContainers[0].Name)
+			assert.Equal(ginkgo.GinkgoT(), "fetcher", spec.InitContainers[1].Name)
+
+			jsonPatch = tarsTool.JsonPatch{
+				{
+					OP:   tarsTool.JsonPatchRemove,
+					Path: "/spec/k8s/sidecars",
+				},
+			}
+			bs, _ = json.Marshal(jsonPatch)
+			_, err = tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			time.Sleep(s.Opts.SyncTime)
+
+			statefulset, err = tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			assert.Equal(ginkgo.GinkgoT(), 1, len(statefulset.Spec.Template.Spec.Containers))
+		})
+
+		ginkgo.It("container name conflict", func() {
+			jsonPatch := tarsTool.JsonPatch{
+				{
+					OP:   tarsTool.JsonPatchAdd,
+					Path: "/spec/k8s/initContainers",
+					Value: []tarsV1Beta3.TK8SContainer{
+						{
+							Name:  "tarsnode",
+							Image: "busybox",
+						},
+					},
+				},
+			}
+			bs, _ := json.Marshal(jsonPatch)
+			_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.NotNil(ginkgo.GinkgoT(), err)
+		})
+	})
+
+	ginkgo.Context("scheduling", func() {
+		ginkgo.It("tolerations", func() {
+			tolerations := []k8sCoreV1.Toleration{
+				{
+					Key:      scaffold.RandStringRunes(10),
+					Operator: k8sCoreV1.TolerationOpExists,
+					Effect:   k8sCoreV1.TaintEffectNoSchedule,
+				},
+			}
+			jsonPatch := tarsTool.JsonPatch{
+				{
+					OP:    tarsTool.JsonPatchAdd,
+					Path:  "/spec/k8s/tolerations",
+					Value: tolerations,
+				},
+			}
+			bs, _ := json.Marshal(jsonPatch)
+			_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			time.Sleep(s.Opts.SyncTime)
+
+			statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			assert.NotNil(ginkgo.GinkgoT(), statefulset)
+
+			spec := &statefulset.Spec.Template.Spec
+			assert.Equal(ginkgo.GinkgoT(), tolerations, spec.Tolerations)
+		})
+
+		ginkgo.It("zoneSpread", func() {
+			jsonPatch := tarsTool.JsonPatch{
+				{
+					OP:    tarsTool.JsonPatchAdd,
+					Path:  "/spec/k8s/zoneSpread",
+					Value: true,
+				},
+			}
+			bs, _ := json.Marshal(jsonPatch)
+			_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			time.Sleep(s.Opts.SyncTime)
+
+			statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			assert.NotNil(ginkgo.GinkgoT(), statefulset)
+
+			expectedConstraints := []k8sCoreV1.TopologySpreadConstraint{
+				{
+					MaxSkew:           1,
+					TopologyKey:       tarsMeta.K8SZoneLabel,
+					WhenUnsatisfiable: k8sCoreV1.ScheduleAnyway,
+					LabelSelector: &k8sMetaV1.LabelSelector{
+						MatchLabels: map[string]string{
+							tarsMeta.TServerAppLabel:  App,
+							tarsMeta.TServerNameLabel: Server,
+						},
+					},
+				},
+			}
+			spec := &statefulset.Spec.Template.Spec
+			assert.Equal(ginkgo.GinkgoT(), expectedConstraints, spec.TopologySpreadConstraints)
+		})
+
+		ginkgo.It("invalid toleration", func() {
+			jsonPatch := tarsTool.JsonPatch{
+				{
+					OP:   tarsTool.JsonPatchAdd,
+					Path: "/spec/k8s/tolerations",
+					Value: []k8sCoreV1.Toleration{
+						{
+							Operator: k8sCoreV1.TolerationOpEqual,
+							Value:    scaffold.RandStringRunes(5),
+						},
+					},
+				},
+			}
+			bs, _ := json.Marshal(jsonPatch)
+			_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.NotNil(ginkgo.GinkgoT(), err)
+		})
+	})
+
+	ginkgo.Context("probes", func() {
+		ginkgo.It("servant probe", func() {
+			jsonPatch := tarsTool.JsonPatch{
+				{
+					OP:   tarsTool.JsonPatchAdd,
+					Path: "/spec/k8s/readinessProbe",
+					Value: &tarsV1Beta3.TK8SProbe{
+						TK8SProbeHandler: tarsV1Beta3.TK8SProbeHandler{
+							Servant: FirstObj,
+						},
+						InitialDelaySeconds: 5,
+					},
+				},
+			}
+			bs, _ := json.Marshal(jsonPatch)
+			_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			time.Sleep(s.Opts.SyncTime)
+
+			statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			assert.NotNil(ginkgo.GinkgoT(), statefulset)
+
+			spec := &statefulset.Spec.Template.Spec
+			assert.NotNil(ginkgo.GinkgoT(), spec.Containers[0].ReadinessProbe)
+			assert.Nil(ginkgo.GinkgoT(), spec.Containers[0].LivenessProbe)
+
+			expectedProbe := &k8sCoreV1.Probe{
+				Handler: k8sCoreV1.Handler{
+					TCPSocket: &k8sCoreV1.TCPSocketAction{
+						Port: intstr.FromInt(10000),
+					},
+				},
+				InitialDelaySeconds: 5,
+				TimeoutSeconds:      1,
+				PeriodSeconds:       10,
+				SuccessThreshold:    1,
+				FailureThreshold:    3,
+			}
+			assert.Equal(ginkgo.GinkgoT(), expectedProbe, spec.Containers[0].ReadinessProbe)
+		})
+
+		ginkgo.It("httpGet probe", func() {
+			jsonPatch := tarsTool.JsonPatch{
+				{
+					OP:   tarsTool.JsonPatchAdd,
+					Path: "/spec/k8s/livenessProbe",
+					Value: &tarsV1Beta3.TK8SProbe{
+						TK8SProbeHandler: tarsV1Beta3.TK8SProbeHandler{
+							HTTPGet: &k8sCoreV1.HTTPGetAction{
+								Path: "/health",
+								Port: intstr.FromInt(8080),
+							},
+						},
+						PeriodSeconds: 5,
+					},
+				},
+			}
+			bs, _ := json.Marshal(jsonPatch)
+			_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			time.Sleep(s.Opts.SyncTime)
+
+			statefulset, err := tarsRuntime.Clients.K8sClient.AppsV1().StatefulSets(s.Namespace).Get(context.TODO(), Resource, k8sMetaV1.GetOptions{})
+			assert.Nil(ginkgo.GinkgoT(), err)
+			assert.NotNil(ginkgo.GinkgoT(), statefulset)
+
+			spec := &statefulset.Spec.Template.Spec
+			assert.NotNil(ginkgo.GinkgoT(), spec.Containers[0].LivenessProbe)
+
+			expectedProbe := &k8sCoreV1.Probe{
+				Handler: k8sCoreV1.Handler{
+					HTTPGet: &k8sCoreV1.HTTPGetAction{
+						Path:   "/health",
+						Port:   intstr.FromInt(8080),
+						Scheme: k8sCoreV1.URISchemeHTTP,
+					},
+				},
+				TimeoutSeconds:   1,
+				PeriodSeconds:    5,
+				SuccessThreshold: 1,
+				FailureThreshold: 3,
+			}
+			assert.Equal(ginkgo.GinkgoT(), expectedProbe, spec.Containers[0].LivenessProbe)
+		})
+
+		ginkgo.It("unknown servant probe", func() {
+			jsonPatch := tarsTool.JsonPatch{
+				{
+					OP:   tarsTool.JsonPatchAdd,
+					Path: "/spec/k8s/startupProbe",
+					Value: &tarsV1Beta3.TK8SProbe{
+						TK8SProbeHandler: tarsV1Beta3.TK8SProbeHandler{
+							Servant: scaffold.RandStringRunes(10),
+						},
+					},
+				},
+			}
+			bs, _ := json.Marshal(jsonPatch)
+			_, err := tarsRuntime.Clients.CrdClient.TarsV1beta3().TServers(s.Namespace).Patch(context.TODO(), Resource, patchTypes.JSONPatchType, bs, k8sMetaV1.PatchOptions{})
+			assert.NotNil(ginkgo.GinkgoT(), err)
+		})
+	})
+
 	ginkgo.Context("release & replicas", func() {
 
 		ginkgo.It("before release", func() {